@@ -38,9 +38,15 @@ type DexClientSpec struct {
 	// Redirect URIs
 	RedirectURIs []string `json:"redirectURIs,omitempty"`
 	// +optional
-	// Trusted Peers
+	// Client IDs of other OAuth2 clients of the same dex server allowed to issue tokens for this client. Each should
+	// be the client ID of a DexClient in the same namespace, client IDs without one are reported on the
+	// TrustedPeersResolved condition.
 	TrustedPeers []string `json:"trustedPeers,omitempty"`
 	// +optional
+	// Other DexClients in the same namespace to trust as peers. The client IDs of the referenced DexClients are
+	// resolved on every reconcile and added to TrustedPeers, so the relationship follows client ID changes.
+	TrustedPeerRefs []corev1.LocalObjectReference `json:"trustedPeerRefs,omitempty"`
+	// +optional
 	// LogoURL
 	LogoURL string `json:"logoURL,omitempty"`
 }
@@ -48,6 +54,9 @@ type DexClientSpec struct {
 const (
 	DexClientConditionTypeApplied             string = "Applied"
 	DexClientConditionTypeOAuth2ClientCreated string = "OAuth2ClientCreated"
+	// TrustedPeersResolved is false when a TrustedPeerRefs entry references a DexClient that does not exist, or a
+	// TrustedPeers client ID is not the client ID of a DexClient
+	DexClientConditionTypeTrustedPeersResolved string = "TrustedPeersResolved"
 )
 
 // DexClientStatus defines the observed state of DexClient
@@ -0,0 +1,69 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DexConnectorSpec defines the desired state of DexConnector
+type DexConnectorSpec struct {
+	// +kubebuilder:validation:Required
+	// The DexServer in the same namespace whose dex config includes this connector
+	DexServerRef corev1.LocalObjectReference `json:"dexServerRef"`
+	// The connector config, in the same format as the DexServer connectors. The connector Id must be unique
+	// across the DexServer connectors and all DexConnectors referencing the DexServer.
+	ConnectorSpec `json:",inline"`
+}
+
+const (
+	// Accepted is false when the referenced DexServer does not exist or the connector Id is not unique
+	DexConnectorConditionTypeAccepted string = "Accepted"
+)
+
+// DexConnectorStatus defines the observed state of DexConnector
+type DexConnectorStatus struct {
+	// Conditions contains the different condition statuses for this DexConnector.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// DexConnector is the Schema for the dexconnectors API
+type DexConnector struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DexConnectorSpec   `json:"spec,omitempty"`
+	Status DexConnectorStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// DexConnectorList contains a list of DexConnector
+type DexConnectorList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DexConnector `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DexConnector{}, &DexConnectorList{})
+}
@@ -18,6 +18,8 @@ package v1alpha1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -38,21 +40,32 @@ type Org struct {
 type GitHubConfigSpec struct {
 	ClientID        string                 `json:"clientID,omitempty"`
 	ClientSecretRef corev1.SecretReference `json:"clientSecretRef,omitempty"`
-	RedirectURI     string                 `json:"redirectURI,omitempty"`
-	Org             string                 `json:"org,omitempty"`
-	Orgs            []Org                  `json:"orgs,omitempty"`
-	HostName        string                 `json:"hostName,omitempty"`
-	RootCA          string                 `json:"rootCA,omitempty"`
-	TeamNameField   string                 `json:"teamNameField,omitempty"`
-	LoadAllGroups   bool                   `json:"loadAllGroups,omitempty"`
-	UseLoginAsID    bool                   `json:"useLoginAsID,omitempty"`
+	// Key of the client secret in the secret referenced by clientSecretRef. Defaults to clientSecret.
+	// +optional
+	ClientSecretKey string `json:"clientSecretKey,omitempty"`
+	RedirectURI     string `json:"redirectURI,omitempty"`
+	Org             string `json:"org,omitempty"`
+	Orgs            []Org  `json:"orgs,omitempty"`
+	HostName        string `json:"hostName,omitempty"`
+	// Path of the CA certificate of the GitHub Enterprise hostName in the dex container
+	RootCA string `json:"rootCA,omitempty"`
+	// Secret in the DexServer namespace holding the CA certificate of the GitHub Enterprise hostName in its ca.crt
+	// key, for a private CA. It is mounted into the dex container and takes precedence over rootCA.
+	// +optional
+	RootCARef     *corev1.LocalObjectReference `json:"rootCARef,omitempty"`
+	TeamNameField string                       `json:"teamNameField,omitempty"`
+	LoadAllGroups bool                         `json:"loadAllGroups,omitempty"`
+	UseLoginAsID  bool                         `json:"useLoginAsID,omitempty"`
 }
 
 // MicrosoftConfigSpec describes the configuration specific to the Microsoft connector
 type MicrosoftConfigSpec struct {
 	ClientID        string                 `json:"clientID,omitempty"`
 	ClientSecretRef corev1.SecretReference `json:"clientSecretRef,omitempty"`
-	RedirectURI     string                 `json:"redirectURI,omitempty"`
+	// Key of the client secret in the secret referenced by clientSecretRef. Defaults to clientSecret.
+	// +optional
+	ClientSecretKey string `json:"clientSecretKey,omitempty"`
+	RedirectURI     string `json:"redirectURI,omitempty"`
 	// groups claim in dex is only supported when tenant is specified in Microsoft connector config.
 	Tenant string `json:"tenant,omitempty"`
 	// When the groups claim is present in a request to dex and tenant is configured,
@@ -63,6 +76,31 @@ type MicrosoftConfigSpec struct {
 	Groups             []string `json:"groups,omitempty"`
 }
 
+// GoogleConfigSpec describes the configuration specific to the Google connector
+type GoogleConfigSpec struct {
+	ClientID        string                 `json:"clientID,omitempty"`
+	ClientSecretRef corev1.SecretReference `json:"clientSecretRef,omitempty"`
+	// Key of the client secret in the secret referenced by clientSecretRef. Defaults to clientSecret.
+	// +optional
+	ClientSecretKey string `json:"clientSecretKey,omitempty"`
+	RedirectURI     string `json:"redirectURI,omitempty"`
+	// Restricts the login to the users of these Google Workspace domains, for example example.com. All Google
+	// accounts can log in when empty.
+	// +optional
+	HostedDomains []string `json:"hostedDomains,omitempty"`
+	// Restricts the login to the members of these Google groups. The groups are fetched with the service account
+	// and admin email.
+	// +optional
+	Groups []string `json:"groups,omitempty"`
+	// Key of the JSON key of the Google service account in a secret of the DexServer namespace, mounted into the
+	// dex container. Required to fetch the groups of the users.
+	// +optional
+	ServiceAccountFilePathRef *corev1.SecretKeySelector `json:"serviceAccountFilePathRef,omitempty"`
+	// Email of a Google Workspace admin impersonated by the service account to fetch the groups
+	// +optional
+	AdminEmail string `json:"adminEmail,omitempty"`
+}
+
 // LDAP UserMatcher holds information about user and group matching
 type UserMatcher struct {
 	UserAttr  string `json:"userAttr"`
@@ -135,6 +173,14 @@ type LDAPConfigSpec struct {
 	RootCARef corev1.SecretReference `json:"rootCARef,omitempty"`
 	// A raw certificate file can also be provided inline as a base64 encoded PEM file.
 	RootCAData []byte `json:"rootCAData,omitempty"`
+	// Key of a secret in the DexServer namespace holding the client certificate, for LDAP servers requiring client
+	// authentication. Takes precedence over the tls.crt file of the rootCARef secret.
+	// +optional
+	ClientCertRef *corev1.SecretKeySelector `json:"clientCertRef,omitempty"`
+	// Key of a secret in the DexServer namespace holding the private key of the client certificate. Takes
+	// precedence over the tls.key file of the rootCARef secret.
+	// +optional
+	ClientKeyRef *corev1.SecretKeySelector `json:"clientKeyRef,omitempty"`
 	// The DN for an application service account. The connector uses the bindDN and bindPW as credentials to
 	// search for users and groups. Not required if the LDAP server provides access for anonymous auth.
 	BindDN string `json:"bindDN,omitempty"`
@@ -142,6 +188,9 @@ type LDAPConfigSpec struct {
 	// as credentials to search for users and groups. Not required if the LDAP server provides access
 	// for anonymous auth.
 	BindPWRef corev1.SecretReference `json:"bindPWRef,omitempty"`
+	// Key of the password in the secret referenced by bindPWRef. Defaults to bindPW.
+	// +optional
+	BindPWKey string `json:"bindPWKey,omitempty"`
 	// The attribute to display in the provided password prompt. If unset, will display "Username"
 	UsernamePrompt string `json:"usernamePrompt,omitempty"`
 	// User entry search configuration.
@@ -153,13 +202,22 @@ type LDAPConfigSpec struct {
 // ConnectorSpec defines the OIDC connector config details
 type ConnectorSpec struct {
 	Name string `json:"name,omitempty"`
-	// +kubebuilder:validation:Enum=github;ldap;microsoft
+	// Type of the dex connector. The github, ldap, microsoft and google connectors are configured by their config
+	// block, the other dex connector types by rawConfig only. A google connector without a google block is
+	// configured by rawConfig only too. Common aliases of the dex type names, such as openid-connect
+	// for oidc or azuread for microsoft, are accepted to ease the migration of existing dex configs.
+	// +kubebuilder:validation:Enum=github;ldap;microsoft;oidc;oauth;gitlab;google;saml;openshift;bitbucket-cloud;gitea;keystone;authproxy;atlassian-crowd;linkedin;github-enterprise;active-directory;azure;azuread;openid;openid-connect;bitbucket;crowd
 	Type ConnectorType `json:"type,omitempty"`
 	// Unique Id for the connector
 	Id        string              `json:"id,omitempty"`
 	GitHub    GitHubConfigSpec    `json:"github,omitempty"`
 	LDAP      LDAPConfigSpec      `json:"ldap,omitempty"`
 	Microsoft MicrosoftConfigSpec `json:"microsoft,omitempty"`
+	Google    GoogleConfigSpec    `json:"google,omitempty"`
+	// Additional keys merged into the config block of the connector, for dex connector options that are not typed
+	// yet. Keys already typed in the connector config cannot be set.
+	// +optional
+	RawConfig map[string]apiextensionsv1.JSON `json:"rawConfig,omitempty"`
 }
 
 type ConnectorType string
@@ -173,21 +231,548 @@ const (
 
 	// ConnectorTypeMicrosoft enables Dex to use the Microsoft OAuth2 flow to identify the end user through their Microsoft account
 	ConnectorTypeMicrosoft ConnectorType = "microsoft"
+
+	// ConnectorTypeGoogle enables Dex to use the Google OAuth2 flow to identify the end user through their Google account
+	ConnectorTypeGoogle ConnectorType = "google"
+
+	// The following dex connector types have no config block, their config is set with rawConfig
+
+	ConnectorTypeOIDC           ConnectorType = "oidc"
+	ConnectorTypeOAuth          ConnectorType = "oauth"
+	ConnectorTypeGitLab         ConnectorType = "gitlab"
+	ConnectorTypeSAML           ConnectorType = "saml"
+	ConnectorTypeOpenShift      ConnectorType = "openshift"
+	ConnectorTypeBitbucketCloud ConnectorType = "bitbucket-cloud"
+	ConnectorTypeGitea          ConnectorType = "gitea"
+	ConnectorTypeKeystone       ConnectorType = "keystone"
+	ConnectorTypeAuthProxy      ConnectorType = "authproxy"
+	ConnectorTypeAtlassianCrowd ConnectorType = "atlassian-crowd"
+	ConnectorTypeLinkedIn       ConnectorType = "linkedin"
+)
+
+// StorageType is the storage backend of dex
+// +kubebuilder:validation:Enum=kubernetes;postgres
+type StorageType string
+
+const (
+	// StorageTypeKubernetes stores the dex state in custom resources in the namespace of the DexServer
+	StorageTypeKubernetes StorageType = "kubernetes"
+	// StorageTypePostgres stores the dex state in a Postgres database
+	StorageTypePostgres StorageType = "postgres"
+)
+
+// StorageSpec configures the storage backend of dex
+type StorageSpec struct {
+	// Storage backend. Defaults to kubernetes.
+	// +optional
+	Type StorageType `json:"type,omitempty"`
+	// Postgres database, required with the postgres type
+	// +optional
+	Postgres *PostgresStorageSpec `json:"postgres,omitempty"`
+}
+
+// PostgresStorageSpec configures the Postgres database of dex
+type PostgresStorageSpec struct {
+	Host string `json:"host"`
+	// Defaults to 5432
+	// +optional
+	Port     *int32 `json:"port,omitempty"`
+	Database string `json:"database"`
+	User     string `json:"user"`
+	// Secret holding the password of the user, in the namespace of the DexServer. The password is passed to dex in
+	// an environment variable, a change of the secret restarts the dex pods.
+	PasswordRef corev1.LocalObjectReference `json:"passwordRef"`
+	// Key of the password in the PasswordRef secret. Defaults to password.
+	// +optional
+	PasswordKey string `json:"passwordKey,omitempty"`
+	// +optional
+	SSL *PostgresSSLSpec `json:"ssl,omitempty"`
+}
+
+// PostgresSSLSpec configures the TLS connection to the Postgres database
+type PostgresSSLSpec struct {
+	// SSL mode of the connection. The dex default is verify-full.
+	// +kubebuilder:validation:Enum=disable;require;verify-ca;verify-full
+	// +optional
+	Mode string `json:"mode,omitempty"`
+	// Secret holding the ca.crt of the CA of the database server, in the namespace of the DexServer. It is mounted
+	// into the dex pods.
+	// +optional
+	CARef corev1.LocalObjectReference `json:"caRef,omitempty"`
+}
+
+// ProbesSpec tunes the liveness and readiness probes of the dex container
+type ProbesSpec struct {
+	// Seconds after the start of the dex container before the probes start. Defaults to 10.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+	// Seconds between two probes. Defaults to 10.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	PeriodSeconds *int32 `json:"periodSeconds,omitempty"`
+	// Seconds after which a probe times out. Defaults to 5.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+}
+
+// AutoscalingSpec configures the HorizontalPodAutoscaler of the dex deployment
+type AutoscalingSpec struct {
+	// Lower bound of the number of dex pods. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// Upper bound of the number of dex pods
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+	// Average CPU utilization of the dex pods, in percent of their CPU request, that the autoscaler targets.
+	// Defaults to 80. The dex container needs a CPU request in resources.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+}
+
+// ExpirySpec configures the lifetimes of the tokens and keys issued by dex. Durations are Go durations such as "15m"
+// or "24h", an unset duration keeps the dex default.
+type ExpirySpec struct {
+	// Lifetime of the ID tokens. The dex default is 24h.
+	// +optional
+	IDTokens string `json:"idTokens,omitempty"`
+	// Interval at which the signing keys are rotated. The dex default is 6h.
+	// +optional
+	SigningKeys string `json:"signingKeys,omitempty"`
+	// Lifetime of the device flow requests. The dex default is 5m.
+	// +optional
+	DeviceRequests string `json:"deviceRequests,omitempty"`
+	// Rotation and lifetime of the refresh tokens
+	// +optional
+	RefreshTokens *RefreshTokenExpirySpec `json:"refreshTokens,omitempty"`
+}
+
+// RefreshTokenExpirySpec configures the rotation and lifetime of the refresh tokens issued by dex
+type RefreshTokenExpirySpec struct {
+	// When true, a refresh token stays the same when it is used instead of being rotated
+	// +optional
+	DisableRotation bool `json:"disableRotation,omitempty"`
+	// Interval during which the previous refresh token is still accepted after a rotation, for example for
+	// concurrent refreshes of a client. The dex default is 3s.
+	// +optional
+	ReuseInterval string `json:"reuseInterval,omitempty"`
+	// A refresh token expires when it is not used for this duration. Defaults to no expiry.
+	// +optional
+	ValidIfNotUsedFor string `json:"validIfNotUsedFor,omitempty"`
+	// A refresh token expires this long after it was first issued, even when it is used. Defaults to no expiry.
+	// +optional
+	AbsoluteLifetime string `json:"absoluteLifetime,omitempty"`
+}
+
+// FrontendSpec configures the branding of the login pages of dex
+type FrontendSpec struct {
+	// Theme of the login pages, a directory of the themes directory of the web assets, for example light or dark
+	// +optional
+	Theme string `json:"theme,omitempty"`
+	// URL of the logo shown on the login pages
+	// +optional
+	LogoURL string `json:"logoURL,omitempty"`
+	// Name of the issuer shown on the login pages, for example "Example Corp"
+	// +optional
+	Issuer string `json:"issuer,omitempty"`
+	// Directory of the web assets in the dex container. Defaults to the web assets of the dex image.
+	// +optional
+	Dir string `json:"dir,omitempty"`
+	// ConfigMap in the DexServer namespace holding the assets of a custom theme, such as styles.css, logo.png and
+	// favicon.png. It is mounted as the directory of the theme, which is then required.
+	// +optional
+	ThemeConfigMapRef *corev1.LocalObjectReference `json:"themeConfigMapRef,omitempty"`
+}
+
+// WebTLSSpec configures the serving certificate of the dex web server
+type WebTLSSpec struct {
+	// Existing kubernetes.io/tls secret in the DexServer namespace holding the serving certificate of dex, for
+	// example issued by cert-manager. Defaults to the <name>-tls-secret generated by the OpenShift service CA.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+	// When true, dex serves plain HTTP, for example behind an ingress controller terminating TLS. The Route then
+	// uses edge instead of reencrypt termination. Cannot be set with secretName.
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+	// Existing secret in the DexServer namespace whose ca.crt key holds the CA that signed the serving certificate of
+	// dex, for example when secretName is not issued by the OpenShift service CA. The Route trusts it as its
+	// destination CA, and the Ingress as the CA of the HTTPS backend. Defaults to the service CA trusted by the
+	// OpenShift router. Cannot be set when disabled is true.
+	// +optional
+	CASecretName string `json:"caSecretName,omitempty"`
+}
+
+// StaticPasswordSpec references the secret of a local user of the dex password database
+type StaticPasswordSpec struct {
+	// Secret holding the email, hash, username and userID keys of the user. The hash is the bcrypt hash of the
+	// password of the user. The namespace defaults to the DexServer namespace.
+	SecretRef corev1.SecretReference `json:"secretRef"`
+}
+
+// RouteType is the kind of resource exposing the dex issuer outside the cluster
+// +kubebuilder:validation:Enum=Ingress;Route
+type RouteType string
+
+const (
+	RouteTypeIngress RouteType = "Ingress"
+	RouteTypeRoute   RouteType = "Route"
+)
+
+// ManagedResource is a resource of a DexServer synced by the operator
+// +kubebuilder:validation:Enum=ConfigMap;Service;GRPCService;ServiceAccount;Deployment;Ingress
+type ManagedResource string
+
+const (
+	ManagedResourceConfigMap      ManagedResource = "ConfigMap"
+	ManagedResourceService        ManagedResource = "Service"
+	ManagedResourceGRPCService    ManagedResource = "GRPCService"
+	ManagedResourceServiceAccount ManagedResource = "ServiceAccount"
+	// The dex Deployment, its HorizontalPodAutoscaler and the pruning of its stale ReplicaSets
+	ManagedResourceDeployment ManagedResource = "Deployment"
+	// The Ingress or Route exposing the issuer, depending on the route type
+	ManagedResourceIngress ManagedResource = "Ingress"
 )
 
+// ManagedResourcesSpec selects the resources of a DexServer synced by the operator. The other resources are neither
+// created nor updated, so that external tooling can own them; existing ones are left as they are.
+type ManagedResourcesSpec struct {
+	// Resources synced by the operator. Defaults to all of them.
+	// +optional
+	Include []ManagedResource `json:"include,omitempty"`
+	// Resources not synced by the operator, on top of the ones missing from include
+	// +optional
+	Exclude []ManagedResource `json:"exclude,omitempty"`
+}
+
 // DexServerSpec defines the desired state of DexServer
 type DexServerSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	// TODO: Issuer references the dex instance web URI. Should this be returned as status?
-	Issuer     string          `json:"issuer,omitempty"`
+	// A path-based issuer, such as https://example.com/auth, serves dex below that path: the Ingress routes the
+	// path to dex, and connectors without a redirect URI use the callback below it.
+	Issuer string `json:"issuer,omitempty"`
+	// Additional hostnames dex is reachable at, such as an internal hostname next to the external hostname of the
+	// issuer. The Ingress, or one Route per hostname, also serves the path of the issuer on them, and connectors
+	// may set their redirect URI to the dex callback on them. Dex has a single issuer: the discovery document, the
+	// tokens and the default connector redirect URI keep the hostname of the issuer, so OIDC clients must still
+	// use the issuer. With an ingress certificate, the certificate must also cover these hostnames.
+	// +optional
+	AdditionalHosts []string `json:"additionalHosts,omitempty"`
+	// The connectors, with those of the DexConnectors of the DexServer, are rendered into the dex config sorted by
+	// id, so that reordering them does not change the config and restart dex
 	Connectors []ConnectorSpec `json:"connectors,omitempty"`
 	// Optional bring-your-own-certificate. Otherwise, the default certificate is used for dex server Ingress.
+	// With the Route type, the certificate and key of the kubernetes.io/tls secret are copied into the Route.
+	// The issuer is exposed once the secret holds a valid certificate and key, for example once cert-manager issued
+	// the certificate; meanwhile the WaitingForCertificate reason is reported.
 	IngressCertificateRef corev1.LocalObjectReference `json:"ingressCertificateRef,omitempty"`
+	// When true, plain HTTP requests to the issuer are redirected to HTTPS. On the Ingress this sets the
+	// nginx.ingress.kubernetes.io/force-ssl-redirect annotation, which is honored by ingress-nginx only; other
+	// ingress controllers need their own redirect configuration. On a Route this sets the insecure edge
+	// termination policy to Redirect. Defaults to false, no redirect is configured.
+	// +optional
+	ForceHTTPSRedirect bool `json:"forceHTTPSRedirect,omitempty"`
+	// Serving certificate of the dex web server. Defaults to the certificate generated by the OpenShift service CA
+	// through the serving-cert-secret-name annotation of the Service, which is only available on OpenShift.
+	// +optional
+	WebTLS *WebTLSSpec `json:"webTLS,omitempty"`
+	// The resource exposing the issuer outside the cluster: a networking.k8s.io Ingress, or an OpenShift
+	// route.openshift.io Route with reencrypt TLS termination to the serving certificate of dex. When the type
+	// changes, the resource of the previous type is deleted. Defaults to Ingress.
+	// +optional
+	RouteType RouteType `json:"routeType,omitempty"`
+	// When true, connector secrets (client secrets, LDAP bind passwords) are not written into the dex ConfigMap.
+	// The config references environment variables instead (for example $DEX_CONNECTOR_GITHUB_CLIENT_SECRET),
+	// which are populated on the dex container from the referenced secrets. The referenced secrets must be in
+	// the same namespace as the DexServer.
+	// +optional
+	UseEnvExpansion bool `json:"useEnvExpansion,omitempty"`
+	// Session affinity of the dex http Service. Defaults to None. ClientIP keeps a client on the same dex
+	// replica for the duration of the auth flow. With proper shared storage this should not be needed, but
+	// it is a useful escape hatch when replicas share state imperfectly.
+	// +kubebuilder:validation:Enum=None;ClientIP
+	// +optional
+	SessionAffinity corev1.ServiceAffinity `json:"sessionAffinity,omitempty"`
+	// Seconds a ClientIP session sticks to the same replica. Defaults to 10800 (3 hours).
+	// Only used when SessionAffinity is ClientIP.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=86400
+	// +optional
+	SessionAffinityTimeoutSeconds *int32 `json:"sessionAffinityTimeoutSeconds,omitempty"`
+	// IP families of the dex http and gRPC Services on dual-stack clusters, IPv4 and/or IPv6, primary family
+	// first. The primary family of an existing Service cannot be changed. Defaults to the cluster default.
+	// +kubebuilder:validation:MaxItems=2
+	// +optional
+	IPFamilies []corev1.IPFamily `json:"ipFamilies,omitempty"`
+	// IP family policy of the dex http and gRPC Services. SingleStack allows a single IP family. Defaults to the
+	// cluster default.
+	// +kubebuilder:validation:Enum=SingleStack;PreferDualStack;RequireDualStack
+	// +optional
+	IPFamilyPolicy *corev1.IPFamilyPolicyType `json:"ipFamilyPolicy,omitempty"`
+	// Version of the dex config format to render, for example "v2.30". Version specific fields, such as the LDAP
+	// group search userMatchers list (v2.27 and later) versus a single userAttr/groupAttr pair, are rendered to match.
+	// Defaults to the version in the tag of the dex image, and to the latest format when the tag is not a version.
+	// Versions other than v2 are rejected as an invalid spec.
+	// +optional
+	DexConfigVersion string `json:"dexConfigVersion,omitempty"`
+	// When true, the root CAs of all connectors are aggregated into the ConfigMap <name>-ca-bundle under the key
+	// ca-bundle.crt, for consumption by other components such as a front proxy. The ConfigMap is kept in sync
+	// with the connector root CA secrets and is removed when the flag is unset.
+	// +optional
+	PublishCABundle bool `json:"publishCABundle,omitempty"`
+	// When true, the discovery document and the JSON Web Key Set of dex are published into the ConfigMap
+	// <name>-jwks under the keys openid-configuration.json and keys.json, for relying parties that cannot reach dex
+	// at runtime. The published copy is refreshed when dex rotates its signing keys and is removed when the flag
+	// is unset.
+	// +optional
+	PublishJWKS bool `json:"publishJWKS,omitempty"`
+	// Additional subject alternative names (DNS names or IP addresses) of the generated gRPC server certificate,
+	// for example a custom DNS name used for cross-cluster gRPC access. The certificate is regenerated when the
+	// list changes.
+	// +optional
+	GRPCCertSANs []string `json:"grpcCertSANs,omitempty"`
+	// Serialization of the dex config: YAML (default) renders config.yaml, JSON renders config.json, for example for
+	// dex images or debugging tools expecting JSON. Dex parses both, JSON being a subset of YAML. Changing the format
+	// restarts the dex pods.
+	// +kubebuilder:validation:Enum=YAML;JSON
+	// +optional
+	ConfigFormat ConfigFormatType `json:"configFormat,omitempty"`
+	// Scope of the RBAC granted to dex for its kubernetes storage. Namespace binds a Role for the dex storage
+	// resources in the DexServer namespace. Cluster binds the ClusterRole, which also allows dex to register its
+	// storage CustomResourceDefinitions. Defaults to Namespace when the dex storage CustomResourceDefinitions are
+	// already installed, and to Cluster otherwise. The DexServers of a namespace share the RBAC of dex, which has
+	// the widest scope any of them requests.
+	// +kubebuilder:validation:Enum=Namespace;Cluster
+	// +optional
+	RBACScope RBACScopeType `json:"rbacScope,omitempty"`
+	// Entries added to the /etc/hosts file of the dex pods, for example to resolve the hostname in the certificate
+	// of an LDAP server that is only reachable by IP address. Defaults to none.
+	// +optional
+	HostAliases []corev1.HostAlias `json:"hostAliases,omitempty"`
+	// Secrets in the DexServer namespace with the credentials to pull the dex image, for example from the private
+	// registry of an air-gapped cluster. Defaults to none.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+	// Labels of the nodes the dex pods are scheduled on. Defaults to none.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations of the dex pods, replacing the default ones. Defaults to tolerating the NoSchedule taints
+	// node-role.kubernetes.io/infra and dedicated.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// Scheduling constraints of the dex pods, replacing the default ones. Defaults to spreading the dex pods across
+	// zones and nodes.
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// Labels added to the resources generated from the DexServer, such as the Deployment, the Services and the
+	// ConfigMap, for example cost-center or team labels. The labels set by the operator win on conflict. Labels
+	// removed from the map are not removed from the generated resources. Defaults to none.
+	// +optional
+	AdditionalLabels map[string]string `json:"additionalLabels,omitempty"`
+	// Annotations added to the resources generated from the DexServer. The annotations set by the operator win on
+	// conflict. Annotations removed from the map are not removed from the generated resources. Defaults to none.
+	// +optional
+	AdditionalAnnotations map[string]string `json:"additionalAnnotations,omitempty"`
+	// When true, the root filesystem of the dex container is mounted read-only. Dex only writes temporary files,
+	// to a writable emptyDir volume mounted at /tmp.
+	// +optional
+	ReadOnlyRootFilesystem bool `json:"readOnlyRootFilesystem,omitempty"`
+	// Size limit of the writable emptyDir volumes of the dex pods, such as /tmp with readOnlyRootFilesystem, so that
+	// dex cannot fill the ephemeral storage of the node. A pod exceeding it is evicted. Defaults to 64Mi.
+	// +optional
+	EmptyDirSizeLimit *resource.Quantity `json:"emptyDirSizeLimit,omitempty"`
+	// Supplemental group of the dex pods that owns the mounted volumes, such as the serving, mTLS and LDAP
+	// certificate secrets, so that the non-root dex process can read them, for example 1001, the group of the dex
+	// image. When unset, no fsGroup is set on the dex pods and the pod security policy assigns one, as the OpenShift
+	// restricted SCC does from the range of the namespace.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	FSGroup *int64 `json:"fsGroup,omitempty"`
+	// Local users of the dex password database, for example to bootstrap or test dex before connectors are
+	// configured. The password database is enabled when there is at least one. Defaults to none.
+	// +optional
+	StaticPasswords []StaticPasswordSpec `json:"staticPasswords,omitempty"`
+	// Storage backend of dex. Defaults to the kubernetes storage.
+	// +optional
+	Storage *StorageSpec `json:"storage,omitempty"`
+	// Lifetimes of the tokens and signing keys. The expiry section of the dex config is omitted when unset, so the
+	// dex defaults apply.
+	// +optional
+	Expiry *ExpirySpec `json:"expiry,omitempty"`
+	// Branding of the login pages. The frontend section of the dex config is omitted when unset, so the default dex
+	// branding applies.
+	// +optional
+	Frontend *FrontendSpec `json:"frontend,omitempty"`
+	// Number of dex pods. Defaults to 1. With several pods, a PodDisruptionBudget keeps all pods but one available
+	// during node drains. A single pod has no PodDisruptionBudget, which would block the drains.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Scales the dex deployment with a HorizontalPodAutoscaler on the CPU utilization of the dex pods, for example
+	// with the Postgres storage. Replicas is ignored when set, the operator no longer manages the number of dex
+	// pods. The PodDisruptionBudget follows minReplicas. Defaults to no autoscaling.
+	// +optional
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+	// Compute resources of the dex container. Defaults to no requests or limits.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// Source of the gRPC mTLS certificates. SelfSigned (default) generates a CA and the certificates in the
+	// operator. KubeCSR submits CertificateSigningRequests, signed by GRPCCertSignerName once approved, so that the
+	// certificates chain to the cluster CA. CertManager requests the certificates from the cert-manager issuer
+	// GRPCCertIssuerRef. The reconcile waits, and requeues, until the certificates are issued.
+	// +kubebuilder:validation:Enum=SelfSigned;KubeCSR;CertManager
+	// +optional
+	GRPCCertSource GRPCCertSourceType `json:"grpcCertSource,omitempty"`
+	// Signer of the CertificateSigningRequests of the KubeCSR gRPC certificate source, for example a signer whose CA
+	// is the cluster CA published in the kube-root-ca.crt ConfigMap. Required for KubeCSR.
+	// +optional
+	GRPCCertSignerName string `json:"grpcCertSignerName,omitempty"`
+	// The cert-manager issuer of the CertManager gRPC certificate source. Required for CertManager.
+	// +optional
+	GRPCCertIssuerRef *CertManagerIssuerReference `json:"grpcCertIssuerRef,omitempty"`
+	// Defers the setup of the gRPC API, its mTLS secret and service, until a dex pod of the deployment is available,
+	// so that the login path comes up first. Until then dex runs without the gRPC API and the MTLSSecretReady
+	// condition reports WaitingForHTTPAvailable. Enabling the gRPC API afterwards rolls the deployment once.
+	// +optional
+	DeferGRPC bool `json:"deferGRPC,omitempty"`
+	// Seconds a rollout of the dex deployment may go without progress before the deployment, and the
+	// DeploymentRolledOut condition, report it as failed. Defaults to 600, the kubernetes default. Raise it for slow
+	// rolling upgrades.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ProgressDeadlineSeconds *int32 `json:"progressDeadlineSeconds,omitempty"`
+	// Timing of the liveness (/healthz/live) and readiness (/healthz/ready) probes of the dex container. The probes
+	// request the telemetry port of dex, which serves plain HTTP.
+	// +optional
+	Probes *ProbesSpec `json:"probes,omitempty"`
+	// Resources synced by the operator, for example to leave the Service to a service mesh. The Deployment mounts
+	// the dex ConfigMap, so the ConfigMap cannot be excluded while the Deployment is synced. Defaults to all
+	// resources.
+	// +optional
+	ManagedResources *ManagedResourcesSpec `json:"managedResources,omitempty"`
+	// Key of a secret in the DexServer namespace holding PEM encoded CA certificates trusted by dex for all its
+	// outbound TLS connections, such as to the OIDC, SAML and Google connector endpoints of a private CA. The key is
+	// mounted into the system certificate directory of the dex container, next to the system CAs. The LDAP connectors
+	// keep their own rootCA. Updates of the secret roll the dex pods.
+	// +optional
+	TrustedCABundleRef *corev1.SecretKeySelector `json:"trustedCABundleRef,omitempty"`
+	// Seconds a terminating dex pod is given to complete its in-flight requests, such as the long-polling of the
+	// device flow, before it is killed. Defaults to the cluster default of 30 seconds.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"`
+	// Seconds a terminating dex pod keeps serving, through a preStop hook, so that it is removed from the endpoints of
+	// the Services, and from the ingress controllers, before dex stops. Must be less than the termination grace
+	// period. The hook runs sleep, which the dex image must provide. Defaults to no preStop hook.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	PreStopSleepSeconds *int32 `json:"preStopSleepSeconds,omitempty"`
+	// Stops applying the resources of the DexServer, for example to preview the dex config of a connector migration.
+	// The dex config is still rendered, with the connector credentials redacted, and recorded in
+	// status.renderedConfig. The existing resources are left as they are until the DexServer is resumed.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
 }
 
+// CertManagerIssuerReference references a cert-manager Issuer or ClusterIssuer
+type CertManagerIssuerReference struct {
+	// Name of the issuer
+	Name string `json:"name"`
+	// Kind of the issuer, Issuer (default) or ClusterIssuer
+	// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// Group of the issuer, defaults to cert-manager.io
+	// +optional
+	Group string `json:"group,omitempty"`
+}
+
+type GRPCCertSourceType string
+
+const (
+	// GRPCCertSourceSelfSigned generates a self-signed CA and the gRPC certificates in the operator
+	GRPCCertSourceSelfSigned GRPCCertSourceType = "SelfSigned"
+
+	// GRPCCertSourceKubeCSR issues the gRPC certificates through the kubernetes CertificateSigningRequest API
+	GRPCCertSourceKubeCSR GRPCCertSourceType = "KubeCSR"
+
+	// GRPCCertSourceCertManager issues the gRPC certificates through cert-manager Certificates
+	GRPCCertSourceCertManager GRPCCertSourceType = "CertManager"
+)
+
+type RBACScopeType string
+
+const (
+	// RBACScopeNamespace grants dex access to its storage resources in the DexServer namespace only
+	RBACScopeNamespace RBACScopeType = "Namespace"
+
+	// RBACScopeCluster grants dex access to its storage resources in all namespaces and to register its storage CRDs
+	RBACScopeCluster RBACScopeType = "Cluster"
+)
+
+type ConfigFormatType string
+
+const (
+	// ConfigFormatYAML renders the dex config as config.yaml
+	ConfigFormatYAML ConfigFormatType = "YAML"
+
+	// ConfigFormatJSON renders the dex config as config.json
+	ConfigFormatJSON ConfigFormatType = "JSON"
+)
+
 const (
 	DexServerConditionTypeApplied string = "Applied"
+	// Available reports whether at least one dex pod is ready, with the last termination of a crashlooping dex
+	// container when none is. When the operator runs with the issuer reachability check enabled, it also reports
+	// whether the issuer discovery endpoint is reachable from within the cluster once a dex pod is ready.
+	DexServerConditionTypeAvailable string = "Available"
+
+	// Each reconcile phase reports its own condition so the status and last transition time of
+	// every phase can be tracked independently of the others.
+	DexServerConditionTypeMTLSSecretReady          string = "MTLSSecretReady"
+	DexServerConditionTypeConfigMapReady           string = "ConfigMapReady"
+	DexServerConditionTypeCABundleReady            string = "CABundleReady"
+	DexServerConditionTypeHTTPServiceReady         string = "HTTPServiceReady"
+	DexServerConditionTypeGRPCServiceReady         string = "GRPCServiceReady"
+	DexServerConditionTypeServiceAccountReady      string = "ServiceAccountReady"
+	DexServerConditionTypeClusterRoleBindingReady  string = "ClusterRoleBindingReady"
+	DexServerConditionTypeDeploymentReady          string = "DeploymentReady"
+	DexServerConditionTypePodDisruptionBudgetReady string = "PodDisruptionBudgetReady"
+	DexServerConditionTypeAutoscalerReady          string = "AutoscalerReady"
+	DexServerConditionTypeIngressReady             string = "IngressReady"
+	DexServerConditionTypeRouteReady               string = "RouteReady"
+
+	// RedirectURIsConsistent is false when a connector redirect URI is not the callback of dex, or a DexClient of the
+	// namespace registers the callback of dex as its own redirect URI
+	DexServerConditionTypeRedirectURIsConsistent string = "RedirectURIsConsistent"
+
+	// DeploymentImageUpToDate reports whether the dex deployment runs the desired dex image, for example after
+	// an operator upgrade changed the image
+	DexServerConditionTypeDeploymentImageUpToDate string = "DeploymentImageUpToDate"
+
+	// DeploymentRecreated is set when the operator deleted and recreated the dex deployment because an immutable
+	// field changed. Dex is unavailable until the pods of the new deployment are ready.
+	DexServerConditionTypeDeploymentRecreated string = "DeploymentRecreated"
+
+	// DeploymentRolledOut reports whether all replicas of the dex deployment run its latest pod template, and
+	// whether the rollout exceeded the progress deadline of the deployment
+	DexServerConditionTypeDeploymentRolledOut string = "DeploymentRolledOut"
+
+	// JWKSPublished reports whether the JWKS of dex is published into the <name>-jwks ConfigMap. It is only set
+	// when publishJWKS is true.
+	DexServerConditionTypeJWKSPublished string = "JWKSPublished"
+
+	// Degraded is true when the serving certificate secret generated by the OpenShift service CA did not appear
+	// within the serving certificate timeout of the operator, and unknown while it is awaited. It is only set when
+	// webTLS does not reference a secret.
+	DexServerConditionTypeDegraded string = "Degraded"
+
+	// Paused is true while the DexServer is paused and none of its resources are applied
+	DexServerConditionTypePaused string = "Paused"
 )
 
 // DexServerStatus defines the observed state of DexServer
@@ -201,9 +786,38 @@ type DexServerStatus struct {
 	// Conditions contains the different condition statuses for this DexServer.
 	// +optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Ids of the connectors rendered into the dex config by the last successful sync of the ConfigMap, including
+	// the connectors of the DexConnectors of the DexServer
+	// +optional
+	ActiveConnectors []string `json:"activeConnectors,omitempty"`
+	// Version of the running dex, the tag (or else the digest) of the dex image once its rollout has completed
+	// +optional
+	DexVersion string `json:"dexVersion,omitempty"`
+	// Time of the next reconcile scheduled by the operator, after a failure, while waiting on another component or
+	// for the periodic resync. Unset when the DexServer is only reconciled on its next change.
+	// +optional
+	NextReconcileTime *metav1.Time `json:"nextReconcileTime,omitempty"`
+	// Backoff before the next reconcile of a failing DexServer. It doubles on every consecutive failure, up to the
+	// maximum reconcile backoff of the operator.
+	// +optional
+	Backoff *metav1.Duration `json:"backoff,omitempty"`
+	// Number of consecutive failed reconciles, reset by a successful reconcile
+	// +optional
+	Retries int32 `json:"retries,omitempty"`
+	// Generation of the DexServer last reconciled successfully. The reconcile of the current generation is in
+	// progress, or failed, while it is lower than metadata.generation.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Dex config rendered while the DexServer is paused, with the connector credentials and static password hashes
+	// redacted. Unset once the DexServer is resumed.
+	// +optional
+	RenderedConfig string `json:"renderedConfig,omitempty"`
 }
 
 type RelatedObjectReference struct {
+	// The group and version of the referenced resource, for example v1 or auth.identitatem.io/v1alpha1
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
 	// the Kind of the referenced resource
 	Kind string `json:"kind,omitempty"`
 	// The name of the referenced object
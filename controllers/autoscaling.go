@@ -0,0 +1,122 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+const (
+	// Default for AutoscalingSpec.MinReplicas
+	DEFAULT_AUTOSCALING_MIN_REPLICAS int32 = 1
+	// Default for AutoscalingSpec.TargetCPUUtilizationPercentage
+	DEFAULT_AUTOSCALING_TARGET_CPU_UTILIZATION_PERCENTAGE int32 = 80
+)
+
+// The HorizontalPodAutoscaler API, applied and deleted through the dynamic client
+var horizontalPodAutoscalerGVK = schema.GroupVersionKind{Group: "autoscaling", Version: "v2", Kind: "HorizontalPodAutoscaler"}
+var horizontalPodAutoscalerGVR = horizontalPodAutoscalerGVK.GroupVersion().WithResource("horizontalpodautoscalers")
+
+// newHorizontalPodAutoscaler returns an empty HorizontalPodAutoscaler to watch. The vendored k8s.io/api has no
+// autoscaling/v2 types, so it is watched as unstructured.
+func newHorizontalPodAutoscaler() *unstructured.Unstructured {
+	hpa := &unstructured.Unstructured{}
+	hpa.SetGroupVersionKind(horizontalPodAutoscalerGVK)
+	return hpa
+}
+
+// isHorizontalPodAutoscalerServed returns true if the cluster serves the autoscaling/v2 API, which a watch of the
+// HorizontalPodAutoscalers needs to start
+func (r *DexServerReconciler) isHorizontalPodAutoscalerServed() bool {
+	return r.isAPIServed(horizontalPodAutoscalerGVK)
+}
+
+// getMinReplicas returns the lower bound of the number of dex pods, minReplicas when autoscaling
+func getMinReplicas(dexServer *authv1alpha1.DexServer) int32 {
+	if autoscaling := dexServer.Spec.Autoscaling; autoscaling != nil {
+		if autoscaling.MinReplicas != nil {
+			return *autoscaling.MinReplicas
+		}
+		return DEFAULT_AUTOSCALING_MIN_REPLICAS
+	}
+	return getReplicas(dexServer)
+}
+
+// getDeploymentReplicas returns the number of dex pods of the deployment. When autoscaling, the number of pods set by
+// the HorizontalPodAutoscaler on the existing deployment is kept, so that the operator does not scale it back.
+func getDeploymentReplicas(dexServer *authv1alpha1.DexServer, previousDeployment *appsv1.Deployment) int32 {
+	if dexServer.Spec.Autoscaling == nil {
+		return getReplicas(dexServer)
+	}
+	if previousDeployment != nil && previousDeployment.Spec.Replicas != nil {
+		return *previousDeployment.Spec.Replicas
+	}
+	return getMinReplicas(dexServer)
+}
+
+// syncAutoscaler applies the HorizontalPodAutoscaler of the dex deployment, or deletes it when autoscaling is disabled
+func (r *DexServerReconciler) syncAutoscaler(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+	autoscaling := dexServer.Spec.Autoscaling
+	if autoscaling == nil {
+		err := r.DynamicClient.Resource(horizontalPodAutoscalerGVR).Namespace(dexServer.Namespace).Delete(ctx, dexServer.Name, metav1.DeleteOptions{})
+		if err == nil {
+			log.Info("deleted the HorizontalPodAutoscaler, autoscaling is disabled", "name", dexServer.Name)
+			return nil
+		}
+		if kubeerrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, "error deleting the HorizontalPodAutoscaler")
+	}
+
+	targetCPUUtilizationPercentage := DEFAULT_AUTOSCALING_TARGET_CPU_UTILIZATION_PERCENTAGE
+	if autoscaling.TargetCPUUtilizationPercentage != nil {
+		targetCPUUtilizationPercentage = *autoscaling.TargetCPUUtilizationPercentage
+	}
+	log.Info("syncAutoscaler", "MinReplicas", getMinReplicas(dexServer), "MaxReplicas", autoscaling.MaxReplicas)
+
+	values := struct {
+		MinReplicas                    int32
+		MaxReplicas                    int32
+		TargetCPUUtilizationPercentage int32
+		DexServer                      *authv1alpha1.DexServer
+	}{
+		MinReplicas:                    getMinReplicas(dexServer),
+		MaxReplicas:                    autoscaling.MaxReplicas,
+		TargetCPUUtilizationPercentage: targetCPUUtilizationPercentage,
+		DexServer:                      dexServer,
+	}
+
+	files := []string{
+		"dex-server/horizontal_pod_autoscaler.yaml",
+	}
+
+	applier, readerDeploy := r.getApplierAndReader(dexServer)
+	_, err := applier.ApplyCustomResources(readerDeploy, values, false, "", files...)
+	return err
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+const (
+	// Bounds of the requeue of a DexServer without a ready dex pod. The requeue doubles with the time the DexServer
+	// has been unavailable.
+	PODS_NOT_READY_MIN_REQUEUE = 5 * time.Second
+	PODS_NOT_READY_MAX_REQUEUE = 5 * time.Minute
+)
+
+// getPodsAvailableCondition returns the Available condition from the readiness of the dex pods. It is true when at
+// least one dex pod is ready. Otherwise the message reports the last termination of a crashlooping dex container, as
+// dex exits on an invalid config.
+func (r *DexServerReconciler) getPodsAvailableCondition(dexServer *authv1alpha1.DexServer, ctx context.Context) (metav1.Condition, error) {
+	deployment, err := r.KubeClient.AppsV1().Deployments(dexServer.Namespace).Get(ctx, dexServer.Name, metav1.GetOptions{})
+	if err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return podsUnavailableCondition("PodsNotReady", "the dex deployment does not exist"), nil
+		}
+		return metav1.Condition{}, errors.Wrap(err, "error getting dex server deployment")
+	}
+	pods, err := r.KubeClient.CoreV1().Pods(dexServer.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(deployment.Spec.Selector),
+	})
+	if err != nil {
+		return metav1.Condition{}, errors.Wrap(err, "error listing dex pods")
+	}
+
+	readyPods := 0
+	var crashLoopMessage string
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		if isPodReady(pod) {
+			readyPods++
+			continue
+		}
+		if crashLoopMessage == "" {
+			crashLoopMessage = getCrashLoopMessage(pod)
+		}
+	}
+	if readyPods > 0 {
+		return metav1.Condition{
+			Type:    authv1alpha1.DexServerConditionTypeAvailable,
+			Status:  metav1.ConditionTrue,
+			Reason:  "PodsReady",
+			Message: fmt.Sprintf("%d of %d dex pods are ready", readyPods, len(pods.Items)),
+		}, nil
+	}
+	if crashLoopMessage != "" {
+		return podsUnavailableCondition("CrashLoopBackOff", crashLoopMessage), nil
+	}
+	return podsUnavailableCondition("PodsNotReady", fmt.Sprintf("none of the %d dex pods is ready", len(pods.Items))), nil
+}
+
+func podsUnavailableCondition(reason string, message string) metav1.Condition {
+	return metav1.Condition{
+		Type:    authv1alpha1.DexServerConditionTypeAvailable,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	}
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// getCrashLoopMessage returns the last termination of the crashlooping container of a pod, or "" when no container
+// of the pod is crashlooping
+func getCrashLoopMessage(pod *corev1.Pod) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting == nil || status.State.Waiting.Reason != "CrashLoopBackOff" {
+			continue
+		}
+		message := fmt.Sprintf("container %s of dex pod %s is crashlooping after %d restarts", status.Name, pod.Name, status.RestartCount)
+		if terminated := status.LastTerminationState.Terminated; terminated != nil {
+			message = fmt.Sprintf("%s. It last terminated with reason %s and exit code %d", message, terminated.Reason, terminated.ExitCode)
+			if terminated.Message != "" {
+				message = fmt.Sprintf("%s: %s", message, terminated.Message)
+			}
+		}
+		return message
+	}
+	return ""
+}
+
+// getPodsNotReadyRequeueAfter returns the requeue of a DexServer without a ready dex pod: the time it has been
+// unavailable, within PODS_NOT_READY_MIN_REQUEUE and PODS_NOT_READY_MAX_REQUEUE
+func getPodsNotReadyRequeueAfter(dexServer *authv1alpha1.DexServer) time.Duration {
+	requeueAfter := PODS_NOT_READY_MIN_REQUEUE
+	if cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeAvailable); cond != nil && cond.Status == metav1.ConditionFalse {
+		if unavailable := time.Since(cond.LastTransitionTime.Time); unavailable > requeueAfter {
+			requeueAfter = unavailable
+		}
+	}
+	if requeueAfter > PODS_NOT_READY_MAX_REQUEUE {
+		return PODS_NOT_READY_MAX_REQUEUE
+	}
+	return requeueAfter
+}
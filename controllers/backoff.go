@@ -0,0 +1,90 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+const (
+	// The backoff after the first failed reconcile of a DexServer, doubled on every consecutive failure
+	RECONCILE_BASE_BACKOFF = 5 * time.Millisecond
+	// The default cap of the reconcile backoff, the controller-runtime default
+	DEFAULT_MAX_RECONCILE_BACKOFF = 1000 * time.Second
+)
+
+// newReconcileRateLimiter returns the rate limiter of the DexServer workqueue. It is the controller-runtime default
+// rate limiter, with the per DexServer exponential backoff capped at maxBackoff.
+func newReconcileRateLimiter(maxBackoff time.Duration) workqueue.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(RECONCILE_BASE_BACKOFF, maxBackoff),
+		// 10 qps, 100 bucket size. This is only for retry speed and its only the overall factor (not per item)
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+	)
+}
+
+// getReconcileRateLimiter returns the rate limiter shared with the workqueue, which counts the consecutive failed
+// reconciles of each DexServer
+func (r *DexServerReconciler) getReconcileRateLimiter() workqueue.RateLimiter {
+	r.rateLimiterOnce.Do(func() {
+		r.rateLimiter = newReconcileRateLimiter(r.getMaxReconcileBackoff())
+	})
+	return r.rateLimiter
+}
+
+func (r *DexServerReconciler) getMaxReconcileBackoff() time.Duration {
+	if r.MaxReconcileBackoff <= 0 {
+		return DEFAULT_MAX_RECONCILE_BACKOFF
+	}
+	return r.MaxReconcileBackoff
+}
+
+// getReconcileBackoff returns the backoff the workqueue applies after a failed reconcile that follows retries failed
+// reconciles
+func (r *DexServerReconciler) getReconcileBackoff(retries int) time.Duration {
+	maxBackoff := r.getMaxReconcileBackoff()
+	backoff := RECONCILE_BASE_BACKOFF
+	for i := 0; i < retries && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+// setNextReconcileStatus records when the DexServer is reconciled next. retries is the number of consecutive failed
+// reconciles, the backoff is only reported while the DexServer fails. A zero requeueAfter clears the next reconcile
+// time, the DexServer is then only reconciled on a change.
+func setNextReconcileStatus(dexServer *authv1alpha1.DexServer, requeueAfter time.Duration, retries int) {
+	dexServer.Status.Retries = int32(retries)
+	dexServer.Status.Backoff = nil
+	if retries > 0 && requeueAfter > 0 {
+		dexServer.Status.Backoff = &metav1.Duration{Duration: requeueAfter}
+	}
+	dexServer.Status.NextReconcileTime = nil
+	if requeueAfter > 0 {
+		nextReconcileTime := metav1.NewTime(time.Now().Add(requeueAfter))
+		dexServer.Status.NextReconcileTime = &nextReconcileTime
+	}
+}
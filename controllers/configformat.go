@@ -0,0 +1,76 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	clusteradmapply "open-cluster-management.io/clusteradm/pkg/helpers/apply"
+	"open-cluster-management.io/clusteradm/pkg/helpers/asset"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+const (
+	// Names of the dex config in the ConfigMap and in the dex container, by config format
+	CONFIG_FILE_NAME_YAML = "config.yaml"
+	CONFIG_FILE_NAME_JSON = "config.json"
+)
+
+// getConfigFormat returns the serialization of the dex config, defaulting to YAML
+func getConfigFormat(dexServer *authv1alpha1.DexServer) authv1alpha1.ConfigFormatType {
+	if dexServer.Spec.ConfigFormat == "" {
+		return authv1alpha1.ConfigFormatYAML
+	}
+	return dexServer.Spec.ConfigFormat
+}
+
+// getConfigFileName returns the key of the dex config in the ConfigMap, which is also the file dex is started with.
+// The key is part of the ConfigMap hash and of the pod template, so changing the format restarts the dex pods.
+func getConfigFileName(dexServer *authv1alpha1.DexServer) string {
+	if getConfigFormat(dexServer) == authv1alpha1.ConfigFormatJSON {
+		return CONFIG_FILE_NAME_JSON
+	}
+	return CONFIG_FILE_NAME_YAML
+}
+
+// renderDexConfig renders the dex config template and serializes it in the given format. The JSON config is
+// indented, so that it stays readable in the ConfigMap.
+func renderDexConfig(reader asset.ScenarioReader, values interface{}, format authv1alpha1.ConfigFormatType) ([]byte, error) {
+	// The applier of the DexServer sets its owner reference on what it renders, which needs a kubernetes object
+	applier := (&clusteradmapply.ApplierBuilder{}).Build()
+	dexConfig, err := applier.MustTempalteAsset(reader, values, "", "dex-server/config.yaml")
+	if err != nil {
+		return nil, errors.Wrap(err, "error rendering the dex config")
+	}
+	if format != authv1alpha1.ConfigFormatJSON {
+		return dexConfig, nil
+	}
+	j, err := yaml.YAMLToJSON(dexConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "error converting the dex config to json")
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, j, "", "  "); err != nil {
+		return nil, errors.Wrap(err, "error indenting the dex config")
+	}
+	out.WriteString("\n")
+	return out.Bytes(), nil
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// dexConfigRenderer holds the version specific rendering behavior of the dex config
+type dexConfigRenderer struct {
+	// Dex releases before v2.27 take a single userAttr/groupAttr pair in the LDAP group search instead of
+	// the userMatchers list
+	singleGroupUserMatcher bool
+}
+
+var (
+	dexConfigVersionRegexp = regexp.MustCompile(`^v?(\d+)\.(\d+)(\.\d+)?`)
+
+	// The renderer for the latest supported config format, also used for unknown versions
+	latestDexConfigRenderer = dexConfigRenderer{}
+)
+
+// getDexConfigVersion returns the dex config version of the DexServer, derived from the dex image tag when unset
+func getDexConfigVersion(dexServer *authv1alpha1.DexServer) string {
+	if dexServer.Spec.DexConfigVersion != "" {
+		return dexServer.Spec.DexConfigVersion
+	}
+	image, err := getDexImagePullSpec()
+	if err != nil {
+		return ""
+	}
+	return getImageTag(image)
+}
+
+// getImageTag returns the tag of an image pull spec, or "" when the image has no tag
+func getImageTag(image string) string {
+	// Images pinned by digest carry no version
+	image = strings.Split(image, "@")[0]
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return ""
+}
+
+// getImageVersion returns the version of the dex image, its tag or else its digest
+func getImageVersion(image string) string {
+	if tag := getImageTag(image); tag != "" {
+		return tag
+	}
+	if i := strings.LastIndex(image, "@"); i >= 0 {
+		return image[i+1:]
+	}
+	return ""
+}
+
+// getDexConfigRenderer returns the renderer for a dex config version. Only dex v2 config versions are supported;
+// for any other version the latest renderer is returned together with an error.
+func getDexConfigRenderer(version string) (dexConfigRenderer, error) {
+	matches := dexConfigVersionRegexp.FindStringSubmatch(version)
+	if matches == nil {
+		return latestDexConfigRenderer, fmt.Errorf("unknown dex config version %q, rendering the latest config format", version)
+	}
+	major, _ := strconv.Atoi(matches[1])
+	minor, _ := strconv.Atoi(matches[2])
+	if major != 2 {
+		return latestDexConfigRenderer, fmt.Errorf("unsupported dex config version %q, rendering the latest config format", version)
+	}
+	return dexConfigRenderer{
+		singleGroupUserMatcher: minor < 27,
+	}, nil
+}
+
+// renderGroupSearch returns the LDAP group search config in the format of the renderer
+func (c dexConfigRenderer) renderGroupSearch(groupSearch authv1alpha1.GroupSearchSpec) DexGroupSearchSpec {
+	rendered := DexGroupSearchSpec{
+		BaseDN:   groupSearch.BaseDN,
+		Filter:   groupSearch.Filter,
+		Scope:    groupSearch.Scope,
+		NameAttr: groupSearch.NameAttr,
+	}
+	if c.singleGroupUserMatcher {
+		if len(groupSearch.UserMatchers) > 0 {
+			rendered.UserAttr = groupSearch.UserMatchers[0].UserAttr
+			rendered.GroupAttr = groupSearch.UserMatchers[0].GroupAttr
+		}
+	} else {
+		rendered.UserMatchers = groupSearch.UserMatchers
+	}
+	return rendered
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Logger key of the correlation ID of a reconcile
+	RECONCILE_ID_LOG_KEY = "reconcileID"
+)
+
+// reconcileIDKey is the context key of the reconcile correlation ID
+type reconcileIDKey struct{}
+
+// withReconcileID generates a short correlation ID for a reconcile and adds it to the returned context and to its
+// logger, so every log line of the reconcile carries it. Failure condition messages include the same ID via
+// withReconcileIDMessage, so a failed condition can be traced to the log lines of the reconcile that set it.
+func withReconcileID(ctx context.Context) context.Context {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return ctx
+	}
+	reconcileID := hex.EncodeToString(id)
+	log := ctrllog.FromContext(ctx).WithValues(RECONCILE_ID_LOG_KEY, reconcileID)
+	return context.WithValue(ctrllog.IntoContext(ctx, log), reconcileIDKey{}, reconcileID)
+}
+
+// withReconcileIDMessage appends the correlation ID of the reconcile in ctx to a failure condition message
+func withReconcileIDMessage(ctx context.Context, message string) string {
+	reconcileID, ok := ctx.Value(reconcileIDKey{}).(string)
+	if !ok {
+		return message
+	}
+	return fmt.Sprintf("%s (%s: %s)", message, RECONCILE_ID_LOG_KEY, reconcileID)
+}
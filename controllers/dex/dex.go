@@ -25,16 +25,23 @@ import (
 	"google.golang.org/grpc/credentials"
 )
 
+// ErrClientNotFound is returned when dex has no client with the requested id
+var ErrClientNotFound = errors.New("client not found")
+
 // Options keeps some configuration options for Dex client
 type Options struct {
 	// HostAndPort host name and port of gRPC server
 	HostAndPort string
+	// ServerName name the gRPC server certificate is verified against, defaults to the host name of HostAndPort
+	ServerName string
 	// ClientCrt TLS certificate for gRPC client
 	CrtBuffer *bytes.Buffer
 	// ClientKey TLS certificate key for gRPC client
 	KeyBuffer *bytes.Buffer
 	// ClientCA self signed CA certificate for gRPC TLS connection
 	CABuffer *bytes.Buffer
+	// UserAgent prepended to the user-agent of the gRPC calls, identifying the caller in the dex logs
+	UserAgent string
 }
 
 // APIClient represent a client wrapper for Dex
@@ -59,10 +66,15 @@ func NewClientPEM(opts *Options) (*APIClient, error) {
 	clientTLSConfig := &tls.Config{
 		RootCAs:      certPool,
 		Certificates: []tls.Certificate{clientCert},
+		ServerName:   opts.ServerName,
 	}
 	creds := credentials.NewTLS(clientTLSConfig)
 
-	conn, err := grpc.Dial(opts.HostAndPort, grpc.WithTransportCredentials(creds), grpc.WithBlock(), grpc.FailOnNonTempDialError(true))
+	dialOpts := []grpc.DialOption{grpc.WithTransportCredentials(creds), grpc.WithBlock(), grpc.FailOnNonTempDialError(true)}
+	if opts.UserAgent != "" {
+		dialOpts = append(dialOpts, grpc.WithUserAgent(opts.UserAgent))
+	}
+	conn, err := grpc.Dial(opts.HostAndPort, dialOpts...)
 	if err != nil {
 		return nil, errors.Wrapf(err, "opening the gRPC connection with server %q", opts.HostAndPort)
 	}
@@ -145,7 +157,7 @@ func (c *APIClient) DeleteClient(ctx context.Context, id string) error {
 		return errors.Wrapf(err, "failed to delete the client with id %q", id)
 	}
 	if res.NotFound {
-		return fmt.Errorf("delete did not find the client with id %q", id)
+		return errors.Wrapf(ErrClientNotFound, "delete did not find the client with id %q", id)
 	}
 	return nil
 }
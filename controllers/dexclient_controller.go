@@ -21,19 +21,25 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/json"
+	goerrors "errors"
 	"fmt"
+	"strings"
 	"time"
 
+	dexapiv2 "github.com/dexidp/dex/api/v2"
+	"google.golang.org/grpc/metadata"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
@@ -48,12 +54,74 @@ import (
 const (
 	DEX_CLIENT_SECRET_LABEL           = "auth.identitatem.io/dex-client-secret"
 	DEX_CLIENT_SECRET_HASH_ANNOTATION = "auth.identitatem.io/dex-client-secret-hash"
+	// Finalizer deleting the OAuth2 client of a DexClient from dex before the DexClient is removed
+	DEX_CLIENT_FINALIZER = "auth.identitatem.io/oauth2client-cleanup"
+	// Default user-agent of the gRPC calls to dex
+	DEFAULT_GRPC_USER_AGENT = "dex-operator"
+	// gRPC metadata key of the namespace/name of the DexClient a gRPC call is made for
+	GRPC_DEX_CLIENT_METADATA_KEY = "x-dex-operator-dexclient"
 )
 
+// withGRPCClientIdentity adds the namespace/name of the DexClient to the outgoing gRPC metadata of ctx, so that the
+// calls to dex can be attributed to the DexClient they were made for
+func withGRPCClientIdentity(ctx context.Context, dexClient *authv1alpha1.DexClient) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, GRPC_DEX_CLIENT_METADATA_KEY, dexClient.Namespace+"/"+dexClient.Name)
+}
+
+// dexClientAPI is the part of the dex gRPC API used to manage OAuth2 clients
+type dexClientAPI interface {
+	CreateClient(ctx context.Context, redirectUris []string, trustedPeers []string,
+		public bool, name string, id string, logoURL string, secret string) (*dexapiv2.Client, *dexapi.CreateClientError)
+	UpdateClient(ctx context.Context, clientID string, redirectUris []string,
+		trustedPeers []string, public bool, name string, logoURL string) error
+	DeleteClient(ctx context.Context, id string) error
+	CloseConnection() error
+}
+
 // DexClientReconciler reconciles a DexClient object
 type DexClientReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// When true, a DexClient with trusted peers that are not the client ID of a DexClient in its namespace is not
+	// sent to dex. Otherwise the dangling peers are only reported on the TrustedPeersResolved condition, for peers
+	// managed outside of DexClients.
+	RejectDanglingTrustedPeers bool
+	// User-agent of the gRPC calls to dex, so that the dex logs attribute the changes to the OAuth2 clients to the
+	// operator. Defaults to DEFAULT_GRPC_USER_AGENT.
+	GRPCUserAgent string
+	// Label selector of the DexServers whose DexClients are reconciled by this operator instance, the same as the
+	// DexServerReconciler one. When nil, all DexClients are reconciled.
+	LabelSelector labels.Selector
+
+	// Connects to the dex gRPC API, defaults to dialDexAPI with the user-agent
+	dialDexAPI func(mTLSSecret *corev1.Secret, namespace string) (dexClientAPI, error)
+}
+
+// dialDexAPI connects to the gRPC API of the dex in namespace, authenticated with the client certificate of the mTLS
+// secret and trusting its CA. The server certificate is verified against the FQDN of the gRPC service.
+func dialDexAPI(mTLSSecret *corev1.Secret, namespace string, userAgent string) (dexClientAPI, error) {
+	return dexapi.NewClientPEM(&dexapi.Options{
+		HostAndPort: fmt.Sprintf("%s%s", getServiceName(namespace), ":5557"),
+		ServerName:  getServiceName(namespace),
+		CABuffer:    bytes.NewBuffer(mTLSSecret.Data["ca.crt"]),
+		CrtBuffer:   bytes.NewBuffer(mTLSSecret.Data["client.crt"]),
+		KeyBuffer:   bytes.NewBuffer(mTLSSecret.Data["client.key"]),
+		UserAgent:   userAgent,
+	})
+}
+
+func (r *DexClientReconciler) getDexAPI(mTLSSecret *corev1.Secret, namespace string) (dexClientAPI, error) {
+	if r.dialDexAPI != nil {
+		return r.dialDexAPI(mTLSSecret, namespace)
+	}
+	return dialDexAPI(mTLSSecret, namespace, r.getGRPCUserAgent())
+}
+
+func (r *DexClientReconciler) getGRPCUserAgent() string {
+	if r.GRPCUserAgent == "" {
+		return DEFAULT_GRPC_USER_AGENT
+	}
+	return r.GRPCUserAgent
 }
 
 //+kubebuilder:rbac:groups=auth.identitatem.io,resources=dexclients,verbs=get;list;watch;create;update;patch;delete
@@ -73,6 +141,7 @@ type DexClientReconciler struct {
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.8.3/pkg/reconcile
 func (r *DexClientReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx = withReconcileID(ctx)
 	log := ctrllog.FromContext(ctx)
 	log.V(1).Info("Reconciling...")
 
@@ -80,8 +149,34 @@ func (r *DexClientReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	if err := r.Get(ctx, req.NamespacedName, dexv1Client); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	// Identify the DexClient on the gRPC calls made for it
+	ctx = withGRPCClientIdentity(ctx, dexv1Client)
+
+	// A DexClient is finalized even when its DexServer is gone or no longer matches the label selector, otherwise
+	// its deletion is blocked by the finalizer
+	if !dexv1Client.DeletionTimestamp.IsZero() {
+		log.Info("finalizing dexclient", "DexClient.name", dexv1Client.Name, "DexClient.namespace", dexv1Client.Namespace)
+		return r.finalizeDexClient(dexv1Client, ctx)
+	}
+
+	// With sharded operator instances, only the instance reconciling the DexServer calls its gRPC API
+	selected, err := r.isDexServerSelected(dexv1Client, ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !selected {
+		log.V(1).Info("DexServer of the DexClient does not match the label selector... skip reconcile")
+		return ctrl.Result{}, nil
+	}
 
 	log.Info("found dexclient", "DexClient.name", dexv1Client.Name, "DexClient.namespace", dexv1Client.Namespace)
+	// Delete the OAuth2 client from dex before the DexClient is removed
+	if !controllerutil.ContainsFinalizer(dexv1Client, DEX_CLIENT_FINALIZER) {
+		controllerutil.AddFinalizer(dexv1Client, DEX_CLIENT_FINALIZER)
+		if err := r.Update(ctx, dexv1Client); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 
 	// If dex server and dex client are created at the same time, we may need to wait a few seconds for dex server reconciler
 	// to create the mtls certs
@@ -104,7 +199,7 @@ func (r *DexClientReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 				Type:    authv1alpha1.DexClientConditionTypeApplied,
 				Status:  metav1.ConditionFalse,
 				Reason:  "MTLSSecretCheckFailed",
-				Message: fmt.Sprintf("failed checking MTLS secret. error: %s", err.Error()),
+				Message: withReconcileIDMessage(ctx, fmt.Sprintf("failed checking MTLS secret. error: %s", err.Error())),
 			}
 			if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
 				return ctrl.Result{}, err
@@ -113,22 +208,18 @@ func (r *DexClientReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		}
 	}
 
-	// Fetch the mTLS client cert and create the grpc client
+	// The objects the DexClient is tied to, persisted with the next status update
+	dexv1Client.Status.RelatedObjects = getDexClientRelatedObjects(dexv1Client, mTLSSecret)
 
-	dexApiOptions := &dexapi.Options{
-		HostAndPort: fmt.Sprintf("%s.%s.%s%s", GRPC_SERVICE_NAME, dexv1Client.Namespace, "svc.cluster.local", ":5557"),
-		CABuffer:    bytes.NewBuffer(mTLSSecret.Data["ca.crt"]),
-		CrtBuffer:   bytes.NewBuffer(mTLSSecret.Data["client.crt"]),
-		KeyBuffer:   bytes.NewBuffer(mTLSSecret.Data["client.key"]),
-	}
-	dexApiClient, err := dexapi.NewClientPEM(dexApiOptions)
+	// Fetch the mTLS client cert and create the grpc client
+	dexApiClient, err := r.getDexAPI(mTLSSecret, dexv1Client.Namespace)
 	if err != nil {
 		log.Error(err, "Failed to create api client connection to gRPC server", "client", dexv1Client.Name)
 		cond := metav1.Condition{
 			Type:    authv1alpha1.DexClientConditionTypeApplied,
 			Status:  metav1.ConditionFalse,
 			Reason:  "GRPCConnectionFailed",
-			Message: fmt.Sprintf("failed creating api client connection to gRPC server. error: %s", err.Error()),
+			Message: withReconcileIDMessage(ctx, fmt.Sprintf("failed creating api client connection to gRPC server. error: %s", err.Error())),
 		}
 		if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
 			return ctrl.Result{}, err
@@ -138,32 +229,114 @@ func (r *DexClientReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 
 	defer dexApiClient.CloseConnection()
 
+	// Resolve the client IDs of the DexClients referenced as trusted peers
+	trustedPeers, danglingRefs, err := r.resolveTrustedPeers(dexv1Client, ctx)
+	if err != nil {
+		log.Error(err, "Error resolving trusted peers", "client", dexv1Client.Name)
+		return ctrl.Result{}, err
+	}
+	danglingPeers, err := r.getDanglingTrustedPeers(dexv1Client, ctx)
+	if err != nil {
+		log.Error(err, "Error checking trusted peers", "client", dexv1Client.Name)
+		return ctrl.Result{}, err
+	}
+	trustedPeersCond := trustedPeersResolvedCondition(danglingRefs, danglingPeers)
+	if err := r.updateDexClientStatusConditions(dexv1Client, ctx, trustedPeersCond); err != nil {
+		return ctrl.Result{}, err
+	}
+	if len(danglingPeers) > 0 && r.RejectDanglingTrustedPeers {
+		// Retried when a DexClient with one of the dangling client IDs is created
+		log.Info("rejecting dangling trusted peers", "client", dexv1Client.Name, "danglingPeers", danglingPeers)
+		cond := metav1.Condition{
+			Type:    authv1alpha1.DexClientConditionTypeApplied,
+			Status:  metav1.ConditionFalse,
+			Reason:  "TrustedPeerNotFound",
+			Message: trustedPeersCond.Message,
+		}
+		if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
 	hasClientSecretBeenUpdated, err := r.hasClientSecretBeenUpdated(dexv1Client, ctx)
 
 	if !isOAuth2ClientCreated(dexv1Client.Status.Conditions) {
 		// Create a new OAuth2Client
-		r.CreateOAuth2Client(dexApiClient, dexv1Client, ctx)
-	} else {
-		if hasClientSecretBeenUpdated { // If the client secret has been updated, we will need to delete and recreate the OAuth2Client (since the dex API for UpdateClient does not accept the secret for updating)
-			// Delete OAuth2Client
-			r.DeleteOAuth2Client(dexApiClient, dexv1Client, ctx)
+		return r.CreateOAuth2Client(dexApiClient, dexv1Client, trustedPeers, ctx)
+	}
+	if hasClientSecretBeenUpdated { // If the client secret has been updated, we will need to delete and recreate the OAuth2Client (since the dex API for UpdateClient does not accept the secret for updating)
+		// Delete OAuth2Client
+		if result, err := r.DeleteOAuth2Client(dexApiClient, dexv1Client, ctx); err != nil {
+			return result, err
+		}
+
+		// Recreate a OAuth2Client
+		return r.CreateOAuth2Client(dexApiClient, dexv1Client, trustedPeers, ctx)
+	}
+	// Update Oauth2Client
+	return r.UpdateOAuth2Client(dexApiClient, dexv1Client, trustedPeers, ctx)
+}
+
+// finalizeDexClient deletes the OAuth2 client of a deleted DexClient from dex and then removes the finalizer. When
+// the mTLS secret is gone, the DexServer and its storage were removed with it and there is nothing to delete.
+func (r *DexClientReconciler) finalizeDexClient(dexv1Client *authv1alpha1.DexClient, ctx context.Context) (ctrl.Result, error) {
+	log := ctrllog.FromContext(ctx)
+	if !controllerutil.ContainsFinalizer(dexv1Client, DEX_CLIENT_FINALIZER) {
+		return ctrl.Result{}, nil
+	}
 
-			// Recreate a OAuth2Client
-			r.CreateOAuth2Client(dexApiClient, dexv1Client, ctx)
+	if isOAuth2ClientCreated(dexv1Client.Status.Conditions) {
+		mTLSSecret, err := r.getMTLSSecret(dexv1Client, ctx)
+		if err != nil && !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		if err == nil {
+			dexApiClient, err := r.getDexAPI(mTLSSecret, dexv1Client.Namespace)
+			if err != nil {
+				log.Error(err, "Failed to create api client connection to gRPC server", "client", dexv1Client.Name)
+				cond := metav1.Condition{
+					Type:    authv1alpha1.DexClientConditionTypeOAuth2ClientCreated,
+					Status:  metav1.ConditionTrue,
+					Reason:  "DeleteFailed",
+					Message: withReconcileIDMessage(ctx, fmt.Sprintf("failed creating api client connection to gRPC server. error: %s", err.Error())),
+				}
+				if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
+					return ctrl.Result{}, err
+				}
+				return ctrl.Result{}, err
+			}
+			defer dexApiClient.CloseConnection()
+			if result, err := r.DeleteOAuth2Client(dexApiClient, dexv1Client, ctx); err != nil {
+				cond := metav1.Condition{
+					Type:    authv1alpha1.DexClientConditionTypeOAuth2ClientCreated,
+					Status:  metav1.ConditionTrue,
+					Reason:  "DeleteFailed",
+					Message: withReconcileIDMessage(ctx, fmt.Sprintf("failed deleting client. error: %s", err.Error())),
+				}
+				if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
+					return ctrl.Result{}, err
+				}
+				return result, err
+			}
 		} else {
-			// Update Oauth2Client
-			r.UpdateOAuth2Client(dexApiClient, dexv1Client, ctx)
+			log.Info("mtls secret not found, the dex storage is gone", "client", dexv1Client.Name)
 		}
 	}
+
+	controllerutil.RemoveFinalizer(dexv1Client, DEX_CLIENT_FINALIZER)
+	if err := r.Update(ctx, dexv1Client); err != nil {
+		return ctrl.Result{}, err
+	}
 	return ctrl.Result{}, nil
 }
 
-func (r *DexClientReconciler) CreateOAuth2Client(dexApiClient *dexapi.APIClient, dexv1Client *authv1alpha1.DexClient, ctx context.Context) (ctrl.Result, error) {
+func (r *DexClientReconciler) CreateOAuth2Client(dexApiClient dexClientAPI, dexv1Client *authv1alpha1.DexClient, trustedPeers []string, ctx context.Context) (ctrl.Result, error) {
 	log := ctrllog.FromContext(ctx)
 
 	log.Info("Creating dex client", "name", dexv1Client.Name,
 		"redirectURIs", dexv1Client.Spec.RedirectURIs,
-		"TrustedPeers", dexv1Client.Spec.TrustedPeers,
+		"TrustedPeers", trustedPeers,
 		"Public", dexv1Client.Spec.Public,
 		"ClientID", dexv1Client.Spec.ClientID,
 		"LogoURL", dexv1Client.Spec.LogoURL,
@@ -178,7 +351,7 @@ func (r *DexClientReconciler) CreateOAuth2Client(dexApiClient *dexapi.APIClient,
 			Type:    authv1alpha1.DexClientConditionTypeApplied,
 			Status:  metav1.ConditionFalse,
 			Reason:  "DexClientSecretFailed",
-			Message: fmt.Sprintf("failed getting client secret. error: %s", err.Error()),
+			Message: withReconcileIDMessage(ctx, fmt.Sprintf("failed getting client secret. error: %s", err.Error())),
 		}
 		if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
 			return ctrl.Result{}, err
@@ -190,12 +363,12 @@ func (r *DexClientReconciler) CreateOAuth2Client(dexApiClient *dexapi.APIClient,
 	res, createClientError := dexApiClient.CreateClient(
 		ctx,
 		dexv1Client.Spec.RedirectURIs,
-		dexv1Client.Spec.TrustedPeers,
+		trustedPeers,
 		dexv1Client.Spec.Public,
 		dexv1Client.Name,
 		dexv1Client.Spec.ClientID,
 		dexv1Client.Spec.LogoURL,
-		dexclientclientSecret,
+		dexclientclientSecret.Reveal(),
 	)
 	if createClientError != nil {
 		if createClientError.AlreadyExists {
@@ -212,13 +385,20 @@ func (r *DexClientReconciler) CreateOAuth2Client(dexApiClient *dexapi.APIClient,
 			return ctrl.Result{Requeue: true}, nil
 		} else {
 			log.Error(createClientError.ApiError, "Client create failed", "client", dexv1Client.Name)
-			cond := metav1.Condition{
+			message := withReconcileIDMessage(ctx, fmt.Sprintf("failed creating client. error: %s", createClientError.ApiError.Error()))
+			condApplied := metav1.Condition{
 				Type:    authv1alpha1.DexClientConditionTypeApplied,
 				Status:  metav1.ConditionFalse,
 				Reason:  "DexClientCreateFailed",
-				Message: fmt.Sprintf("failed creating client. error: %s", createClientError.ApiError.Error()),
+				Message: message,
 			}
-			if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
+			condOauth := metav1.Condition{
+				Type:    authv1alpha1.DexClientConditionTypeOAuth2ClientCreated,
+				Status:  metav1.ConditionFalse,
+				Reason:  "CreateFailed",
+				Message: message,
+			}
+			if err := r.updateDexClientStatusConditions(dexv1Client, ctx, condApplied, condOauth); err != nil {
 				return ctrl.Result{}, err
 			}
 			return ctrl.Result{}, createClientError.ApiError
@@ -244,7 +424,7 @@ func (r *DexClientReconciler) CreateOAuth2Client(dexApiClient *dexapi.APIClient,
 	return ctrl.Result{}, nil
 }
 
-func (r *DexClientReconciler) UpdateOAuth2Client(dexApiClient *dexapi.APIClient, dexv1Client *authv1alpha1.DexClient, ctx context.Context) (ctrl.Result, error) {
+func (r *DexClientReconciler) UpdateOAuth2Client(dexApiClient dexClientAPI, dexv1Client *authv1alpha1.DexClient, trustedPeers []string, ctx context.Context) (ctrl.Result, error) {
 	log := ctrllog.FromContext(ctx)
 	// Update Client
 	log.Info("Client update", "client ID", dexv1Client.Name)
@@ -252,7 +432,7 @@ func (r *DexClientReconciler) UpdateOAuth2Client(dexApiClient *dexapi.APIClient,
 		ctx,
 		dexv1Client.Spec.ClientID,
 		dexv1Client.Spec.RedirectURIs,
-		dexv1Client.Spec.TrustedPeers,
+		trustedPeers,
 		dexv1Client.Spec.Public,
 		dexv1Client.Name,
 		dexv1Client.Spec.LogoURL,
@@ -263,7 +443,7 @@ func (r *DexClientReconciler) UpdateOAuth2Client(dexApiClient *dexapi.APIClient,
 			Type:    authv1alpha1.DexClientConditionTypeApplied,
 			Status:  metav1.ConditionFalse,
 			Reason:  "DexClientUpdateFailed",
-			Message: fmt.Sprintf("failed updating client. error: %s", err.Error()),
+			Message: withReconcileIDMessage(ctx, fmt.Sprintf("failed updating client. error: %s", err.Error())),
 		}
 		if err := r.updateDexClientStatusConditions(dexv1Client, ctx, cond); err != nil {
 			return ctrl.Result{}, err
@@ -284,7 +464,7 @@ func (r *DexClientReconciler) UpdateOAuth2Client(dexApiClient *dexapi.APIClient,
 	return ctrl.Result{}, nil
 }
 
-func (r *DexClientReconciler) DeleteOAuth2Client(dexApiClient *dexapi.APIClient, dexv1Client *authv1alpha1.DexClient, ctx context.Context) (ctrl.Result, error) {
+func (r *DexClientReconciler) DeleteOAuth2Client(dexApiClient dexClientAPI, dexv1Client *authv1alpha1.DexClient, ctx context.Context) (ctrl.Result, error) {
 	log := ctrllog.FromContext(ctx)
 	// Delete Client
 	log.Info("Client delete", "client ID", dexv1Client.Name)
@@ -292,6 +472,10 @@ func (r *DexClientReconciler) DeleteOAuth2Client(dexApiClient *dexapi.APIClient,
 		ctx,
 		dexv1Client.Spec.ClientID,
 	)
+	if goerrors.Is(err, dexapi.ErrClientNotFound) {
+		log.Info("Client already deleted", "client ID", dexv1Client.Name)
+		return ctrl.Result{}, nil
+	}
 	if err != nil {
 		log.Error(err, "Client deletion failed", "client", dexv1Client.Name)
 		return ctrl.Result{}, err
@@ -377,6 +561,83 @@ func (r *DexClientReconciler) hasClientSecretBeenUpdated(dexv1Client *authv1alph
 	return false, nil
 }
 
+// Resolve the trusted peers of a DexClient: the client IDs in TrustedPeers plus the client IDs of the DexClients
+// referenced by TrustedPeerRefs. The names of referenced DexClients that do not exist are returned separately.
+func (r *DexClientReconciler) resolveTrustedPeers(dexv1Client *authv1alpha1.DexClient, ctx context.Context) ([]string, []string, error) {
+	trustedPeers := []string{}
+	seen := map[string]bool{}
+	addPeer := func(clientID string) {
+		if !seen[clientID] {
+			seen[clientID] = true
+			trustedPeers = append(trustedPeers, clientID)
+		}
+	}
+	for _, clientID := range dexv1Client.Spec.TrustedPeers {
+		addPeer(clientID)
+	}
+
+	danglingRefs := []string{}
+	for _, ref := range dexv1Client.Spec.TrustedPeerRefs {
+		peer := &authv1alpha1.DexClient{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: dexv1Client.Namespace}, peer); err != nil {
+			if kubeerrors.IsNotFound(err) {
+				danglingRefs = append(danglingRefs, ref.Name)
+				continue
+			}
+			return nil, nil, err
+		}
+		addPeer(peer.Spec.ClientID)
+	}
+	return trustedPeers, danglingRefs, nil
+}
+
+// getDanglingTrustedPeers returns the client IDs in the TrustedPeers of a DexClient that are not the client ID of
+// a DexClient in its namespace. Dex accepts them, but the trust is silently broken.
+func (r *DexClientReconciler) getDanglingTrustedPeers(dexv1Client *authv1alpha1.DexClient, ctx context.Context) ([]string, error) {
+	danglingPeers := []string{}
+	if len(dexv1Client.Spec.TrustedPeers) == 0 {
+		return danglingPeers, nil
+	}
+	dexClients := &authv1alpha1.DexClientList{}
+	if err := r.List(ctx, dexClients, client.InNamespace(dexv1Client.Namespace)); err != nil {
+		return nil, err
+	}
+	clientIDs := map[string]bool{}
+	for _, dexClient := range dexClients.Items {
+		clientIDs[dexClient.Spec.ClientID] = true
+	}
+	for _, clientID := range dexv1Client.Spec.TrustedPeers {
+		if !clientIDs[clientID] {
+			danglingPeers = append(danglingPeers, clientID)
+		}
+	}
+	return danglingPeers, nil
+}
+
+func trustedPeersResolvedCondition(danglingRefs []string, danglingPeers []string) metav1.Condition {
+	messages := []string{}
+	if len(danglingRefs) > 0 {
+		messages = append(messages, fmt.Sprintf("referenced trusted peer DexClients not found: %s", strings.Join(danglingRefs, ", ")))
+	}
+	if len(danglingPeers) > 0 {
+		messages = append(messages, fmt.Sprintf("trusted peer client IDs without a DexClient: %s", strings.Join(danglingPeers, ", ")))
+	}
+	if len(messages) > 0 {
+		return metav1.Condition{
+			Type:    authv1alpha1.DexClientConditionTypeTrustedPeersResolved,
+			Status:  metav1.ConditionFalse,
+			Reason:  "TrustedPeerNotFound",
+			Message: strings.Join(messages, "; "),
+		}
+	}
+	return metav1.Condition{
+		Type:    authv1alpha1.DexClientConditionTypeTrustedPeersResolved,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Resolved",
+		Message: "all trusted peers are resolved",
+	}
+}
+
 func isOAuth2ClientCreated(conditions []metav1.Condition) bool {
 	for _, condition := range conditions {
 		if condition.Type == authv1alpha1.DexClientConditionTypeOAuth2ClientCreated {
@@ -386,8 +647,31 @@ func isOAuth2ClientCreated(conditions []metav1.Condition) bool {
 	return false
 }
 
+// getDexClientRelatedObjects returns the DexServer the OAuth2 client of a DexClient is registered with, named by the
+// app label of its mTLS secret, and the secret holding the client secret
+func getDexClientRelatedObjects(dexClient *authv1alpha1.DexClient, mTLSSecret *corev1.Secret) []authv1alpha1.RelatedObjectReference {
+	relatedObjects := []authv1alpha1.RelatedObjectReference{}
+	if dexServerName := mTLSSecret.Labels["app"]; dexServerName != "" {
+		relatedObjects = append(relatedObjects, authv1alpha1.RelatedObjectReference{
+			APIVersion: authv1alpha1.GroupVersion.String(),
+			Kind:       "DexServer",
+			Name:       dexServerName,
+			Namespace:  dexClient.Namespace,
+		})
+	}
+	if secretRef := dexClient.Spec.ClientSecretRef; secretRef.Name != "" {
+		relatedObjects = append(relatedObjects, authv1alpha1.RelatedObjectReference{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Secret",
+			Name:       secretRef.Name,
+			Namespace:  secretRef.Namespace,
+		})
+	}
+	return relatedObjects
+}
+
 func (r *DexClientReconciler) updateDexClientStatusConditions(dexClient *authv1alpha1.DexClient, ctx context.Context, newConditions ...metav1.Condition) error {
-	dexClient.Status.Conditions = mergeStatusConditions(dexClient.Status.Conditions, newConditions...)
+	dexClient.Status.Conditions = mergeStatusConditions(dexClient.Status.Conditions, dexClient.Generation, newConditions...)
 	return r.Client.Status().Update(ctx, dexClient)
 }
 
@@ -401,8 +685,9 @@ func (r *DexClientReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		UpdateFunc: func(e event.UpdateEvent) bool {
 			dexClientOld := e.ObjectOld.(*authv1alpha1.DexClient)
 			dexClientNew := e.ObjectNew.(*authv1alpha1.DexClient)
-			// only handle the Finalizer and Spec changes
-			return !equality.Semantic.DeepEqual(e.ObjectOld.GetFinalizers(), e.ObjectNew.GetFinalizers()) ||
+			// only handle the deletion, Finalizer and Spec changes
+			return !equality.Semantic.DeepEqual(e.ObjectOld.GetDeletionTimestamp(), e.ObjectNew.GetDeletionTimestamp()) ||
+				!equality.Semantic.DeepEqual(e.ObjectOld.GetFinalizers(), e.ObjectNew.GetFinalizers()) ||
 				!equality.Semantic.DeepEqual(dexClientOld.Spec, dexClientNew.Spec)
 
 		},
@@ -419,7 +704,7 @@ func (r *DexClientReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		},
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&authv1alpha1.DexClient{}, builder.WithPredicates(dexClientPredicate)).
 		Owns(&corev1.Secret{}).
 		Watches(&source.Kind{Type: &corev1.Secret{}}, // Since the client secrets for Dex Clients are not generated by this controller, updates to them will not trigger the reconcile loop. We need map them to a resource (dex client) that is managed by this controller.
@@ -440,7 +725,53 @@ func (r *DexClientReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				return requests // Events from the watched secrets mapped to the DexClient resource
 			}),
 			builder.WithPredicates(clientSecretPredicate)). // Predicate to ensure we're only watching secrets that have the label "auth.identitatem.io/dex-client-secret" on them
-		Complete(r)
+		// Reconcile the DexClients that reference a changed DexClient as trusted peer, so they pick up its client ID.
+		// Only its creation, deletion and spec changes matter, its status updates would enqueue the referrers in a loop.
+		Watches(&source.Kind{Type: &authv1alpha1.DexClient{}},
+			handler.EnqueueRequestsFromMapFunc(func(a client.Object) []reconcile.Request {
+				var dexClientList authv1alpha1.DexClientList
+				_ = mgr.GetClient().List(context.TODO(), &dexClientList, client.InNamespace(a.GetNamespace()))
+				peerClientID := ""
+				if peer, ok := a.(*authv1alpha1.DexClient); ok {
+					peerClientID = peer.Spec.ClientID
+				}
+				return getTrustedPeerReferrers(dexClientList.Items, a.GetName(), peerClientID)
+			}),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}))
+	// Reconcile the DexClients of a DexServer that starts matching the label selector, they were skipped until then
+	if r.LabelSelector != nil && !r.LabelSelector.Empty() {
+		b = b.Watches(&source.Kind{Type: &authv1alpha1.DexServer{}},
+			handler.EnqueueRequestsFromMapFunc(func(a client.Object) []reconcile.Request {
+				var dexClientList authv1alpha1.DexClientList
+				_ = mgr.GetClient().List(context.TODO(), &dexClientList, client.InNamespace(a.GetNamespace()))
+				requests := []reconcile.Request{}
+				for _, dexClient := range dexClientList.Items {
+					requests = append(requests, reconcile.Request{
+						NamespacedName: types.NamespacedName{Name: dexClient.Name, Namespace: dexClient.Namespace},
+					})
+				}
+				return requests
+			}),
+			builder.WithPredicates(dexServerSelectedPredicate(r.LabelSelector)))
+	}
+	return b.Complete(r)
+}
+
+// isDexServerSelected returns true if the DexServer of the DexClient matches the label selector. The DexServer is the
+// one named by the app label of the mTLS secret of the namespace. Until that secret exists the DexClient only waits
+// for it, and once it is gone there is no dex left to call, so any instance may reconcile the DexClient.
+func (r *DexClientReconciler) isDexServerSelected(dexClient *authv1alpha1.DexClient, ctx context.Context) (bool, error) {
+	if r.LabelSelector == nil || r.LabelSelector.Empty() {
+		return true, nil
+	}
+	mTLSSecret, err := r.getMTLSSecret(dexClient, ctx)
+	if err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return isDexServerSelected(r.Client, r.LabelSelector, dexClient.Namespace, mTLSSecret.Labels["app"], ctx)
 }
 
 func (r *DexClientReconciler) getMTLSSecret(m *authv1alpha1.DexClient, ctx context.Context) (*corev1.Secret, error) {
@@ -459,7 +790,8 @@ func (r *DexClientReconciler) getMTLSSecret(m *authv1alpha1.DexClient, ctx conte
 	return resource, nil
 }
 
-func (r *DexClientReconciler) getClientClientSecretFromRef(m *authv1alpha1.DexClient, ctx context.Context) (string, error) {
+// getClientClientSecretFromRef returns the OAuth2 client secret of a DexClient, redacted when printed or logged
+func (r *DexClientReconciler) getClientClientSecretFromRef(m *authv1alpha1.DexClient, ctx context.Context) (secretString, error) {
 	log := ctrllog.FromContext(ctx)
 	secretName := m.Spec.ClientSecretRef.Name
 	secretNamespace := m.Spec.ClientSecretRef.Namespace
@@ -476,7 +808,31 @@ func (r *DexClientReconciler) getClientClientSecretFromRef(m *authv1alpha1.DexCl
 	log.Info("retrieve clientSecret in ", "secretName", secretName, "secretNamespace", "secretNamespace")
 	if secret, ok := resource.Data["clientSecret"]; ok {
 		log.Info("found clientSecret in ", "secretName", secretName, "secretNamespace", "secretNamespace")
-		return string(secret), nil
+		return secretString(secret), nil
 	}
 	return "", fmt.Errorf("secret %s/%s doesn't contain the data clientSecret", secretNamespace, secretName)
 }
+
+// Return requests for the DexClients that reference the DexClient peerName in their TrustedPeerRefs, or its client
+// ID peerClientID in their TrustedPeers
+func getTrustedPeerReferrers(dexClients []authv1alpha1.DexClient, peerName string, peerClientID string) []reconcile.Request {
+	var requests = []reconcile.Request{}
+	for _, dexClient := range dexClients {
+		references := false
+		for _, ref := range dexClient.Spec.TrustedPeerRefs {
+			references = references || ref.Name == peerName
+		}
+		for _, clientID := range dexClient.Spec.TrustedPeers {
+			references = references || (peerClientID != "" && clientID == peerClientID)
+		}
+		if references {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      dexClient.Name,
+					Namespace: dexClient.Namespace,
+				},
+			})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,378 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	dexapiv2 "github.com/dexidp/dex/api/v2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/metadata"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+	dexapi "github.com/identitatem/dex-operator/controllers/dex"
+)
+
+// fakeDexClientAPI records the OAuth2 clients managed through the dex gRPC API
+type fakeDexClientAPI struct {
+	clients   map[string]*dexapiv2.Client
+	createErr error
+	// Outgoing gRPC metadata of the last CreateClient call
+	createMetadata metadata.MD
+}
+
+func (f *fakeDexClientAPI) CreateClient(ctx context.Context, redirectUris []string, trustedPeers []string,
+	public bool, name string, id string, logoURL string, secret string) (*dexapiv2.Client, *dexapi.CreateClientError) {
+	f.createMetadata, _ = metadata.FromOutgoingContext(ctx)
+	if f.createErr != nil {
+		return nil, &dexapi.CreateClientError{ApiError: f.createErr}
+	}
+	if _, ok := f.clients[id]; ok {
+		return nil, &dexapi.CreateClientError{ApiError: fmt.Errorf("client %q already exists", id), AlreadyExists: true}
+	}
+	f.clients[id] = &dexapiv2.Client{Id: id, Secret: secret, RedirectUris: redirectUris, TrustedPeers: trustedPeers,
+		Public: public, Name: name, LogoUrl: logoURL}
+	return f.clients[id], nil
+}
+
+func (f *fakeDexClientAPI) UpdateClient(ctx context.Context, clientID string, redirectUris []string,
+	trustedPeers []string, public bool, name string, logoURL string) error {
+	c, ok := f.clients[clientID]
+	if !ok {
+		return fmt.Errorf("update did not find the client with id %q", clientID)
+	}
+	c.RedirectUris, c.TrustedPeers, c.Name, c.LogoUrl = redirectUris, trustedPeers, name, logoURL
+	return nil
+}
+
+func (f *fakeDexClientAPI) DeleteClient(ctx context.Context, id string) error {
+	if _, ok := f.clients[id]; !ok {
+		return errors.Wrapf(dexapi.ErrClientNotFound, "delete did not find the client with id %q", id)
+	}
+	delete(f.clients, id)
+	return nil
+}
+
+func (f *fakeDexClientAPI) CloseConnection() error {
+	return nil
+}
+
+// reconcileTestDexClient reconciles the DexClient name and returns it, or nil once it is deleted
+func reconcileTestDexClient(r *DexClientReconciler, name string) (*authv1alpha1.DexClient, error) {
+	_, reconcileErr := r.Reconcile(context.TODO(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Name: name, Namespace: testDexServerNamespace},
+	})
+	dexClient := &authv1alpha1.DexClient{}
+	if err := r.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: testDexServerNamespace}, dexClient); err != nil {
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+		return nil, reconcileErr
+	}
+	return dexClient, reconcileErr
+}
+
+// newTestDexClient returns a DexClient in the test namespace with the given client ID
+func newTestDexClient(name string, clientID string) *authv1alpha1.DexClient {
+	return &authv1alpha1.DexClient{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testDexServerNamespace,
+		},
+		Spec: authv1alpha1.DexClientSpec{
+			ClientID: clientID,
+		},
+	}
+}
+
+// newTestDexClientReconciler returns a DexClientReconciler backed by a fake client seeded with objs
+func newTestDexClientReconciler(objs ...client.Object) *DexClientReconciler {
+	scheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	Expect(authv1alpha1.AddToScheme(scheme)).To(Succeed())
+
+	return &DexClientReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(),
+		Scheme: scheme,
+	}
+}
+
+var _ = Describe("DexClient trusted peers", func() {
+	It("resolves the client IDs of referenced DexClients", func() {
+		dexClient := newTestDexClient("app", "app-client")
+		dexClient.Spec.TrustedPeers = []string{"raw-peer", "peer-client"}
+		dexClient.Spec.TrustedPeerRefs = []corev1.LocalObjectReference{{Name: "peer"}, {Name: "missing"}}
+		r := newTestDexClientReconciler(dexClient, newTestDexClient("peer", "peer-client"))
+
+		trustedPeers, danglingRefs, err := r.resolveTrustedPeers(dexClient, context.TODO())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trustedPeers).To(Equal([]string{"raw-peer", "peer-client"}))
+		Expect(danglingRefs).To(Equal([]string{"missing"}))
+
+		danglingPeers, err := r.getDanglingTrustedPeers(dexClient, context.TODO())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(danglingPeers).To(Equal([]string{"raw-peer"}))
+
+		cond := trustedPeersResolvedCondition(danglingRefs, danglingPeers)
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("TrustedPeerNotFound"))
+		Expect(cond.Message).To(ContainSubstring("missing"))
+		Expect(cond.Message).To(ContainSubstring("raw-peer"))
+	})
+
+	It("follows client ID changes of referenced DexClients", func() {
+		dexClient := newTestDexClient("app", "app-client")
+		dexClient.Spec.TrustedPeerRefs = []corev1.LocalObjectReference{{Name: "peer"}}
+		peer := newTestDexClient("peer", "peer-client")
+		r := newTestDexClientReconciler(dexClient, peer)
+
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: "peer", Namespace: testDexServerNamespace}, peer)).To(Succeed())
+		peer.Spec.ClientID = "renamed-peer-client"
+		Expect(r.Update(context.TODO(), peer)).To(Succeed())
+
+		trustedPeers, danglingRefs, err := r.resolveTrustedPeers(dexClient, context.TODO())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trustedPeers).To(Equal([]string{"renamed-peer-client"}))
+		Expect(danglingRefs).To(BeEmpty())
+		Expect(trustedPeersResolvedCondition(danglingRefs, nil).Status).To(Equal(metav1.ConditionTrue))
+
+		By("enqueueing the referencing DexClient when the peer changes")
+		requests := getTrustedPeerReferrers([]authv1alpha1.DexClient{*dexClient, *peer}, "peer", "renamed-peer-client")
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Name).To(Equal("app"))
+	})
+
+	It("enqueues the DexClients that trust a client ID when a DexClient with it appears", func() {
+		dexClient := newTestDexClient("app", "app-client")
+		dexClient.Spec.TrustedPeers = []string{"peer-client"}
+		peer := newTestDexClient("peer", "peer-client")
+
+		requests := getTrustedPeerReferrers([]authv1alpha1.DexClient{*dexClient, *peer}, "peer", "peer-client")
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Name).To(Equal("app"))
+	})
+})
+
+var _ = Describe("DexClient OAuth2 client", func() {
+	var dexAPI *fakeDexClientAPI
+	var r *DexClientReconciler
+
+	BeforeEach(func() {
+		dexClient := newTestDexClient("app", "app-client")
+		dexClient.Spec.ClientSecretRef = corev1.SecretReference{Name: "app-secret", Namespace: testDexServerNamespace}
+		dexClient.Spec.RedirectURIs = []string{"https://app.example.com/callback"}
+		r = newTestDexClientReconciler(dexClient,
+			newTestSecret("app-secret", map[string]string{"clientSecret": "s3cr3t"}),
+			newTestSecret(SECRET_MTLS_NAME, map[string]string{"ca.crt": "ca", "client.crt": "crt", "client.key": "key"}))
+		dexAPI = &fakeDexClientAPI{clients: map[string]*dexapiv2.Client{}}
+		r.dialDexAPI = func(mTLSSecret *corev1.Secret, namespace string) (dexClientAPI, error) {
+			Expect(string(mTLSSecret.Data["client.crt"])).To(Equal("crt"))
+			Expect(namespace).To(Equal(testDexServerNamespace))
+			return dexAPI, nil
+		}
+	})
+
+	It("creates the OAuth2 client and deletes it through the finalizer", func() {
+		dexClient, err := reconcileTestDexClient(r, "app")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexClient.Finalizers).To(ContainElement(DEX_CLIENT_FINALIZER))
+		Expect(meta.IsStatusConditionTrue(dexClient.Status.Conditions, authv1alpha1.DexClientConditionTypeOAuth2ClientCreated)).To(BeTrue())
+		Expect(dexAPI.clients).To(HaveKey("app-client"))
+		Expect(dexAPI.clients["app-client"].Secret).To(Equal("s3cr3t"))
+		Expect(dexAPI.clients["app-client"].RedirectUris).To(Equal([]string{"https://app.example.com/callback"}))
+		Expect(dexAPI.createMetadata.Get(GRPC_DEX_CLIENT_METADATA_KEY)).To(Equal([]string{testDexServerNamespace + "/app"}))
+
+		By("updating the OAuth2 client on changes")
+		dexClient.Spec.RedirectURIs = []string{"https://app.example.com/oauth/callback"}
+		Expect(r.Update(context.TODO(), dexClient)).To(Succeed())
+		_, err = reconcileTestDexClient(r, "app")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexAPI.clients["app-client"].RedirectUris).To(Equal([]string{"https://app.example.com/oauth/callback"}))
+
+		By("deleting the OAuth2 client with the DexClient")
+		Expect(r.Delete(context.TODO(), dexClient)).To(Succeed())
+		dexClient, err = reconcileTestDexClient(r, "app")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexClient).To(BeNil())
+		Expect(dexAPI.clients).NotTo(HaveKey("app-client"))
+	})
+
+	It("reports the DexServer and the client secret as related objects", func() {
+		mTLSSecret := &corev1.Secret{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: SECRET_MTLS_NAME, Namespace: testDexServerNamespace}, mTLSSecret)).To(Succeed())
+		mTLSSecret.Labels = map[string]string{"app": testDexServerName}
+		Expect(r.Update(context.TODO(), mTLSSecret)).To(Succeed())
+
+		dexClient, err := reconcileTestDexClient(r, "app")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexClient.Status.RelatedObjects).To(Equal([]authv1alpha1.RelatedObjectReference{
+			{APIVersion: "auth.identitatem.io/v1alpha1", Kind: "DexServer", Name: testDexServerName, Namespace: testDexServerNamespace},
+			{APIVersion: "v1", Kind: "Secret", Name: "app-secret", Namespace: testDexServerNamespace},
+		}))
+	})
+
+	It("removes the finalizer when the OAuth2 client is already gone", func() {
+		_, err := reconcileTestDexClient(r, "app")
+		Expect(err).NotTo(HaveOccurred())
+		delete(dexAPI.clients, "app-client")
+
+		dexClient := &authv1alpha1.DexClient{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: "app", Namespace: testDexServerNamespace}, dexClient)).To(Succeed())
+		Expect(r.Delete(context.TODO(), dexClient)).To(Succeed())
+		dexClient, err = reconcileTestDexClient(r, "app")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexClient).To(BeNil())
+	})
+
+	It("passes the trusted peers to the OAuth2 client", func() {
+		Expect(r.Create(context.TODO(), newTestDexClient("cli", "cli-client"))).To(Succeed())
+		Expect(r.Create(context.TODO(), newTestDexClient("peer", "peer-client"))).To(Succeed())
+		dexClient := &authv1alpha1.DexClient{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: "app", Namespace: testDexServerNamespace}, dexClient)).To(Succeed())
+		dexClient.Spec.TrustedPeers = []string{"cli-client"}
+		dexClient.Spec.TrustedPeerRefs = []corev1.LocalObjectReference{{Name: "peer"}}
+		Expect(r.Update(context.TODO(), dexClient)).To(Succeed())
+
+		dexClient, err := reconcileTestDexClient(r, "app")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexAPI.clients["app-client"].TrustedPeers).To(Equal([]string{"cli-client", "peer-client"}))
+		Expect(meta.IsStatusConditionTrue(dexClient.Status.Conditions, authv1alpha1.DexClientConditionTypeTrustedPeersResolved)).To(BeTrue())
+
+		By("updating the trusted peers of the OAuth2 client")
+		dexClient.Spec.TrustedPeerRefs = nil
+		Expect(r.Update(context.TODO(), dexClient)).To(Succeed())
+		_, err = reconcileTestDexClient(r, "app")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexAPI.clients["app-client"].TrustedPeers).To(Equal([]string{"cli-client"}))
+	})
+
+	It("reports dangling trusted peers and still applies the DexClient by default", func() {
+		dexClient := &authv1alpha1.DexClient{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: "app", Namespace: testDexServerNamespace}, dexClient)).To(Succeed())
+		dexClient.Spec.TrustedPeers = []string{"unknown-client"}
+		Expect(r.Update(context.TODO(), dexClient)).To(Succeed())
+
+		dexClient, err := reconcileTestDexClient(r, "app")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexAPI.clients["app-client"].TrustedPeers).To(Equal([]string{"unknown-client"}))
+		cond := meta.FindStatusCondition(dexClient.Status.Conditions, authv1alpha1.DexClientConditionTypeTrustedPeersResolved)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("TrustedPeerNotFound"))
+		Expect(cond.Message).To(ContainSubstring("unknown-client"))
+	})
+
+	It("does not apply a DexClient with dangling trusted peers when they are rejected", func() {
+		dexClient := &authv1alpha1.DexClient{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: "app", Namespace: testDexServerNamespace}, dexClient)).To(Succeed())
+		dexClient.Spec.TrustedPeers = []string{"unknown-client"}
+		Expect(r.Update(context.TODO(), dexClient)).To(Succeed())
+		r.RejectDanglingTrustedPeers = true
+
+		dexClient, err := reconcileTestDexClient(r, "app")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexAPI.clients).NotTo(HaveKey("app-client"))
+		cond := meta.FindStatusCondition(dexClient.Status.Conditions, authv1alpha1.DexClientConditionTypeApplied)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("TrustedPeerNotFound"))
+		Expect(cond.Message).To(ContainSubstring("unknown-client"))
+
+		By("applying it once the trusted peer exists")
+		Expect(r.Create(context.TODO(), newTestDexClient("peer", "unknown-client"))).To(Succeed())
+		dexClient, err = reconcileTestDexClient(r, "app")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexAPI.clients).To(HaveKey("app-client"))
+		Expect(meta.IsStatusConditionTrue(dexClient.Status.Conditions, authv1alpha1.DexClientConditionTypeTrustedPeersResolved)).To(BeTrue())
+	})
+
+	It("only applies the DexClients of the DexServers matching the label selector", func() {
+		mTLSSecret := &corev1.Secret{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: SECRET_MTLS_NAME, Namespace: testDexServerNamespace}, mTLSSecret)).To(Succeed())
+		mTLSSecret.Labels = map[string]string{"app": testDexServerName}
+		Expect(r.Update(context.TODO(), mTLSSecret)).To(Succeed())
+		dexServer := newTestDexServer()
+		Expect(r.Create(context.TODO(), dexServer)).To(Succeed())
+		r.LabelSelector = labels.SelectorFromSet(labels.Set{"tenant-class": "gold"})
+
+		dexClient, err := reconcileTestDexClient(r, "app")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexClient.Finalizers).To(BeEmpty())
+		Expect(dexClient.Status.Conditions).To(BeEmpty())
+		Expect(dexAPI.clients).To(BeEmpty())
+
+		By("applying it once its DexServer matches")
+		dexServer.Labels = map[string]string{"tenant-class": "gold"}
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexClient(r, "app")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexAPI.clients).To(HaveKey("app-client"))
+	})
+
+	It("finalizes a DexClient whose DexServer is gone with a label selector set", func() {
+		mTLSSecret := &corev1.Secret{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: SECRET_MTLS_NAME, Namespace: testDexServerNamespace}, mTLSSecret)).To(Succeed())
+		mTLSSecret.Labels = map[string]string{"app": testDexServerName}
+		Expect(r.Update(context.TODO(), mTLSSecret)).To(Succeed())
+		dexServer := newTestDexServer()
+		dexServer.Labels = map[string]string{"tenant-class": "gold"}
+		Expect(r.Create(context.TODO(), dexServer)).To(Succeed())
+		r.LabelSelector = labels.SelectorFromSet(labels.Set{"tenant-class": "gold"})
+		_, err := reconcileTestDexClient(r, "app")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexAPI.clients).To(HaveKey("app-client"))
+
+		By("deleting the DexClient after its DexServer, while the mtls secret remains")
+		Expect(r.Delete(context.TODO(), dexServer)).To(Succeed())
+		dexClient := &authv1alpha1.DexClient{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: "app", Namespace: testDexServerNamespace}, dexClient)).To(Succeed())
+		Expect(r.Delete(context.TODO(), dexClient)).To(Succeed())
+		dexClient, err = reconcileTestDexClient(r, "app")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexClient).To(BeNil())
+		Expect(dexAPI.clients).NotTo(HaveKey("app-client"))
+	})
+
+	It("reports a failed creation on the OAuth2ClientCreated condition", func() {
+		dexAPI.createErr = fmt.Errorf("storage unavailable")
+		dexClient, err := reconcileTestDexClient(r, "app")
+		Expect(err).To(HaveOccurred())
+		cond := meta.FindStatusCondition(dexClient.Status.Conditions, authv1alpha1.DexClientConditionTypeOAuth2ClientCreated)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("CreateFailed"))
+		Expect(cond.Message).To(ContainSubstring("storage unavailable"))
+
+		By("deleting the DexClient without an OAuth2 client")
+		Expect(r.Delete(context.TODO(), dexClient)).To(Succeed())
+		dexClient, err = reconcileTestDexClient(r, "app")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexClient).To(BeNil())
+	})
+})
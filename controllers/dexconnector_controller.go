@@ -0,0 +1,215 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// DexConnectorReconciler reports whether a DexConnector is aggregated into the config of its DexServer. The
+// aggregation itself is done by the DexServerReconciler.
+type DexConnectorReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Label selector of the DexServers whose DexConnectors are reconciled by this operator instance, the same as the
+	// DexServerReconciler one. When nil, all DexConnectors are reconciled.
+	LabelSelector labels.Selector
+}
+
+//+kubebuilder:rbac:groups=auth.identitatem.io,resources=dexconnectors,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=auth.identitatem.io,resources=dexconnectors/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=auth.identitatem.io,resources=dexconnectors/finalizers,verbs=update
+//+kubebuilder:rbac:groups=auth.identitatem.io,resources=dexservers,verbs=get;list;watch
+
+// Reconcile sets the Accepted condition of a DexConnector
+func (r *DexConnectorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := ctrllog.FromContext(ctx)
+	log.V(1).Info("Reconciling...")
+
+	dexConnector := &authv1alpha1.DexConnector{}
+	if err := r.Get(ctx, req.NamespacedName, dexConnector); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	cond := metav1.Condition{
+		Type:    authv1alpha1.DexConnectorConditionTypeAccepted,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Accepted",
+		Message: fmt.Sprintf("connector %s is part of the config of DexServer %s", dexConnector.Spec.Id, dexConnector.Spec.DexServerRef.Name),
+	}
+
+	dexServer := &authv1alpha1.DexServer{}
+	err := r.Get(ctx, types.NamespacedName{Name: dexConnector.Spec.DexServerRef.Name, Namespace: dexConnector.Namespace}, dexServer)
+	switch {
+	case kubeerrors.IsNotFound(err):
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "DexServerNotFound"
+		cond.Message = fmt.Sprintf("DexServer %s not found", dexConnector.Spec.DexServerRef.Name)
+	case err != nil:
+		return ctrl.Result{}, err
+	case !r.getLabelSelector().Matches(labels.Set(dexServer.Labels)):
+		log.V(1).Info("DexServer of the DexConnector does not match the label selector... skip reconcile")
+		return ctrl.Result{}, nil
+	default:
+		dexConnectors, err := listDexConnectors(r.Client, dexServer, ctx)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if _, err := aggregateDexConnectors(dexServer, dexConnectors); err != nil {
+			for _, id := range getDuplicateConnectorIds(dexServer, dexConnectors) {
+				if id == dexConnector.Spec.Id {
+					cond.Status = metav1.ConditionFalse
+					cond.Reason = "DuplicateConnectorId"
+					cond.Message = err.Error()
+				}
+			}
+		}
+	}
+
+	if err := r.updateDexConnectorStatusConditions(dexConnector, ctx, cond); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// listDexConnectors returns the DexConnectors referencing the DexServer, sorted by name so that the rendered
+// config does not depend on list order
+func listDexConnectors(c client.Client, dexServer *authv1alpha1.DexServer, ctx context.Context) ([]authv1alpha1.DexConnector, error) {
+	dexConnectorList := &authv1alpha1.DexConnectorList{}
+	if err := c.List(ctx, dexConnectorList, client.InNamespace(dexServer.Namespace)); err != nil {
+		return nil, err
+	}
+	dexConnectors := []authv1alpha1.DexConnector{}
+	for _, dexConnector := range dexConnectorList.Items {
+		if dexConnector.Spec.DexServerRef.Name == dexServer.Name {
+			dexConnectors = append(dexConnectors, dexConnector)
+		}
+	}
+	sort.Slice(dexConnectors, func(i, j int) bool {
+		return dexConnectors[i].Name < dexConnectors[j].Name
+	})
+	return dexConnectors, nil
+}
+
+// aggregateDexConnectors returns a copy of the DexServer with the connectors of the DexConnectors appended to the
+// DexServer connectors. Returns an error when a connector Id is used more than once.
+func aggregateDexConnectors(dexServer *authv1alpha1.DexServer, dexConnectors []authv1alpha1.DexConnector) (*authv1alpha1.DexServer, error) {
+	if duplicateIds := getDuplicateConnectorIds(dexServer, dexConnectors); len(duplicateIds) > 0 {
+		return nil, fmt.Errorf("connector ids %s are used more than once in DexServer %s and its DexConnectors",
+			strings.Join(duplicateIds, ", "), dexServer.Name)
+	}
+	aggregated := dexServer.DeepCopy()
+	for _, dexConnector := range dexConnectors {
+		aggregated.Spec.Connectors = append(aggregated.Spec.Connectors, dexConnector.Spec.ConnectorSpec)
+	}
+	return aggregated, nil
+}
+
+// getDuplicateConnectorIds returns the connector ids used more than once across the DexServer and DexConnectors
+func getDuplicateConnectorIds(dexServer *authv1alpha1.DexServer, dexConnectors []authv1alpha1.DexConnector) []string {
+	ids := []string{}
+	for _, connector := range dexServer.Spec.Connectors {
+		ids = append(ids, connector.Id)
+	}
+	for _, dexConnector := range dexConnectors {
+		ids = append(ids, dexConnector.Spec.Id)
+	}
+
+	seen := map[string]int{}
+	duplicateIds := []string{}
+	for _, id := range ids {
+		seen[id]++
+		if seen[id] == 2 {
+			duplicateIds = append(duplicateIds, id)
+		}
+	}
+	return duplicateIds
+}
+
+// getDexConnectorReferrers returns a request for every DexConnector referencing the DexServer dexServerName
+func getDexConnectorReferrers(dexConnectors []authv1alpha1.DexConnector, dexServerName string) []reconcile.Request {
+	requests := []reconcile.Request{}
+	for _, dexConnector := range dexConnectors {
+		if dexConnector.Spec.DexServerRef.Name == dexServerName {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      dexConnector.Name,
+					Namespace: dexConnector.Namespace,
+				},
+			})
+		}
+	}
+	return requests
+}
+
+func (r *DexConnectorReconciler) getLabelSelector() labels.Selector {
+	if r.LabelSelector == nil {
+		return labels.Everything()
+	}
+	return r.LabelSelector
+}
+
+func (r *DexConnectorReconciler) updateDexConnectorStatusConditions(dexConnector *authv1alpha1.DexConnector, ctx context.Context, newConditions ...metav1.Condition) error {
+	dexConnector.Status.Conditions = mergeStatusConditions(dexConnector.Status.Conditions, dexConnector.Generation, newConditions...)
+	return r.Client.Status().Update(ctx, dexConnector)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *DexConnectorReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// A DexConnector change can make the Id of the other DexConnectors of the same DexServer unique or duplicate,
+	// and a DexServer change can add a duplicate Id or the missing DexServer. Reconcile all affected DexConnectors.
+	mapToDexConnectors := func(dexServerName func(client.Object) string) handler.EventHandler {
+		return handler.EnqueueRequestsFromMapFunc(func(a client.Object) []reconcile.Request {
+			var dexConnectorList authv1alpha1.DexConnectorList
+			_ = mgr.GetClient().List(context.TODO(), &dexConnectorList, client.InNamespace(a.GetNamespace()))
+			return getDexConnectorReferrers(dexConnectorList.Items, dexServerName(a))
+		})
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&authv1alpha1.DexConnector{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &authv1alpha1.DexConnector{}},
+			mapToDexConnectors(func(a client.Object) string {
+				return a.(*authv1alpha1.DexConnector).Spec.DexServerRef.Name
+			}),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &authv1alpha1.DexServer{}},
+			mapToDexConnectors(func(a client.Object) string {
+				return a.GetName()
+			}),
+			builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, dexServerSelectedPredicate(r.getLabelSelector())))).
+		Complete(r)
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// newTestDexConnector returns a DexConnector in the test namespace referencing the DexServer dexServerName
+func newTestDexConnector(name string, dexServerName string, connector authv1alpha1.ConnectorSpec) *authv1alpha1.DexConnector {
+	return &authv1alpha1.DexConnector{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testDexServerNamespace,
+		},
+		Spec: authv1alpha1.DexConnectorSpec{
+			DexServerRef:  corev1.LocalObjectReference{Name: dexServerName},
+			ConnectorSpec: connector,
+		},
+	}
+}
+
+// newTestDexConnectorReconciler returns a DexConnectorReconciler backed by a fake client seeded with objs
+func newTestDexConnectorReconciler(objs ...client.Object) *DexConnectorReconciler {
+	scheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	Expect(authv1alpha1.AddToScheme(scheme)).To(Succeed())
+
+	return &DexConnectorReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(),
+		Scheme: scheme,
+	}
+}
+
+// reconcileTestDexConnector reconciles the DexConnector name and returns its Accepted condition
+func reconcileTestDexConnector(r *DexConnectorReconciler, name string) *metav1.Condition {
+	_, err := r.Reconcile(context.TODO(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Name: name, Namespace: testDexServerNamespace},
+	})
+	Expect(err).NotTo(HaveOccurred())
+	dexConnector := &authv1alpha1.DexConnector{}
+	Expect(r.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: testDexServerNamespace}, dexConnector)).To(Succeed())
+	return meta.FindStatusCondition(dexConnector.Status.Conditions, authv1alpha1.DexConnectorConditionTypeAccepted)
+}
+
+var _ = Describe("DexConnector reconcile", func() {
+	It("accepts connectors with a unique id", func() {
+		r := newTestDexConnectorReconciler(newTestDexServer(),
+			newTestDexConnector("github", testDexServerName, newTestGitHubConnector("github", "github-secret")))
+
+		cond := reconcileTestDexConnector(r, "github")
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(cond.Reason).To(Equal("Accepted"))
+	})
+
+	It("rejects connectors referencing a missing DexServer", func() {
+		r := newTestDexConnectorReconciler(
+			newTestDexConnector("github", "missing", newTestGitHubConnector("github", "github-secret")))
+
+		cond := reconcileTestDexConnector(r, "github")
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("DexServerNotFound"))
+	})
+
+	It("rejects connectors with an id used by the DexServer or another DexConnector", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{newTestGitHubConnector("github", "github-secret")}
+		r := newTestDexConnectorReconciler(dexServer,
+			newTestDexConnector("github", testDexServerName, newTestGitHubConnector("github", "github-secret")),
+			newTestDexConnector("ldap", testDexServerName, newTestGitHubConnector("ldap", "github-secret")),
+			newTestDexConnector("other-ldap", testDexServerName, newTestGitHubConnector("ldap", "github-secret")),
+			newTestDexConnector("unique", testDexServerName, newTestGitHubConnector("unique", "github-secret")))
+
+		for _, name := range []string{"github", "ldap", "other-ldap"} {
+			cond := reconcileTestDexConnector(r, name)
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse), name)
+			Expect(cond.Reason).To(Equal("DuplicateConnectorId"), name)
+		}
+		Expect(reconcileTestDexConnector(r, "unique").Status).To(Equal(metav1.ConditionTrue))
+	})
+
+	It("skips the connectors of DexServers not matching the label selector", func() {
+		r := newTestDexConnectorReconciler(newTestDexServer(),
+			newTestDexConnector("github", testDexServerName, newTestGitHubConnector("github", "github-secret")))
+		r.LabelSelector = labels.SelectorFromSet(labels.Set{"tenant-class": "gold"})
+
+		Expect(reconcileTestDexConnector(r, "github")).To(BeNil())
+	})
+})
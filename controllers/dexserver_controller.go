@@ -19,31 +19,48 @@ package controllers
 import (
 	"context"
 	"crypto/sha256"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"net/url"
 	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ghodss/yaml"
+	"github.com/go-logr/logr"
+	routev1 "github.com/openshift/api/route/v1"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/apimachinery/pkg/api/equality"
 	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	clusteradmapply "open-cluster-management.io/clusteradm/pkg/helpers/apply"
 	"open-cluster-management.io/clusteradm/pkg/helpers/asset"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
@@ -62,7 +79,35 @@ const (
 	GRPC_SERVICE_NAME           = "grpc"
 	DEX_IMAGE_ENV_NAME          = "RELATED_IMAGE_DEX"
 	MTLS_CERT_EXPIRY_ANNOTATION = "auth.identitatem.io/expiry"
+	MTLS_CERT_SANS_ANNOTATION   = "auth.identitatem.io/grpc-cert-sans"
 	IDP_CREDENTIAL_LABEL        = "auth.identitatem.io/idp-credential"
+	// Comma separated ids of the connectors whose secret resolution and config rendering are logged in detail
+	DEBUG_CONNECTORS_ANNOTATION = "auth.identitatem.io/debug-connectors"
+	CA_BUNDLE_CONFIGMAP_SUFFIX  = "-ca-bundle"
+	CA_BUNDLE_KEY               = "ca-bundle.crt"
+	// Changing its value, for example to the current time, rolls out new dex pods without a config change
+	RESTART_ANNOTATION = "auth.identitatem.io/restart"
+	// Pod template annotation holding the hash of the config the dex pods were started with
+	CONFIG_HASH_ANNOTATION = "auth.identitatem.io/configHash"
+	// Pod template annotation holding the hash of the connector credentials injected as environment variables
+	CONNECTOR_SECRETS_HASH_ANNOTATION = "auth.identitatem.io/connectorSecretsHash"
+	// Finalizer deleting the cluster scoped resources of a DexServer, which are not garbage collected with it
+	DEX_SERVER_FINALIZER = "auth.identitatem.io/cleanup"
+
+	// Owner reference modes of the resources generated for a DexServer
+	OWNER_REFERENCE_MODE_CONTROLLER = "controller" // controller owner reference (default)
+	OWNER_REFERENCE_MODE_OWNER      = "owner"      // plain owner reference, the resources are garbage collected but not controlled
+	OWNER_REFERENCE_MODE_NONE       = "none"       // no owner reference
+	// Default for DexServerSpec.SessionAffinityTimeoutSeconds, matches the kubernetes default
+	DEFAULT_SESSION_AFFINITY_TIMEOUT_SECONDS int32 = 10800
+	// Default for DexServerSpec.ProgressDeadlineSeconds, matches the kubernetes default
+	DEFAULT_PROGRESS_DEADLINE_SECONDS int32 = 600
+	// The pod template annotation set by kubectl rollout restart
+	DEFAULT_RESTART_ANNOTATION_KEY = "kubectl.kubernetes.io/restartedAt"
+	// Default for DexServerSpec.Replicas
+	DEFAULT_REPLICAS int32 = 1
+	// Default for DexServerSpec.EmptyDirSizeLimit
+	DEFAULT_EMPTY_DIR_SIZE_LIMIT = "64Mi"
 )
 
 // DexServerReconciler reconciles a DexServer object
@@ -72,13 +117,66 @@ type DexServerReconciler struct {
 	DynamicClient      dynamic.Interface
 	APIExtensionClient apiextensionsclient.Interface
 	Scheme             *runtime.Scheme
+	// When true, the issuer discovery endpoint is requested from within the cluster after every successful
+	// reconcile with a ready dex pod and the result is reported on the Available condition. The check never fails
+	// the reconcile.
+	CheckIssuerReachability bool
+	// When true, DexServers may use an http issuer, for local and development setups. Otherwise only https issuers
+	// are applied, as OIDC requires.
+	AllowHTTPIssuer bool
+	// How generated resources reference their DexServer: controller (default), owner or none. With owner or none,
+	// changes to generated resources do not trigger a reconcile, which lets GitOps tools such as Argo CD or Flux
+	// track their ownership; drift is corrected on the periodic reconcile.
+	OwnerReferenceMode string
+	// Namespaces, other than its own, from which a DexServer may read connector secrets. When empty, connector
+	// secrets may be read from any namespace.
+	AllowedSecretNamespaces []string
+	// When true, a dex deployment whose immutable fields, such as the selector, changed is deleted and recreated.
+	// Otherwise the reconcile fails until the deployment is deleted manually.
+	RecreateDeploymentOnImmutableChange bool
+	// Records the events of the DexServers, such as the sync failures and the changes of the generated resources.
+	// Defaults to the event recorder of the manager.
+	Recorder record.EventRecorder
+	// Maximum number of DexServers reconciled concurrently, defaults to 1. A reconcile only shares the read-only
+	// embedded templates with other reconciles; the applier and all rendered values are built per reconcile.
+	MaxConcurrentReconciles int
+	// Cap of the exponential backoff between the reconciles of a failing DexServer, defaults to 1000s
+	MaxReconcileBackoff time.Duration
+	// Number of consecutive failed reconciles after which a DexServer is no longer retried until it changes. When 0,
+	// failed reconciles are retried indefinitely.
+	MaxReconcileRetries int
+	// Age after which the ReplicaSets of previous revisions of the dex deployment that are scaled down to zero are
+	// deleted, on top of the revision history limit of the deployment. When 0, they are kept.
+	StaleReplicaSetMaxAge time.Duration
+	// Timeout of each read of a secret referenced by a DexServer, such as a connector credential. A timed out read
+	// fails the reconcile with the SecretFetchTimeout reason and is retried. Defaults to 10s.
+	SecretFetchTimeout time.Duration
+	// Pod template annotation with which the rolling restarts of the dex deployments are triggered, for example by
+	// a GitOps tool. The updates of a restart are not reconciled. Defaults to kubectl.kubernetes.io/restartedAt.
+	RestartAnnotationKey string
+	// Only the DexServers matching the selector are reconciled, which lets several operator instances share a
+	// cluster with disjoint DexServers. When nil, all DexServers are reconciled.
+	LabelSelector labels.Selector
+	// When true, the OfflineSessions and RefreshTokens dex stored with the kubernetes storage for a connector are
+	// deleted once the connector is removed, which invalidates the sessions of its users. When false, they are kept.
+	CleanupOrphanedConnectorStorage bool
+	// Time the serving certificate secret generated by the OpenShift service CA may take to appear before the
+	// DexServer is reported Degraded with the ServingCertMissing reason. Defaults to 10m.
+	ServingCertTimeout time.Duration
+
+	rateLimiter     workqueue.RateLimiter
+	rateLimiterOnce sync.Once
 }
 
 //+kubebuilder:rbac:groups=auth.identitatem.io,resources=dexservers,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=auth.identitatem.io,resources=dexservers/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=auth.identitatem.io,resources=dexservers/finalizers,verbs=update
+//+kubebuilder:rbac:groups=auth.identitatem.io,resources=dexconnectors,verbs=get;list;watch
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;delete
 //+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
 //+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;delete
@@ -87,9 +185,15 @@ type DexServerReconciler struct {
 //+kubebuilder:rbac:groups=route.openshift.io,resources=routes/custom-host,verbs=create;patch
 //+kubebuilder:rbac:groups="rbac.authorization.k8s.io",resources={clusterroles},verbs=get;list;watch;create;update;patch;delete;escalate;bind
 //+kubebuilder:rbac:groups="rbac.authorization.k8s.io",resources={clusterrolebindings},verbs=get;list;create;watch;update;patch;delete
+//+kubebuilder:rbac:groups="rbac.authorization.k8s.io",resources={roles,rolebindings},verbs=get;list;watch;create;update;patch;delete;escalate;bind
 //+kubebuilder:rbac:groups="apiextensions.k8s.io",resources={customresourcedefinitions},verbs=get;list;create;update;patch;delete
 //+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=dex.coreos.com,resources=offlinesessionses;refreshtokens,verbs=list;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -101,6 +205,16 @@ type DexServerReconciler struct {
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.8.3/pkg/reconcile
 func (r *DexServerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	start := time.Now()
+	ctx, span := startSpan(ctx, "Reconcile", req.NamespacedName)
+	result, err := r.reconcile(ctx, req)
+	endSpan(span, err)
+	observeReconcile(start, err)
+	return result, err
+}
+
+func (r *DexServerReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	ctx = withReconcileID(ctx)
 	log := ctrllog.FromContext(ctx)
 	log.V(1).Info("Reconciling...")
 
@@ -114,139 +228,608 @@ func (r *DexServerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	// Prepare Mutual TLS for gRPC connection
-	if err := r.manageMTLSSecret(dexServer, ctx); err != nil {
-		log.Error(err, "failed to manage mtls secret")
-		cond := metav1.Condition{
-			Type:   authv1alpha1.DexServerConditionTypeApplied,
-			Status: metav1.ConditionFalse,
-			Reason: "ConfigMTLSSecretFailed",
-			Message: fmt.Sprintf("failed to configure MTLS secret. error: %s",
-				err.Error()),
-		}
-		if err := updateDexServerStatusConditions(r.Client, dexServer, cond); err != nil {
-			return ctrl.Result{}, err
-		}
+	// A DexServer that no longer matches the label selector of any operator instance is still finalized, otherwise its
+	// deletion is blocked by the finalizer
+	if !dexServer.DeletionTimestamp.IsZero() {
+		return r.finalizeDexServer(dexServer, ctx)
+	}
+
+	// Requests mapped from secrets, DexConnectors and DexClients are not filtered by the predicates
+	if !r.getLabelSelector().Matches(labels.Set(dexServer.Labels)) {
+		log.V(1).Info("DexServer does not match the label selector... skip reconcile")
+		return ctrl.Result{}, nil
+	}
+
+	// Nothing to apply in a namespace being deleted, the garbage collector removes the DexServer and its resources
+	terminating, err := r.isNamespaceTerminating(dexServer.Namespace, ctx)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
+	if terminating {
+		log.Info("namespace is terminating... skip reconcile", "namespace", dexServer.Namespace)
+		return ctrl.Result{}, nil
+	}
 
-	if err := r.syncConfigMap(dexServer, ctx); err != nil {
-		log.Error(err, "failed to sync ConfigMap")
-		cond := metav1.Condition{
-			Type:   authv1alpha1.DexServerConditionTypeApplied,
-			Status: metav1.ConditionFalse,
-			Reason: "ConfigMapFailed",
-			Message: fmt.Sprintf("failed to sync ConfigMap. error: %s",
-				err.Error()),
-		}
-		if err := updateDexServerStatusConditions(r.Client, dexServer, cond); err != nil {
+	// Delete the ClusterRoleBinding of the storage RBAC before the DexServer is removed
+	if !controllerutil.ContainsFinalizer(dexServer, DEX_SERVER_FINALIZER) {
+		controllerutil.AddFinalizer(dexServer, DEX_SERVER_FINALIZER)
+		if err := r.Update(ctx, dexServer); err != nil {
 			return ctrl.Result{}, err
 		}
-		return ctrl.Result{}, err
 	}
 
-	if err := r.syncService(dexServer, ctx); err != nil {
-		log.Error(err, "failed to sync http service")
+	// Every exposed resource and connector callback derives from the issuer, nothing is applied without a valid one
+	if err := validateIssuer(dexServer.Spec.Issuer); err != nil {
+		log.Error(err, "invalid issuer")
 		cond := metav1.Condition{
-			Type:   authv1alpha1.DexServerConditionTypeApplied,
-			Status: metav1.ConditionFalse,
-			Reason: "ConfigHTTPServiceFailed",
-			Message: fmt.Sprintf("failed to sync http service. error: %s",
-				err.Error()),
+			Type:    authv1alpha1.DexServerConditionTypeApplied,
+			Status:  metav1.ConditionFalse,
+			Reason:  "InvalidIssuer",
+			Message: withReconcileIDMessage(ctx, err.Error()),
 		}
+		setNextReconcileStatus(dexServer, 0, 0)
 		if err := updateDexServerStatusConditions(r.Client, dexServer, cond); err != nil {
 			return ctrl.Result{}, err
 		}
-		return ctrl.Result{}, err
+		// Nothing to retry until the DexServer changes
+		return ctrl.Result{}, nil
 	}
-
-	if err := r.syncServiceGrpc(dexServer, ctx); err != nil {
-		log.Error(err, "failed to sync grpc Service")
+	if err := validateIssuerScheme(dexServer.Spec.Issuer, r.AllowHTTPIssuer); err != nil {
+		log.Error(err, "insecure issuer")
 		cond := metav1.Condition{
-			Type:   authv1alpha1.DexServerConditionTypeApplied,
-			Status: metav1.ConditionFalse,
-			Reason: "ConfigGRPCServiceFailed",
-			Message: fmt.Sprintf("failed to sync grpc service. error: %s",
-				err.Error()),
+			Type:    authv1alpha1.DexServerConditionTypeApplied,
+			Status:  metav1.ConditionFalse,
+			Reason:  "InsecureIssuer",
+			Message: withReconcileIDMessage(ctx, err.Error()),
 		}
+		setNextReconcileStatus(dexServer, 0, 0)
 		if err := updateDexServerStatusConditions(r.Client, dexServer, cond); err != nil {
 			return ctrl.Result{}, err
 		}
+		// Nothing to retry until the DexServer changes
+		return ctrl.Result{}, nil
+	}
 
+	// Add the connectors of the DexConnectors referencing this DexServer. The aggregated DexServer is only used to
+	// render the dex resources, it is never written back.
+	dexConnectors, err := listDexConnectors(r.Client, dexServer, ctx)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
-
-	if err := r.syncServiceAccount(dexServer, ctx); err != nil {
-		log.Error(err, "failed to sync ServiceAccount")
+	desiredDexServer, err := aggregateDexConnectors(dexServer, dexConnectors)
+	if err != nil {
+		log.Error(err, "failed to aggregate DexConnectors")
 		cond := metav1.Condition{
-			Type:   authv1alpha1.DexServerConditionTypeApplied,
-			Status: metav1.ConditionFalse,
-			Reason: "ConfigServiceAccountFailed",
-			Message: fmt.Sprintf("failed to sync ServiceAccount. error: %s",
-				err.Error()),
+			Type:    authv1alpha1.DexServerConditionTypeApplied,
+			Status:  metav1.ConditionFalse,
+			Reason:  "DuplicateConnectorId",
+			Message: withReconcileIDMessage(ctx, err.Error()),
 		}
+		setNextReconcileStatus(dexServer, 0, 0)
 		if err := updateDexServerStatusConditions(r.Client, dexServer, cond); err != nil {
 			return ctrl.Result{}, err
 		}
-		return ctrl.Result{}, err
+		// Nothing to retry until the DexServer or its DexConnectors change
+		return ctrl.Result{}, nil
 	}
+	desiredDexServer.Spec.Issuer = normalizeIssuer(desiredDexServer.Spec.Issuer)
 
-	if err := r.syncClusterRoleBinding(dexServer, ctx); err != nil {
-		log.Error(err, "failed to sync ClusterRoleBinding")
+	// Reject invalid field values before anything is applied
+	if err := validateDexServerSpec(desiredDexServer); err != nil {
+		log.Error(err, "invalid DexServer spec")
 		cond := metav1.Condition{
-			Type:   authv1alpha1.DexServerConditionTypeApplied,
-			Status: metav1.ConditionFalse,
-			Reason: "ConfigClusterRoleBindingFailed",
-			Message: fmt.Sprintf("failed to sync ClusterRoleBinding. error: %s",
-				err.Error()),
+			Type:    authv1alpha1.DexServerConditionTypeApplied,
+			Status:  metav1.ConditionFalse,
+			Reason:  "InvalidSpec",
+			Message: withReconcileIDMessage(ctx, err.Error()),
 		}
+		setNextReconcileStatus(dexServer, 0, 0)
 		if err := updateDexServerStatusConditions(r.Client, dexServer, cond); err != nil {
 			return ctrl.Result{}, err
 		}
-		return ctrl.Result{}, err
+		// Nothing to retry until the DexServer or its DexConnectors change
+		return ctrl.Result{}, nil
 	}
 
-	if err := r.syncDeployment(dexServer, ctx); err != nil {
-		log.Error(err, "failed to sync Deployment")
+	// Render aliased connector types, such as openid-connect, with their dex type name
+	canonicalizeConnectorTypes(desiredDexServer)
+
+	// Reject connector secrets outside the allowed namespaces before reading any of them
+	if err := r.validateConnectorSecretNamespaces(desiredDexServer); err != nil {
+		log.Error(err, "connector secret namespace not allowed")
 		cond := metav1.Condition{
-			Type:   authv1alpha1.DexServerConditionTypeApplied,
-			Status: metav1.ConditionFalse,
-			Reason: "ConfigDeploymentFailed",
-			Message: fmt.Sprintf("failed to sync Deployment. error: %s",
-				err.Error()),
+			Type:    authv1alpha1.DexServerConditionTypeApplied,
+			Status:  metav1.ConditionFalse,
+			Reason:  "SecretNamespaceNotAllowed",
+			Message: withReconcileIDMessage(ctx, err.Error()),
 		}
+		setNextReconcileStatus(dexServer, 0, 0)
 		if err := updateDexServerStatusConditions(r.Client, dexServer, cond); err != nil {
 			return ctrl.Result{}, err
 		}
+		// Nothing to retry until the DexServer changes
+		return ctrl.Result{}, nil
+	}
+
+	// A paused DexServer only renders its config, for inspection
+	if desiredDexServer.Spec.Paused {
+		return r.reconcilePausedDexServer(dexServer, desiredDexServer, ctx)
+	}
+	clearPausedStatus(dexServer)
+
+	// Record the image of the existing deployment before it is synced, to report image changes
+	previousDexImage, err := r.getDeploymentImage(dexServer, ctx)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	if err := r.syncIngress(dexServer, ctx); err != nil {
-		log.Error(err, "failed to sync Ingress")
-		cond := metav1.Condition{
-			Type:   authv1alpha1.DexServerConditionTypeApplied,
-			Status: metav1.ConditionFalse,
-			Reason: "ConfigIngressFailed",
-			Message: fmt.Sprintf("failed to sync Ingress. error: %s",
-				err.Error()),
+	// Run each phase in order. Every phase records its own condition, and the first failure stops the
+	// reconcile and is also reported on the summary Applied condition.
+	ctx, phaseConditions := withPhaseConditions(ctx)
+	conditions := []metav1.Condition{}
+	phases, err := r.syncPhases(desiredDexServer, ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	for _, phase := range phases {
+		if !isPhaseManaged(desiredDexServer, phase.conditionType) {
+			log.V(1).Info("skipping the sync of an unmanaged resource", "resource", phase.resource)
+			conditions = append(conditions, metav1.Condition{
+				Type:    phase.conditionType,
+				Status:  metav1.ConditionTrue,
+				Reason:  "Unmanaged",
+				Message: fmt.Sprintf("%s is managed outside of the operator", phase.resource),
+			})
+			continue
 		}
-		if err := updateDexServerStatusConditions(r.Client, dexServer, cond); err != nil {
-			return ctrl.Result{}, err
+		phaseCtx, span := startSpan(ctx, "sync "+phase.resource, req.NamespacedName, attribute.String("dexserver.phase", phase.conditionType))
+		err := phase.sync(desiredDexServer, phaseCtx)
+		endSpan(span, err)
+		// The phases report the status of what they rendered on the aggregated DexServer
+		dexServer.Status.ActiveConnectors = desiredDexServer.Status.ActiveConnectors
+		if err != nil {
+			reason := phase.failedReason
+			message := withReconcileIDMessage(ctx, fmt.Sprintf("failed to sync %s. error: %s", phase.resource, err.Error()))
+			result, resultErr := ctrl.Result{}, err
+			retries := 0
+			var waitingErr *phaseWaitingError
+			var failedErr *phaseFailedError
+			if errors.As(err, &failedErr) {
+				reason = failedErr.reason
+			}
+			if errors.As(err, &waitingErr) {
+				// Not a failure, the phase waits on another component and is retried later
+				log.Info("waiting to sync "+phase.resource, "reason", waitingErr.reason, "message", waitingErr.message)
+				reason, message = waitingErr.reason, waitingErr.message
+				result, resultErr = ctrl.Result{RequeueAfter: waitingErr.requeueAfter}, nil
+				setNextReconcileStatus(dexServer, waitingErr.requeueAfter, 0)
+			} else {
+				log.Error(err, "failed to sync "+phase.resource)
+				r.recordEvent(dexServer, corev1.EventTypeWarning, reason, "failed to sync %s: %s", phase.resource, err.Error())
+				// The workqueue counts the failures before this one, this failure is retried after the next backoff
+				retries = r.getReconcileRateLimiter().NumRequeues(req) + 1
+				if r.MaxReconcileRetries > 0 && retries > r.MaxReconcileRetries {
+					log.Info("giving up on the DexServer until it changes", "retries", retries-1)
+					message = fmt.Sprintf("%s. Giving up after %d retries, until the DexServer changes", message, retries-1)
+					r.getReconcileRateLimiter().Forget(req)
+					result, resultErr = ctrl.Result{}, nil
+					setNextReconcileStatus(dexServer, 0, retries)
+				} else {
+					setNextReconcileStatus(dexServer, r.getReconcileBackoff(retries-1), retries)
+				}
+			}
+			conditions = append(conditions,
+				metav1.Condition{
+					Type:    phase.conditionType,
+					Status:  metav1.ConditionFalse,
+					Reason:  reason,
+					Message: message,
+				},
+				metav1.Condition{
+					Type:    authv1alpha1.DexServerConditionTypeApplied,
+					Status:  metav1.ConditionFalse,
+					Reason:  reason,
+					Message: message,
+				},
+			)
+			conditions = append(conditions, *phaseConditions...)
+			if imageCond := r.getDeploymentImageCondition(dexServer, previousDexImage, ctx); imageCond != nil {
+				conditions = append(conditions, *imageCond)
+			}
+			if err := updateDexServerStatusConditions(r.Client, dexServer, conditions...); err != nil {
+				return ctrl.Result{}, err
+			}
+			return result, resultErr
 		}
-		return ctrl.Result{}, err
+		conditions = append(conditions, metav1.Condition{
+			Type:    phase.conditionType,
+			Status:  metav1.ConditionTrue,
+			Reason:  "Synced",
+			Message: fmt.Sprintf("%s is synced", phase.resource),
+		})
 	}
 
-	cond := metav1.Condition{
+	conditions = append(conditions, metav1.Condition{
 		Type:    authv1alpha1.DexServerConditionTypeApplied,
 		Status:  metav1.ConditionTrue,
 		Reason:  "Applied",
 		Message: "DexServer is applied",
+	})
+	conditions = append(conditions, *phaseConditions...)
+	if imageCond := r.getDeploymentImageCondition(dexServer, previousDexImage, ctx); imageCond != nil {
+		conditions = append(conditions, *imageCond)
 	}
-	if err := updateDexServerStatusConditions(r.Client, dexServer, cond); err != nil {
-		return ctrl.Result{}, err
+	if rolloutCond, err := r.getDeploymentRolloutCondition(desiredDexServer, ctx); err != nil {
+		log.Error(err, "failed to get the rollout of the deployment")
+	} else if rolloutCond != nil {
+		conditions = append(conditions, *rolloutCond)
+	}
+	if servingCertCond, err := r.getServingCertCondition(dexServer, ctx); err != nil {
+		log.Error(err, "failed to check the serving certificate secret")
+	} else if servingCertCond != nil {
+		conditions = append(conditions, *servingCertCond)
+	} else {
+		meta.RemoveStatusCondition(&dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeDegraded)
+	}
+	// A deployment managed outside of the operator is left to its own tooling
+	if isResourceManaged(dexServer, authv1alpha1.ManagedResourceDeployment) {
+		if err := r.pruneStaleReplicaSets(dexServer, ctx); err != nil {
+			log.Error(err, "failed to delete the stale ReplicaSets of the deployment")
+		}
+		if err := r.cleanupOrphanedConnectorStorage(dexServer, ctx); err != nil {
+			log.Error(err, "failed to delete the dex storage objects of the removed connectors")
+		}
+	}
+	if dexVersion, err := r.getRolledOutDexVersion(dexServer, ctx); err != nil {
+		log.Error(err, "failed to get the dex version")
+	} else if dexVersion != "" && dexVersion != dexServer.Status.DexVersion {
+		log.Info("dex version rolled out", "dexVersion", dexVersion)
+		dexServer.Status.DexVersion = dexVersion
+	}
+	// dex exits on an invalid config, so the applied deployment is only available once one of its pods is ready
+	podsReady := true
+	if podsCondition, err := r.getPodsAvailableCondition(desiredDexServer, ctx); err != nil {
+		log.Error(err, "failed to get the readiness of the dex pods")
+	} else if podsCondition.Status != metav1.ConditionTrue {
+		log.Info("no dex pod is ready", "reason", podsCondition.Reason, "message", podsCondition.Message)
+		podsReady = false
+		conditions = append(conditions, podsCondition)
+	} else if !r.CheckIssuerReachability {
+		conditions = append(conditions, podsCondition)
+	}
+	if podsReady && r.CheckIssuerReachability {
+		var availableCondition metav1.Condition
+		if rootCAs, err := r.getInternalRootCAs(dexServer, ctx); err != nil {
+			availableCondition = issuerUnavailableCondition("IssuerCAUnavailable", err.Error())
+		} else {
+			availableCondition = checkIssuerReachability(ctx, dexServer.Spec.Issuer, rootCAs)
+		}
+		if availableCondition.Status != metav1.ConditionTrue {
+			log.Info("issuer is not reachable from within the cluster", "reason", availableCondition.Reason, "message", availableCondition.Message)
+		}
+		conditions = append(conditions, availableCondition)
+	}
+	if redirectURIsCond, err := r.getRedirectURIsCondition(desiredDexServer, ctx); err != nil {
+		log.Error(err, "failed to cross-check the redirect URIs")
+	} else {
+		if redirectURIsCond.Status != metav1.ConditionTrue {
+			log.Info("inconsistent redirect URIs", "message", redirectURIsCond.Message)
+		}
+		conditions = append(conditions, redirectURIsCond)
 	}
 	// Reconcile hourly to ensure grpc mtls certs are regenerated before expiry
-	return ctrl.Result{Requeue: true, RequeueAfter: 1 * time.Hour}, nil
+	requeueAfter := 1 * time.Hour
+	if jwksCond, refreshAfter := r.syncJWKSConfigMap(desiredDexServer, ctx); jwksCond != nil {
+		if jwksCond.Status != metav1.ConditionTrue {
+			log.Info("failed to publish the JWKS", "reason", jwksCond.Reason, "message", jwksCond.Message)
+		}
+		conditions = append(conditions, *jwksCond)
+		if refreshAfter > 0 && refreshAfter < requeueAfter {
+			requeueAfter = refreshAfter
+		}
+	}
+	if !podsReady {
+		if podsRequeueAfter := getPodsNotReadyRequeueAfter(dexServer); podsRequeueAfter < requeueAfter {
+			requeueAfter = podsRequeueAfter
+		}
+	}
+	setNextReconcileStatus(dexServer, requeueAfter, 0)
+	// The resource of a previous route type is gone, so is its condition
+	meta.RemoveStatusCondition(&dexServer.Status.Conditions, getUnusedRouteConditionType(desiredDexServer))
+	// The generation is only observed once the whole reconcile succeeded
+	dexServer.Status.ObservedGeneration = dexServer.Generation
+	if err := updateDexServerStatusConditions(r.Client, dexServer, conditions...); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{Requeue: true, RequeueAfter: requeueAfter}, nil
+}
+
+// recordEvent records an event on the DexServer, when the reconciler has a recorder
+func (r *DexServerReconciler) recordEvent(dexServer *authv1alpha1.DexServer, eventType string, reason string, messageFmt string, args ...interface{}) {
+	if r.Recorder == nil {
+		return
+	}
+	r.Recorder.Eventf(dexServer, eventType, reason, messageFmt, args...)
+}
+
+// isNamespaceTerminating returns true when the namespace is being deleted
+func (r *DexServerReconciler) isNamespaceTerminating(namespace string, ctx context.Context) (bool, error) {
+	ns := &corev1.Namespace{}
+	if err := r.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "error getting namespace")
+	}
+	return ns.DeletionTimestamp != nil || ns.Status.Phase == corev1.NamespaceTerminating, nil
+}
+
+// getDeploymentImage returns the dex image of the existing deployment, or "" if the deployment does not exist yet
+func (r *DexServerReconciler) getDeploymentImage(dexServer *authv1alpha1.DexServer, ctx context.Context) (string, error) {
+	deployment, err := r.KubeClient.AppsV1().Deployments(dexServer.Namespace).Get(ctx, dexServer.Name, metav1.GetOptions{})
+	if err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", errors.Wrap(err, "error getting dex server deployment")
+	}
+	if len(deployment.Spec.Template.Spec.Containers) == 0 {
+		return "", nil
+	}
+	return deployment.Spec.Template.Spec.Containers[0].Image, nil
+}
+
+// getRolledOutDexVersion returns the version of the dex image once the rollout of the deployment has completed, or
+// "" while it is in progress
+func (r *DexServerReconciler) getRolledOutDexVersion(dexServer *authv1alpha1.DexServer, ctx context.Context) (string, error) {
+	deployment, err := r.KubeClient.AppsV1().Deployments(dexServer.Namespace).Get(ctx, dexServer.Name, metav1.GetOptions{})
+	if err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", errors.Wrap(err, "error getting dex server deployment")
+	}
+	if len(deployment.Spec.Template.Spec.Containers) == 0 || !isDeploymentRolledOut(deployment) {
+		return "", nil
+	}
+	return getImageVersion(deployment.Spec.Template.Spec.Containers[0].Image), nil
+}
+
+// isDeploymentRolledOut returns true when all replicas of the deployment run its latest pod template
+func isDeploymentRolledOut(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.Replicas == replicas &&
+		deployment.Status.AvailableReplicas == replicas
+}
+
+// getProgressDeadlineSeconds returns the progress deadline of the dex deployment, defaulting to the kubernetes default
+func getProgressDeadlineSeconds(dexServer *authv1alpha1.DexServer) int32 {
+	if dexServer.Spec.ProgressDeadlineSeconds != nil {
+		return *dexServer.Spec.ProgressDeadlineSeconds
+	}
+	return DEFAULT_PROGRESS_DEADLINE_SECONDS
+}
+
+// getDeploymentRolloutCondition reports the rollout of the dex deployment. A rollout fails when the deployment reports
+// that it exceeded its progress deadline, so the condition matches the deployment's own detection. Returns nil when
+// the deployment does not exist.
+func (r *DexServerReconciler) getDeploymentRolloutCondition(dexServer *authv1alpha1.DexServer, ctx context.Context) (*metav1.Condition, error) {
+	deployment, err := r.KubeClient.AppsV1().Deployments(dexServer.Namespace).Get(ctx, dexServer.Name, metav1.GetOptions{})
+	if err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "error getting dex server deployment")
+	}
+	progressDeadlineSeconds := getProgressDeadlineSeconds(dexServer)
+	for _, cond := range deployment.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Status == corev1.ConditionFalse && cond.Reason == "ProgressDeadlineExceeded" {
+			return &metav1.Condition{
+				Type:    authv1alpha1.DexServerConditionTypeDeploymentRolledOut,
+				Status:  metav1.ConditionFalse,
+				Reason:  "ProgressDeadlineExceeded",
+				Message: fmt.Sprintf("the rollout of the dex deployment made no progress for %d seconds. %s", progressDeadlineSeconds, cond.Message),
+			}, nil
+		}
+	}
+	if !isDeploymentRolledOut(deployment) {
+		return &metav1.Condition{
+			Type:    authv1alpha1.DexServerConditionTypeDeploymentRolledOut,
+			Status:  metav1.ConditionFalse,
+			Reason:  "RollingOut",
+			Message: fmt.Sprintf("the rollout of the dex deployment is in progress, it fails after %d seconds without progress", progressDeadlineSeconds),
+		}, nil
+	}
+	return &metav1.Condition{
+		Type:    authv1alpha1.DexServerConditionTypeDeploymentRolledOut,
+		Status:  metav1.ConditionTrue,
+		Reason:  "RolledOut",
+		Message: "all replicas of the dex deployment run its latest pod template",
+	}, nil
+}
+
+// getDeploymentImageCondition compares the image of the deployment with the desired dex image. previousDexImage is the
+// image of the deployment before this reconcile, used to report that the image was updated. Returns nil when either
+// the deployment or the desired image is not known.
+func (r *DexServerReconciler) getDeploymentImageCondition(dexServer *authv1alpha1.DexServer, previousDexImage string, ctx context.Context) *metav1.Condition {
+	log := ctrllog.FromContext(ctx)
+	desiredDexImage, err := getDexImagePullSpec()
+	if err != nil {
+		return nil
+	}
+	currentDexImage, err := r.getDeploymentImage(dexServer, ctx)
+	if err != nil || currentDexImage == "" {
+		return nil
+	}
+	if currentDexImage != desiredDexImage {
+		log.Info("dex deployment image differs from the desired image", "image", currentDexImage, "desiredImage", desiredDexImage)
+		return &metav1.Condition{
+			Type:    authv1alpha1.DexServerConditionTypeDeploymentImageUpToDate,
+			Status:  metav1.ConditionFalse,
+			Reason:  "ImageOutdated",
+			Message: fmt.Sprintf("deployment image %s differs from the desired image %s", currentDexImage, desiredDexImage),
+		}
+	}
+	if previousDexImage != "" && previousDexImage != desiredDexImage {
+		log.Info("updated dex deployment image", "previousImage", previousDexImage, "image", desiredDexImage)
+		return &metav1.Condition{
+			Type:    authv1alpha1.DexServerConditionTypeDeploymentImageUpToDate,
+			Status:  metav1.ConditionTrue,
+			Reason:  "ImageUpdated",
+			Message: fmt.Sprintf("deployment image updated from %s to %s", previousDexImage, desiredDexImage),
+		}
+	}
+	return &metav1.Condition{
+		Type:    authv1alpha1.DexServerConditionTypeDeploymentImageUpToDate,
+		Status:  metav1.ConditionTrue,
+		Reason:  "ImageUpToDate",
+		Message: fmt.Sprintf("deployment runs the desired image %s", desiredDexImage),
+	}
+}
+
+// dexServerSyncPhase is a single step of the DexServer reconcile
+type dexServerSyncPhase struct {
+	// The condition type reporting the outcome of this phase
+	conditionType string
+	// The condition reason used when this phase fails
+	failedReason string
+	// Name of the managed resource, used in logs and condition messages
+	resource string
+	sync     func(*authv1alpha1.DexServer, context.Context) error
+}
+
+// phaseWaitingError is returned by a sync phase that waits on another component, for example for a certificate to be
+// issued. The reconcile stops without an error, reports reason on the conditions and is requeued after requeueAfter.
+type phaseWaitingError struct {
+	reason       string
+	message      string
+	requeueAfter time.Duration
+}
+
+func (e *phaseWaitingError) Error() string {
+	return e.message
+}
+
+// phaseFailedError is returned by a sync phase to report its failure with reason instead of the failed reason of the
+// phase, for example for an invalid value that is only checked while the resource is rendered
+type phaseFailedError struct {
+	reason string
+	err    error
+}
+
+func (e *phaseFailedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *phaseFailedError) Unwrap() error {
+	return e.err
+}
+
+// phaseConditionsKey is the context key of the additional conditions reported by the sync phases of a reconcile
+type phaseConditionsKey struct{}
+
+// withPhaseConditions returns a context in which sync phases can report conditions, besides their own, with
+// addPhaseCondition. The reported conditions are returned and recorded with the conditions of the reconcile.
+func withPhaseConditions(ctx context.Context) (context.Context, *[]metav1.Condition) {
+	phaseConditions := &[]metav1.Condition{}
+	return context.WithValue(ctx, phaseConditionsKey{}, phaseConditions), phaseConditions
+}
+
+// addPhaseCondition reports a condition from a sync phase
+func addPhaseCondition(ctx context.Context, condition metav1.Condition) {
+	if phaseConditions, ok := ctx.Value(phaseConditionsKey{}).(*[]metav1.Condition); ok {
+		*phaseConditions = append(*phaseConditions, condition)
+	}
+}
+
+// syncPhases returns the reconcile phases in the order they are applied. While the gRPC API is deferred, its phases
+// are replaced by a final phase that waits for the HTTP path to become available.
+func (r *DexServerReconciler) syncPhases(dexServer *authv1alpha1.DexServer, ctx context.Context) ([]dexServerSyncPhase, error) {
+	grpcEnabled, err := r.isGRPCEnabled(dexServer, ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Prepare Mutual TLS for gRPC connection
+	mtlsPhase := dexServerSyncPhase{authv1alpha1.DexServerConditionTypeMTLSSecretReady, "ConfigMTLSSecretFailed", "MTLS secret", r.manageMTLSSecret}
+	grpcServicePhase := dexServerSyncPhase{authv1alpha1.DexServerConditionTypeGRPCServiceReady, "ConfigGRPCServiceFailed", "grpc service", r.syncServiceGrpc}
+	if !grpcEnabled {
+		mtlsPhase.sync = waitForHTTPAvailable
+	}
+
+	phases := []dexServerSyncPhase{}
+	if grpcEnabled {
+		phases = append(phases, mtlsPhase)
+	}
+	phases = append(phases,
+		dexServerSyncPhase{authv1alpha1.DexServerConditionTypeConfigMapReady, "ConfigMapFailed", "ConfigMap", r.syncConfigMap},
+		dexServerSyncPhase{authv1alpha1.DexServerConditionTypeCABundleReady, "ConfigCABundleFailed", "CA bundle ConfigMap", r.syncCABundleConfigMap},
+		dexServerSyncPhase{authv1alpha1.DexServerConditionTypeHTTPServiceReady, "ConfigHTTPServiceFailed", "http service", r.syncService},
+	)
+	if grpcEnabled {
+		phases = append(phases, grpcServicePhase)
+	}
+	phases = append(phases,
+		dexServerSyncPhase{authv1alpha1.DexServerConditionTypeServiceAccountReady, "ConfigServiceAccountFailed", "ServiceAccount", r.syncServiceAccount},
+		dexServerSyncPhase{authv1alpha1.DexServerConditionTypeClusterRoleBindingReady, "ConfigClusterRoleBindingFailed", "storage RBAC", r.syncStorageRBAC},
+		dexServerSyncPhase{authv1alpha1.DexServerConditionTypeDeploymentReady, "ConfigDeploymentFailed", "Deployment", r.syncDeployment},
+		dexServerSyncPhase{authv1alpha1.DexServerConditionTypePodDisruptionBudgetReady, "ConfigPodDisruptionBudgetFailed", "PodDisruptionBudget", r.syncPodDisruptionBudget},
+		dexServerSyncPhase{authv1alpha1.DexServerConditionTypeAutoscalerReady, "ConfigAutoscalerFailed", "HorizontalPodAutoscaler", r.syncAutoscaler},
+	)
+	if getRouteType(dexServer) == authv1alpha1.RouteTypeRoute {
+		phases = append(phases, dexServerSyncPhase{authv1alpha1.DexServerConditionTypeRouteReady, "ConfigRouteFailed", "Route", r.syncRoute})
+	} else {
+		phases = append(phases, dexServerSyncPhase{authv1alpha1.DexServerConditionTypeIngressReady, "ConfigIngressFailed", "Ingress", r.syncIngress})
+	}
+	if !grpcEnabled {
+		phases = append(phases, mtlsPhase)
+	}
+	return phases, nil
+}
+
+// httpAvailableRequeueInterval is the interval at which a deferred gRPC API checks if the HTTP path is available
+var httpAvailableRequeueInterval = 30 * time.Second
+
+// waitForHTTPAvailable is the sync phase of a deferred gRPC API. It reports the pending gRPC phases and waits, the
+// gRPC API is enabled by the first reconcile after a dex pod becomes available.
+func waitForHTTPAvailable(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	message := "the gRPC API is deferred until the dex deployment is available"
+	addPhaseCondition(ctx, metav1.Condition{
+		Type:    authv1alpha1.DexServerConditionTypeGRPCServiceReady,
+		Status:  metav1.ConditionFalse,
+		Reason:  "WaitingForHTTPAvailable",
+		Message: message,
+	})
+	return &phaseWaitingError{
+		reason:       "WaitingForHTTPAvailable",
+		message:      message,
+		requeueAfter: httpAvailableRequeueInterval,
+	}
+}
+
+// isGRPCEnabled returns true when dex serves the gRPC API. A deferred gRPC API is enabled once a dex pod is
+// available, and stays enabled once its mTLS secret exists.
+func (r *DexServerReconciler) isGRPCEnabled(dexServer *authv1alpha1.DexServer, ctx context.Context) (bool, error) {
+	if !dexServer.Spec.DeferGRPC {
+		return true, nil
+	}
+	if _, err := r.getMTLSSecret(dexServer, ctx); err == nil {
+		return true, nil
+	} else if !kubeerrors.IsNotFound(err) {
+		return false, errors.Wrap(err, "error getting dex server grpc mtls secret")
+	}
+	deployment, err := r.KubeClient.AppsV1().Deployments(dexServer.Namespace).Get(ctx, dexServer.Name, metav1.GetOptions{})
+	if err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "error getting dex server deployment")
+	}
+	return deployment.Status.AvailableReplicas > 0, nil
 }
 
 // Check if the secret already contains the required label "auth.identitatem.io/idp-credential"
@@ -265,47 +848,247 @@ func checkAndAddLabelToSecret(secret *corev1.Secret, r *DexServerReconciler, ctx
 	}
 }
 
-func getConnectorSecretFromRef(connector authv1alpha1.ConnectorSpec, m *authv1alpha1.DexServer, r *DexServerReconciler, ctx context.Context) (string, error) {
-	var secretNamespace, secretName string
+// getConnectorSecretParam returns the dex config parameter of the connector credential
+func getConnectorSecretParam(connector authv1alpha1.ConnectorSpec) string {
+	if connector.Type == authv1alpha1.ConnectorTypeLDAP {
+		return "bindPW"
+	}
+	return "clientSecret"
+}
+
+// getConnectorSecretRef returns the secret reference holding the credential of the connector, along with the
+// key of the credential in the secret. The secret namespace defaults to the DexServer namespace, and the key to the
+// dex config parameter of the credential.
+func getConnectorSecretRef(connector authv1alpha1.ConnectorSpec, m *authv1alpha1.DexServer) (corev1.SecretReference, string, error) {
+	var secretRef corev1.SecretReference
+	var secretKey string
 
 	switch connector.Type {
 	case authv1alpha1.ConnectorTypeGitHub:
-		secretName = connector.GitHub.ClientSecretRef.Name
-		if secretNamespace = connector.GitHub.ClientSecretRef.Namespace; secretNamespace == "" {
-			secretNamespace = m.Namespace
+		secretRef = connector.GitHub.ClientSecretRef
+		secretKey = connector.GitHub.ClientSecretKey
+	case authv1alpha1.ConnectorTypeMicrosoft:
+		secretRef = connector.Microsoft.ClientSecretRef
+		secretKey = connector.Microsoft.ClientSecretKey
+	case authv1alpha1.ConnectorTypeGoogle:
+		secretRef = connector.Google.ClientSecretRef
+		secretKey = connector.Google.ClientSecretKey
+	case authv1alpha1.ConnectorTypeLDAP:
+		secretRef = connector.LDAP.BindPWRef
+		secretKey = connector.LDAP.BindPWKey
+	default:
+		return secretRef, "", fmt.Errorf("could not retrieve secret")
+	}
+	if secretRef.Namespace == "" {
+		secretRef.Namespace = m.Namespace
+	}
+	if secretKey == "" {
+		secretKey = getConnectorSecretParam(connector)
+	}
+	return secretRef, secretKey, nil
+}
+
+// getConnectorLogger returns the logger of the diagnostics of a connector. They are logged at the debug level, or at
+// the info level for the connectors listed in the debug-connectors annotation of the DexServer. Secret values must
+// never be logged.
+func getConnectorLogger(connector authv1alpha1.ConnectorSpec, m *authv1alpha1.DexServer, ctx context.Context) logr.Logger {
+	log := ctrllog.FromContext(ctx).WithValues("connector", connector.Id)
+	for _, id := range strings.Split(m.Annotations[DEBUG_CONNECTORS_ANNOTATION], ",") {
+		if strings.TrimSpace(id) == connector.Id {
+			return log
 		}
-		resource := &corev1.Secret{}
-		if err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: secretNamespace}, resource); err != nil && kubeerrors.IsNotFound(err) {
+	}
+	return log.V(1)
+}
+
+// getConnectorSecretFromRef returns the credential of a typed connector, redacted when printed or logged
+func getConnectorSecretFromRef(connector authv1alpha1.ConnectorSpec, m *authv1alpha1.DexServer, r *DexServerReconciler, ctx context.Context) (secretString, error) {
+	connectorLog := getConnectorLogger(connector, m, ctx)
+	secretRef, secretKey, err := getConnectorSecretRef(connector, m)
+	if err != nil {
+		return "", err
+	}
+	connectorLog.Info("resolving connector secret", "Secret.Namespace", secretRef.Namespace, "Secret.Name", secretRef.Name, "key", secretKey)
+	if err := r.checkSecretNamespaceAllowed(m, secretRef.Namespace); err != nil {
+		connectorLog.Info("connector secret namespace is not allowed", "Secret.Namespace", secretRef.Namespace)
+		return "", err
+	}
+	resource := &corev1.Secret{}
+	if err := r.getSecretWithTimeout(ctx, types.NamespacedName{Name: secretRef.Name, Namespace: secretRef.Namespace}, resource); err != nil {
+		if kubeerrors.IsNotFound(err) {
+			connectorLog.Info("connector secret not found", "Secret.Namespace", secretRef.Namespace, "Secret.Name", secretRef.Name)
 			return "", err
 		}
-		checkAndAddLabelToSecret(resource, r, ctx)
-		return string(resource.Data["clientSecret"]), nil
-	case authv1alpha1.ConnectorTypeMicrosoft:
-		secretName = connector.Microsoft.ClientSecretRef.Name
-		if secretNamespace = connector.Microsoft.ClientSecretRef.Namespace; secretNamespace == "" {
-			secretNamespace = m.Namespace
-		}
-		resource := &corev1.Secret{}
-		if err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: secretNamespace}, resource); err != nil && kubeerrors.IsNotFound(err) {
+		if isSecretFetchTimeout(err) {
+			connectorLog.Info("timed out reading connector secret", "Secret.Namespace", secretRef.Namespace, "Secret.Name", secretRef.Name)
 			return "", err
 		}
-		checkAndAddLabelToSecret(resource, r, ctx)
-		return string(resource.Data["clientSecret"]), nil
-	case authv1alpha1.ConnectorTypeLDAP:
-		secretName = connector.LDAP.BindPWRef.Name
-		if secretNamespace = connector.LDAP.BindPWRef.Namespace; secretNamespace == "" {
-			secretNamespace = m.Namespace
+		return "", errors.Wrapf(err, "error reading connector secret %s/%s", secretRef.Namespace, secretRef.Name)
+	}
+	_, labeled := resource.Labels[IDP_CREDENTIAL_LABEL]
+	checkAndAddLabelToSecret(resource, r, ctx)
+	connectorLog.Info("resolved connector secret", "Secret.Namespace", secretRef.Namespace, "Secret.Name", secretRef.Name,
+		"key", secretKey, "keyPresent", len(resource.Data[secretKey]) > 0, "watchLabelAdded", !labeled)
+	return secretString(resource.Data[secretKey]), nil
+}
+
+// checkConnectorSecretKey returns an error when the secret of a typed connector exists but has no credential under
+// the configured key, which would otherwise render an empty credential into the dex config. A missing secret or a
+// disallowed namespace is reported when the credential is resolved, a timed out read is returned as is and any other
+// read error is wrapped.
+func (r *DexServerReconciler) checkConnectorSecretKey(connector authv1alpha1.ConnectorSpec, m *authv1alpha1.DexServer, ctx context.Context) error {
+	secretRef, secretKey, err := getConnectorSecretRef(connector, m)
+	if err != nil || secretRef.Name == "" {
+		return nil
+	}
+	if err := r.checkSecretNamespaceAllowed(m, secretRef.Namespace); err != nil {
+		return nil
+	}
+	secret := &corev1.Secret{}
+	if err := r.getSecretWithTimeout(ctx, types.NamespacedName{Name: secretRef.Name, Namespace: secretRef.Namespace}, secret); err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return nil
 		}
-		resource := &corev1.Secret{}
-		if err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: secretNamespace}, resource); err != nil && kubeerrors.IsNotFound(err) {
-			return "", err
+		if isSecretFetchTimeout(err) {
+			return err
 		}
-		checkAndAddLabelToSecret(resource, r, ctx)
-		return string(resource.Data["bindPW"]), nil
-	default:
-		return "", fmt.Errorf("could not retrieve secret")
+		return errors.Wrapf(err, "connector %s: error reading secret %s/%s", connector.Id, secretRef.Namespace, secretRef.Name)
+	}
+	if _, found := secret.Data[secretKey]; !found {
+		return &phaseFailedError{
+			reason: "ConnectorSecretKeyMissing",
+			err:    fmt.Errorf("connector %s: secret %s/%s has no key %s", connector.Id, secretRef.Namespace, secretRef.Name, secretKey),
+		}
+	}
+	return nil
+}
+
+// checkSecretNamespaceAllowed returns an error if the DexServer may not read secrets from namespace
+func (r *DexServerReconciler) checkSecretNamespaceAllowed(m *authv1alpha1.DexServer, namespace string) error {
+	if len(r.AllowedSecretNamespaces) == 0 || namespace == "" || namespace == m.Namespace {
+		return nil
+	}
+	for _, allowedNamespace := range r.AllowedSecretNamespaces {
+		if namespace == allowedNamespace {
+			return nil
+		}
+	}
+	return fmt.Errorf("secrets in namespace %s are not allowed for DexServer %s/%s, allowed namespaces are %s",
+		namespace, m.Namespace, m.Name, strings.Join(r.AllowedSecretNamespaces, ", "))
+}
+
+// validateConnectorSecretNamespaces checks that all secrets referenced by the connectors are in allowed namespaces
+func (r *DexServerReconciler) validateConnectorSecretNamespaces(m *authv1alpha1.DexServer) error {
+	for _, connector := range m.Spec.Connectors {
+		if secretRef, _, err := getConnectorSecretRef(connector, m); err == nil {
+			if err := r.checkSecretNamespaceAllowed(m, secretRef.Namespace); err != nil {
+				return fmt.Errorf("connector %s: %s", connector.Id, err.Error())
+			}
+		}
+		if connector.Type == authv1alpha1.ConnectorTypeLDAP {
+			if err := r.checkSecretNamespaceAllowed(m, connector.LDAP.RootCARef.Namespace); err != nil {
+				return fmt.Errorf("connector %s: %s", connector.Id, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// getConnectorSecretEnvName returns the name of the dex container environment variable holding the connector
+// credential when UseEnvExpansion is enabled, for example DEX_CONNECTOR_GITHUB_CLIENT_SECRET. It is named after the
+// dex config parameter, whatever the key of the credential in its secret.
+func getConnectorSecretEnvName(connector authv1alpha1.ConnectorSpec) string {
+	sanitize := func(s string) string {
+		return strings.Map(func(c rune) rune {
+			if (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+				return c
+			}
+			return '_'
+		}, strings.ToUpper(s))
 	}
+	// clientSecret -> CLIENT_SECRET, bindPW -> BIND_PW
+	key := regexp.MustCompile("([a-z0-9])([A-Z])").ReplaceAllString(getConnectorSecretParam(connector), "${1}_${2}")
+	return "DEX_CONNECTOR_" + sanitize(connector.Id) + "_" + sanitize(key)
+}
 
+// getConnectorSecretValue returns the value to render into the dex config for the connector credential. When
+// UseEnvExpansion is enabled this is a reference to the environment variable holding the credential, which dex
+// expands at startup, so that the secret itself is kept out of the ConfigMap.
+func getConnectorSecretValue(connector authv1alpha1.ConnectorSpec, m *authv1alpha1.DexServer, r *DexServerReconciler, ctx context.Context) (secretString, error) {
+	secretValue, err := getConnectorSecretFromRef(connector, m, r, ctx)
+	if err != nil {
+		return secretValue, err
+	}
+	if m.Spec.UseEnvExpansion {
+		return secretString("$" + getConnectorSecretEnvName(connector)), nil
+	}
+	// The config of a paused DexServer is recorded in its status
+	if m.Spec.Paused {
+		return REDACTED, nil
+	}
+	return secretValue, nil
+}
+
+// getConnectorSecretEnvVars returns the dex container environment variables populated from the connector
+// secrets when UseEnvExpansion is enabled
+func getConnectorSecretEnvVars(m *authv1alpha1.DexServer) ([]corev1.EnvVar, error) {
+	var envVars []corev1.EnvVar
+	if !m.Spec.UseEnvExpansion {
+		return envVars, nil
+	}
+	for _, connector := range m.Spec.Connectors {
+		// Connectors configured by rawConfig only have no secret reference
+		if !isTypedConnector(connector.Type, connector) {
+			continue
+		}
+		secretRef, secretKey, err := getConnectorSecretRef(connector, m)
+		if err != nil {
+			return nil, err
+		}
+		// A secretKeyRef can only refer to a secret in the namespace of the pod
+		if secretRef.Namespace != m.Namespace {
+			return nil, fmt.Errorf("secret %s/%s for connector %s must be in namespace %s when useEnvExpansion is enabled",
+				secretRef.Namespace, secretRef.Name, connector.Id, m.Namespace)
+		}
+		envVars = append(envVars, corev1.EnvVar{
+			Name: getConnectorSecretEnvName(connector),
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: secretRef.Name},
+					Key:                  secretKey,
+				},
+			},
+		})
+	}
+	return envVars, nil
+}
+
+// getConnectorSecretsHash returns the hash of the connector credentials referenced by the environment variables of
+// envVars. With UseEnvExpansion the credentials are not part of the dex config and dex only reads its environment at
+// startup, so their changes are rolled out through this hash on the pod template. Missing secrets are skipped.
+func (r *DexServerReconciler) getConnectorSecretsHash(dexServer *authv1alpha1.DexServer, envVars []corev1.EnvVar, ctx context.Context) (string, error) {
+	if len(envVars) == 0 {
+		return "", nil
+	}
+	h := sha256.New()
+	for _, envVar := range envVars {
+		if envVar.ValueFrom == nil || envVar.ValueFrom.SecretKeyRef == nil {
+			continue
+		}
+		secretKeyRef := envVar.ValueFrom.SecretKeyRef
+		secret := &corev1.Secret{}
+		if err := r.getSecretWithTimeout(ctx, types.NamespacedName{Name: secretKeyRef.Name, Namespace: dexServer.Namespace}, secret); err != nil {
+			if kubeerrors.IsNotFound(err) {
+				continue
+			}
+			return "", errors.Wrapf(err, "error getting connector secret %s", secretKeyRef.Name)
+		}
+		h.Write([]byte(envVar.Name))
+		h.Write([]byte(secret.Name))
+		h.Write([]byte(secretKeyRef.Key))
+		h.Write(secret.Data[secretKeyRef.Key])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
 
 // Define the secret for grpc Mutual TLS. This secret is volume mounted on the dex instance pod. The client cert should be loaded by the gRPC client code.
@@ -315,6 +1098,10 @@ func (r *DexServerReconciler) defineMTLSSecret(m *authv1alpha1.DexServer, mtlsCe
 	}
 	annotations := map[string]string{
 		MTLS_CERT_EXPIRY_ANNOTATION: mtlsCerts.expiry.UTC().Format(time.RFC3339),
+		MTLS_CERT_SOURCE_ANNOTATION: string(getGRPCCertSource(m)),
+	}
+	if len(m.Spec.GRPCCertSANs) > 0 {
+		annotations[MTLS_CERT_SANS_ANNOTATION] = strings.Join(m.Spec.GRPCCertSANs, ",")
 	}
 	secretSpec := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
@@ -332,7 +1119,11 @@ func (r *DexServerReconciler) defineMTLSSecret(m *authv1alpha1.DexServer, mtlsCe
 			"client.key": mtlsCerts.clientPrivKeyPEM.Bytes(),
 		},
 	}
-	ctrl.SetControllerReference(m, secretSpec, r.Scheme)
+	// The CA key is only known for self-signed certs
+	if mtlsCerts.caPrivKeyPEM.Len() == 0 {
+		delete(secretSpec.Data, "ca.key")
+	}
+	r.setOwnerReference(m, secretSpec)
 	return secretSpec
 }
 
@@ -373,46 +1164,237 @@ func (r *DexServerReconciler) manageMTLSSecret(dexServer *authv1alpha1.DexServer
 				regenerate = true
 			}
 
-		}
+		}
+		// the additional SANs of the server cert changed... regenerate
+		if secret.Annotations[MTLS_CERT_SANS_ANNOTATION] != strings.Join(dexServer.Spec.GRPCCertSANs, ",") {
+			log.V(1).Info("mtls cert SANs changed... regenerate")
+			regenerate = true
+		}
+		// the generated server cert lacks DNS names of the gRPC service... regenerate
+		if getGRPCCertSource(dexServer) == authv1alpha1.GRPCCertSourceSelfSigned &&
+			!hasGRPCServiceDNSNames(secret.Data["tls.crt"], dexServer.Namespace) {
+			log.V(1).Info("mtls cert lacks the gRPC service DNS names... regenerate")
+			regenerate = true
+		}
+		// the cert source changed... regenerate
+		if getMTLSSecretCertSource(secret) != getGRPCCertSource(dexServer) {
+			log.V(1).Info("mtls cert source changed... regenerate")
+			regenerate = true
+		}
+		// cert-manager renews the certs itself... copy them on every reconcile
+		if getGRPCCertSource(dexServer) == authv1alpha1.GRPCCertSourceCertManager {
+			regenerate = true
+		}
+	}
+	if !secretExists || regenerate {
+		mTLSCerts, err := r.getMTLSCerts(dexServer, ctx)
+		if err != nil {
+			return errors.Wrap(err, "error generating mtls certs")
+		}
+		spec := r.defineMTLSSecret(dexServer, mTLSCerts)
+		if !secretExists {
+			log.Info("Creating a new MTLS Secret", "Secret.Namespace", spec.Namespace, "Secret.Name", spec.Name)
+			if err := r.Create(ctx, spec); err != nil {
+				return errors.Wrap(err, "error creating mtls secret")
+			}
+			r.recordEvent(dexServer, corev1.EventTypeNormal, "MTLSSecretCreated", "gRPC mTLS secret %s created", spec.Name)
+		} else if equality.Semantic.DeepEqual(secret.Data, spec.Data) && equality.Semantic.DeepEqual(secret.Annotations, spec.Annotations) {
+			log.V(1).Info("mtls cert unchanged")
+		} else {
+			log.Info("Updating MTLS Secret", "Secret.Namespace", spec.Namespace, "Secret.Name", spec.Name)
+			if err := r.Update(ctx, spec); err != nil {
+				return errors.Wrap(err, "error updating mtls secret")
+			}
+			r.recordEvent(dexServer, corev1.EventTypeNormal, "MTLSSecretRotated", "gRPC mTLS secret %s rotated", spec.Name)
+		}
+		if getGRPCCertSource(dexServer) == authv1alpha1.GRPCCertSourceKubeCSR {
+			if err := r.cleanupGRPCCertCSRs(dexServer, ctx); err != nil {
+				return err
+			}
+		}
+	} else {
+		log.V(1).Info("mtls cert found and does not require renewal")
+	}
+	if mtlsSecret, err := r.getMTLSSecret(dexServer, ctx); err == nil {
+		if expiryTime, err := time.Parse(time.RFC3339, mtlsSecret.Annotations[MTLS_CERT_EXPIRY_ANNOTATION]); err == nil {
+			setMTLSCertExpiryMetric(dexServer, expiryTime)
+		}
+	}
+	return nil
+}
+
+func (r *DexServerReconciler) syncServiceAccount(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+	log.Info("syncServiceAccount", "ServiceAccount.Name", SERVICE_ACCOUNT_NAME)
+
+	values := struct {
+		ServiceAccountName string
+		DexServer          *authv1alpha1.DexServer
+	}{
+		ServiceAccountName: SERVICE_ACCOUNT_NAME,
+		DexServer:          dexServer,
+	}
+
+	files := []string{
+		"dex-server/service_account.yaml",
+	}
+
+	applier, readerDeploy := r.getApplierAndReader(dexServer)
+	_, err := applier.ApplyDirectly(readerDeploy, values, false, "", files...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Storage CustomResourceDefinitions dex registers when it uses kubernetes storage
+var dexStorageCRDNames = []string{
+	"authcodes.dex.coreos.com",
+	"authrequests.dex.coreos.com",
+	"connectors.dex.coreos.com",
+	"oauth2clients.dex.coreos.com",
+	"offlinesessionses.dex.coreos.com",
+	"passwords.dex.coreos.com",
+	"refreshtokens.dex.coreos.com",
+	"signingkeies.dex.coreos.com",
+}
+
+// getRBACScope returns the scope of the RBAC dex needs for its storage. Unless set on the DexServer, the least
+// privilege is used: dex only needs to register its storage CRDs, which requires a cluster scoped binding, when
+// they are not installed yet.
+func (r *DexServerReconciler) getRBACScope(dexServer *authv1alpha1.DexServer, ctx context.Context) (authv1alpha1.RBACScopeType, error) {
+	if dexServer.Spec.RBACScope != "" {
+		return dexServer.Spec.RBACScope, nil
+	}
+	for _, crdName := range dexStorageCRDNames {
+		if _, err := r.APIExtensionClient.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, crdName, metav1.GetOptions{}); err != nil {
+			if kubeerrors.IsNotFound(err) {
+				return authv1alpha1.RBACScopeCluster, nil
+			}
+			return "", err
+		}
+	}
+	return authv1alpha1.RBACScopeNamespace, nil
+}
+
+// getNamespaceRBACScope returns the widest RBAC scope of the DexServers in the namespace of dexServer. They share the
+// service account of dex and its bindings, so the binding of the other scope is only removed when no DexServer of
+// the namespace needs it.
+func (r *DexServerReconciler) getNamespaceRBACScope(dexServer *authv1alpha1.DexServer, ctx context.Context) (authv1alpha1.RBACScopeType, error) {
+	scope, err := r.getRBACScope(dexServer, ctx)
+	if err != nil || scope == authv1alpha1.RBACScopeCluster {
+		return scope, err
+	}
+	dexServers := &authv1alpha1.DexServerList{}
+	if err := r.List(ctx, dexServers, client.InNamespace(dexServer.Namespace)); err != nil {
+		return "", err
+	}
+	for i := range dexServers.Items {
+		other := &dexServers.Items[i]
+		if other.Name == dexServer.Name || !other.DeletionTimestamp.IsZero() {
+			continue
+		}
+		otherScope, err := r.getRBACScope(other, ctx)
+		if err != nil {
+			return "", err
+		}
+		if otherScope == authv1alpha1.RBACScopeCluster {
+			return otherScope, nil
+		}
+	}
+	return scope, nil
+}
+
+// syncStorageRBAC binds dex to the role of the required scope and removes the binding of the other scope
+func (r *DexServerReconciler) syncStorageRBAC(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+	scope, err := r.getNamespaceRBACScope(dexServer, ctx)
+	if err != nil {
+		return err
+	}
+	log.Info("syncStorageRBAC", "scope", scope)
+
+	roleName := SERVICE_ACCOUNT_NAME
+	clusterRoleBindingName := SERVICE_ACCOUNT_NAME + "-" + dexServer.Namespace
+	if scope == authv1alpha1.RBACScopeCluster {
+		if err := r.syncClusterRoleBinding(dexServer, ctx); err != nil {
+			return err
+		}
+		if err := r.KubeClient.RbacV1().RoleBindings(dexServer.Namespace).Delete(ctx, roleName, metav1.DeleteOptions{}); err != nil && !kubeerrors.IsNotFound(err) {
+			return err
+		}
+		if err := r.KubeClient.RbacV1().Roles(dexServer.Namespace).Delete(ctx, roleName, metav1.DeleteOptions{}); err != nil && !kubeerrors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	if err := r.syncRoleBinding(dexServer, ctx); err != nil {
+		return err
+	}
+	if err := r.KubeClient.RbacV1().ClusterRoleBindings().Delete(ctx, clusterRoleBindingName, metav1.DeleteOptions{}); err != nil && !kubeerrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// finalizeDexServer deletes the ClusterRoleBinding of a deleted DexServer and then removes the finalizer. The
+// binding is shared by the DexServers of a namespace, it is kept as long as another one remains.
+func (r *DexServerReconciler) finalizeDexServer(dexServer *authv1alpha1.DexServer, ctx context.Context) (ctrl.Result, error) {
+	log := ctrllog.FromContext(ctx)
+	if !controllerutil.ContainsFinalizer(dexServer, DEX_SERVER_FINALIZER) {
+		return ctrl.Result{}, nil
 	}
-	if !secretExists || regenerate {
-		mTLSCerts, err := generateMTLSCerts(dexServer.Namespace)
-		if err != nil {
-			return errors.Wrap(err, "error generating mtls certs")
-		}
-		spec := r.defineMTLSSecret(dexServer, mTLSCerts)
-		if !secretExists {
-			log.Info("Creating a new MTLS Secret", "Secret.Namespace", spec.Namespace, "Secret.Name", spec.Name)
-			if err := r.Create(ctx, spec); err != nil {
-				return errors.Wrap(err, "error creating mtls secret")
-			}
-		} else {
-			log.Info("Updating MTLS Secret", "Secret.Namespace", spec.Namespace, "Secret.Name", spec.Name)
-			if err := r.Update(ctx, spec); err != nil {
-				return errors.Wrap(err, "error updating mtls secret")
-			}
+
+	dexServers := &authv1alpha1.DexServerList{}
+	if err := r.List(ctx, dexServers, client.InNamespace(dexServer.Namespace)); err != nil {
+		return ctrl.Result{}, err
+	}
+	inUse := false
+	for _, other := range dexServers.Items {
+		if other.Name != dexServer.Name && other.DeletionTimestamp.IsZero() {
+			inUse = true
+			break
 		}
+	}
 
+	clusterRoleBindingName := SERVICE_ACCOUNT_NAME + "-" + dexServer.Namespace
+	if inUse {
+		log.Info("ClusterRoleBinding still used by another DexServer", "ClusterRoleBinding.Name", clusterRoleBindingName)
 	} else {
-		log.V(1).Info("mtls cert found and does not require renewal")
+		log.Info("deleting ClusterRoleBinding", "ClusterRoleBinding.Name", clusterRoleBindingName)
+		if err := r.KubeClient.RbacV1().ClusterRoleBindings().Delete(ctx, clusterRoleBindingName, metav1.DeleteOptions{}); err != nil && !kubeerrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
 	}
-	return nil
+
+	deleteMTLSCertExpiryMetric(dexServer)
+	controllerutil.RemoveFinalizer(dexServer, DEX_SERVER_FINALIZER)
+	if err := r.Update(ctx, dexServer); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
 }
 
-func (r *DexServerReconciler) syncServiceAccount(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+func (r *DexServerReconciler) syncRoleBinding(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
 	log := ctrllog.FromContext(ctx)
-	log.Info("syncServiceAccount", "ServiceAccount.Name", SERVICE_ACCOUNT_NAME)
+	roleName := SERVICE_ACCOUNT_NAME
+	log.Info("syncRoleBinding", "RoleBinding.Name", roleName)
 
 	values := struct {
+		RoleName           string
 		ServiceAccountName string
 		DexServer          *authv1alpha1.DexServer
 	}{
+		RoleName:           roleName,
 		ServiceAccountName: SERVICE_ACCOUNT_NAME,
 		DexServer:          dexServer,
 	}
 
 	files := []string{
-		"dex-server/service_account.yaml",
+		"dex-server/role.yaml",
+		"dex-server/role_binding.yaml",
 	}
 
 	applier, readerDeploy := r.getApplierAndReader(dexServer)
@@ -454,10 +1436,14 @@ func (r *DexServerReconciler) syncClusterRoleBinding(dexServer *authv1alpha1.Dex
 	return nil
 }
 
+// errDexImageNotConfigured is returned by getDexImagePullSpec when the operator has no dex image to deploy
+var errDexImageNotConfigured = fmt.Errorf("required environment variable %v is empty or not set, set it to the pull spec "+
+	"of the dex image in the deployment of the operator", DEX_IMAGE_ENV_NAME)
+
 func getDexImagePullSpec() (string, error) {
 	imageName := os.Getenv(DEX_IMAGE_ENV_NAME)
 	if len(imageName) == 0 {
-		return "", fmt.Errorf("required environment variable %v is empty or not set", DEX_IMAGE_ENV_NAME)
+		return "", errDexImageNotConfigured
 	}
 	return imageName, nil
 }
@@ -466,7 +1452,8 @@ func getDexImagePullSpec() (string, error) {
 func (r *DexServerReconciler) syncDeployment(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
 	dexImage, err := getDexImagePullSpec()
 	if err != nil {
-		return err
+		// A misconfiguration of the operator rather than of the DexServer, reported with its own reason
+		return &phaseFailedError{reason: "DexImageNotConfigured", err: err}
 	}
 	log := ctrllog.FromContext(ctx)
 	log.Info("syncDeployment", "DexImage", dexImage)
@@ -475,27 +1462,31 @@ func (r *DexServerReconciler) syncDeployment(dexServer *authv1alpha1.DexServer,
 	var additionalVolumes []corev1.Volume
 	var additionalVolumeMountsYaml, additionalVolumesYaml []byte
 	// Update Volume Mounts based on rootCA secret refs for LDAP connectors (Trusted Root CA and optionally client cert and key files)
+	// and on the client cert and key secret refs
 	// Iterate over connectors defined in the DexServer to create the dex configuration for connectors
 	for _, connector := range dexServer.Spec.Connectors {
-		if connector.Type == authv1alpha1.ConnectorTypeLDAP && connector.LDAP.RootCARef.Name != "" {
-			newVolume := corev1.Volume{
-				Name: "ldapcerts-" + connector.Id,
-				VolumeSource: corev1.VolumeSource{
-					Secret: &corev1.SecretVolumeSource{
-						SecretName: connector.LDAP.RootCARef.Name,
-					},
-				},
-			}
-
-			newVolumeMount := corev1.VolumeMount{
-				Name:      "ldapcerts-" + connector.Id,
-				MountPath: "/etc/dex/ldapcerts/" + connector.Id,
-			}
-
-			additionalVolumeMounts = append(additionalVolumeMounts, newVolumeMount)
-			additionalVolumes = append(additionalVolumes, newVolume)
-		}
+		ldapVolumes, ldapVolumeMounts := getLDAPCertVolumes(connector)
+		additionalVolumes = append(additionalVolumes, ldapVolumes...)
+		additionalVolumeMounts = append(additionalVolumeMounts, ldapVolumeMounts...)
+		githubVolumes, githubVolumeMounts := getGitHubCertVolumes(connector)
+		additionalVolumes = append(additionalVolumes, githubVolumes...)
+		additionalVolumeMounts = append(additionalVolumeMounts, githubVolumeMounts...)
+		googleVolumes, googleVolumeMounts := getGoogleServiceAccountVolumes(connector)
+		additionalVolumes = append(additionalVolumes, googleVolumes...)
+		additionalVolumeMounts = append(additionalVolumeMounts, googleVolumeMounts...)
+	}
+	storageVolumes, storageVolumeMounts := getStorageVolumes(dexServer)
+	additionalVolumes = append(additionalVolumes, storageVolumes...)
+	additionalVolumeMounts = append(additionalVolumeMounts, storageVolumeMounts...)
+	frontendVolumes, frontendVolumeMounts := getFrontendVolumes(dexServer)
+	additionalVolumes = append(additionalVolumes, frontendVolumes...)
+	additionalVolumeMounts = append(additionalVolumeMounts, frontendVolumeMounts...)
+	if err := r.checkTrustedCABundle(dexServer, ctx); err != nil {
+		return err
 	}
+	trustedCAVolumes, trustedCAVolumeMounts := getTrustedCABundleVolumes(dexServer)
+	additionalVolumes = append(additionalVolumes, trustedCAVolumes...)
+	additionalVolumeMounts = append(additionalVolumeMounts, trustedCAVolumeMounts...)
 	if len(additionalVolumeMounts) > 0 {
 		// Get yaml representation of additional volumeMounts and volumes
 		additionalVolumeMountsYaml, err = yaml.Marshal(&additionalVolumeMounts)
@@ -508,6 +1499,75 @@ func (r *DexServerReconciler) syncDeployment(dexServer *authv1alpha1.DexServer,
 		}
 	}
 
+	// When env expansion is enabled, connector secrets are injected as environment variables
+	var additionalEnvYaml []byte
+	additionalEnv, err := getConnectorSecretEnvVars(dexServer)
+	if err != nil {
+		return err
+	}
+	connectorSecretsHash, err := r.getConnectorSecretsHash(dexServer, additionalEnv, ctx)
+	if err != nil {
+		return err
+	}
+	additionalEnv = append(additionalEnv, getStorageEnvVars(dexServer)...)
+	if len(additionalEnv) > 0 {
+		additionalEnvYaml, err = yaml.Marshal(&additionalEnv)
+		if err != nil {
+			log.Error(err, "failed to marshal yaml for additional env")
+			return err
+		}
+	}
+
+	var resourcesYaml []byte
+	if dexServer.Spec.Resources != nil {
+		resourcesYaml, err = yaml.Marshal(dexServer.Spec.Resources)
+		if err != nil {
+			log.Error(err, "failed to marshal yaml for resources")
+			return err
+		}
+	}
+
+	var hostAliasesYaml []byte
+	if len(dexServer.Spec.HostAliases) > 0 {
+		hostAliasesYaml, err = yaml.Marshal(&dexServer.Spec.HostAliases)
+		if err != nil {
+			log.Error(err, "failed to marshal yaml for host aliases")
+			return err
+		}
+	}
+
+	var imagePullSecretsYaml []byte
+	if len(dexServer.Spec.ImagePullSecrets) > 0 {
+		imagePullSecretsYaml, err = yaml.Marshal(&dexServer.Spec.ImagePullSecrets)
+		if err != nil {
+			log.Error(err, "failed to marshal yaml for image pull secrets")
+			return err
+		}
+	}
+
+	var nodeSelectorYaml, tolerationsYaml, affinityYaml []byte
+	if len(dexServer.Spec.NodeSelector) > 0 {
+		nodeSelectorYaml, err = yaml.Marshal(&dexServer.Spec.NodeSelector)
+		if err != nil {
+			log.Error(err, "failed to marshal yaml for node selector")
+			return err
+		}
+	}
+	if len(dexServer.Spec.Tolerations) > 0 {
+		tolerationsYaml, err = yaml.Marshal(&dexServer.Spec.Tolerations)
+		if err != nil {
+			log.Error(err, "failed to marshal yaml for tolerations")
+			return err
+		}
+	}
+	if dexServer.Spec.Affinity != nil {
+		affinityYaml, err = yaml.Marshal(dexServer.Spec.Affinity)
+		if err != nil {
+			log.Error(err, "failed to marshal yaml for affinity")
+			return err
+		}
+	}
+
 	// Add the dex ConfigMap sha256 checksum to the Deployment to trigger rolling restarts when the ConfigMap changes
 	dexConfigMap := &corev1.ConfigMap{}
 	var dexConfigMapHash string
@@ -538,30 +1598,118 @@ func (r *DexServerReconciler) syncDeployment(dexServer *authv1alpha1.DexServer,
 		mtlsSecretExpiry = mtlsSecret.Annotations[MTLS_CERT_EXPIRY_ANNOTATION]
 	}
 
+	storageSecretHash, err := r.getStorageSecretHash(dexServer, ctx)
+	if err != nil {
+		return err
+	}
+	mountedSecretsHash, err := r.getMountedSecretsHash(dexServer, additionalVolumes, ctx)
+	if err != nil {
+		return err
+	}
+
+	livenessProbe, readinessProbe := getDexProbes(dexServer)
+	livenessProbeYaml, err := yaml.Marshal(livenessProbe)
+	if err != nil {
+		log.Error(err, "failed to marshal yaml for liveness probe")
+		return err
+	}
+	readinessProbeYaml, err := yaml.Marshal(readinessProbe)
+	if err != nil {
+		log.Error(err, "failed to marshal yaml for readiness probe")
+		return err
+	}
+	var lifecycleYaml []byte
+	if lifecycle := getDexLifecycle(dexServer); lifecycle != nil {
+		lifecycleYaml, err = yaml.Marshal(lifecycle)
+		if err != nil {
+			log.Error(err, "failed to marshal yaml for lifecycle")
+			return err
+		}
+	}
+
+	grpcEnabled, err := r.isGRPCEnabled(dexServer, ctx)
+	if err != nil {
+		return err
+	}
+
+	previousDeployment, err := r.KubeClient.AppsV1().Deployments(dexServer.Namespace).Get(ctx, dexServer.Name, metav1.GetOptions{})
+	if err != nil {
+		if !kubeerrors.IsNotFound(err) {
+			return errors.Wrap(err, "error getting dex server deployment")
+		}
+		previousDeployment = nil
+	}
+
 	values := struct {
-		DexImage               string
-		DexConfigMapHash       string
-		ServiceAccountName     string
-		TlsSecretName          string
-		MtlsSecretName         string
-		MtlsSecretExpiry       string
-		DexServer              *authv1alpha1.DexServer
-		AdditionalVolumeMounts string
-		AdditionalVolumes      string
+		DexImage                string
+		DexConfigMapHash        string
+		ConfigFileName          string
+		StorageSecretHash       string
+		MountedSecretsHash      string
+		ConnectorSecretsHash    string
+		RestartAnnotationKey    string
+		RestartedAt             string
+		ServiceAccountName      string
+		TlsSecretName           string
+		MtlsSecretName          string
+		MtlsSecretExpiry        string
+		GRPCEnabled             bool
+		ProgressDeadlineSeconds int32
+		Replicas                int32
+		FSGroup                 *int64
+		EmptyDirSizeLimit       string
+		DexServer               *authv1alpha1.DexServer
+		AdditionalVolumeMounts  string
+		AdditionalVolumes       string
+		AdditionalEnv           string
+		HostAliases             string
+		ImagePullSecrets        string
+		NodeSelector            string
+		Tolerations             string
+		Affinity                string
+		Resources               string
+		LivenessProbe           string
+		ReadinessProbe          string
+		Lifecycle               string
+		// The cluster default applies when empty
+		TerminationGracePeriod string
 	}{
-		DexImage:           dexImage,
-		DexConfigMapHash:   dexConfigMapHash,
-		ServiceAccountName: SERVICE_ACCOUNT_NAME,
-		// this secret is generated using service serving certificate via service annotation
+		DexImage:             dexImage,
+		DexConfigMapHash:     dexConfigMapHash,
+		ConfigFileName:       getConfigFileName(dexServer),
+		StorageSecretHash:    storageSecretHash,
+		MountedSecretsHash:   mountedSecretsHash,
+		ConnectorSecretsHash: connectorSecretsHash,
+		// The resulting deployment update is a restart, ignored by ignoreDeploymentRestartPredicate
+		RestartAnnotationKey: r.getRestartAnnotationKey(),
+		RestartedAt:          dexServer.Annotations[RESTART_ANNOTATION],
+		ServiceAccountName:   SERVICE_ACCOUNT_NAME,
+		// Unless set in the spec, this secret is generated using service serving certificate via service annotation
 		// service.beta.openshift.io/serving-cert-secret-name: dexServer.Name-tls-secret
-		TlsSecretName: fmt.Sprintf(dexServer.Name + SECRET_WEB_TLS_SUFFIX),
+		TlsSecretName: getWebTLSSecretName(dexServer),
 		// This secret is generated by this controller, here we load the server side cert and ca
 		// service.beta.openshift.io/serving-cert-secret-name: dexServer.Name-mtls-secret
-		MtlsSecretName:         SECRET_MTLS_NAME,
-		MtlsSecretExpiry:       mtlsSecretExpiry,
-		DexServer:              dexServer,
-		AdditionalVolumeMounts: string(additionalVolumeMountsYaml),
-		AdditionalVolumes:      string(additionalVolumesYaml),
+		MtlsSecretName:          SECRET_MTLS_NAME,
+		MtlsSecretExpiry:        mtlsSecretExpiry,
+		GRPCEnabled:             grpcEnabled,
+		ProgressDeadlineSeconds: getProgressDeadlineSeconds(dexServer),
+		Replicas:                getDeploymentReplicas(dexServer, previousDeployment),
+		FSGroup:                 dexServer.Spec.FSGroup,
+		EmptyDirSizeLimit:       getEmptyDirSizeLimit(dexServer),
+		DexServer:               dexServer,
+		AdditionalVolumeMounts:  string(additionalVolumeMountsYaml),
+		AdditionalVolumes:       string(additionalVolumesYaml),
+		AdditionalEnv:           string(additionalEnvYaml),
+		HostAliases:             string(hostAliasesYaml),
+		ImagePullSecrets:        string(imagePullSecretsYaml),
+		NodeSelector:            string(nodeSelectorYaml),
+		Tolerations:             string(tolerationsYaml),
+		Affinity:                string(affinityYaml),
+		Resources:               string(resourcesYaml),
+		LivenessProbe:           string(livenessProbeYaml),
+		ReadinessProbe:          string(readinessProbeYaml),
+		Lifecycle:               string(lifecycleYaml),
+		TerminationGracePeriod:  getTerminationGracePeriodSeconds(dexServer),
 	}
 
 	files := []string{
@@ -570,6 +1718,113 @@ func (r *DexServerReconciler) syncDeployment(dexServer *authv1alpha1.DexServer,
 
 	applier, readerDeploy := r.getApplierAndReader(dexServer)
 	_, err = applier.ApplyDeployments(readerDeploy, values, false, "", files...)
+	if err != nil && isImmutableFieldError(err) {
+		if !r.RecreateDeploymentOnImmutableChange {
+			return errors.Wrap(err, "an immutable field of the deployment changed, delete the deployment or enable "+
+				"the recreation of the deployment on immutable changes")
+		}
+		if err := r.deleteDeploymentForRecreate(dexServer, ctx); err != nil {
+			return err
+		}
+		if _, err := applier.ApplyDeployments(readerDeploy, values, false, "", files...); err != nil {
+			return errors.Wrap(err, "error recreating the deployment")
+		}
+		addPhaseCondition(ctx, metav1.Condition{
+			Type:    authv1alpha1.DexServerConditionTypeDeploymentRecreated,
+			Status:  metav1.ConditionTrue,
+			Reason:  "ImmutableFieldChanged",
+			Message: withReconcileIDMessage(ctx, "deployment recreated because an immutable field changed, dex is unavailable until the new pods are ready"),
+		})
+		r.recordEvent(dexServer, corev1.EventTypeNormal, "DeploymentRecreated", "Deployment %s recreated because an immutable field changed", dexServer.Name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	deployment, err := r.KubeClient.AppsV1().Deployments(dexServer.Namespace).Get(ctx, dexServer.Name, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "error getting dex server deployment")
+	}
+	if previousDeployment == nil {
+		r.recordEvent(dexServer, corev1.EventTypeNormal, "DeploymentCreated", "Deployment %s created", dexServer.Name)
+	} else if !equality.Semantic.DeepEqual(previousDeployment.Spec, deployment.Spec) {
+		r.recordEvent(dexServer, corev1.EventTypeNormal, "DeploymentUpdated", "Deployment %s updated", dexServer.Name)
+	}
+
+	return nil
+}
+
+// getReplicas returns the number of dex pods
+func getReplicas(dexServer *authv1alpha1.DexServer) int32 {
+	if dexServer.Spec.Replicas != nil {
+		return *dexServer.Spec.Replicas
+	}
+	return DEFAULT_REPLICAS
+}
+
+// getEmptyDirSizeLimit returns the size limit of the writable emptyDir volumes of the dex pods
+func getEmptyDirSizeLimit(dexServer *authv1alpha1.DexServer) string {
+	if dexServer.Spec.EmptyDirSizeLimit != nil {
+		return dexServer.Spec.EmptyDirSizeLimit.String()
+	}
+	return DEFAULT_EMPTY_DIR_SIZE_LIMIT
+}
+
+// The PodDisruptionBudget API, served from Kubernetes 1.21
+var podDisruptionBudgetGVK = policyv1.SchemeGroupVersion.WithKind("PodDisruptionBudget")
+
+// isAPIServed returns true if the cluster serves the kind, which a watch of its resources needs to start
+func (r *DexServerReconciler) isAPIServed(gvk schema.GroupVersionKind) bool {
+	resources, err := r.KubeClient.Discovery().ServerResourcesForGroupVersion(gvk.GroupVersion().String())
+	if err != nil {
+		return false
+	}
+	for _, resource := range resources.APIResources {
+		if resource.Kind == gvk.Kind {
+			return true
+		}
+	}
+	return false
+}
+
+// syncPodDisruptionBudget keeps all dex pods but one available while nodes are drained. A single dex pod has no
+// PodDisruptionBudget, which would block the drains, nor do clusters not serving the policy/v1 API.
+func (r *DexServerReconciler) syncPodDisruptionBudget(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+	if !r.isAPIServed(podDisruptionBudgetGVK) {
+		log.Info("skipping the PodDisruptionBudget, its API is not served", "apiVersion", podDisruptionBudgetGVK.GroupVersion().String())
+		return nil
+	}
+	replicas := getMinReplicas(dexServer)
+	if replicas <= 1 {
+		err := r.KubeClient.PolicyV1().PodDisruptionBudgets(dexServer.Namespace).Delete(ctx, dexServer.Name, metav1.DeleteOptions{})
+		if err == nil {
+			log.Info("deleted the PodDisruptionBudget, the deployment runs a single pod", "name", dexServer.Name)
+			return nil
+		}
+		if kubeerrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, "error deleting the PodDisruptionBudget")
+	}
+	minAvailable := replicas - 1
+	log.Info("syncPodDisruptionBudget", "MinAvailable", minAvailable)
+
+	values := struct {
+		MinAvailable int32
+		DexServer    *authv1alpha1.DexServer
+	}{
+		MinAvailable: minAvailable,
+		DexServer:    dexServer,
+	}
+
+	files := []string{
+		"dex-server/pod_disruption_budget.yaml",
+	}
+
+	applier, readerDeploy := r.getApplierAndReader(dexServer)
+	_, err := applier.ApplyDirectly(readerDeploy, values, false, "", files...)
 	if err != nil {
 		return err
 	}
@@ -577,16 +1832,66 @@ func (r *DexServerReconciler) syncDeployment(dexServer *authv1alpha1.DexServer,
 	return nil
 }
 
+// isImmutableFieldError returns true when an update was rejected because it changes an immutable field. The applier
+// does not wrap the API error, so only its message is left to check.
+func isImmutableFieldError(err error) bool {
+	return strings.Contains(err.Error(), "field is immutable")
+}
+
+// deleteDeploymentForRecreate deletes the dex deployment so that it can be recreated. Deployments that are not
+// generated for the DexServer are never deleted.
+func (r *DexServerReconciler) deleteDeploymentForRecreate(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+	deployment, err := r.KubeClient.AppsV1().Deployments(dexServer.Namespace).Get(ctx, dexServer.Name, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "error getting dex server deployment")
+	}
+	if deployment.Spec.Template.Labels["app"] != dexServer.Name {
+		return fmt.Errorf("deployment %s is not generated for DexServer %s and is not recreated", deployment.Name, dexServer.Name)
+	}
+	for _, ownerRef := range deployment.OwnerReferences {
+		if ownerRef.Kind == "DexServer" && ownerRef.UID != dexServer.UID {
+			return fmt.Errorf("deployment %s is owned by another DexServer and is not recreated", deployment.Name)
+		}
+	}
+	log.Info("Deleting Deployment to recreate it", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
+	propagation := metav1.DeletePropagationBackground
+	err = r.KubeClient.AppsV1().Deployments(dexServer.Namespace).Delete(ctx, deployment.Name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+		Preconditions:     &metav1.Preconditions{UID: &deployment.UID},
+	})
+	if err != nil && !kubeerrors.IsNotFound(err) {
+		return errors.Wrap(err, "error deleting dex server deployment")
+	}
+	return nil
+}
+
 func (r *DexServerReconciler) syncService(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
 	log := ctrllog.FromContext(ctx)
 	log.Info("syncService", "DexServer.Name", dexServer.Name, "DexServer.Namespace", dexServer.Namespace)
 
+	sessionAffinity, sessionAffinityConfig := getServiceSessionAffinity(dexServer)
+	var sessionAffinityTimeoutSeconds int32
+	if sessionAffinityConfig != nil {
+		sessionAffinityTimeoutSeconds = *sessionAffinityConfig.ClientIP.TimeoutSeconds
+	}
+
+	// The OpenShift service CA only generates the serving certificate when no secret is set
+	var servingCertSecretName string
+	if isServingCertGenerated(dexServer) {
+		servingCertSecretName = getWebTLSSecretName(dexServer)
+	}
+
 	values := struct {
-		ServingCertSecretName string
-		DexServer             *authv1alpha1.DexServer
+		ServingCertSecretName         string
+		SessionAffinity               corev1.ServiceAffinity
+		SessionAffinityTimeoutSeconds int32
+		DexServer                     *authv1alpha1.DexServer
 	}{
-		ServingCertSecretName: fmt.Sprintf(dexServer.Name + SECRET_WEB_TLS_SUFFIX),
-		DexServer:             dexServer,
+		ServingCertSecretName:         servingCertSecretName,
+		SessionAffinity:               sessionAffinity,
+		SessionAffinityTimeoutSeconds: sessionAffinityTimeoutSeconds,
+		DexServer:                     dexServer,
 	}
 
 	files := []string{
@@ -599,20 +1904,140 @@ func (r *DexServerReconciler) syncService(dexServer *authv1alpha1.DexServer, ctx
 		return err
 	}
 
+	// The applier only reconciles the selector and type of an existing Service, so update the session affinity
+	// and the IP families here
+	service, err := r.KubeClient.CoreV1().Services(dexServer.Namespace).Get(ctx, dexServer.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	ipFamiliesChanged := setServiceIPFamilies(dexServer, service)
+	if ipFamiliesChanged || service.Spec.SessionAffinity != sessionAffinity || !equality.Semantic.DeepEqual(service.Spec.SessionAffinityConfig, sessionAffinityConfig) {
+		service.Spec.SessionAffinity = sessionAffinity
+		service.Spec.SessionAffinityConfig = sessionAffinityConfig
+		if _, err := r.KubeClient.CoreV1().Services(dexServer.Namespace).Update(ctx, service, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (r *DexServerReconciler) getApplierAndReader(dexServer *authv1alpha1.DexServer) (clusteradmapply.Applier, asset.ScenarioReader) {
+// getServiceSessionAffinity returns the session affinity of the dex http Service, defaulting to None
+func getServiceSessionAffinity(dexServer *authv1alpha1.DexServer) (corev1.ServiceAffinity, *corev1.SessionAffinityConfig) {
+	if dexServer.Spec.SessionAffinity != corev1.ServiceAffinityClientIP {
+		return corev1.ServiceAffinityNone, nil
+	}
+	timeoutSeconds := DEFAULT_SESSION_AFFINITY_TIMEOUT_SECONDS
+	if dexServer.Spec.SessionAffinityTimeoutSeconds != nil {
+		timeoutSeconds = *dexServer.Spec.SessionAffinityTimeoutSeconds
+	}
+	return corev1.ServiceAffinityClientIP, &corev1.SessionAffinityConfig{
+		ClientIP: &corev1.ClientIPConfig{TimeoutSeconds: &timeoutSeconds},
+	}
+}
+
+// setServiceIPFamilies sets the IP families and IP family policy of the DexServer on a dex Service and returns
+// whether they changed. When unset, the ones defaulted by the cluster are kept.
+func setServiceIPFamilies(dexServer *authv1alpha1.DexServer, service *corev1.Service) bool {
+	changed := false
+	if len(dexServer.Spec.IPFamilies) > 0 && !equality.Semantic.DeepEqual(service.Spec.IPFamilies, dexServer.Spec.IPFamilies) {
+		service.Spec.IPFamilies = dexServer.Spec.IPFamilies
+		changed = true
+	}
+	if dexServer.Spec.IPFamilyPolicy != nil && !equality.Semantic.DeepEqual(service.Spec.IPFamilyPolicy, dexServer.Spec.IPFamilyPolicy) {
+		service.Spec.IPFamilyPolicy = dexServer.Spec.IPFamilyPolicy
+		changed = true
+	}
+	return changed
+}
+
+// applierSchemeLock guards the package scheme of the clusteradm applier. ApplyDeployments registers the Deployment
+// type in that scheme on every call, while the other apply methods decode with it, so deployments are applied
+// exclusively and everything else concurrently.
+var applierSchemeLock sync.RWMutex
+
+// lockedApplier is a clusteradm applier that is safe to use from concurrent reconciles. It adds the additional
+// labels and annotations of the DexServer to the applied objects.
+type lockedApplier struct {
+	clusteradmapply.Applier
+	additionalLabels      map[string]string
+	additionalAnnotations map[string]string
+}
+
+func (a *lockedApplier) ApplyDirectly(reader asset.ScenarioReader, values interface{}, dryRun bool, headerFile string, files ...string) ([]string, error) {
+	applierSchemeLock.RLock()
+	defer applierSchemeLock.RUnlock()
+	reader, values, headerFile, err := a.withAdditionalMetadata(reader, values, headerFile, files...)
+	if err != nil {
+		return nil, err
+	}
+	return a.Applier.ApplyDirectly(reader, values, dryRun, headerFile, files...)
+}
+
+func (a *lockedApplier) ApplyCustomResources(reader asset.ScenarioReader, values interface{}, dryRun bool, headerFile string, files ...string) ([]string, error) {
+	applierSchemeLock.RLock()
+	defer applierSchemeLock.RUnlock()
+	reader, values, headerFile, err := a.withAdditionalMetadata(reader, values, headerFile, files...)
+	if err != nil {
+		return nil, err
+	}
+	return a.Applier.ApplyCustomResources(reader, values, dryRun, headerFile, files...)
+}
+
+func (a *lockedApplier) ApplyDeployments(reader asset.ScenarioReader, values interface{}, dryRun bool, headerFile string, files ...string) ([]string, error) {
+	applierSchemeLock.Lock()
+	defer applierSchemeLock.Unlock()
+	reader, values, headerFile, err := a.withAdditionalMetadata(reader, values, headerFile, files...)
+	if err != nil {
+		return nil, err
+	}
+	return a.Applier.ApplyDeployments(reader, values, dryRun, headerFile, files...)
+}
+
+// getApplierAndReader returns a new applier for the resources of the DexServer and the reader of the embedded
+// templates. The reader is read-only and shared by all reconciles.
+func (r *DexServerReconciler) getApplierAndReader(dexServer *authv1alpha1.DexServer) (*lockedApplier, asset.ScenarioReader) {
 	applierBuilder := &clusteradmapply.ApplierBuilder{}
-	applier := applierBuilder.
-		WithClient(r.KubeClient, r.APIExtensionClient, r.DynamicClient).
-		WithOwner(dexServer, true, true, r.Scheme).
-		Build()
+	applierBuilder.WithClient(r.KubeClient, r.APIExtensionClient, r.DynamicClient)
+	switch r.OwnerReferenceMode {
+	case OWNER_REFERENCE_MODE_NONE:
+	case OWNER_REFERENCE_MODE_OWNER:
+		applierBuilder.WithOwner(dexServer, false, false, r.Scheme)
+	default:
+		applierBuilder.WithOwner(dexServer, true, true, r.Scheme)
+	}
+	applier := &lockedApplier{
+		Applier:               applierBuilder.Build(),
+		additionalLabels:      dexServer.Spec.AdditionalLabels,
+		additionalAnnotations: dexServer.Spec.AdditionalAnnotations,
+	}
 
 	readerDeploy := deploy.GetScenarioResourcesReader()
 	return applier, readerDeploy
 }
 
+// setOwnerReference sets the owner reference of a resource created directly by the controller, following OwnerReferenceMode
+func (r *DexServerReconciler) setOwnerReference(dexServer *authv1alpha1.DexServer, object metav1.Object) error {
+	switch r.OwnerReferenceMode {
+	case OWNER_REFERENCE_MODE_NONE:
+		return nil
+	case OWNER_REFERENCE_MODE_OWNER:
+		return controllerutil.SetOwnerReference(dexServer, object, r.Scheme)
+	default:
+		return ctrl.SetControllerReference(dexServer, object, r.Scheme)
+	}
+}
+
+// ValidateOwnerReferenceMode returns an error if mode is not a supported owner reference mode
+func ValidateOwnerReferenceMode(mode string) error {
+	switch mode {
+	case OWNER_REFERENCE_MODE_CONTROLLER, OWNER_REFERENCE_MODE_OWNER, OWNER_REFERENCE_MODE_NONE:
+		return nil
+	}
+	return fmt.Errorf("unsupported owner reference mode %q, must be one of %s, %s or %s", mode,
+		OWNER_REFERENCE_MODE_CONTROLLER, OWNER_REFERENCE_MODE_OWNER, OWNER_REFERENCE_MODE_NONE)
+}
+
 func (r *DexServerReconciler) syncServiceGrpc(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
 	log := ctrllog.FromContext(ctx)
 	log.Info("syncServiceGrpc", "DexServer.Name", dexServer.Name, "DexServer.Namespace", dexServer.Namespace)
@@ -635,72 +2060,153 @@ func (r *DexServerReconciler) syncServiceGrpc(dexServer *authv1alpha1.DexServer,
 		return err
 	}
 
+	// The applier only reconciles the selector and type of an existing Service, so update the IP families here
+	service, err := r.KubeClient.CoreV1().Services(dexServer.Namespace).Get(ctx, GRPC_SERVICE_NAME, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if setServiceIPFamilies(dexServer, service) {
+		if _, err := r.KubeClient.CoreV1().Services(dexServer.Namespace).Update(ctx, service, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 type DexConnectorConfigSpec struct {
-	// Common fields between GitHub and Microsoft OAuth2 configuration
-	ClientID     string `yaml:"clientID,omitempty"`
-	ClientSecret string `yaml:"clientSecret,omitempty"`
-	RedirectURI  string `yaml:"redirectURI,omitempty"`
+	// Common fields between GitHub, Microsoft and Google OAuth2 configuration
+	ClientID     string `json:"clientID,omitempty"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+	RedirectURI  string `json:"redirectURI,omitempty"`
 
 	// Github configuration
-	Org           string             `yaml:"org,omitempty"`
-	Orgs          []authv1alpha1.Org `yaml:"orgs,omitempty"`
-	HostName      string             `yaml:"hostName,omitempty"`
-	TeamNameField string             `yaml:"teamNameField,omitempty"`
-	LoadAllGroups bool               `yaml:"loadAllGroups,omitempty"`
-	UseLoginAsID  bool               `yaml:"useLoginAsID,omitempty"`
+	Org           string             `json:"org,omitempty"`
+	Orgs          []authv1alpha1.Org `json:"orgs,omitempty"`
+	HostName      string             `json:"hostName,omitempty"`
+	TeamNameField string             `json:"teamNameField,omitempty"`
+	LoadAllGroups bool               `json:"loadAllGroups,omitempty"`
+	UseLoginAsID  bool               `json:"useLoginAsID,omitempty"`
 
 	// Microsoft configuration
-	Tenant             string   `yaml:"tenant,omitempty"`
-	OnlySecurityGroups bool     `yaml:"onlySecurityGroups,omitempty"`
-	Groups             []string `yaml:"groups,omitempty"`
+	Tenant             string   `json:"tenant,omitempty"`
+	OnlySecurityGroups bool     `json:"onlySecurityGroups,omitempty"`
+	Groups             []string `json:"groups,omitempty"` // Also Google groups
+
+	// Google configuration
+	HostedDomains          []string `json:"hostedDomains,omitempty"`
+	ServiceAccountFilePath string   `json:"serviceAccountFilePath,omitempty"`
+	AdminEmail             string   `json:"adminEmail,omitempty"`
 
 	// LDAP configuration
-	Host               string                       `yaml:"host,omitempty"`
-	InsecureNoSSL      bool                         `yaml:"insecureNoSSL,omitempty"`
-	InsecureSkipVerify bool                         `yaml:"insecureSkipVerify,omitempty"`
-	StartTLS           bool                         `yaml:"startTLS,omitempty"`
-	ClientCA           string                       `yaml:"clientCA,omitempty"`
-	ClientKey          string                       `yaml:"clientKey,omitempty"`
-	RootCAData         []byte                       `yaml:"rootCAData,omitempty"`
-	BindDN             string                       `yaml:"bindDN,omitempty"`
-	BindPW             string                       `yaml:"bindPW,omitempty"`
-	UsernamePrompt     string                       `yaml:"usernamePrompt,omitempty"`
-	UserSearch         authv1alpha1.UserSearchSpec  `yaml:"userSearch,omitempty"`
-	GroupSearch        authv1alpha1.GroupSearchSpec `yaml:"groupSearch,omitempty"`
+	Host               string `json:"host,omitempty"`
+	InsecureNoSSL      bool   `json:"insecureNoSSL,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+	StartTLS           bool   `json:"startTLS,omitempty"`
+	ClientCert         string `json:"clientCert,omitempty"`
+	ClientKey          string `json:"clientKey,omitempty"`
+	RootCAData         []byte `json:"rootCAData,omitempty"`
+	BindDN             string `json:"bindDN,omitempty"`
+	BindPW             string `json:"bindPW,omitempty"`
+	UsernamePrompt     string `json:"usernamePrompt,omitempty"`
+	// Pointers, so that the searches are omitted when unconfigured
+	UserSearch  *authv1alpha1.UserSearchSpec `json:"userSearch,omitempty"`
+	GroupSearch *DexGroupSearchSpec          `json:"groupSearch,omitempty"`
 
 	// Common field between GitHub and LDAP configs
 	RootCA string `json:"rootCA,omitempty"`
+
+	// Untyped connector options, merged into the rendered config
+	RawConfig map[string]apiextensionsv1.JSON `json:"-"`
+}
+
+// MarshalJSON renders the typed connector config with the raw connector config merged into it
+func (c DexConnectorConfigSpec) MarshalJSON() ([]byte, error) {
+	type typedConfig DexConnectorConfigSpec
+	typed, err := json.Marshal(typedConfig(c))
+	if err != nil || len(c.RawConfig) == 0 {
+		return typed, err
+	}
+	config := map[string]json.RawMessage{}
+	if err := json.Unmarshal(typed, &config); err != nil {
+		return nil, err
+	}
+	for key, value := range c.RawConfig {
+		config[key] = json.RawMessage(value.Raw)
+	}
+	return json.Marshal(config)
+}
+
+// DexGroupSearchSpec is the rendered LDAP group search. Dex releases before v2.27 take a single
+// userAttr/groupAttr pair instead of the userMatchers list.
+type DexGroupSearchSpec struct {
+	BaseDN       string                     `json:"baseDN,omitempty"`
+	Filter       string                     `json:"filter,omitempty"`
+	Scope        string                     `json:"scope,omitempty"`
+	UserMatchers []authv1alpha1.UserMatcher `json:"userMatchers,omitempty"`
+	UserAttr     string                     `json:"userAttr,omitempty"`
+	GroupAttr    string                     `json:"groupAttr,omitempty"`
+	NameAttr     string                     `json:"nameAttr,omitempty"`
 }
 
 type DexConnectorSpec struct {
-	// +kubebuilder:validation:Enum=github;ldap
-	Type   string                 `yaml:"type,omitempty"`
-	Id     string                 `yaml:"id,omitempty"`
-	Name   string                 `yaml:"name,omitempty"`
-	Config DexConnectorConfigSpec `yaml:"config,omitempty"`
+	Type   string                 `json:"type,omitempty"`
+	Id     string                 `json:"id,omitempty"`
+	Name   string                 `json:"name,omitempty"`
+	Config DexConnectorConfigSpec `json:"config,omitempty"`
 }
 
-func (r *DexServerReconciler) syncConfigMap(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+// getConnectorRedirectURI returns the redirect URI of an OAuth2 connector, the callback URL of dex when it is not set
+func getConnectorRedirectURI(redirectURI string, dexServer *authv1alpha1.DexServer) string {
+	if redirectURI != "" {
+		return redirectURI
+	}
+	return getDefaultRedirectURI(dexServer.Spec.Issuer)
+}
+
+// renderDexServerConfig renders the dex config of the DexServer and returns it with the connectors rendered into it
+func (r *DexServerReconciler) renderDexServerConfig(dexServer *authv1alpha1.DexServer, ctx context.Context) ([]byte, []DexConnectorSpec, error) {
 	log := ctrllog.FromContext(ctx)
-	log.Info("syncConfigMap")
 
 	connectors := []DexConnectorSpec{}
 
+	// Select the rendering of version specific fields
+	dexConfigVersion := getDexConfigVersion(dexServer)
+	configRenderer, err := getDexConfigRenderer(dexConfigVersion)
+	if err != nil && dexConfigVersion != "" {
+		// spec.dexConfigVersion is validated, so only image tags such as "latest" get here. Images pinned by digest
+		// carry no version and are rendered with the latest format without a warning.
+		log.Info("dex image version not recognized", "error", err, "DexServer.Name", dexServer.Name, "DexServer.Namespace", dexServer.Namespace)
+	}
+
 	// Iterate over connectors defined in the DexServer to create the dex configuration for connectors
 
-	for _, connector := range dexServer.Spec.Connectors {
+	for i, connector := range dexServer.Spec.Connectors {
+		connectorLog := getConnectorLogger(connector, dexServer, ctx)
+		connectorLog.Info("rendering connector config", "type", connector.Type, "useEnvExpansion", dexServer.Spec.UseEnvExpansion)
 		var newConnector DexConnectorSpec
+		// A config block not matching the type would otherwise render an empty connector config
+		if errs := validateConnectorConfigBlock(field.NewPath("spec", "connectors").Index(i), connector); len(errs) > 0 {
+			return nil, nil, &phaseFailedError{reason: "ConnectorTypeMismatch", err: errs.ToAggregate()}
+		}
+		if err := r.checkConnectorSecretKey(connector, dexServer, ctx); err != nil {
+			return nil, nil, err
+		}
 		switch connector.Type {
 		case authv1alpha1.ConnectorTypeGitHub:
 			// Get Github ClientSecret from SecretRef
-			clientSecret, err := getConnectorSecretFromRef(connector, dexServer, r, ctx)
+			clientSecret, err := getConnectorSecretValue(connector, dexServer, r, ctx)
 
 			if err != nil {
-				log.Error(err, "Error getting client secret")
-				return nil
+				log.Error(err, "Error getting client secret")
+				if isSecretFetchTimeout(err) {
+					return nil, nil, err
+				}
+				return nil, nil, errors.Wrapf(err, "connector %s", connector.Id)
+			}
+			rootCAPath, err := r.getGitHubRootCAPath(connector, dexServer, ctx)
+			if err != nil {
+				return nil, nil, err
 			}
 
 			newConnector = DexConnectorSpec{
@@ -708,20 +2214,34 @@ func (r *DexServerReconciler) syncConfigMap(dexServer *authv1alpha1.DexServer, c
 				Id:   connector.Id,
 				Name: connector.Name,
 				Config: DexConnectorConfigSpec{
-					ClientID:     connector.GitHub.ClientID,
-					ClientSecret: clientSecret,
-					RedirectURI:  connector.GitHub.RedirectURI,
-					Org:          connector.GitHub.Org,
-					Orgs:         connector.GitHub.Orgs,
+					ClientID:      connector.GitHub.ClientID,
+					ClientSecret:  clientSecret.Reveal(),
+					RedirectURI:   getConnectorRedirectURI(connector.GitHub.RedirectURI, dexServer),
+					Org:           connector.GitHub.Org,
+					Orgs:          connector.GitHub.Orgs,
+					HostName:      connector.GitHub.HostName,
+					RootCA:        rootCAPath,
+					TeamNameField: connector.GitHub.TeamNameField,
+					LoadAllGroups: connector.GitHub.LoadAllGroups,
+					UseLoginAsID:  connector.GitHub.UseLoginAsID,
 				},
 			}
 		case authv1alpha1.ConnectorTypeMicrosoft:
+			// An invalid tenant is otherwise only reported by Microsoft at login time
+			tenantPath := field.NewPath("spec", "connectors").Index(i).Child("microsoft", "tenant")
+			if errs := validateMicrosoftTenant(tenantPath, connector.Microsoft.Tenant); len(errs) > 0 {
+				return nil, nil, &phaseFailedError{reason: "InvalidMicrosoftTenant", err: errs.ToAggregate()}
+			}
+
 			// Get Microsoft ClientSecret from SecretRef
-			clientSecret, err := getConnectorSecretFromRef(connector, dexServer, r, ctx)
+			clientSecret, err := getConnectorSecretValue(connector, dexServer, r, ctx)
 
 			if err != nil {
 				log.Error(err, "Error getting client secret")
-				return nil
+				if isSecretFetchTimeout(err) {
+					return nil, nil, err
+				}
+				return nil, nil, errors.Wrapf(err, "connector %s", connector.Id)
 			}
 
 			newConnector = DexConnectorSpec{
@@ -729,23 +2249,69 @@ func (r *DexServerReconciler) syncConfigMap(dexServer *authv1alpha1.DexServer, c
 				Id:   connector.Id,
 				Name: connector.Name,
 				Config: DexConnectorConfigSpec{
-					ClientID:     connector.Microsoft.ClientID,
-					ClientSecret: clientSecret,
-					RedirectURI:  connector.Microsoft.RedirectURI,
-					Tenant:       connector.Microsoft.Tenant,
+					ClientID:           connector.Microsoft.ClientID,
+					ClientSecret:       clientSecret.Reveal(),
+					RedirectURI:        getConnectorRedirectURI(connector.Microsoft.RedirectURI, dexServer),
+					Tenant:             connector.Microsoft.Tenant,
+					Groups:             connector.Microsoft.Groups,
+					OnlySecurityGroups: connector.Microsoft.OnlySecurityGroups,
+				},
+			}
+		case authv1alpha1.ConnectorTypeGoogle:
+			if !isGoogleConfigured(connector) {
+				// The config of a google connector without a google block is rendered from rawConfig only
+				newConnector = DexConnectorSpec{
+					Type: string(connector.Type),
+					Id:   connector.Id,
+					Name: connector.Name,
+				}
+				break
+			}
+
+			// Get Google ClientSecret from SecretRef
+			clientSecret, err := getConnectorSecretValue(connector, dexServer, r, ctx)
+
+			if err != nil {
+				log.Error(err, "Error getting client secret")
+				if isSecretFetchTimeout(err) {
+					return nil, nil, err
+				}
+				return nil, nil, errors.Wrapf(err, "connector %s", connector.Id)
+			}
+
+			serviceAccountFilePath, err := r.getGoogleServiceAccountFilePath(connector, dexServer, ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			newConnector = DexConnectorSpec{
+				Type: string(authv1alpha1.ConnectorTypeGoogle),
+				Id:   connector.Id,
+				Name: connector.Name,
+				Config: DexConnectorConfigSpec{
+					ClientID:               connector.Google.ClientID,
+					ClientSecret:           clientSecret.Reveal(),
+					RedirectURI:            getConnectorRedirectURI(connector.Google.RedirectURI, dexServer),
+					HostedDomains:          connector.Google.HostedDomains,
+					Groups:                 connector.Google.Groups,
+					ServiceAccountFilePath: serviceAccountFilePath,
+					AdminEmail:             connector.Google.AdminEmail,
 				},
 			}
 		case authv1alpha1.ConnectorTypeLDAP:
 			// Get LDAP BindPW from SecretRef
-			bindPW, err := getConnectorSecretFromRef(connector, dexServer, r, ctx)
+			bindPW, err := getConnectorSecretValue(connector, dexServer, r, ctx)
 
 			if err != nil {
 				log.Error(err, "Error getting bind pw")
-				return nil
+				if isSecretFetchTimeout(err) {
+					return nil, nil, err
+				}
+				return nil, nil, errors.Wrapf(err, "connector %s", connector.Id)
 			}
 
 			// If there is a secret reference to the trusted Root CA
-			var rootCAPath, clientCAPath, clientKeyPath string
+			var rootCAPath, clientCertPath, clientKeyPath string
 			if connector.LDAP.RootCARef.Name != "" {
 				// Check if the Root CA (ca.crt) and client cert and key files (tls.cert, tls.key) are present
 				secretName := connector.LDAP.RootCARef.Name
@@ -753,23 +2319,42 @@ func (r *DexServerReconciler) syncConfigMap(dexServer *authv1alpha1.DexServer, c
 				if secretNamespace = connector.LDAP.RootCARef.Namespace; secretNamespace == "" {
 					secretNamespace = dexServer.Namespace
 				}
+				if err := r.checkSecretNamespaceAllowed(dexServer, secretNamespace); err != nil {
+					return nil, nil, err
+				}
 				resource := &corev1.Secret{}
-				// Add label to this secret so that the secret can be watched for updates
-				checkAndAddLabelToSecret(resource, r, ctx)
-				if err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: secretNamespace}, resource); err != nil && kubeerrors.IsNotFound(err) {
+				if err := r.getSecretWithTimeout(ctx, types.NamespacedName{Name: secretName, Namespace: secretNamespace}, resource); err != nil {
+					if isSecretFetchTimeout(err) {
+						return nil, nil, err
+					}
 					// Error getting secret
 					log.Error(err, "Error getting root CA")
-					return nil
+					return nil, nil, errors.Wrapf(err, "connector %s root CA", connector.Id)
 				}
+				// Add label to this secret so that the secret can be watched for updates
+				checkAndAddLabelToSecret(resource, r, ctx)
 				if string(resource.Data["ca.crt"]) != "" {
-					rootCAPath = "/etc/dex/ldapcerts/" + connector.Id + "/ca.crt"
+					rootCAPath = LDAP_CERTS_MOUNT_PATH + "/" + connector.Id + "/ca.crt"
 				}
 				if string(resource.Data["tls.crt"]) != "" {
-					clientCAPath = "/etc/dex/ldapcerts/" + connector.Id + "/tls.crt"
+					clientCertPath = LDAP_CERTS_MOUNT_PATH + "/" + connector.Id + "/tls.crt"
 				}
 				if string(resource.Data["tls.key"]) != "" {
-					clientKeyPath = "/etc/dex/ldapcerts/" + connector.Id + "/tls.key"
+					clientKeyPath = LDAP_CERTS_MOUNT_PATH + "/" + connector.Id + "/tls.key"
 				}
+				connectorLog.Info("resolved LDAP certificates", "Secret.Namespace", secretNamespace, "Secret.Name", secretName,
+					"rootCA", rootCAPath != "", "clientCert", clientCertPath != "", "clientKey", clientKeyPath != "")
+			}
+			// The client cert and key may also live in their own secrets
+			clientCertRefPath, clientKeyRefPath, err := r.getLDAPClientCertPaths(connector, dexServer, ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+			if clientCertRefPath != "" {
+				clientCertPath = clientCertRefPath
+			}
+			if clientKeyRefPath != "" {
+				clientKeyPath = clientKeyRefPath
 			}
 
 			newConnector = DexConnectorSpec{
@@ -782,72 +2367,166 @@ func (r *DexServerReconciler) syncConfigMap(dexServer *authv1alpha1.DexServer, c
 					InsecureSkipVerify: connector.LDAP.InsecureSkipVerify,
 					StartTLS:           connector.LDAP.StartTLS,
 					RootCA:             rootCAPath,
-					ClientCA:           clientCAPath,
+					ClientCert:         clientCertPath,
 					ClientKey:          clientKeyPath,
 					BindDN:             connector.LDAP.BindDN,
-					BindPW:             bindPW,
+					BindPW:             bindPW.Reveal(),
 					UsernamePrompt:     connector.LDAP.UsernamePrompt,
 				},
 			}
 
 			if connector.LDAP.UserSearch.BaseDN != "" {
-				newConnector.Config.UserSearch.BaseDN = connector.LDAP.UserSearch.BaseDN
-				newConnector.Config.UserSearch.Filter = connector.LDAP.UserSearch.Filter
-				newConnector.Config.UserSearch.Username = connector.LDAP.UserSearch.Username
-				newConnector.Config.UserSearch.Scope = connector.LDAP.UserSearch.Scope
-				newConnector.Config.UserSearch.IDAttr = connector.LDAP.UserSearch.IDAttr
-				newConnector.Config.UserSearch.EmailAttr = connector.LDAP.UserSearch.EmailAttr
-				newConnector.Config.UserSearch.NameAttr = connector.LDAP.UserSearch.NameAttr
-				newConnector.Config.UserSearch = authv1alpha1.UserSearchSpec{
-					BaseDN:    connector.LDAP.UserSearch.BaseDN,
-					Filter:    connector.LDAP.UserSearch.Filter,
-					Username:  connector.LDAP.UserSearch.Username,
-					Scope:     connector.LDAP.UserSearch.Scope,
-					IDAttr:    connector.LDAP.UserSearch.IDAttr,
-					EmailAttr: connector.LDAP.UserSearch.EmailAttr,
-					NameAttr:  connector.LDAP.UserSearch.NameAttr,
-				}
+				userSearch := connector.LDAP.UserSearch
+				newConnector.Config.UserSearch = &userSearch
 			}
 
 			if connector.LDAP.GroupSearch.BaseDN != "" {
-				newConnector.Config.GroupSearch = authv1alpha1.GroupSearchSpec{
-					BaseDN:       connector.LDAP.GroupSearch.BaseDN,
-					Filter:       connector.LDAP.GroupSearch.Filter,
-					Scope:        connector.LDAP.GroupSearch.Scope,
-					UserMatchers: connector.LDAP.GroupSearch.UserMatchers,
-					NameAttr:     connector.LDAP.GroupSearch.NameAttr,
-				}
+				groupSearch := configRenderer.renderGroupSearch(connector.LDAP.GroupSearch)
+				newConnector.Config.GroupSearch = &groupSearch
 			}
 
 		default:
-			return nil
+			if _, found := getCanonicalConnectorType(connector.Type); !found {
+				return nil, nil, &phaseFailedError{reason: "UnsupportedConnectorType", err: fmt.Errorf("connector %s: type %s is not supported", connector.Id, connector.Type)}
+			}
+			// The config of the other dex connector types is rendered from rawConfig only
+			newConnector = DexConnectorSpec{
+				Type: string(connector.Type),
+				Id:   connector.Id,
+				Name: connector.Name,
+			}
 		}
 
 		// Add connector to list
+		newConnector.Config.RawConfig = connector.RawConfig
+		rawConfigKeys := []string{}
+		for key := range connector.RawConfig {
+			rawConfigKeys = append(rawConfigKeys, key)
+		}
+		sort.Strings(rawConfigKeys)
+		connectorLog.Info("rendered connector config", "rawConfigKeys", rawConfigKeys)
 		connectors = append(connectors, newConnector)
 	}
+	// Reordering the connectors of the spec, or DexConnectors, must not change the config hash and restart dex
+	sort.SliceStable(connectors, func(i, j int) bool {
+		return connectors[i].Id < connectors[j].Id
+	})
+
+	// Without connectors, for example with static passwords only, the section is omitted. The empty document "{}"
+	// would not be valid within the config.
+	var connectorYaml []byte
+	if len(connectors) > 0 {
+		connectorYamlSpec := struct {
+			Connectors []DexConnectorSpec `json:"connectors,omitempty"`
+		}{
+			Connectors: connectors,
+		}
+
+		// Get yaml representation of configYamlData
+		connectorYaml, err = yaml.Marshal(&connectorYamlSpec)
+
+		if err != nil {
+			log.Error(err, "failed to marshal dex config.yaml")
+			return nil, nil, err
+		}
+	}
+
+	// The static users enable the password database
+	var staticPasswordsYaml []byte
+	staticPasswords, err := r.getStaticPasswords(dexServer, ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(staticPasswords) > 0 {
+		staticPasswordsYaml, err = yaml.Marshal(&struct {
+			StaticPasswords []DexStaticPassword `json:"staticPasswords"`
+		}{
+			StaticPasswords: staticPasswords,
+		})
+		if err != nil {
+			log.Error(err, "failed to marshal yaml for static passwords")
+			return nil, nil, err
+		}
+	}
+
+	storageYaml, err := r.getStorageYaml(dexServer, ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Without an expiry section the dex defaults apply
+	var expiryYaml []byte
+	if dexServer.Spec.Expiry != nil {
+		expiryYaml, err = yaml.Marshal(&struct {
+			Expiry *authv1alpha1.ExpirySpec `json:"expiry"`
+		}{
+			Expiry: dexServer.Spec.Expiry,
+		})
+		if err != nil {
+			log.Error(err, "failed to marshal yaml for expiry")
+			return nil, nil, err
+		}
+	}
+
+	// Without a frontend section the default dex branding applies
+	frontendYaml, err := getFrontendYaml(dexServer)
+	if err != nil {
+		log.Error(err, "failed to marshal yaml for frontend")
+		return nil, nil, err
+	}
+
+	grpcEnabled, err := r.isGRPCEnabled(dexServer, ctx)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	connectorYamlSpec := struct {
-		Connectors []DexConnectorSpec `json:"connectors,omitempty"`
+	values := struct {
+		Issuer              string
+		ConnectorsYaml      string
+		StaticPasswordsYaml string
+		ExpiryYaml          string
+		FrontendYaml        string
+		StorageYaml         string
+		GRPCEnabled         bool
+		WebTLSDisabled      bool
+		DexServer           *authv1alpha1.DexServer
 	}{
-		Connectors: connectors,
+		Issuer:              dexServer.Spec.Issuer,
+		ConnectorsYaml:      string(connectorYaml),
+		StaticPasswordsYaml: string(staticPasswordsYaml),
+		ExpiryYaml:          string(expiryYaml),
+		FrontendYaml:        string(frontendYaml),
+		StorageYaml:         string(storageYaml),
+		WebTLSDisabled:      isWebTLSDisabled(dexServer),
+		GRPCEnabled:         grpcEnabled,
+		DexServer:           dexServer,
+	}
+
+	_, readerDeploy := r.getApplierAndReader(dexServer)
+	dexConfig, err := renderDexConfig(readerDeploy, values, getConfigFormat(dexServer))
+	if err != nil {
+		return nil, nil, err
 	}
+	return dexConfig, connectors, nil
+}
 
-	// Get yaml representation of configYamlData
-	connectorYaml, err := yaml.Marshal(&connectorYamlSpec)
+func (r *DexServerReconciler) syncConfigMap(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+	log.Info("syncConfigMap")
 
+	dexConfig, connectors, err := r.renderDexServerConfig(dexServer, ctx)
 	if err != nil {
-		log.Error(err, "failed to marshal dex config.yaml")
 		return err
 	}
 
-	values := struct {
-		Issuer         string
-		ConnectorsYaml string
+	applier, readerDeploy := r.getApplierAndReader(dexServer)
+	configMapValues := struct {
+		ConfigFileName string
+		Config         string
 		DexServer      *authv1alpha1.DexServer
 	}{
-		Issuer:         dexServer.Spec.Issuer,
-		ConnectorsYaml: string(connectorYaml),
+		ConfigFileName: getConfigFileName(dexServer),
+		Config:         string(dexConfig),
 		DexServer:      dexServer,
 	}
 
@@ -855,6 +2534,75 @@ func (r *DexServerReconciler) syncConfigMap(dexServer *authv1alpha1.DexServer, c
 		"dex-server/config_map.yaml",
 	}
 
+	previousConfigMap, err := r.KubeClient.CoreV1().ConfigMaps(dexServer.Namespace).Get(ctx, dexServer.Name, metav1.GetOptions{})
+	if err != nil {
+		if !kubeerrors.IsNotFound(err) {
+			return errors.Wrap(err, "error getting dex server configmap")
+		}
+		previousConfigMap = nil
+	}
+
+	_, err = applier.ApplyDirectly(readerDeploy, configMapValues, false, "", files...)
+	if err != nil {
+		return err
+	}
+
+	configMap, err := r.KubeClient.CoreV1().ConfigMaps(dexServer.Namespace).Get(ctx, dexServer.Name, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "error getting dex server configmap")
+	}
+	if previousConfigMap == nil {
+		r.recordEvent(dexServer, corev1.EventTypeNormal, "ConfigMapCreated", "ConfigMap %s created", dexServer.Name)
+	} else if !equality.Semantic.DeepEqual(previousConfigMap.Data, configMap.Data) {
+		r.recordEvent(dexServer, corev1.EventTypeNormal, "ConfigMapChanged", "ConfigMap %s changed", dexServer.Name)
+	}
+
+	// Report the connectors rendered into the config, in their order in the config
+	activeConnectors := []string{}
+	for _, connector := range connectors {
+		activeConnectors = append(activeConnectors, connector.Id)
+	}
+	dexServer.Status.ActiveConnectors = activeConnectors
+
+	return nil
+}
+
+// syncCABundleConfigMap publishes the root CAs of all connectors in a single ConfigMap when PublishCABundle is set,
+// and removes that ConfigMap otherwise
+func (r *DexServerReconciler) syncCABundleConfigMap(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+	log.Info("syncCABundleConfigMap", "PublishCABundle", dexServer.Spec.PublishCABundle)
+
+	configMapName := dexServer.Name + CA_BUNDLE_CONFIGMAP_SUFFIX
+	if !dexServer.Spec.PublishCABundle {
+		err := r.KubeClient.CoreV1().ConfigMaps(dexServer.Namespace).Delete(ctx, configMapName, metav1.DeleteOptions{})
+		if err != nil && !kubeerrors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	rootCAs, err := r.getConnectorRootCAs(dexServer, ctx)
+	if err != nil {
+		return err
+	}
+
+	values := struct {
+		CABundleConfigMapName string
+		CABundleKey           string
+		CABundle              string
+		DexServer             *authv1alpha1.DexServer
+	}{
+		CABundleConfigMapName: configMapName,
+		CABundleKey:           CA_BUNDLE_KEY,
+		CABundle:              strings.Join(rootCAs, "\n"),
+		DexServer:             dexServer,
+	}
+
+	files := []string{
+		"dex-server/ca_bundle_config_map.yaml",
+	}
+
 	applier, readerDeploy := r.getApplierAndReader(dexServer)
 	_, err = applier.ApplyDirectly(readerDeploy, values, false, "", files...)
 	if err != nil {
@@ -864,22 +2612,111 @@ func (r *DexServerReconciler) syncConfigMap(dexServer *authv1alpha1.DexServer, c
 	return nil
 }
 
+// getConnectorRootCAs returns the PEM encoded root CAs configured on the LDAP and GitHub Enterprise connectors of the
+// DexServer, in connector order
+func (r *DexServerReconciler) getConnectorRootCAs(dexServer *authv1alpha1.DexServer, ctx context.Context) ([]string, error) {
+	rootCAs := []string{}
+	for _, connector := range dexServer.Spec.Connectors {
+		switch connector.Type {
+		case authv1alpha1.ConnectorTypeLDAP:
+			if connector.LDAP.RootCARef.Name != "" {
+				secretNamespace := connector.LDAP.RootCARef.Namespace
+				if secretNamespace == "" {
+					secretNamespace = dexServer.Namespace
+				}
+				if err := r.checkSecretNamespaceAllowed(dexServer, secretNamespace); err != nil {
+					return nil, err
+				}
+				secret := &corev1.Secret{}
+				if err := r.getSecretWithTimeout(ctx, types.NamespacedName{Name: connector.LDAP.RootCARef.Name, Namespace: secretNamespace}, secret); err != nil {
+					return nil, errors.Wrapf(err, "error getting root CA of connector %s", connector.Id)
+				}
+				// Add label to this secret so that the bundle is kept in sync with it
+				checkAndAddLabelToSecret(secret, r, ctx)
+				if caData := strings.TrimSpace(string(secret.Data["ca.crt"])); caData != "" {
+					rootCAs = append(rootCAs, caData)
+				}
+			}
+			if caData := strings.TrimSpace(string(connector.LDAP.RootCAData)); caData != "" {
+				rootCAs = append(rootCAs, caData)
+			}
+		case authv1alpha1.ConnectorTypeGitHub:
+			// The rootCA path of the connector is only readable in the dex container, only rootCARef is bundled
+			if connector.GitHub.RootCARef == nil {
+				continue
+			}
+			secret := &corev1.Secret{}
+			if err := r.getSecretWithTimeout(ctx, types.NamespacedName{Name: connector.GitHub.RootCARef.Name, Namespace: dexServer.Namespace}, secret); err != nil {
+				return nil, errors.Wrapf(err, "error getting root CA of connector %s", connector.Id)
+			}
+			// Add label to this secret so that the bundle is kept in sync with it
+			checkAndAddLabelToSecret(secret, r, ctx)
+			if caData := strings.TrimSpace(string(secret.Data["ca.crt"])); caData != "" {
+				rootCAs = append(rootCAs, caData)
+			}
+		}
+	}
+	return rootCAs, nil
+}
+
+// ingressCertificateRequeueInterval is the interval at which a missing or incomplete ingress certificate secret is
+// checked again, while for example cert-manager issues the certificate
+var ingressCertificateRequeueInterval = 30 * time.Second
+
+// getIngressCertificate returns the secret referenced by IngressCertificateRef once it holds a valid TLS certificate
+// and key. Until then it returns a phaseWaitingError, rather than exposing the issuer with a missing certificate.
+func (r *DexServerReconciler) getIngressCertificate(dexServer *authv1alpha1.DexServer, ctx context.Context) (*corev1.Secret, error) {
+	name := dexServer.Spec.IngressCertificateRef.Name
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: dexServer.Namespace}, secret); err != nil {
+		if !kubeerrors.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "error getting the ingress certificate secret %s", name)
+		}
+		return nil, &phaseWaitingError{
+			reason:       "WaitingForCertificate",
+			message:      fmt.Sprintf("waiting for the ingress certificate secret %s to be created", name),
+			requeueAfter: ingressCertificateRequeueInterval,
+		}
+	}
+	if _, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]); err != nil {
+		return nil, &phaseWaitingError{
+			reason: "WaitingForCertificate",
+			message: fmt.Sprintf("waiting for the ingress certificate secret %s to hold a valid certificate and key in %s and %s: %s",
+				name, corev1.TLSCertKey, corev1.TLSPrivateKeyKey, err.Error()),
+			requeueAfter: ingressCertificateRequeueInterval,
+		}
+	}
+	return secret, nil
+}
+
 func (r *DexServerReconciler) syncIngress(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
 	log := ctrllog.FromContext(ctx)
-	u, _ := url.Parse(dexServer.Spec.Issuer)
-	routeHost := u.Host
-	log.Info("syncIngress", "Host", routeHost)
+	hosts := getIssuerHosts(dexServer)
+	log.Info("syncIngress", "Hosts", hosts)
 
 	ingressCertificateRefName := dexServer.Spec.IngressCertificateRef.Name
+	if ingressCertificateRefName != "" {
+		if _, err := r.getIngressCertificate(dexServer, ctx); err != nil {
+			return err
+		}
+	}
 
 	values := struct {
-		Host                   string
+		Hosts                  []string
+		Path                   string
 		DexServer              *authv1alpha1.DexServer
 		IngressCertificateName string
+		ForceHTTPSRedirect     bool
+		WebTLSDisabled         bool
+		WebTLSCASecretName     string
 	}{
-		Host:                   routeHost,
+		Hosts:                  hosts,
+		Path:                   getIssuerRoutePath(dexServer.Spec.Issuer),
 		DexServer:              dexServer,
 		IngressCertificateName: ingressCertificateRefName,
+		ForceHTTPSRedirect:     dexServer.Spec.ForceHTTPSRedirect,
+		WebTLSDisabled:         isWebTLSDisabled(dexServer),
+		WebTLSCASecretName:     getWebTLSCASecretName(dexServer),
 	}
 
 	files := []string{
@@ -894,17 +2731,238 @@ func (r *DexServerReconciler) syncIngress(dexServer *authv1alpha1.DexServer, ctx
 		return err
 	}
 
+	// Only one of the Ingress and the Routes exposes the issuer
+	return r.deleteStaleRoutes(dexServer, nil, ctx)
+
+}
+
+// syncRoute exposes the issuer through an OpenShift Route, which reencrypts the traffic to the serving certificate
+// of dex, or terminates TLS at the edge when dex serves plain HTTP. The router trusts the service CA signing the
+// generated serving certificate, other serving certificates need the destination CA of the web TLS CA secret. A
+// Route has a single host, each additional host gets its own Route.
+func (r *DexServerReconciler) syncRoute(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+	hosts := getIssuerHosts(dexServer)
+	log.Info("syncRoute", "Hosts", hosts)
+
+	var certificate, key string
+	// A Route cannot reference a secret, the bring-your-own-certificate is copied into it
+	if dexServer.Spec.IngressCertificateRef.Name != "" {
+		secret, err := r.getIngressCertificate(dexServer, ctx)
+		if err != nil {
+			return err
+		}
+		certificate, key = string(secret.Data[corev1.TLSCertKey]), string(secret.Data[corev1.TLSPrivateKeyKey])
+	}
+	destinationCACertificate, err := r.getWebTLSCA(dexServer, ctx)
+	if err != nil {
+		return err
+	}
+
+	files := []string{
+		"dex-server/route.yaml",
+	}
+
+	applier, readerDeploy := r.getApplierAndReader(dexServer)
+	routeNames := []string{}
+	for i, host := range hosts {
+		values := struct {
+			Name               string
+			Host               string
+			Path               string
+			DexServer          *authv1alpha1.DexServer
+			ForceHTTPSRedirect bool
+			WebTLSDisabled     bool
+			Certificate        string
+			Key                string
+			// The router trusts the service CA when empty
+			DestinationCACertificate string
+		}{
+			Name:                     getRouteName(dexServer, i),
+			Host:                     host,
+			Path:                     getIssuerRoutePath(dexServer.Spec.Issuer),
+			DexServer:                dexServer,
+			ForceHTTPSRedirect:       dexServer.Spec.ForceHTTPSRedirect,
+			WebTLSDisabled:           isWebTLSDisabled(dexServer),
+			Certificate:              certificate,
+			Key:                      key,
+			DestinationCACertificate: destinationCACertificate,
+		}
+		if _, err := applier.ApplyCustomResources(readerDeploy, values, false, "", files...); err != nil {
+			return err
+		}
+		routeNames = append(routeNames, values.Name)
+	}
+	if err := r.deleteStaleRoutes(dexServer, routeNames, ctx); err != nil {
+		return err
+	}
+
+	// Only one of the Ingress and the Routes exposes the issuer
+	return r.deleteExposingResource(dexServer, networkingv1.SchemeGroupVersion.WithResource("ingresses"), ctx)
+}
+
+// getRouteName returns the name of the Route of the i-th host of getIssuerHosts: the name of the DexServer for the
+// host of the issuer, suffixed with the position of the additional host otherwise
+func getRouteName(dexServer *authv1alpha1.DexServer, i int) string {
+	if i == 0 {
+		return dexServer.Name
+	}
+	return fmt.Sprintf("%s-host-%d", dexServer.Name, i)
+}
+
+// deleteStaleRoutes deletes the Routes of the DexServer other than routeNames, such as the Route of a removed
+// additional host, or all of them once the route type is an Ingress. Clusters without the Route API report them
+// as not found.
+func (r *DexServerReconciler) deleteStaleRoutes(dexServer *authv1alpha1.DexServer, routeNames []string, ctx context.Context) error {
+	routes := r.DynamicClient.Resource(routev1.GroupVersion.WithResource("routes")).Namespace(dexServer.Namespace)
+	list, err := routes.List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{"dexconfig_name": dexServer.Name}).String(),
+	})
+	if err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, "error listing the routes")
+	}
+	keep := map[string]bool{}
+	for _, name := range routeNames {
+		keep[name] = true
+	}
+	for _, route := range list.Items {
+		if keep[route.GetName()] {
+			continue
+		}
+		if err := routes.Delete(ctx, route.GetName(), metav1.DeleteOptions{}); err != nil && !kubeerrors.IsNotFound(err) {
+			return errors.Wrapf(err, "error deleting the stale route %s", route.GetName())
+		}
+		ctrllog.FromContext(ctx).Info("deleted stale route", "name", route.GetName())
+	}
 	return nil
+}
+
+// deleteExposingResource deletes the Ingress or the Route of the DexServer left over from a previous route type.
+// Clusters without the Route API report it as not found.
+func (r *DexServerReconciler) deleteExposingResource(dexServer *authv1alpha1.DexServer, gvr schema.GroupVersionResource, ctx context.Context) error {
+	err := r.DynamicClient.Resource(gvr).Namespace(dexServer.Namespace).Delete(ctx, dexServer.Name, metav1.DeleteOptions{})
+	if err == nil {
+		ctrllog.FromContext(ctx).Info("deleted the resource of the previous route type", "resource", gvr.Resource, "name", dexServer.Name)
+		return nil
+	}
+	if kubeerrors.IsNotFound(err) {
+		return nil
+	}
+	return errors.Wrapf(err, "error deleting the %s of the previous route type", gvr.Resource)
+}
+
+// getRouteType returns the kind of resource exposing the issuer, defaulting to an Ingress
+func getRouteType(dexServer *authv1alpha1.DexServer) authv1alpha1.RouteType {
+	if dexServer.Spec.RouteType == "" {
+		return authv1alpha1.RouteTypeIngress
+	}
+	return dexServer.Spec.RouteType
+}
 
+// getUnusedRouteConditionType returns the condition type of the exposing resource not used by the route type
+func getUnusedRouteConditionType(dexServer *authv1alpha1.DexServer) string {
+	if getRouteType(dexServer) == authv1alpha1.RouteTypeRoute {
+		return authv1alpha1.DexServerConditionTypeIngressReady
+	}
+	return authv1alpha1.DexServerConditionTypeRouteReady
+}
+
+// dexServerPredicate only lets DexServer creations, deletions, finalizer changes and spec changes through. The
+// reconcile updates the DexServer status, so status-only updates must never trigger another reconcile.
+func dexServerPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+		CreateFunc:  func(e event.CreateEvent) bool { return true },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			// finalizer changes do not bump the generation
+			if !equality.Semantic.DeepEqual(e.ObjectOld.GetFinalizers(), e.ObjectNew.GetFinalizers()) {
+				return true
+			}
+			// the finalizer runs once the deletion is requested, whether or not it bumps the generation
+			if e.ObjectOld.GetDeletionTimestamp().IsZero() && !e.ObjectNew.GetDeletionTimestamp().IsZero() {
+				return true
+			}
+			// neither do annotation changes, reconcile the ones the operator reads
+			if e.ObjectOld.GetAnnotations()[DEBUG_CONNECTORS_ANNOTATION] != e.ObjectNew.GetAnnotations()[DEBUG_CONNECTORS_ANNOTATION] {
+				return true
+			}
+			if e.ObjectOld.GetAnnotations()[RESTART_ANNOTATION] != e.ObjectNew.GetAnnotations()[RESTART_ANNOTATION] {
+				return true
+			}
+			// status updates never bump the generation, spec changes always do
+			if !(predicate.GenerationChangedPredicate{}).Update(e) {
+				return false
+			}
+			dexServerOld := e.ObjectOld.(*authv1alpha1.DexServer)
+			dexServerNew := e.ObjectNew.(*authv1alpha1.DexServer)
+			return !equality.Semantic.DeepEqual(dexServerOld.Spec, dexServerNew.Spec)
+		},
+	}
+}
+
+// Filter the events of the DexServers that do not match the label selector of the operator
+func dexServerLabelSelectorPredicate(selector labels.Selector) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(o client.Object) bool {
+		return selector.Matches(labels.Set(o.GetLabels())) || isFinalizing(o)
+	})
+}
+
+// isFinalizing returns true if the object is being deleted and still has the finalizer of this operator
+func isFinalizing(o client.Object) bool {
+	return o.GetDeletionTimestamp() != nil && controllerutil.ContainsFinalizer(o, DEX_SERVER_FINALIZER)
+}
+
+// Label changes do not bump the generation, reconcile the DexServers that start matching the label selector
+func dexServerSelectedPredicate(selector labels.Selector) predicate.Predicate {
+	return predicate.Funcs{
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+		CreateFunc:  func(e event.CreateEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return !selector.Matches(labels.Set(e.ObjectOld.GetLabels())) && selector.Matches(labels.Set(e.ObjectNew.GetLabels()))
+		},
+	}
+}
+
+func (r *DexServerReconciler) getLabelSelector() labels.Selector {
+	if r.LabelSelector == nil {
+		return labels.Everything()
+	}
+	return r.LabelSelector
+}
+
+// isDexServerSelected returns true if the DexServer name in namespace matches selector, so that the DexClients and
+// DexConnectors of a DexServer are only handled by the operator instance reconciling it. A DexServer that does not
+// exist is not selected, unless selector selects everything.
+func isDexServerSelected(c client.Client, selector labels.Selector, namespace string, name string, ctx context.Context) (bool, error) {
+	if selector == nil || selector.Empty() {
+		return true, nil
+	}
+	dexServer := &authv1alpha1.DexServer{}
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, dexServer); err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return selector.Matches(labels.Set(dexServer.Labels)), nil
 }
 
-// Rolling restarts are accomplished with an annotation on the pod template. Ignore this and resulting updates
-// to allow rolling restarts to complete successfully.
-func ignoreDeploymentRestartPredicate() predicate.Predicate {
-	// hold the generation of any deployment restarts in progress, by namespace and name
+// Rolling restarts are accomplished with an annotation on the pod template, restartAnnotationKey. Ignore this and
+// resulting updates to allow rolling restarts to complete successfully.
+func ignoreDeploymentRestartPredicate(restartAnnotationKey string) predicate.Predicate {
+	// hold the generation of any deployment restarts in progress, by namespace and name. The informers of the
+	// manager may deliver events concurrently, so the map is guarded by a lock.
 	restartsInProgress := map[string]int64{}
+	var restartsInProgressLock sync.Mutex
 	return predicate.Funcs{
 		UpdateFunc: func(e event.UpdateEvent) bool {
+			restartsInProgressLock.Lock()
+			defer restartsInProgressLock.Unlock()
 			if len(e.ObjectOld.GetOwnerReferences()) == 0 {
 				return false
 			} else if e.ObjectOld.GetOwnerReferences()[0].Kind != "DexServer" {
@@ -927,10 +2985,10 @@ func ignoreDeploymentRestartPredicate() predicate.Predicate {
 			newDeployment := e.ObjectNew.(*appsv1.Deployment)
 
 			newPodSpecAnnotations := newDeployment.Spec.Template.ObjectMeta.Annotations
-			if newDeploymentRestartedAt, found := newPodSpecAnnotations["kubectl.kubernetes.io/restartedAt"]; found {
+			if newDeploymentRestartedAt, found := newPodSpecAnnotations[restartAnnotationKey]; found {
 				oldPodSpecAnnotations := oldDeployment.Spec.Template.ObjectMeta.Annotations
 				if len(oldPodSpecAnnotations) == 0 ||
-					(newDeploymentRestartedAt != oldPodSpecAnnotations["kubectl.kubernetes.io/restartedAt"]) {
+					(newDeploymentRestartedAt != oldPodSpecAnnotations[restartAnnotationKey]) {
 					// this is a new restart. don't process it. hold on to it so we can ignore future updates to the deployment from this same restart
 					restartsInProgress[namespacedName] = e.ObjectNew.GetGeneration()
 					log.V(1).Info("new restart detected", "generation", e.ObjectNew.GetGeneration())
@@ -943,14 +3001,24 @@ func ignoreDeploymentRestartPredicate() predicate.Predicate {
 	}
 }
 
+// getRestartAnnotationKey returns the pod template annotation of the deployment restarts, defaulting to the kubectl one
+func (r *DexServerReconciler) getRestartAnnotationKey() string {
+	if r.RestartAnnotationKey == "" {
+		return DEFAULT_RESTART_ANNOTATION_KEY
+	}
+	return r.RestartAnnotationKey
+}
+
 // MergeStatusConditions returns a new status condition array with merged status conditions. It is based on newConditions,
-// and merges the corresponding existing conditions if exists.
-func mergeStatusConditions(conditions []metav1.Condition, newConditions ...metav1.Condition) []metav1.Condition {
+// and merges the corresponding existing conditions if exists. The new conditions record the generation they were
+// computed for.
+func mergeStatusConditions(conditions []metav1.Condition, observedGeneration int64, newConditions ...metav1.Condition) []metav1.Condition {
 	merged := []metav1.Condition{}
 
 	merged = append(merged, conditions...)
 
 	for _, condition := range newConditions {
+		condition.ObservedGeneration = observedGeneration
 		// merge two conditions if necessary
 		meta.SetStatusCondition(&merged, condition)
 	}
@@ -959,7 +3027,7 @@ func mergeStatusConditions(conditions []metav1.Condition, newConditions ...metav
 }
 
 func updateDexServerStatusConditions(c client.Client, dexServer *authv1alpha1.DexServer, newConditions ...metav1.Condition) error {
-	dexServer.Status.Conditions = mergeStatusConditions(dexServer.Status.Conditions, newConditions...)
+	dexServer.Status.Conditions = mergeStatusConditions(dexServer.Status.Conditions, dexServer.Generation, newConditions...)
 	return c.Status().Update(context.TODO(), dexServer)
 }
 
@@ -996,23 +3064,14 @@ func (r *DexServerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
-	deploymentOwnsOpts := []builder.OwnsOption{
-		builder.WithPredicates(ignoreDeploymentRestartPredicate()), // ignore deployment rolling restarts
+	// Events reference the DexServer, they are listed by kubectl describe dexserver
+	if r.Recorder == nil {
+		r.Recorder = mgr.GetEventRecorderFor("dexserver-controller")
 	}
 
-	dexServerPredicate := predicate.Predicate(predicate.Funcs{
-		GenericFunc: func(e event.GenericEvent) bool { return false },
-		DeleteFunc:  func(e event.DeleteEvent) bool { return false },
-		CreateFunc:  func(e event.CreateEvent) bool { return true },
-		UpdateFunc: func(e event.UpdateEvent) bool {
-			dexServerOld := e.ObjectOld.(*authv1alpha1.DexServer)
-			dexServerNew := e.ObjectNew.(*authv1alpha1.DexServer)
-			// only handle the Finalizer and Spec changes
-			return !equality.Semantic.DeepEqual(e.ObjectOld.GetFinalizers(), e.ObjectNew.GetFinalizers()) ||
-				!equality.Semantic.DeepEqual(dexServerOld.Spec, dexServerNew.Spec)
-
-		},
-	})
+	deploymentOwnsOpts := []builder.OwnsOption{
+		builder.WithPredicates(ignoreDeploymentRestartPredicate(r.getRestartAnnotationKey())), // ignore deployment rolling restarts
+	}
 
 	// Watch for updates to the secrets containing credentials for IDP connectors (example: Github client secret, LDAP bind password etc)
 	// These secrets are labelled with auth.identitatem.io/idp-credential=""
@@ -1025,11 +3084,19 @@ func (r *DexServerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		},
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&authv1alpha1.DexServer{}, builder.WithPredicates(dexServerPredicate)).
+	b := ctrl.NewControllerManagedBy(mgr).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+			RateLimiter:             r.getReconcileRateLimiter(),
+		}).
+		For(&authv1alpha1.DexServer{}, builder.WithPredicates(
+			dexServerLabelSelectorPredicate(r.getLabelSelector()),
+			predicate.Or(dexServerPredicate(), dexServerSelectedPredicate(r.getLabelSelector())))).
 		Owns(&corev1.ConfigMap{}).
 		Owns(&corev1.Service{}).
 		Owns(&corev1.ServiceAccount{}).
+		Owns(&rbacv1.Role{}).
+		Owns(&rbacv1.RoleBinding{}).
 		Owns(&corev1.Secret{}).
 		Owns(&appsv1.Deployment{}, deploymentOwnsOpts...).
 		Owns(&networkingv1.Ingress{}).
@@ -1041,6 +3108,9 @@ func (r *DexServerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				var requests = []reconcile.Request{}
 
 				for _, dexServer := range dexServerList.Items {
+					if !r.getLabelSelector().Matches(labels.Set(dexServer.Labels)) {
+						continue
+					}
 					requests = append(requests, reconcile.Request{
 						NamespacedName: types.NamespacedName{
 							Name:      dexServer.Name,
@@ -1051,7 +3121,31 @@ func (r *DexServerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				return requests // Events from the watched secrets mapped to the DexServer resource
 			}),
 			builder.WithPredicates(secretPredicate)). // Predicate to ensure we're only watching secrets that have the label "auth.identitatem.io/idp-credential" on them
-		Complete(r)
+		// Aggregate the connectors of DexConnectors into the config of the DexServer they reference
+		Watches(&source.Kind{Type: &authv1alpha1.DexConnector{}},
+			handler.EnqueueRequestsFromMapFunc(func(a client.Object) []reconcile.Request {
+				return []reconcile.Request{{
+					NamespacedName: types.NamespacedName{
+						Name:      a.(*authv1alpha1.DexConnector).Spec.DexServerRef.Name,
+						Namespace: a.GetNamespace(),
+					},
+				}}
+			}),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		// Cross-check the redirect URIs of the DexClients with the connectors of the DexServers of their namespace
+		Watches(&source.Kind{Type: &authv1alpha1.DexClient{}},
+			handler.EnqueueRequestsFromMapFunc(r.mapDexClientToDexServers),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}))
+	// Revert the changes to the PodDisruptionBudget and the HorizontalPodAutoscaler right away, on the clusters
+	// serving their API
+	if r.isAPIServed(podDisruptionBudgetGVK) {
+		b = b.Owns(&policyv1.PodDisruptionBudget{})
+	}
+	if r.isHorizontalPodAutoscalerServed() {
+		b = b.Owns(newHorizontalPodAutoscaler())
+	}
+	// Recreate deleted generated resources right away, whatever the owner reference mode
+	return r.watchDeletedResources(b).Complete(r)
 }
 
 // func (r *DexServerReconciler) startdexServer(ctx context.Context, ds *v1alpha1.DexServer, c client.Client) (*v1alpha1.DexServer, error) {
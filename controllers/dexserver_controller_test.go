@@ -0,0 +1,4181 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	routev1 "github.com/openshift/api/route/v1"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2beta2 "k8s.io/api/autoscaling/v2beta2"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+const (
+	testDexServerName      = "dexserver-test"
+	testDexServerNamespace = "dexserver-test-ns"
+	testDexImage           = "quay.io/dexidp/dex:v2.30.0"
+)
+
+// newTestDexServer returns a minimal DexServer for use in tests
+func newTestDexServer() *authv1alpha1.DexServer {
+	return &authv1alpha1.DexServer{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testDexServerName,
+			Namespace: testDexServerNamespace,
+			UID:       types.UID(testDexServerName),
+		},
+		Spec: authv1alpha1.DexServerSpec{
+			Issuer: "https://dex.example.com",
+		},
+	}
+}
+
+// newTestDexServerReconciler returns a DexServerReconciler backed by fake clients. The controller-runtime client
+// is seeded with objs; resources created through the applier land in the fake kube and dynamic clients.
+func newTestDexServerReconciler(objs ...client.Object) *DexServerReconciler {
+	scheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	Expect(authv1alpha1.AddToScheme(scheme)).To(Succeed())
+	Expect(routev1.AddToScheme(scheme)).To(Succeed())
+
+	kubeClient := kubefake.NewSimpleClientset()
+	// The applier discovers the Ingress, Route, HorizontalPodAutoscaler and PodDisruptionBudget resources before applying them
+	kubeClient.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "networking.k8s.io/v1",
+			APIResources: []metav1.APIResource{{Name: "ingresses", Namespaced: true, Kind: "Ingress"}},
+		},
+		{
+			GroupVersion: "route.openshift.io/v1",
+			APIResources: []metav1.APIResource{{Name: "routes", Namespaced: true, Kind: "Route"}},
+		},
+		{
+			GroupVersion: "autoscaling/v2",
+			APIResources: []metav1.APIResource{{Name: "horizontalpodautoscalers", Namespaced: true, Kind: "HorizontalPodAutoscaler"}},
+		},
+		{
+			GroupVersion: "policy/v1",
+			APIResources: []metav1.APIResource{{Name: "poddisruptionbudgets", Namespaced: true, Kind: "PodDisruptionBudget"}},
+		},
+	}
+
+	return &DexServerReconciler{
+		Client:             fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(),
+		KubeClient:         kubeClient,
+		DynamicClient:      dynamicfake.NewSimpleDynamicClient(scheme),
+		APIExtensionClient: apiextensionsfake.NewSimpleClientset(),
+		Scheme:             scheme,
+	}
+}
+
+// reconcileTestDexServer runs a single reconcile of the test DexServer and returns the updated DexServer
+func reconcileTestDexServer(r *DexServerReconciler) (*authv1alpha1.DexServer, error) {
+	ctx := context.TODO()
+	_, reconcileErr := r.Reconcile(ctx, ctrl.Request{
+		NamespacedName: types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace},
+	})
+	dexServer := &authv1alpha1.DexServer{}
+	Expect(r.Get(ctx, types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+	return dexServer, reconcileErr
+}
+
+// getTestConfigYaml returns the dex config.yaml rendered into the ConfigMap of the test DexServer
+func getTestConfigYaml(r *DexServerReconciler) string {
+	configMap, err := r.KubeClient.CoreV1().ConfigMaps(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+	Expect(err).NotTo(HaveOccurred())
+	return configMap.Data["config.yaml"]
+}
+
+// getTestDeployment returns the dex Deployment rendered for the test DexServer
+func getTestDeployment(r *DexServerReconciler) *appsv1.Deployment {
+	deployment, err := r.KubeClient.AppsV1().Deployments(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+	Expect(err).NotTo(HaveOccurred())
+	return deployment
+}
+
+// newTestSecret returns a secret in the test namespace holding data
+func newTestSecret(name string, data map[string]string) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testDexServerNamespace},
+		Data:       map[string][]byte{},
+	}
+	for k, v := range data {
+		secret.Data[k] = []byte(v)
+	}
+	return secret
+}
+
+// createTestDexPod creates a pod of the dex deployment of the test DexServer with status
+func createTestDexPod(r *DexServerReconciler, name string, status corev1.PodStatus) {
+	_, err := r.KubeClient.CoreV1().Pods(testDexServerNamespace).Create(context.TODO(), &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testDexServerNamespace,
+			Labels: map[string]string{
+				"app":                 testDexServerName,
+				"dexconfig_name":      testDexServerName,
+				"dexconfig_namespace": testDexServerNamespace,
+			},
+		},
+		Spec:   corev1.PodSpec{Containers: []corev1.Container{{Name: testDexServerName}}},
+		Status: status,
+	}, metav1.CreateOptions{})
+	Expect(err).NotTo(HaveOccurred())
+}
+
+// createTestReadyDexPod creates a ready pod of the dex deployment of the test DexServer
+func createTestReadyDexPod(r *DexServerReconciler) {
+	createTestDexPod(r, "dex-ready", corev1.PodStatus{
+		Phase:      corev1.PodRunning,
+		Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+	})
+}
+
+// newTestCA returns a self-signed CA for signing test certificates
+func newTestCA() (*x509.Certificate, *rsa.PrivateKey) {
+	caKey, err := rsa.GenerateKey(rand.Reader, PRIVATE_KEY_SIZE)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour * 24),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caBytes, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	Expect(err).NotTo(HaveOccurred())
+	caCert, err := x509.ParseCertificate(caBytes)
+	Expect(err).NotTo(HaveOccurred())
+	return caCert, caKey
+}
+
+// signTestCSR signs a PEM encoded certificate request with the test CA like a CertificateSigningRequest signer
+func signTestCSR(csrPEM []byte, caCert *x509.Certificate, caKey *rsa.PrivateKey) []byte {
+	block, _ := pem.Decode(csrPEM)
+	Expect(block).NotTo(BeNil())
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		IPAddresses:  csr.IPAddresses,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour * 24),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, caCert, csr.PublicKey, caKey)
+	Expect(err).NotTo(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})
+}
+
+// newTestServingCert returns a serving certificate for 127.0.0.1 signed by the CA
+func newTestServingCert(caCert *x509.Certificate, caKey crypto.Signer) tls.Certificate {
+	key, err := rsa.GenerateKey(rand.Reader, PRIVATE_KEY_SIZE)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour * 24),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	Expect(err).NotTo(HaveOccurred())
+	return tls.Certificate{Certificate: [][]byte{certBytes}, PrivateKey: key}
+}
+
+// newTestTLSSecret returns a TLS secret holding a valid certificate and key
+func newTestTLSSecret(name string) *corev1.Secret {
+	certs, err := generateMTLSCerts(testDexServerNamespace, nil)
+	Expect(err).NotTo(HaveOccurred())
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testDexServerNamespace},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certs.certPEM.Bytes(),
+			corev1.TLSPrivateKeyKey: certs.certPrivKeyPEM.Bytes(),
+		},
+	}
+}
+
+// slowSecretClient blocks the reads of the named secret until their context is done, like a slow API server
+type slowSecretClient struct {
+	client.Client
+	name string
+}
+
+func (c *slowSecretClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	if _, ok := obj.(*corev1.Secret); ok && key.Name == c.name {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+// failingSecretClient fails the reads of the named secret with err, like an API server denying access
+type failingSecretClient struct {
+	client.Client
+	name string
+	err  error
+}
+
+func (c *failingSecretClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	if _, ok := obj.(*corev1.Secret); ok && key.Name == c.name {
+		return c.err
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+// newTestGitHubConnector returns a GitHub connector using the client secret in secretName
+func newTestGitHubConnector(id string, secretName string) authv1alpha1.ConnectorSpec {
+	return authv1alpha1.ConnectorSpec{
+		Name: id,
+		Id:   id,
+		Type: authv1alpha1.ConnectorTypeGitHub,
+		GitHub: authv1alpha1.GitHubConfigSpec{
+			ClientID:        "client-id",
+			ClientSecretRef: corev1.SecretReference{Name: secretName},
+			RedirectURI:     "https://dex.example.com/callback",
+		},
+	}
+}
+
+// newTestMicrosoftConnector returns a Microsoft connector whose client secret is read from secretName
+func newTestMicrosoftConnector(id string, secretName string, tenant string) authv1alpha1.ConnectorSpec {
+	return authv1alpha1.ConnectorSpec{
+		Name: id,
+		Id:   id,
+		Type: authv1alpha1.ConnectorTypeMicrosoft,
+		Microsoft: authv1alpha1.MicrosoftConfigSpec{
+			ClientID:        "client-id",
+			ClientSecretRef: corev1.SecretReference{Name: secretName},
+			RedirectURI:     "https://dex.example.com/callback",
+			Tenant:          tenant,
+		},
+	}
+}
+
+// getDeploymentImageConditionForTest returns the DeploymentImageUpToDate condition of the test DexServer without syncing it
+func getDeploymentImageConditionForTest(r *DexServerReconciler) *metav1.Condition {
+	dexServer := newTestDexServer()
+	previousDexImage, err := r.getDeploymentImage(dexServer, context.TODO())
+	Expect(err).NotTo(HaveOccurred())
+	imageCond := r.getDeploymentImageCondition(dexServer, previousDexImage, context.TODO())
+	Expect(imageCond).NotTo(BeNil())
+	return imageCond
+}
+
+var _ = Describe("DexServer reconcile", func() {
+	var originalDexImage string
+
+	BeforeEach(func() {
+		originalDexImage = os.Getenv(DEX_IMAGE_ENV_NAME)
+		Expect(os.Setenv(DEX_IMAGE_ENV_NAME, testDexImage)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.Setenv(DEX_IMAGE_ENV_NAME, originalDexImage)).To(Succeed())
+	})
+
+	It("tracks the condition of each phase independently", func() {
+		r := newTestDexServerReconciler(newTestDexServer())
+
+		By("failing the Deployment phase")
+		Expect(os.Unsetenv(DEX_IMAGE_ENV_NAME)).To(Succeed())
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).To(HaveOccurred())
+
+		configMapCond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeConfigMapReady)
+		Expect(configMapCond).NotTo(BeNil())
+		Expect(configMapCond.Status).To(Equal(metav1.ConditionTrue))
+
+		deploymentCond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeDeploymentReady)
+		Expect(deploymentCond).NotTo(BeNil())
+		Expect(deploymentCond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(deploymentCond.Reason).To(Equal("DexImageNotConfigured"))
+
+		// Phases after the failed one have not run yet
+		Expect(meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeIngressReady)).To(BeNil())
+		Expect(meta.IsStatusConditionFalse(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)).To(BeTrue())
+
+		By("recovering the Deployment phase")
+		Expect(os.Setenv(DEX_IMAGE_ENV_NAME, testDexImage)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeDeploymentReady)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeIngressReady)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)).To(BeTrue())
+
+		// The ConfigMap phase did not transition, so its transition time is preserved
+		Expect(meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeConfigMapReady).LastTransitionTime).
+			To(Equal(configMapCond.LastTransitionTime))
+	})
+
+	It("keeps connector secrets out of the ConfigMap when env expansion is enabled", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.UseEnvExpansion = true
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{newTestGitHubConnector("my-github", "github-secret")}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}))
+
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+
+		configYaml := getTestConfigYaml(r)
+		Expect(configYaml).To(ContainSubstring("$DEX_CONNECTOR_MY_GITHUB_CLIENT_SECRET"))
+		Expect(configYaml).NotTo(ContainSubstring("s3cr3t"))
+
+		env := getTestDeployment(r).Spec.Template.Spec.Containers[0].Env
+		Expect(env).To(ContainElement(corev1.EnvVar{
+			Name: "DEX_CONNECTOR_MY_GITHUB_CLIENT_SECRET",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "github-secret"},
+					Key:                  "clientSecret",
+				},
+			},
+		}))
+	})
+
+	It("rejects cross-namespace connector secrets when env expansion is enabled", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.UseEnvExpansion = true
+		connector := newTestGitHubConnector("github", "github-secret")
+		connector.GitHub.ClientSecretRef.Namespace = "other-namespace"
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{connector}
+
+		_, err := getConnectorSecretEnvVars(dexServer)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rolls out a rotated connector secret when env expansion is enabled", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.UseEnvExpansion = true
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{newTestGitHubConnector("github", "github-secret")}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}))
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		annotations := getTestDeployment(r).Spec.Template.Annotations
+		configHash := annotations[CONFIG_HASH_ANNOTATION]
+		connectorSecretsHash := annotations[CONNECTOR_SECRETS_HASH_ANNOTATION]
+		Expect(connectorSecretsHash).NotTo(BeEmpty())
+
+		By("keeping the hash while the connector secret is unchanged")
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getTestDeployment(r).Spec.Template.Annotations[CONNECTOR_SECRETS_HASH_ANNOTATION]).To(Equal(connectorSecretsHash))
+
+		By("changing the hash once the connector secret rotates")
+		secret := &corev1.Secret{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: "github-secret", Namespace: testDexServerNamespace}, secret)).To(Succeed())
+		secret.Data["clientSecret"] = []byte("rotated")
+		Expect(r.Update(context.TODO(), secret)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		annotations = getTestDeployment(r).Spec.Template.Annotations
+		Expect(annotations[CONFIG_HASH_ANNOTATION]).To(Equal(configHash))
+		Expect(annotations[CONNECTOR_SECRETS_HASH_ANNOTATION]).NotTo(Equal(connectorSecretsHash))
+	})
+
+	It("renders the session affinity of the http Service", func() {
+		dexServer := newTestDexServer()
+		r := newTestDexServerReconciler(dexServer)
+
+		By("defaulting to None")
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		service, err := r.KubeClient.CoreV1().Services(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(service.Spec.SessionAffinity).To(Equal(corev1.ServiceAffinityNone))
+		Expect(service.Spec.SessionAffinityConfig).To(BeNil())
+
+		By("switching an existing Service to ClientIP")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		timeoutSeconds := int32(600)
+		dexServer.Spec.SessionAffinity = corev1.ServiceAffinityClientIP
+		dexServer.Spec.SessionAffinityTimeoutSeconds = &timeoutSeconds
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		service, err = r.KubeClient.CoreV1().Services(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(service.Spec.SessionAffinity).To(Equal(corev1.ServiceAffinityClientIP))
+		Expect(*service.Spec.SessionAffinityConfig.ClientIP.TimeoutSeconds).To(Equal(timeoutSeconds))
+	})
+
+	It("reports issuer reachability on the Available condition without failing the reconcile", func() {
+		issuerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != ISSUER_DISCOVERY_PATH {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(`{"issuer":"` + "http://" + req.Host + `"}`))
+		}))
+		defer issuerServer.Close()
+
+		By("reaching the discovery endpoint")
+		dexServer := newTestDexServer()
+		dexServer.Spec.Issuer = issuerServer.URL
+		r := newTestDexServerReconciler(dexServer)
+		r.AllowHTTPIssuer = true
+		r.CheckIssuerReachability = true
+		createTestReadyDexPod(r)
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		availableCond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeAvailable)
+		Expect(availableCond).NotTo(BeNil())
+		Expect(availableCond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(availableCond.Reason).To(Equal("IssuerReachable"))
+
+		By("failing to connect to the issuer")
+		dexServer = newTestDexServer()
+		dexServer.Spec.Issuer = issuerServer.URL
+		issuerServer.Close()
+		r = newTestDexServerReconciler(dexServer)
+		r.AllowHTTPIssuer = true
+		r.CheckIssuerReachability = true
+		createTestReadyDexPod(r)
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		availableCond = meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeAvailable)
+		Expect(availableCond).NotTo(BeNil())
+		Expect(availableCond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(availableCond.Reason).To(Equal("IssuerUnreachable"))
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)).To(BeTrue())
+	})
+
+	It("publishes the JWKS of dex and refreshes it at the next key rotation", func() {
+		keys := `{"keys":[{"kid":"key-1"}]}`
+		issuerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case ISSUER_DISCOVERY_PATH:
+				w.Write([]byte(`{"issuer":"http://` + req.Host + `","jwks_uri":"http://` + req.Host + `/keys"}`))
+			case JWKS_PATH:
+				w.Header().Set("Cache-Control", "max-age=600, must-revalidate")
+				w.Write([]byte(keys))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer issuerServer.Close()
+
+		dexServer := newTestDexServer()
+		dexServer.Spec.Issuer = issuerServer.URL
+		dexServer.Spec.PublishJWKS = true
+		r := newTestDexServerReconciler(dexServer)
+		r.AllowHTTPIssuer = true
+		createTestReadyDexPod(r)
+		result, err := r.Reconcile(context.TODO(), ctrl.Request{
+			NamespacedName: types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(600 * time.Second))
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeJWKSPublished)).To(BeTrue())
+		configMap, err := r.KubeClient.CoreV1().ConfigMaps(testDexServerNamespace).Get(context.TODO(), testDexServerName+JWKS_CONFIGMAP_SUFFIX, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configMap.Data[JWKS_KEY]).To(MatchJSON(keys))
+		Expect(configMap.Data[JWKS_DISCOVERY_KEY]).To(ContainSubstring(`"jwks_uri"`))
+
+		By("publishing the rotated keys")
+		keys = `{"keys":[{"kid":"key-2"},{"kid":"key-1"}]}`
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		configMap, err = r.KubeClient.CoreV1().ConfigMaps(testDexServerNamespace).Get(context.TODO(), testDexServerName+JWKS_CONFIGMAP_SUFFIX, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configMap.Data[JWKS_KEY]).To(MatchJSON(keys))
+
+		By("reporting a condition when dex is not reachable")
+		issuerServer.Close()
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		jwksCond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeJWKSPublished)
+		Expect(jwksCond).NotTo(BeNil())
+		Expect(jwksCond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(jwksCond.Reason).To(Equal("JWKSFetchFailed"))
+
+		By("removing the ConfigMap when publishing is disabled")
+		dexServer.Spec.PublishJWKS = false
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.KubeClient.CoreV1().ConfigMaps(testDexServerNamespace).Get(context.TODO(), testDexServerName+JWKS_CONFIGMAP_SUFFIX, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("reports the readiness of the dex pods on the Available condition", func() {
+		r := newTestDexServerReconciler(newTestDexServer())
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}}
+
+		By("requeueing while no dex pod is ready")
+		result, err := r.Reconcile(context.TODO(), req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(PODS_NOT_READY_MIN_REQUEUE))
+		dexServer := &authv1alpha1.DexServer{}
+		Expect(r.Get(context.TODO(), req.NamespacedName, dexServer)).To(Succeed())
+		availableCond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeAvailable)
+		Expect(availableCond).NotTo(BeNil())
+		Expect(availableCond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(availableCond.Reason).To(Equal("PodsNotReady"))
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)).To(BeTrue())
+
+		By("backing off while the DexServer stays unavailable")
+		availableCond.LastTransitionTime = metav1.NewTime(time.Now().Add(-time.Minute))
+		meta.RemoveStatusCondition(&dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeAvailable)
+		dexServer.Status.Conditions = append(dexServer.Status.Conditions, *availableCond)
+		Expect(r.Status().Update(context.TODO(), dexServer)).To(Succeed())
+		result, err = r.Reconcile(context.TODO(), req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">=", time.Minute))
+		Expect(result.RequeueAfter).To(BeNumerically("<=", PODS_NOT_READY_MAX_REQUEUE))
+
+		By("reporting the last termination of a crashlooping dex container")
+		createTestDexPod(r, "dex-crashloop", corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:         testDexServerName,
+				RestartCount: 4,
+				State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					Reason:   "Error",
+					ExitCode: 2,
+					Message:  "failed to initialize server: invalid config",
+				}},
+			}},
+		})
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		availableCond = meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeAvailable)
+		Expect(availableCond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(availableCond.Reason).To(Equal("CrashLoopBackOff"))
+		Expect(availableCond.Message).To(ContainSubstring("dex pod dex-crashloop is crashlooping after 4 restarts"))
+		Expect(availableCond.Message).To(ContainSubstring("reason Error and exit code 2: failed to initialize server: invalid config"))
+
+		By("becoming available once a dex pod is ready")
+		createTestReadyDexPod(r)
+		result, err = r.Reconcile(context.TODO(), req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(time.Hour))
+		Expect(r.Get(context.TODO(), req.NamespacedName, dexServer)).To(Succeed())
+		availableCond = meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeAvailable)
+		Expect(availableCond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(availableCond.Reason).To(Equal("PodsReady"))
+		Expect(availableCond.Message).To(Equal("1 of 2 dex pods are ready"))
+	})
+
+	It("renders the LDAP userMatchers as a list and omits the unconfigured searches", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{
+			{
+				Name: "ldap",
+				Id:   "ldap",
+				Type: authv1alpha1.ConnectorTypeLDAP,
+				LDAP: authv1alpha1.LDAPConfigSpec{
+					Host:      "ldap.example.com:636",
+					BindPWRef: corev1.SecretReference{Name: "ldap-secret"},
+					GroupSearch: authv1alpha1.GroupSearchSpec{
+						BaseDN: "ou=groups,dc=example,dc=com",
+						UserMatchers: []authv1alpha1.UserMatcher{
+							{UserAttr: "uid", GroupAttr: "memberUid"},
+							{UserAttr: "DN", GroupAttr: "member"},
+						},
+					},
+				},
+			},
+			{
+				Name: "ldap-users",
+				Id:   "ldap-users",
+				Type: authv1alpha1.ConnectorTypeLDAP,
+				LDAP: authv1alpha1.LDAPConfigSpec{
+					Host:      "ldap.example.com:636",
+					BindPWRef: corev1.SecretReference{Name: "ldap-secret"},
+				},
+			},
+		}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("ldap-secret", map[string]string{"bindPW": "password"}))
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+
+		config := struct {
+			Connectors []struct {
+				Config map[string]interface{} `json:"config"`
+			} `json:"connectors"`
+		}{}
+		Expect(yaml.Unmarshal([]byte(getTestConfigYaml(r)), &config)).To(Succeed())
+		Expect(config.Connectors).To(HaveLen(2))
+		Expect(config.Connectors[0].Config).To(HaveKeyWithValue("groupSearch", map[string]interface{}{
+			"baseDN": "ou=groups,dc=example,dc=com",
+			"userMatchers": []interface{}{
+				map[string]interface{}{"userAttr": "uid", "groupAttr": "memberUid"},
+				map[string]interface{}{"userAttr": "DN", "groupAttr": "member"},
+			},
+		}))
+		Expect(config.Connectors[0].Config).NotTo(HaveKey("userSearch"))
+		Expect(config.Connectors[1].Config).NotTo(HaveKey("groupSearch"))
+		Expect(config.Connectors[1].Config).NotTo(HaveKey("userSearch"))
+	})
+
+	It("renders the LDAP group search for the dex config version", func() {
+		newLDAPDexServer := func(dexConfigVersion string) *authv1alpha1.DexServer {
+			dexServer := newTestDexServer()
+			dexServer.Spec.DexConfigVersion = dexConfigVersion
+			dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{{
+				Name: "ldap",
+				Id:   "ldap",
+				Type: authv1alpha1.ConnectorTypeLDAP,
+				LDAP: authv1alpha1.LDAPConfigSpec{
+					Host:      "ldap.example.com:636",
+					BindDN:    "cn=admin,dc=example,dc=com",
+					BindPWRef: corev1.SecretReference{Name: "ldap-secret"},
+					GroupSearch: authv1alpha1.GroupSearchSpec{
+						BaseDN:       "ou=groups,dc=example,dc=com",
+						UserMatchers: []authv1alpha1.UserMatcher{{UserAttr: "DN", GroupAttr: "member"}},
+					},
+				},
+			}}
+			return dexServer
+		}
+		ldapSecret := newTestSecret("ldap-secret", map[string]string{"bindPW": "password"})
+
+		By("rendering userMatchers for current versions")
+		r := newTestDexServerReconciler(newLDAPDexServer("v2.30"), ldapSecret.DeepCopy())
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getTestConfigYaml(r)).To(ContainSubstring("userMatchers"))
+
+		By("rendering a single userAttr/groupAttr pair before v2.27")
+		r = newTestDexServerReconciler(newLDAPDexServer("v2.26.1"), ldapSecret.DeepCopy())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		configYaml := getTestConfigYaml(r)
+		Expect(configYaml).NotTo(ContainSubstring("userMatchers"))
+		Expect(configYaml).To(ContainSubstring("userAttr: DN"))
+		Expect(configYaml).To(ContainSubstring("groupAttr: member"))
+
+		By("deriving the version from the dex image tag")
+		Expect(os.Setenv(DEX_IMAGE_ENV_NAME, "quay.io/dexidp/dex:v2.26.0")).To(Succeed())
+		Expect(getDexConfigVersion(newTestDexServer())).To(Equal("v2.26.0"))
+		Expect(os.Setenv(DEX_IMAGE_ENV_NAME, "quay.io/dexidp/dex@sha256:0123")).To(Succeed())
+		Expect(getDexConfigVersion(newTestDexServer())).To(BeEmpty())
+
+		By("rendering the latest format for unknown versions")
+		renderer, err := getDexConfigRenderer("v3.0")
+		Expect(err).To(HaveOccurred())
+		Expect(renderer).To(Equal(latestDexConfigRenderer))
+		renderer, err = getDexConfigRenderer("latest")
+		Expect(err).To(HaveOccurred())
+		Expect(renderer).To(Equal(latestDexConfigRenderer))
+
+		By("rejecting an unsupported spec.dexConfigVersion")
+		r = newTestDexServerReconciler(newLDAPDexServer("v3.0"), ldapSecret.DeepCopy())
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("InvalidSpec"))
+		Expect(cond.Message).To(ContainSubstring("spec.dexConfigVersion"))
+	})
+
+	It("publishes the connector root CAs in an aggregated CA bundle ConfigMap", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.PublishCABundle = true
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{{
+			Name: "ldap",
+			Id:   "ldap",
+			Type: authv1alpha1.ConnectorTypeLDAP,
+			LDAP: authv1alpha1.LDAPConfigSpec{
+				Host:       "ldap.example.com:636",
+				BindPWRef:  corev1.SecretReference{Name: "ldap-secret"},
+				RootCARef:  corev1.SecretReference{Name: "ldap-ca"},
+				RootCAData: []byte("inline-ca"),
+			},
+		}}
+		r := newTestDexServerReconciler(dexServer,
+			newTestSecret("ldap-secret", map[string]string{"bindPW": "password"}),
+			newTestSecret("ldap-ca", map[string]string{"ca.crt": "secret-ca"}))
+		getCABundle := func() (string, error) {
+			configMap, err := r.KubeClient.CoreV1().ConfigMaps(testDexServerNamespace).Get(context.TODO(), testDexServerName+CA_BUNDLE_CONFIGMAP_SUFFIX, metav1.GetOptions{})
+			if err != nil {
+				return "", err
+			}
+			return configMap.Data[CA_BUNDLE_KEY], nil
+		}
+
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeCABundleReady)).To(BeTrue())
+		caBundle, err := getCABundle()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(caBundle).To(Equal("secret-ca\ninline-ca\n"))
+
+		By("keeping the bundle in sync with the root CA secret")
+		caSecret := &corev1.Secret{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: "ldap-ca", Namespace: testDexServerNamespace}, caSecret)).To(Succeed())
+		Expect(caSecret.Labels).To(HaveKey(IDP_CREDENTIAL_LABEL))
+		caSecret.Data["ca.crt"] = []byte("rotated-ca")
+		Expect(r.Update(context.TODO(), caSecret)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		caBundle, err = getCABundle()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(caBundle).To(Equal("rotated-ca\ninline-ca\n"))
+
+		By("removing the bundle when publishing is disabled")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.PublishCABundle = false
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = getCABundle()
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("publishes the root CAs of GitHub Enterprise connectors in the CA bundle ConfigMap", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.PublishCABundle = true
+		connector := newTestGitHubConnector("github-enterprise", "github-secret")
+		connector.GitHub.HostName = "github.example.com"
+		connector.GitHub.RootCARef = &corev1.LocalObjectReference{Name: "github-ca"}
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{
+			connector,
+			newTestGitHubConnector("github", "github-secret"),
+			{
+				Name: "ldap",
+				Id:   "ldap",
+				Type: authv1alpha1.ConnectorTypeLDAP,
+				LDAP: authv1alpha1.LDAPConfigSpec{
+					Host:       "ldap.example.com:636",
+					BindPWRef:  corev1.SecretReference{Name: "ldap-secret"},
+					RootCAData: []byte("ldap-ca"),
+				},
+			},
+		}
+		r := newTestDexServerReconciler(dexServer,
+			newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}),
+			newTestSecret("ldap-secret", map[string]string{"bindPW": "password"}),
+			newTestSecret("github-ca", map[string]string{"ca.crt": "github-ca"}))
+
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeCABundleReady)).To(BeTrue())
+		configMap, err := r.KubeClient.CoreV1().ConfigMaps(testDexServerNamespace).Get(context.TODO(), testDexServerName+CA_BUNDLE_CONFIGMAP_SUFFIX, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configMap.Data[CA_BUNDLE_KEY]).To(Equal("github-ca\nldap-ca\n"))
+		caSecret := &corev1.Secret{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: "github-ca", Namespace: testDexServerNamespace}, caSecret)).To(Succeed())
+		Expect(caSecret.Labels).To(HaveKey(IDP_CREDENTIAL_LABEL))
+	})
+
+	It("sets owner references on generated resources following the owner reference mode", func() {
+		getOwnerReferences := func(r *DexServerReconciler) ([]metav1.OwnerReference, []metav1.OwnerReference) {
+			service, err := r.KubeClient.CoreV1().Services(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			mtlsSecret := &corev1.Secret{}
+			Expect(r.Get(context.TODO(), types.NamespacedName{Name: SECRET_MTLS_NAME, Namespace: testDexServerNamespace}, mtlsSecret)).To(Succeed())
+			return service.OwnerReferences, mtlsSecret.OwnerReferences
+		}
+
+		By("defaulting to a controller reference")
+		r := newTestDexServerReconciler(newTestDexServer())
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		serviceRefs, secretRefs := getOwnerReferences(r)
+		Expect(serviceRefs).To(HaveLen(1))
+		Expect(*serviceRefs[0].Controller).To(BeTrue())
+		Expect(secretRefs).To(HaveLen(1))
+		Expect(*secretRefs[0].Controller).To(BeTrue())
+
+		By("setting a plain owner reference")
+		r = newTestDexServerReconciler(newTestDexServer())
+		r.OwnerReferenceMode = OWNER_REFERENCE_MODE_OWNER
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		serviceRefs, secretRefs = getOwnerReferences(r)
+		Expect(serviceRefs).To(HaveLen(1))
+		Expect(serviceRefs[0].Name).To(Equal(testDexServerName))
+		Expect(serviceRefs[0].Controller).To(BeNil())
+		Expect(secretRefs).To(HaveLen(1))
+		Expect(secretRefs[0].Controller).To(BeNil())
+
+		By("omitting owner references")
+		r = newTestDexServerReconciler(newTestDexServer())
+		r.OwnerReferenceMode = OWNER_REFERENCE_MODE_NONE
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		serviceRefs, secretRefs = getOwnerReferences(r)
+		Expect(serviceRefs).To(BeEmpty())
+		Expect(secretRefs).To(BeEmpty())
+
+		Expect(ValidateOwnerReferenceMode("gitops")).To(HaveOccurred())
+	})
+
+	It("names the gRPC service and localhost in the gRPC server certificate", func() {
+		certs, err := generateMTLSCerts(testDexServerNamespace, nil)
+		Expect(err).NotTo(HaveOccurred())
+		block, _ := pem.Decode(certs.certPEM.Bytes())
+		Expect(block).NotTo(BeNil())
+		cert, err := x509.ParseCertificate(block.Bytes)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cert.DNSNames).To(Equal([]string{
+			"grpc",
+			"grpc." + testDexServerNamespace,
+			"grpc." + testDexServerNamespace + ".svc",
+			"grpc." + testDexServerNamespace + ".svc.cluster.local",
+			"localhost",
+		}))
+
+		By("verifying each name against the generated CA")
+		roots := x509.NewCertPool()
+		Expect(roots.AppendCertsFromPEM(certs.caPEM.Bytes())).To(BeTrue())
+		for _, dnsName := range cert.DNSNames {
+			_, err := cert.Verify(x509.VerifyOptions{DNSName: dnsName, Roots: roots})
+			Expect(err).NotTo(HaveOccurred(), dnsName)
+		}
+		Expect(hasGRPCServiceDNSNames(certs.certPEM.Bytes(), testDexServerNamespace)).To(BeTrue())
+		Expect(hasGRPCServiceDNSNames(certs.certPEM.Bytes(), "other-ns")).To(BeFalse())
+	})
+
+	It("adds the configured SANs to the gRPC server certificate", func() {
+		getServerCert := func(r *DexServerReconciler) *x509.Certificate {
+			mtlsSecret := &corev1.Secret{}
+			Expect(r.Get(context.TODO(), types.NamespacedName{Name: SECRET_MTLS_NAME, Namespace: testDexServerNamespace}, mtlsSecret)).To(Succeed())
+			block, _ := pem.Decode(mtlsSecret.Data["tls.crt"])
+			Expect(block).NotTo(BeNil())
+			cert, err := x509.ParseCertificate(block.Bytes)
+			Expect(err).NotTo(HaveOccurred())
+			return cert
+		}
+
+		dexServer := newTestDexServer()
+		dexServer.Spec.GRPCCertSANs = []string{"grpc.dex.example.com", "10.0.0.1"}
+		r := newTestDexServerReconciler(dexServer)
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cert := getServerCert(r)
+		Expect(cert.DNSNames).To(ConsistOf(append(getGRPCServiceDNSNames(testDexServerNamespace), "grpc.dex.example.com")))
+		Expect(cert.IPAddresses).To(ContainElement(net.ParseIP("10.0.0.1").To4()))
+
+		By("regenerating the certificate when the SANs change")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.GRPCCertSANs = []string{"grpc.other.example.com"}
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getServerCert(r).DNSNames).To(ConsistOf(append(getGRPCServiceDNSNames(testDexServerNamespace), "grpc.other.example.com")))
+
+		By("rejecting invalid SANs")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.GRPCCertSANs = []string{"not a dns name"}
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("InvalidSpec"))
+		Expect(cond.Message).To(ContainSubstring("spec.grpcCertSANs[0]"))
+	})
+
+	It("updates the deployment image when the desired dex image changes", func() {
+		r := newTestDexServerReconciler(newTestDexServer())
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getTestDeployment(r).Spec.Template.Spec.Containers[0].Image).To(Equal(testDexImage))
+		imageCond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeDeploymentImageUpToDate)
+		Expect(imageCond).NotTo(BeNil())
+		Expect(imageCond.Reason).To(Equal("ImageUpToDate"))
+
+		By("changing the dex image of the operator")
+		upgradedDexImage := "quay.io/dexidp/dex:v2.31.0"
+		Expect(os.Setenv(DEX_IMAGE_ENV_NAME, upgradedDexImage)).To(Succeed())
+		Expect(getDeploymentImageConditionForTest(r).Status).To(Equal(metav1.ConditionFalse))
+
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getTestDeployment(r).Spec.Template.Spec.Containers[0].Image).To(Equal(upgradedDexImage))
+		imageCond = meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeDeploymentImageUpToDate)
+		Expect(imageCond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(imageCond.Reason).To(Equal("ImageUpdated"))
+		Expect(imageCond.Message).To(ContainSubstring(testDexImage))
+		Expect(imageCond.Message).To(ContainSubstring(upgradedDexImage))
+	})
+
+	It("rejects connector secrets outside the allowed secret namespaces", func() {
+		dexServer := newTestDexServer()
+		connector := newTestGitHubConnector("github", "github-secret")
+		connector.GitHub.ClientSecretRef.Namespace = "other-namespace"
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{connector}
+		r := newTestDexServerReconciler(dexServer)
+		r.AllowedSecretNamespaces = []string{"shared-secrets"}
+
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		appliedCond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(appliedCond).NotTo(BeNil())
+		Expect(appliedCond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(appliedCond.Reason).To(Equal("SecretNamespaceNotAllowed"))
+		Expect(appliedCond.Message).To(ContainSubstring("other-namespace"))
+		Expect(meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeConfigMapReady)).To(BeNil())
+
+		_, err = getConnectorSecretFromRef(connector, dexServer, r, context.TODO())
+		Expect(err).To(HaveOccurred())
+
+		By("allowing the DexServer namespace and the allowed namespaces")
+		Expect(r.checkSecretNamespaceAllowed(dexServer, testDexServerNamespace)).To(Succeed())
+		Expect(r.checkSecretNamespaceAllowed(dexServer, "shared-secrets")).To(Succeed())
+		r.AllowedSecretNamespaces = nil
+		Expect(r.checkSecretNamespaceAllowed(dexServer, "other-namespace")).To(Succeed())
+	})
+
+	It("redacts the connector secrets when they are printed or logged", func() {
+		dexServer := newTestDexServer()
+		connector := newTestGitHubConnector("github", "github-secret")
+		r := newTestDexServerReconciler(dexServer, newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}))
+		logs := &bytes.Buffer{}
+		ctx := ctrllog.IntoContext(context.TODO(), zap.New(zap.WriteTo(logs)))
+
+		clientSecret, err := getConnectorSecretFromRef(connector, dexServer, r, ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clientSecret.Reveal()).To(Equal("s3cr3t"))
+		for _, format := range []string{"%s", "%v", "%+v", "%#v", "%q", "%x"} {
+			Expect(fmt.Sprintf(format, clientSecret)).To(Equal(REDACTED), format)
+		}
+		Expect(fmt.Sprintf("%v", struct{ ClientSecret secretString }{clientSecret})).NotTo(ContainSubstring("s3cr3t"))
+		ctrllog.FromContext(ctx).Info("resolved", "clientSecret", clientSecret)
+		ctrllog.FromContext(ctx).Error(fmt.Errorf("failed with %v", clientSecret), "failed")
+		Expect(logs.String()).To(ContainSubstring(REDACTED))
+		Expect(logs.String()).NotTo(ContainSubstring("s3cr3t"))
+	})
+
+	It("binds dex to the least privileged storage RBAC scope", func() {
+		dexServer := newTestDexServer()
+		r := newTestDexServerReconciler(dexServer)
+		clusterRoleBindingName := SERVICE_ACCOUNT_NAME + "-" + testDexServerNamespace
+
+		By("binding the ClusterRole while the dex storage CRDs are not installed")
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.KubeClient.RbacV1().ClusterRoleBindings().Get(context.TODO(), clusterRoleBindingName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.KubeClient.RbacV1().RoleBindings(testDexServerNamespace).Get(context.TODO(), SERVICE_ACCOUNT_NAME, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+
+		By("binding a namespaced Role once the dex storage CRDs are installed")
+		for _, crdName := range dexStorageCRDNames {
+			_, err := r.APIExtensionClient.ApiextensionsV1().CustomResourceDefinitions().Create(context.TODO(),
+				&apiextensionsv1.CustomResourceDefinition{ObjectMeta: metav1.ObjectMeta{Name: crdName}}, metav1.CreateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		role, err := r.KubeClient.RbacV1().Roles(testDexServerNamespace).Get(context.TODO(), SERVICE_ACCOUNT_NAME, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(role.Rules[0].APIGroups).To(Equal([]string{"dex.coreos.com"}))
+		roleBinding, err := r.KubeClient.RbacV1().RoleBindings(testDexServerNamespace).Get(context.TODO(), SERVICE_ACCOUNT_NAME, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(roleBinding.Subjects[0].Name).To(Equal(SERVICE_ACCOUNT_NAME))
+		_, err = r.KubeClient.RbacV1().ClusterRoleBindings().Get(context.TODO(), clusterRoleBindingName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+
+		By("binding the ClusterRole when the cluster scope is requested")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.RBACScope = authv1alpha1.RBACScopeCluster
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.KubeClient.RbacV1().ClusterRoleBindings().Get(context.TODO(), clusterRoleBindingName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.KubeClient.RbacV1().RoleBindings(testDexServerNamespace).Get(context.TODO(), SERVICE_ACCOUNT_NAME, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+
+		By("keeping the ClusterRole binding of another DexServer of the namespace")
+		other := newTestDexServer()
+		other.Name = "other-dexserver"
+		other.Spec.RBACScope = authv1alpha1.RBACScopeNamespace
+		Expect(r.Create(context.TODO(), other)).To(Succeed())
+		Expect(r.syncStorageRBAC(other, context.TODO())).To(Succeed())
+		_, err = r.KubeClient.RbacV1().ClusterRoleBindings().Get(context.TODO(), clusterRoleBindingName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.KubeClient.RbacV1().RoleBindings(testDexServerNamespace).Get(context.TODO(), SERVICE_ACCOUNT_NAME, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("does not reconcile the status updates made by the reconcile", func() {
+		dexServer := newTestDexServer()
+		// The finalizer added by the first reconcile is reconciled on its own
+		dexServer.Finalizers = []string{DEX_SERVER_FINALIZER}
+		r := newTestDexServerReconciler(dexServer)
+		oldDexServer := &authv1alpha1.DexServer{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, oldDexServer)).To(Succeed())
+
+		newDexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(newDexServer.Status.Conditions).NotTo(BeEmpty())
+		Expect(dexServerPredicate().Update(event.UpdateEvent{ObjectOld: oldDexServer, ObjectNew: newDexServer})).To(BeFalse())
+	})
+
+	It("aggregates the connectors of DexConnectors into the config", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{newTestGitHubConnector("server-github", "github-secret")}
+		r := newTestDexServerReconciler(dexServer,
+			newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}),
+			newTestDexConnector("connector-github", testDexServerName, newTestGitHubConnector("connector-github", "github-secret")),
+			newTestDexConnector("other-github", "other-dexserver", newTestGitHubConnector("other-github", "github-secret")))
+
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		configYaml := getTestConfigYaml(r)
+		Expect(configYaml).To(ContainSubstring("server-github"))
+		Expect(configYaml).To(ContainSubstring("connector-github"))
+		Expect(configYaml).NotTo(ContainSubstring("other-github"))
+
+		By("not writing the aggregated connectors back to the DexServer")
+		Expect(dexServer.Spec.Connectors).To(HaveLen(1))
+	})
+
+	It("rejects connector ids used by more than one DexConnector", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{newTestGitHubConnector("github", "github-secret")}
+		r := newTestDexServerReconciler(dexServer,
+			newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}),
+			newTestDexConnector("github", testDexServerName, newTestGitHubConnector("github", "github-secret")))
+
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("DuplicateConnectorId"))
+		_, err = r.KubeClient.CoreV1().ConfigMaps(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("renders host aliases into the dex pod spec", func() {
+		dexServer := newTestDexServer()
+		hostAliases := []corev1.HostAlias{{IP: "10.0.0.10", Hostnames: []string{"ldap.example.com"}}}
+		dexServer.Spec.HostAliases = hostAliases
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{{
+			Name: "ldap",
+			Id:   "ldap",
+			Type: authv1alpha1.ConnectorTypeLDAP,
+			LDAP: authv1alpha1.LDAPConfigSpec{
+				Host:      "ldap.example.com:636",
+				BindPWRef: corev1.SecretReference{Name: "ldap-secret"},
+				RootCARef: corev1.SecretReference{Name: "ldap-ca"},
+			},
+		}}
+		r := newTestDexServerReconciler(dexServer,
+			newTestSecret("ldap-secret", map[string]string{"bindPW": "password"}),
+			newTestSecret("ldap-ca", map[string]string{"ca.crt": "ca"}))
+
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		podSpec := getTestDeployment(r).Spec.Template.Spec
+		Expect(podSpec.HostAliases).To(Equal(hostAliases))
+		Expect(podSpec.Volumes[len(podSpec.Volumes)-1].Name).To(Equal("ldapcerts-ldap"))
+
+		By("defaulting to no host aliases")
+		r = newTestDexServerReconciler(newTestDexServer())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getTestDeployment(r).Spec.Template.Spec.HostAliases).To(BeEmpty())
+	})
+
+	It("renders the node selector, tolerations and affinity into the dex pod spec", func() {
+		dexServer := newTestDexServer()
+		nodeSelector := map[string]string{"node-role.kubernetes.io/infra": ""}
+		tolerations := []corev1.Toleration{{Key: "tenant", Operator: corev1.TolerationOpEqual, Value: "gold", Effect: corev1.TaintEffectNoExecute}}
+		affinity := &corev1.Affinity{
+			NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+						MatchExpressions: []corev1.NodeSelectorRequirement{{
+							Key:      "topology.kubernetes.io/zone",
+							Operator: corev1.NodeSelectorOpIn,
+							Values:   []string{"zone-a"},
+						}},
+					}},
+				},
+			},
+		}
+		dexServer.Spec.NodeSelector = nodeSelector
+		dexServer.Spec.Tolerations = tolerations
+		dexServer.Spec.Affinity = affinity
+		r := newTestDexServerReconciler(dexServer)
+
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		podSpec := getTestDeployment(r).Spec.Template.Spec
+		Expect(podSpec.NodeSelector).To(Equal(nodeSelector))
+		Expect(podSpec.Tolerations).To(Equal(tolerations))
+		Expect(podSpec.Affinity).To(Equal(affinity))
+
+		By("defaulting to the infra tolerations and the anti-affinity of the dex pods")
+		r = newTestDexServerReconciler(newTestDexServer())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		defaultDeployment := getTestDeployment(r)
+		podSpec = defaultDeployment.Spec.Template.Spec
+		Expect(podSpec.NodeSelector).To(BeEmpty())
+		Expect(podSpec.Tolerations).To(HaveLen(2))
+		Expect(podSpec.Tolerations[0].Key).To(Equal("node-role.kubernetes.io/infra"))
+		Expect(podSpec.Affinity.NodeAffinity).To(BeNil())
+		Expect(podSpec.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution).To(HaveLen(2))
+
+		By("reconciling the resulting deployment updates, which are not restarts")
+		defaultDeployment.Generation = 1
+		defaultDeployment.OwnerReferences = []metav1.OwnerReference{{Kind: "DexServer", Name: testDexServerName}}
+		scheduledDeployment := defaultDeployment.DeepCopy()
+		scheduledDeployment.Generation = 2
+		scheduledDeployment.Spec.Template.Spec.NodeSelector = nodeSelector
+		scheduledDeployment.Spec.Template.Spec.Tolerations = tolerations
+		scheduledDeployment.Spec.Template.Spec.Affinity = affinity
+		restartPredicate := ignoreDeploymentRestartPredicate(DEFAULT_RESTART_ANNOTATION_KEY)
+		Expect(restartPredicate.Update(event.UpdateEvent{ObjectOld: defaultDeployment, ObjectNew: scheduledDeployment})).To(BeTrue())
+	})
+
+	It("mounts the root CA of a GitHub Enterprise connector", func() {
+		dexServer := newTestDexServer()
+		connector := newTestGitHubConnector("github-enterprise", "github-secret")
+		connector.GitHub.HostName = "github.example.com"
+		connector.GitHub.RootCARef = &corev1.LocalObjectReference{Name: "github-ca"}
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{connector}
+		r := newTestDexServerReconciler(dexServer,
+			newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}),
+			newTestSecret("github-ca", map[string]string{"ca.crt": "ca"}))
+
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getTestConfigYaml(r)).To(ContainSubstring("rootCA: " + GITHUB_CERTS_MOUNT_PATH + "/github-enterprise/ca.crt"))
+		podSpec := getTestDeployment(r).Spec.Template.Spec
+		Expect(podSpec.Containers[0].VolumeMounts).To(ContainElement(corev1.VolumeMount{
+			Name:      "githubcerts-github-enterprise",
+			MountPath: GITHUB_CERTS_MOUNT_PATH + "/github-enterprise",
+		}))
+		volumes := map[string]corev1.Volume{}
+		for _, volume := range podSpec.Volumes {
+			volumes[volume.Name] = volume
+		}
+		Expect(volumes["githubcerts-github-enterprise"].Secret.SecretName).To(Equal("github-ca"))
+		Expect(volumes["githubcerts-github-enterprise"].Secret.Items).To(Equal([]corev1.KeyToPath{{Key: "ca.crt", Path: "ca.crt"}}))
+
+		By("reporting a secret without a CA certificate")
+		secret := &corev1.Secret{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: "github-ca", Namespace: testDexServerNamespace}, secret)).To(Succeed())
+		secret.Data = map[string][]byte{"tls.crt": []byte("cert")}
+		Expect(r.Update(context.TODO(), secret)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).To(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond.Reason).To(Equal("ConnectorSecretKeyMissing"))
+		Expect(cond.Message).To(ContainSubstring("ca.crt"))
+	})
+
+	It("mounts the LDAP client certificate and key from their own secrets", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{{
+			Name: "ldap",
+			Id:   "ldap",
+			Type: authv1alpha1.ConnectorTypeLDAP,
+			LDAP: authv1alpha1.LDAPConfigSpec{
+				Host:      "ldap.example.com:636",
+				RootCARef: corev1.SecretReference{Name: "ldap-ca"},
+				BindPWRef: corev1.SecretReference{Name: "ldap-bind"},
+				ClientCertRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "ldap-client-cert"},
+					Key:                  "cert.pem",
+				},
+				ClientKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "ldap-client-key"},
+					Key:                  "key.pem",
+				},
+			},
+		}}
+		r := newTestDexServerReconciler(dexServer,
+			newTestSecret("ldap-ca", map[string]string{"ca.crt": "ca"}),
+			newTestSecret("ldap-bind", map[string]string{"bindPW": "pw"}),
+			newTestSecret("ldap-client-cert", map[string]string{"cert.pem": "cert"}),
+			newTestSecret("ldap-client-key", map[string]string{"key.pem": "key"}))
+
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		configYaml := getTestConfigYaml(r)
+		Expect(configYaml).To(ContainSubstring("rootCA: /etc/dex/ldapcerts/ldap/ca.crt"))
+		Expect(configYaml).To(ContainSubstring("clientCert: /etc/dex/ldapclientcert/ldap/tls.crt"))
+		Expect(configYaml).To(ContainSubstring("clientKey: /etc/dex/ldapclientkey/ldap/tls.key"))
+		podSpec := getTestDeployment(r).Spec.Template.Spec
+		volumes := map[string]corev1.Volume{}
+		for _, volume := range podSpec.Volumes {
+			volumes[volume.Name] = volume
+		}
+		Expect(volumes).To(HaveKey("ldapcerts-ldap"))
+		Expect(volumes["ldapclientcert-ldap"].Secret.SecretName).To(Equal("ldap-client-cert"))
+		Expect(volumes["ldapclientcert-ldap"].Secret.Items).To(Equal([]corev1.KeyToPath{{Key: "cert.pem", Path: "tls.crt"}}))
+		Expect(volumes["ldapclientkey-ldap"].Secret.Items).To(Equal([]corev1.KeyToPath{{Key: "key.pem", Path: "tls.key"}}))
+
+		By("reporting a referenced key missing from its secret")
+		secret := &corev1.Secret{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: "ldap-client-key", Namespace: testDexServerNamespace}, secret)).To(Succeed())
+		secret.Data = map[string][]byte{"other.pem": []byte("key")}
+		Expect(r.Update(context.TODO(), secret)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).To(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond.Reason).To(Equal("ConnectorSecretKeyMissing"))
+		Expect(cond.Message).To(ContainSubstring("key.pem"))
+	})
+
+	It("skips the sync of the resources that are not managed", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.ManagedResources = &authv1alpha1.ManagedResourcesSpec{
+			Exclude: []authv1alpha1.ManagedResource{authv1alpha1.ManagedResourceService, authv1alpha1.ManagedResourceIngress},
+		}
+		r := newTestDexServerReconciler(dexServer)
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = r.KubeClient.CoreV1().Services(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+		_, err = r.DynamicClient.Resource(networkingv1.SchemeGroupVersion.WithResource("ingresses")).Namespace(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+		getTestDeployment(r)
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeHTTPServiceReady)
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(cond.Reason).To(Equal("Unmanaged"))
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)).To(BeTrue())
+
+		By("only syncing the included resources")
+		previousDeployment := getTestDeployment(r)
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.Issuer = "https://dex.other.example.com"
+		dexServer.Spec.ManagedResources = &authv1alpha1.ManagedResourcesSpec{
+			Include: []authv1alpha1.ManagedResource{authv1alpha1.ManagedResourceConfigMap},
+		}
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getTestConfigYaml(r)).To(ContainSubstring("https://dex.other.example.com"))
+		Expect(getTestDeployment(r).Spec).To(Equal(previousDeployment.Spec))
+
+		By("rejecting a Deployment synced without its ConfigMap")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.ManagedResources = &authv1alpha1.ManagedResourcesSpec{
+			Exclude: []authv1alpha1.ManagedResource{authv1alpha1.ManagedResourceConfigMap},
+		}
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond = meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond.Reason).To(Equal("InvalidSpec"))
+		Expect(cond.Message).To(ContainSubstring("spec.managedResources"))
+	})
+
+	It("serves the OpenShift serving certificate by default", func() {
+		dexServer := newTestDexServer()
+		r := newTestDexServerReconciler(dexServer)
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+
+		service, err := r.KubeClient.CoreV1().Services(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(service.Annotations).To(HaveKeyWithValue("service.beta.openshift.io/serving-cert-secret-name", testDexServerName+SECRET_WEB_TLS_SUFFIX))
+		volumes := map[string]corev1.Volume{}
+		for _, volume := range getTestDeployment(r).Spec.Template.Spec.Volumes {
+			volumes[volume.Name] = volume
+		}
+		Expect(volumes["tls"].Secret.SecretName).To(Equal(testDexServerName + SECRET_WEB_TLS_SUFFIX))
+		Expect(getTestConfigYaml(r)).To(ContainSubstring("https: 0.0.0.0:5556"))
+	})
+
+	It("reports a serving certificate secret that never appears", func() {
+		dexServer := newTestDexServer()
+		r := newTestDexServerReconciler(dexServer)
+		recorder := record.NewFakeRecorder(20)
+		r.Recorder = recorder
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeDegraded)
+		Expect(cond.Status).To(Equal(metav1.ConditionUnknown))
+		Expect(cond.Reason).To(Equal("WaitingForServingCert"))
+
+		By("reporting the DexServer degraded after the timeout")
+		r.ServingCertTimeout = time.Millisecond
+		time.Sleep(10 * time.Millisecond)
+		for len(recorder.Events) > 0 {
+			<-recorder.Events
+		}
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond = meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeDegraded)
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(cond.Reason).To(Equal("ServingCertMissing"))
+		Expect(cond.Message).To(ContainSubstring("service.beta.openshift.io/serving-cert-secret-name"))
+		Expect(recorder.Events).To(Receive(HavePrefix("Warning ServingCertMissing")))
+
+		By("clearing the condition once the secret appears")
+		Expect(r.Create(context.TODO(), newTestSecret(testDexServerName+SECRET_WEB_TLS_SUFFIX, map[string]string{"tls.crt": "crt", "tls.key": "key"}))).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond = meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeDegraded)
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("ServingCertAvailable"))
+	})
+
+	It("serves the serving certificate of the web TLS secret", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.WebTLS = &authv1alpha1.WebTLSSpec{SecretName: "dex-serving-cert"}
+		r := newTestDexServerReconciler(dexServer)
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeDegraded)).To(BeNil())
+
+		service, err := r.KubeClient.CoreV1().Services(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(service.Annotations).NotTo(HaveKey("service.beta.openshift.io/serving-cert-secret-name"))
+		podSpec := getTestDeployment(r).Spec.Template.Spec
+		volumes := map[string]corev1.Volume{}
+		for _, volume := range podSpec.Volumes {
+			volumes[volume.Name] = volume
+		}
+		Expect(volumes["tls"].Secret.SecretName).To(Equal("dex-serving-cert"))
+		Expect(podSpec.Containers[0].VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: "tls", MountPath: "/etc/dex/tls"}))
+		Expect(getTestConfigYaml(r)).To(ContainSubstring("tlsCert: /etc/dex/tls/tls.crt"))
+		Expect(podSpec.Containers[0].Ports[0].Name).To(Equal("https"))
+
+		By("serving plain HTTP when TLS is disabled")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.WebTLS = &authv1alpha1.WebTLSSpec{Disabled: true}
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		config := getTestConfigYaml(r)
+		Expect(config).To(ContainSubstring("http: 0.0.0.0:5556"))
+		Expect(config).NotTo(ContainSubstring("tlsCert: /etc/dex/tls/tls.crt"))
+		podSpec = getTestDeployment(r).Spec.Template.Spec
+		for _, volume := range podSpec.Volumes {
+			Expect(volume.Name).NotTo(Equal("tls"))
+		}
+		for _, volumeMount := range podSpec.Containers[0].VolumeMounts {
+			Expect(volumeMount.Name).NotTo(Equal("tls"))
+		}
+		Expect(podSpec.Containers[0].Ports[0].Name).To(Equal("http"))
+
+		By("rejecting a secret when TLS is disabled")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.WebTLS.SecretName = "dex-serving-cert"
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond.Reason).To(Equal("InvalidSpec"))
+		Expect(cond.Message).To(ContainSubstring("spec.webTLS.secretName"))
+	})
+
+	It("trusts the CA of the web TLS secret on the Ingress and the Route", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.WebTLS = &authv1alpha1.WebTLSSpec{SecretName: "dex-serving-cert", CASecretName: "dex-serving-ca"}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("dex-serving-ca", map[string]string{"ca.crt": "ca"}))
+
+		By("annotating the Ingress with the HTTPS backend and its CA")
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		unstructuredIngress, err := r.DynamicClient.Resource(networkingv1.SchemeGroupVersion.WithResource("ingresses")).
+			Namespace(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		annotations := unstructuredIngress.GetAnnotations()
+		Expect(annotations).To(HaveKeyWithValue("nginx.ingress.kubernetes.io/backend-protocol", "HTTPS"))
+		Expect(annotations).To(HaveKeyWithValue("nginx.ingress.kubernetes.io/proxy-ssl-secret", testDexServerNamespace+"/dex-serving-ca"))
+		Expect(annotations).To(HaveKeyWithValue("route.openshift.io/destination-ca-certificate-secret", "dex-serving-ca"))
+
+		By("setting the destination CA of the reencrypt Route")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.RouteType = authv1alpha1.RouteTypeRoute
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeRouteReady)).To(BeTrue())
+		unstructuredRoute, err := r.DynamicClient.Resource(routev1.GroupVersion.WithResource("routes")).
+			Namespace(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		route := &routev1.Route{}
+		Expect(runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredRoute.Object, route)).To(Succeed())
+		Expect(route.Spec.TLS.Termination).To(Equal(routev1.TLSTerminationReencrypt))
+		Expect(strings.TrimSpace(route.Spec.TLS.DestinationCACertificate)).To(Equal("ca"))
+		secret := &corev1.Secret{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: "dex-serving-ca", Namespace: testDexServerNamespace}, secret)).To(Succeed())
+		Expect(secret.Labels).To(HaveKey(IDP_CREDENTIAL_LABEL))
+
+		By("rejecting a CA secret when TLS is disabled")
+		dexServer.Spec.WebTLS = &authv1alpha1.WebTLSSpec{Disabled: true, CASecretName: "dex-serving-ca"}
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond.Reason).To(Equal("InvalidSpec"))
+		Expect(cond.Message).To(ContainSubstring("spec.webTLS.caSecretName"))
+	})
+
+	It("adds the additional labels and annotations to the generated resources", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.AdditionalLabels = map[string]string{"cost-center": "1234", "app": "other"}
+		dexServer.Spec.AdditionalAnnotations = map[string]string{"example.com/team": "identity"}
+		r := newTestDexServerReconciler(dexServer)
+
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		service, err := r.KubeClient.CoreV1().Services(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(service.Labels).To(HaveKeyWithValue("cost-center", "1234"))
+		Expect(service.Annotations).To(HaveKeyWithValue("example.com/team", "identity"))
+		Expect(service.Annotations).To(HaveKey("service.beta.openshift.io/serving-cert-secret-name"))
+		Expect(service.OwnerReferences).To(HaveLen(1))
+
+		By("keeping the labels of the operator on conflict")
+		Expect(service.Labels).To(HaveKeyWithValue("app", testDexServerName))
+
+		deployment := getTestDeployment(r)
+		Expect(deployment.Labels).To(HaveKeyWithValue("cost-center", "1234"))
+		Expect(deployment.Annotations).To(HaveKeyWithValue("example.com/team", "identity"))
+		Expect(deployment.OwnerReferences).To(HaveLen(1))
+		configMap, err := r.KubeClient.CoreV1().ConfigMaps(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(configMap.Labels).To(HaveKeyWithValue("cost-center", "1234"))
+	})
+
+	It("publishes the dex services to the configured IP families", func() {
+		dexServer := newTestDexServer()
+		r := newTestDexServerReconciler(dexServer)
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		service, err := r.KubeClient.CoreV1().Services(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(service.Spec.IPFamilies).To(BeEmpty())
+		Expect(service.Spec.IPFamilyPolicy).To(BeNil())
+
+		By("updating the existing services")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		preferDualStack := corev1.IPFamilyPolicyPreferDualStack
+		dexServer.Spec.IPFamilies = []corev1.IPFamily{corev1.IPv6Protocol, corev1.IPv4Protocol}
+		dexServer.Spec.IPFamilyPolicy = &preferDualStack
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		for _, name := range []string{testDexServerName, GRPC_SERVICE_NAME} {
+			service, err := r.KubeClient.CoreV1().Services(testDexServerNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(service.Spec.IPFamilies).To(Equal([]corev1.IPFamily{corev1.IPv6Protocol, corev1.IPv4Protocol}), name)
+			Expect(*service.Spec.IPFamilyPolicy).To(Equal(corev1.IPFamilyPolicyPreferDualStack), name)
+		}
+	})
+
+	It("renders the image pull secrets into the dex pod spec", func() {
+		dexServer := newTestDexServer()
+		imagePullSecrets := []corev1.LocalObjectReference{{Name: "registry-creds"}, {Name: "mirror-creds"}}
+		dexServer.Spec.ImagePullSecrets = imagePullSecrets
+		r := newTestDexServerReconciler(dexServer)
+
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getTestDeployment(r).Spec.Template.Spec.ImagePullSecrets).To(Equal(imagePullSecrets))
+
+		By("omitting them by default")
+		r = newTestDexServerReconciler(newTestDexServer())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getTestDeployment(r).Spec.Template.Spec.ImagePullSecrets).To(BeEmpty())
+	})
+
+	It("reports all invalid fields on the Applied condition before applying anything", func() {
+		dexServer := newTestDexServer()
+		timeoutSeconds := int32(-1)
+		dexServer.Spec.SessionAffinityTimeoutSeconds = &timeoutSeconds
+		dexServer.Spec.GRPCCertSANs = []string{"grpc.example.com", "not a dns name"}
+		r := newTestDexServerReconciler(dexServer)
+
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("InvalidSpec"))
+		Expect(cond.Message).To(ContainSubstring("spec.sessionAffinityTimeoutSeconds"))
+		Expect(cond.Message).To(ContainSubstring("spec.grpcCertSANs[1]"))
+		_, err = r.KubeClient.CoreV1().ConfigMaps(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("merges the raw connector config into the rendered connector config", func() {
+		dexServer := newTestDexServer()
+		connector := newTestGitHubConnector("github", "github-secret")
+		connector.RawConfig = map[string]apiextensionsv1.JSON{
+			"preferredEmailDomain": {Raw: []byte(`"example.com"`)},
+			"scopes":               {Raw: []byte(`["read:org","user:email"]`)},
+		}
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{connector}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}))
+
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		configYaml := getTestConfigYaml(r)
+		Expect(configYaml).To(ContainSubstring("preferredEmailDomain: example.com"))
+		Expect(configYaml).To(ContainSubstring("- read:org"))
+		Expect(configYaml).To(ContainSubstring("- user:email"))
+	})
+
+	It("renders connector type aliases and rawConfig only connector types with the dex type name", func() {
+		dexServer := newTestDexServer()
+		microsoft := newTestMicrosoftConnector("microsoft", "microsoft-secret", "common")
+		microsoft.Type = "azuread"
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{
+			microsoft,
+			{
+				Id:   "oidc",
+				Name: "oidc",
+				Type: "openid-connect",
+				RawConfig: map[string]apiextensionsv1.JSON{
+					"issuer":   {Raw: []byte(`"https://accounts.example.com"`)},
+					"clientID": {Raw: []byte(`"oidc-client"`)},
+				},
+			},
+			{
+				Id:        "gitlab",
+				Name:      "gitlab",
+				Type:      authv1alpha1.ConnectorTypeGitLab,
+				RawConfig: map[string]apiextensionsv1.JSON{"baseURL": {Raw: []byte(`"https://gitlab.example.com"`)}},
+			},
+		}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("microsoft-secret", map[string]string{"clientSecret": "s3cr3t"}))
+
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		config := struct {
+			Connectors []struct {
+				Type   string                 `json:"type"`
+				Id     string                 `json:"id"`
+				Config map[string]interface{} `json:"config"`
+			} `json:"connectors"`
+		}{}
+		Expect(yaml.Unmarshal([]byte(getTestConfigYaml(r)), &config)).To(Succeed())
+		Expect(config.Connectors).To(HaveLen(3))
+		Expect(config.Connectors[0].Type).To(Equal("gitlab"))
+		Expect(config.Connectors[0].Config).To(HaveKeyWithValue("baseURL", "https://gitlab.example.com"))
+		Expect(config.Connectors[1].Type).To(Equal("microsoft"))
+		Expect(config.Connectors[1].Config).To(HaveKeyWithValue("tenant", "common"))
+		Expect(config.Connectors[2].Type).To(Equal("oidc"))
+		Expect(config.Connectors[2].Config).To(HaveKeyWithValue("issuer", "https://accounts.example.com"))
+		Expect(config.Connectors[2].Config).To(HaveKeyWithValue("clientID", "oidc-client"))
+	})
+
+	It("rejects unknown connector types and rawConfig only connectors without rawConfig", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{
+			{Id: "unknown", Name: "unknown", Type: "kerberos"},
+			{Id: "oidc", Name: "oidc", Type: authv1alpha1.ConnectorTypeOIDC},
+		}
+		r := newTestDexServerReconciler(dexServer)
+
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Reason).To(Equal("InvalidSpec"))
+		Expect(cond.Message).To(ContainSubstring(`spec.connectors[0].type: Unsupported value: "kerberos"`))
+		Expect(cond.Message).To(ContainSubstring("spec.connectors[1].rawConfig: Required value"))
+		_, err = r.KubeClient.CoreV1().ConfigMaps(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("reports an unset dex image with its own reason", func() {
+		r := newTestDexServerReconciler(newTestDexServer())
+		Expect(os.Unsetenv(DEX_IMAGE_ENV_NAME)).To(Succeed())
+
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).To(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("DexImageNotConfigured"))
+		Expect(cond.Message).To(ContainSubstring(DEX_IMAGE_ENV_NAME))
+		_, err = r.KubeClient.AppsV1().Deployments(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("correlates failed conditions with the log lines of the reconcile", func() {
+		r := newTestDexServerReconciler(newTestDexServer())
+		Expect(os.Unsetenv(DEX_IMAGE_ENV_NAME)).To(Succeed())
+		logs := &bytes.Buffer{}
+		ctx := ctrllog.IntoContext(context.TODO(), zap.New(zap.WriteTo(logs)))
+
+		_, err := r.Reconcile(ctx, ctrl.Request{
+			NamespacedName: types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace},
+		})
+		Expect(err).To(HaveOccurred())
+		dexServer := &authv1alpha1.DexServer{}
+		Expect(r.Get(ctx, types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		matches := regexp.MustCompile(`\(reconcileID: ([0-9a-f]{8})\)$`).FindStringSubmatch(cond.Message)
+		Expect(matches).NotTo(BeNil(), cond.Message)
+		for _, line := range strings.Split(logs.String(), "\n") {
+			if strings.Contains(line, "Reconciling...") || strings.Contains(line, "failed to sync Deployment") {
+				Expect(line).To(ContainSubstring(matches[1]))
+			}
+		}
+
+		By("using a new correlation ID for every reconcile")
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).To(HaveOccurred())
+		Expect(meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied).Message).
+			NotTo(ContainSubstring(matches[1]))
+	})
+
+	It("issues the gRPC certificates through CertificateSigningRequests with the KubeCSR source", func() {
+		caCert, caKey := newTestCA()
+		dexServer := newTestDexServer()
+		dexServer.Spec.GRPCCertSource = authv1alpha1.GRPCCertSourceKubeCSR
+		dexServer.Spec.GRPCCertSignerName = "example.com/grpc"
+		kubeRootCA := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: KUBE_ROOT_CA_CONFIGMAP_NAME, Namespace: testDexServerNamespace},
+			Data:       map[string]string{KUBE_ROOT_CA_KEY: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw}))},
+		}
+		r := newTestDexServerReconciler(dexServer, kubeRootCA)
+
+		By("waiting for the requests to be approved")
+		result, err := r.Reconcile(context.TODO(), ctrl.Request{
+			NamespacedName: types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(grpcCertRequeueInterval))
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeMTLSSecretReady)
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("WaitingForCertApproval"))
+		Expect(meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied).Reason).
+			To(Equal("WaitingForCertApproval"))
+		err = r.Get(context.TODO(), types.NamespacedName{Name: SECRET_MTLS_NAME, Namespace: testDexServerNamespace}, &corev1.Secret{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+
+		By("storing the signed certificates in the mtls secret")
+		for _, certName := range []string{"server", "client"} {
+			csrs := r.KubeClient.CertificatesV1().CertificateSigningRequests()
+			csr, err := csrs.Get(context.TODO(), getGRPCCertCSRName(dexServer, certName), metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(csr.Spec.SignerName).To(Equal("example.com/grpc"))
+			csr.Status.Certificate = signTestCSR(csr.Spec.Request, caCert, caKey)
+			_, err = csrs.UpdateStatus(context.TODO(), csr, metav1.UpdateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)).To(BeTrue())
+
+		mtlsSecret := &corev1.Secret{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: SECRET_MTLS_NAME, Namespace: testDexServerNamespace}, mtlsSecret)).To(Succeed())
+		Expect(mtlsSecret.Annotations[MTLS_CERT_SOURCE_ANNOTATION]).To(Equal(string(authv1alpha1.GRPCCertSourceKubeCSR)))
+		Expect(mtlsSecret.Data).NotTo(HaveKey("ca.key"))
+		block, _ := pem.Decode(mtlsSecret.Data["tls.crt"])
+		serverCert, err := x509.ParseCertificate(block.Bytes)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(serverCert.CheckSignatureFrom(caCert)).To(Succeed())
+		Expect(serverCert.DNSNames).To(ConsistOf(getGRPCServiceDNSNames(testDexServerNamespace)))
+
+		By("cleaning up the requests and the pending keys")
+		_, err = r.KubeClient.CertificatesV1().CertificateSigningRequests().Get(context.TODO(), getGRPCCertCSRName(dexServer, "server"), metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+		err = r.Get(context.TODO(), types.NamespacedName{Name: SECRET_MTLS_PENDING_NAME, Namespace: testDexServerNamespace}, &corev1.Secret{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("fails the reconcile when a gRPC CertificateSigningRequest is denied", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.GRPCCertSource = authv1alpha1.GRPCCertSourceKubeCSR
+		dexServer.Spec.GRPCCertSignerName = "example.com/grpc"
+		r := newTestDexServerReconciler(dexServer)
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+
+		csrs := r.KubeClient.CertificatesV1().CertificateSigningRequests()
+		csr, err := csrs.Get(context.TODO(), getGRPCCertCSRName(dexServer, "client"), metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+			Type:    certificatesv1.CertificateDenied,
+			Status:  corev1.ConditionTrue,
+			Message: "not allowed",
+		})
+		_, err = csrs.UpdateStatus(context.TODO(), csr, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).To(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeMTLSSecretReady)
+		Expect(cond.Reason).To(Equal("ConfigMTLSSecretFailed"))
+		Expect(cond.Message).To(ContainSubstring("Denied: not allowed"))
+	})
+
+	It("reconciles DexServers in parallel without sharing state", func() {
+		// Run with -race to detect unsynchronized shared state
+		const parallelReconciles = 4
+		dexServers, objs := []client.Object{}, []client.Object{}
+		for i := 0; i < parallelReconciles; i++ {
+			dexServer := newTestDexServer()
+			dexServer.Namespace = fmt.Sprintf("%s-%d", testDexServerNamespace, i)
+			dexServer.Spec.Issuer = fmt.Sprintf("https://dex-%d.example.com", i)
+			dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{newTestGitHubConnector("github", "github-secret")}
+			secret := newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"})
+			secret.Namespace = dexServer.Namespace
+			dexServers = append(dexServers, dexServer)
+			objs = append(objs, dexServer, secret)
+		}
+		r := newTestDexServerReconciler(objs...)
+
+		var wg sync.WaitGroup
+		for _, dexServer := range dexServers {
+			wg.Add(1)
+			go func(namespacedName types.NamespacedName) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: namespacedName})
+				Expect(err).NotTo(HaveOccurred())
+			}(client.ObjectKeyFromObject(dexServer))
+		}
+		wg.Wait()
+
+		for i, dexServer := range dexServers {
+			Expect(r.Get(context.TODO(), client.ObjectKeyFromObject(dexServer), dexServer)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(dexServer.(*authv1alpha1.DexServer).Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)).To(BeTrue())
+			configMap, err := r.KubeClient.CoreV1().ConfigMaps(dexServer.GetNamespace()).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(configMap.Data["config.yaml"]).To(ContainSubstring(fmt.Sprintf(`issuer: "https://dex-%d.example.com"`, i)))
+		}
+	})
+
+	It("annotates the Ingress to redirect HTTP to HTTPS when requested", func() {
+		getIngressAnnotations := func(r *DexServerReconciler) map[string]string {
+			ingress, err := r.DynamicClient.Resource(networkingv1.SchemeGroupVersion.WithResource("ingresses")).
+				Namespace(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			return ingress.GetAnnotations()
+		}
+
+		r := newTestDexServerReconciler(newTestDexServer())
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getIngressAnnotations(r)).NotTo(HaveKey("nginx.ingress.kubernetes.io/force-ssl-redirect"))
+
+		dexServer := newTestDexServer()
+		dexServer.Spec.ForceHTTPSRedirect = true
+		r = newTestDexServerReconciler(dexServer)
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getIngressAnnotations(r)).To(HaveKeyWithValue("nginx.ingress.kubernetes.io/force-ssl-redirect", "true"))
+	})
+
+	It("skips the reconcile of a DexServer in a terminating namespace", func() {
+		namespace := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: testDexServerNamespace},
+			Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceTerminating},
+		}
+		r := newTestDexServerReconciler(newTestDexServer(), namespace)
+		result, err := r.Reconcile(context.TODO(), ctrl.Request{
+			NamespacedName: types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(ctrl.Result{}))
+
+		// Nothing is applied and the status is left alone
+		dexServer := &authv1alpha1.DexServer{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		Expect(dexServer.Status.Conditions).To(BeEmpty())
+		err = r.Get(context.TODO(), types.NamespacedName{Name: SECRET_MTLS_NAME, Namespace: testDexServerNamespace}, &corev1.Secret{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+		_, err = r.KubeClient.AppsV1().Deployments(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("reports the dex version once the deployment has rolled out", func() {
+		r := newTestDexServerReconciler(newTestDexServer())
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexServer.Status.DexVersion).To(BeEmpty())
+
+		deployment := getTestDeployment(r)
+		deployment.Status = appsv1.DeploymentStatus{
+			ObservedGeneration: deployment.Generation,
+			Replicas:           1,
+			UpdatedReplicas:    1,
+			AvailableReplicas:  1,
+		}
+		_, err = r.KubeClient.AppsV1().Deployments(testDexServerNamespace).UpdateStatus(context.TODO(), deployment, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexServer.Status.DexVersion).To(Equal("v2.30.0"))
+
+		Expect(getImageVersion("quay.io/dexidp/dex@sha256:abc")).To(Equal("sha256:abc"))
+		Expect(getImageVersion("localhost:5000/dex")).To(BeEmpty())
+	})
+
+	It("recreates the deployment when an immutable field changes and recreation is enabled", func() {
+		r := newTestDexServerReconciler(newTestDexServer())
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Reject the next deployment update like the API server rejects a selector change
+		kubeClient := r.KubeClient.(*kubefake.Clientset)
+		rejectUpdate := func() {
+			rejected := false
+			kubeClient.PrependReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if rejected {
+					return false, nil, nil
+				}
+				rejected = true
+				return true, nil, kubeerrors.NewInvalid(appsv1.SchemeGroupVersion.WithKind("Deployment").GroupKind(), testDexServerName, field.ErrorList{
+					field.Invalid(field.NewPath("spec", "selector"), nil, "field is immutable"),
+				})
+			})
+		}
+
+		By("failing without recreation")
+		Expect(os.Setenv(DEX_IMAGE_ENV_NAME, "quay.io/dexidp/dex:v2.31.0")).To(Succeed())
+		rejectUpdate()
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).To(HaveOccurred())
+		Expect(meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeDeploymentReady).Message).
+			To(ContainSubstring("an immutable field of the deployment changed"))
+
+		By("recreating the deployment")
+		r.RecreateDeploymentOnImmutableChange = true
+		rejectUpdate()
+		kubeClient.ClearActions()
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeDeploymentReady)).To(BeTrue())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeDeploymentRecreated)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Reason).To(Equal("ImmutableFieldChanged"))
+
+		deleted := false
+		for _, action := range kubeClient.Actions() {
+			if action.Matches("delete", "deployments") {
+				deleted = true
+			}
+		}
+		Expect(deleted).To(BeTrue())
+		Expect(getTestDeployment(r).Spec.Template.Labels).To(HaveKeyWithValue("app", testDexServerName))
+	})
+
+	It("logs the diagnostics of the connectors selected by the debug annotation", func() {
+		dexServer := newTestDexServer()
+		dexServer.Annotations = map[string]string{DEBUG_CONNECTORS_ANNOTATION: "github"}
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{
+			newTestGitHubConnector("github", "github-secret"),
+			newTestGitHubConnector("other", "github-secret"),
+		}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}))
+		logs := &bytes.Buffer{}
+		ctx := ctrllog.IntoContext(context.TODO(), zap.New(zap.WriteTo(logs)))
+		_, err := r.Reconcile(ctx, ctrl.Request{
+			NamespacedName: types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(logs.String()).To(ContainSubstring(`"msg":"resolved connector secret","reconcileID"`))
+		Expect(logs.String()).To(ContainSubstring(`"connector":"github"`))
+		Expect(logs.String()).To(ContainSubstring(`"keyPresent":true`))
+		Expect(logs.String()).NotTo(ContainSubstring(`"connector":"other"`))
+		Expect(logs.String()).NotTo(ContainSubstring("s3cr3t"))
+	})
+
+	It("defers the gRPC API until the deployment is available", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.DeferGRPC = true
+		r := newTestDexServerReconciler(dexServer)
+		result, err := r.Reconcile(context.TODO(), ctrl.Request{
+			NamespacedName: types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(httpAvailableRequeueInterval))
+
+		dexServer = &authv1alpha1.DexServer{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		for _, conditionType := range []string{
+			authv1alpha1.DexServerConditionTypeMTLSSecretReady,
+			authv1alpha1.DexServerConditionTypeGRPCServiceReady,
+		} {
+			condition := meta.FindStatusCondition(dexServer.Status.Conditions, conditionType)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal("WaitingForHTTPAvailable"))
+		}
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeDeploymentReady)).To(BeTrue())
+		Expect(getTestConfigYaml(r)).NotTo(ContainSubstring("grpc:"))
+		Expect(getTestDeployment(r).Spec.Template.Spec.Volumes).NotTo(ContainElement(
+			WithTransform(func(v corev1.Volume) string { return v.Name }, Equal("mtls"))))
+		_, err = r.KubeClient.CoreV1().Services(testDexServerNamespace).Get(context.TODO(), GRPC_SERVICE_NAME, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+
+		By("enabling the gRPC API once a dex pod is available")
+		deployment := getTestDeployment(r)
+		deployment.Status.AvailableReplicas = 1
+		_, err = r.KubeClient.AppsV1().Deployments(testDexServerNamespace).UpdateStatus(context.TODO(), deployment, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeMTLSSecretReady)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeGRPCServiceReady)).To(BeTrue())
+		Expect(getTestConfigYaml(r)).To(ContainSubstring("grpc:"))
+		Expect(getTestDeployment(r).Spec.Template.Spec.Volumes).To(ContainElement(
+			WithTransform(func(v corev1.Volume) string { return v.Name }, Equal("mtls"))))
+	})
+
+	It("renders each valid form of the Microsoft tenant", func() {
+		for _, tenant := range []string{
+			"common",
+			"consumers",
+			"organizations",
+			"9b1c3f6e-2a4d-4c8b-9e0f-1a2b3c4d5e6f",
+			"contoso.onmicrosoft.com",
+		} {
+			dexServer := newTestDexServer()
+			dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{newTestMicrosoftConnector("microsoft", "microsoft-secret", tenant)}
+			r := newTestDexServerReconciler(dexServer, newTestSecret("microsoft-secret", map[string]string{"clientSecret": "s3cr3t"}))
+			dexServer, err := reconcileTestDexServer(r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeConfigMapReady)).To(BeTrue())
+			Expect(getTestConfigYaml(r)).To(ContainSubstring("tenant: " + tenant))
+		}
+	})
+
+	It("rejects an invalid Microsoft tenant with a condition", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{newTestMicrosoftConnector("microsoft", "microsoft-secret", "https://login.microsoftonline.com/common")}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("microsoft-secret", map[string]string{"clientSecret": "s3cr3t"}))
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).To(HaveOccurred())
+
+		condition := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeConfigMapReady)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("InvalidMicrosoftTenant"))
+		Expect(condition.Message).To(ContainSubstring("spec.connectors[0].microsoft.tenant"))
+	})
+
+	It("rejects a connector config block not matching the connector type", func() {
+		dexServer := newTestDexServer()
+		connector := newTestGitHubConnector("github", "github-secret")
+		connector.GitHub = authv1alpha1.GitHubConfigSpec{}
+		connector.LDAP.Host = "ldap.example.com:636"
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{connector}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}))
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).To(HaveOccurred())
+
+		condition := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeConfigMapReady)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("ConnectorTypeMismatch"))
+		Expect(condition.Message).To(ContainSubstring("spec.connectors[0].github: Required value"))
+		Expect(condition.Message).To(ContainSubstring("spec.connectors[0].ldap: Forbidden"))
+	})
+
+	It("reports the backoff and the next reconcile time of a failing DexServer", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{newTestMicrosoftConnector("microsoft", "microsoft-secret", "not a tenant")}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("microsoft-secret", map[string]string{"clientSecret": "s3cr3t"}))
+		r.MaxReconcileBackoff = 8 * time.Millisecond
+		r.MaxReconcileRetries = 3
+		createTestReadyDexPod(r)
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}}
+
+		for i, expectedBackoff := range []time.Duration{5 * time.Millisecond, 8 * time.Millisecond, 8 * time.Millisecond} {
+			before := time.Now().Truncate(time.Second)
+			dexServer, err := reconcileTestDexServer(r)
+			Expect(err).To(HaveOccurred())
+			Expect(dexServer.Status.Retries).To(Equal(int32(i + 1)))
+			Expect(dexServer.Status.Backoff).To(Equal(&metav1.Duration{Duration: expectedBackoff}))
+			Expect(dexServer.Status.NextReconcileTime).NotTo(BeNil())
+			Expect(dexServer.Status.NextReconcileTime.Time).NotTo(BeTemporally("<", before))
+			// Requeue the failed DexServer, as the workqueue does
+			r.getReconcileRateLimiter().When(req)
+		}
+
+		By("giving up after the maximum number of retries")
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexServer.Status.Retries).To(Equal(int32(4)))
+		Expect(dexServer.Status.Backoff).To(BeNil())
+		Expect(dexServer.Status.NextReconcileTime).To(BeNil())
+		Expect(meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied).Message).To(
+			ContainSubstring("Giving up after 3 retries"))
+		Expect(r.getReconcileRateLimiter().NumRequeues(req)).To(Equal(0))
+
+		By("resetting the retries once the DexServer reconciles")
+		dexServer.Spec.Connectors[0].Microsoft.Tenant = "common"
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexServer.Status.Retries).To(BeZero())
+		Expect(dexServer.Status.Backoff).To(BeNil())
+		Expect(dexServer.Status.NextReconcileTime.Time).To(BeTemporally(">", time.Now().Add(59*time.Minute)))
+	})
+
+	It("trusts the generated gRPC CA and the serving certificate CA when checking the issuer", func() {
+		discoveryHandler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte(`{"issuer":"https://` + req.Host + `"}`))
+		})
+
+		By("failing verification of a certificate signed by an unknown CA")
+		caCert, caKey := newTestCA()
+		issuerServer := httptest.NewUnstartedServer(discoveryHandler)
+		issuerServer.TLS = &tls.Config{Certificates: []tls.Certificate{newTestServingCert(caCert, caKey)}}
+		issuerServer.StartTLS()
+		defer issuerServer.Close()
+		dexServer := newTestDexServer()
+		dexServer.Spec.Issuer = issuerServer.URL
+		r := newTestDexServerReconciler(dexServer)
+		r.CheckIssuerReachability = true
+		createTestReadyDexPod(r)
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		availableCond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeAvailable)
+		Expect(availableCond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(availableCond.Reason).To(Equal("IssuerCertificateUntrusted"))
+
+		By("trusting the CA of the serving certificate secret")
+		webTLSSecret := newTestSecret(testDexServerName+SECRET_WEB_TLS_SUFFIX, map[string]string{
+			"ca.crt": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw})),
+		})
+		Expect(r.Create(context.TODO(), webTLSSecret)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		availableCond = meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeAvailable)
+		Expect(availableCond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(availableCond.Reason).To(Equal("IssuerReachable"))
+
+		By("trusting the generated CA of the gRPC mTLS secret")
+		mtlsSecret, err := r.getMTLSSecret(dexServer, context.TODO())
+		Expect(err).NotTo(HaveOccurred())
+		mtlsCA, err := tls.X509KeyPair(mtlsSecret.Data["ca.crt"], mtlsSecret.Data["ca.key"])
+		Expect(err).NotTo(HaveOccurred())
+		mtlsCACert, err := x509.ParseCertificate(mtlsCA.Certificate[0])
+		Expect(err).NotTo(HaveOccurred())
+		grpcCASignedServer := httptest.NewUnstartedServer(discoveryHandler)
+		grpcCASignedServer.TLS = &tls.Config{Certificates: []tls.Certificate{newTestServingCert(mtlsCACert, mtlsCA.PrivateKey.(crypto.Signer))}}
+		grpcCASignedServer.StartTLS()
+		defer grpcCASignedServer.Close()
+		dexServer.Spec.Issuer = grpcCASignedServer.URL
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		Expect(r.Delete(context.TODO(), webTLSSecret)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		availableCond = meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeAvailable)
+		Expect(availableCond.Status).To(Equal(metav1.ConditionTrue))
+		Expect(availableCond.Reason).To(Equal("IssuerReachable"))
+	})
+
+	It("renders the GitHub Enterprise host and the team options", func() {
+		dexServer := newTestDexServer()
+		connector := newTestGitHubConnector("github", "github-secret")
+		connector.GitHub.HostName = "github.example.com"
+		connector.GitHub.TeamNameField = "slug"
+		connector.GitHub.LoadAllGroups = true
+		connector.GitHub.UseLoginAsID = true
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{connector, newTestGitHubConnector("public", "github-secret")}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}))
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+
+		config := struct {
+			Connectors []struct {
+				ID     string                 `json:"id"`
+				Config map[string]interface{} `json:"config"`
+			} `json:"connectors"`
+		}{}
+		Expect(yaml.Unmarshal([]byte(getTestConfigYaml(r)), &config)).To(Succeed())
+		Expect(config.Connectors).To(HaveLen(2))
+		Expect(config.Connectors[0].ID).To(Equal("github"))
+		Expect(config.Connectors[0].Config).To(HaveKeyWithValue("hostName", "github.example.com"))
+		Expect(config.Connectors[0].Config).To(HaveKeyWithValue("teamNameField", "slug"))
+		Expect(config.Connectors[0].Config).To(HaveKeyWithValue("loadAllGroups", true))
+		Expect(config.Connectors[0].Config).To(HaveKeyWithValue("useLoginAsID", true))
+
+		By("omitting the host of github.com connectors")
+		Expect(config.Connectors[1].ID).To(Equal("public"))
+		Expect(config.Connectors[1].Config).NotTo(HaveKey("hostName"))
+		Expect(config.Connectors[1].Config).To(HaveKeyWithValue("clientID", "client-id"))
+	})
+
+	It("renders the Microsoft groups and onlySecurityGroups", func() {
+		dexServer := newTestDexServer()
+		connector := newTestMicrosoftConnector("microsoft", "microsoft-secret", "contoso.onmicrosoft.com")
+		connector.Microsoft.Groups = []string{"dex-admins", "dex-users"}
+		connector.Microsoft.OnlySecurityGroups = true
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{
+			connector,
+			newTestMicrosoftConnector("no-groups", "microsoft-secret", "common"),
+		}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("microsoft-secret", map[string]string{"clientSecret": "s3cr3t"}))
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+
+		config := struct {
+			Connectors []struct {
+				ID     string                 `json:"id"`
+				Config map[string]interface{} `json:"config"`
+			} `json:"connectors"`
+		}{}
+		Expect(yaml.Unmarshal([]byte(getTestConfigYaml(r)), &config)).To(Succeed())
+		Expect(config.Connectors).To(HaveLen(2))
+		Expect(config.Connectors[0].Config).To(HaveKeyWithValue("groups", []interface{}{"dex-admins", "dex-users"}))
+		Expect(config.Connectors[0].Config).To(HaveKeyWithValue("onlySecurityGroups", true))
+
+		By("omitting the groups when none are listed")
+		Expect(config.Connectors[1].Config).NotTo(HaveKey("groups"))
+		Expect(config.Connectors[1].Config).NotTo(HaveKey("onlySecurityGroups"))
+	})
+
+	It("restricts the Google connector to its hosted domains", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{
+			{
+				Name: "google",
+				Id:   "google",
+				Type: authv1alpha1.ConnectorTypeGoogle,
+				Google: authv1alpha1.GoogleConfigSpec{
+					ClientID:        "google-client",
+					ClientSecretRef: corev1.SecretReference{Name: "google-secret"},
+					HostedDomains:   []string{"example.com", "example.org"},
+					Groups:          []string{"dex-admins@example.com"},
+					ServiceAccountFilePathRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "google-sa"},
+						Key:                  "key.json",
+					},
+					AdminEmail: "admin@example.com",
+				},
+			},
+			{
+				Name: "any-domain",
+				Id:   "any-domain",
+				Type: authv1alpha1.ConnectorTypeGoogle,
+				Google: authv1alpha1.GoogleConfigSpec{
+					ClientID:        "google-client",
+					ClientSecretRef: corev1.SecretReference{Name: "google-secret"},
+				},
+			},
+		}
+		r := newTestDexServerReconciler(dexServer,
+			newTestSecret("google-secret", map[string]string{"clientSecret": "s3cr3t"}),
+			newTestSecret("google-sa", map[string]string{"key.json": "{}"}))
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+
+		config := struct {
+			Connectors []struct {
+				Type   string                 `json:"type"`
+				Config map[string]interface{} `json:"config"`
+			} `json:"connectors"`
+		}{}
+		Expect(yaml.Unmarshal([]byte(getTestConfigYaml(r)), &config)).To(Succeed())
+		Expect(config.Connectors).To(HaveLen(2))
+		Expect(config.Connectors[1].Type).To(Equal("google"))
+		Expect(config.Connectors[1].Config).To(HaveKeyWithValue("clientSecret", "s3cr3t"))
+		Expect(config.Connectors[1].Config).To(HaveKeyWithValue("redirectURI", "https://dex.example.com/callback"))
+		Expect(config.Connectors[1].Config).To(HaveKeyWithValue("hostedDomains", []interface{}{"example.com", "example.org"}))
+		Expect(config.Connectors[1].Config).To(HaveKeyWithValue("groups", []interface{}{"dex-admins@example.com"}))
+		Expect(config.Connectors[1].Config).To(HaveKeyWithValue("serviceAccountFilePath", "/etc/dex/googleserviceaccount/google/serviceaccount.json"))
+		Expect(config.Connectors[1].Config).To(HaveKeyWithValue("adminEmail", "admin@example.com"))
+		podSpec := getTestDeployment(r).Spec.Template.Spec
+		volumes := map[string]corev1.Volume{}
+		for _, volume := range podSpec.Volumes {
+			volumes[volume.Name] = volume
+		}
+		Expect(volumes["googleserviceaccount-google"].Secret.SecretName).To(Equal("google-sa"))
+		Expect(volumes["googleserviceaccount-google"].Secret.Items).To(Equal([]corev1.KeyToPath{{Key: "key.json", Path: "serviceaccount.json"}}))
+
+		By("omitting the hosted domains and groups when none are listed")
+		Expect(config.Connectors[0].Config).NotTo(HaveKey("hostedDomains"))
+		Expect(config.Connectors[0].Config).NotTo(HaveKey("groups"))
+		Expect(config.Connectors[0].Config).NotTo(HaveKey("serviceAccountFilePath"))
+		Expect(volumes).NotTo(HaveKey("googleserviceaccount-any-domain"))
+	})
+
+	It("keeps rendering a Google connector without a google block from rawConfig", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{{
+			Name: "google",
+			Id:   "google",
+			Type: authv1alpha1.ConnectorTypeGoogle,
+			RawConfig: map[string]apiextensionsv1.JSON{
+				"clientID":      {Raw: []byte(`"google-client"`)},
+				"hostedDomains": {Raw: []byte(`["example.com"]`)},
+			},
+		}}
+		r := newTestDexServerReconciler(dexServer)
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		configYaml := getTestConfigYaml(r)
+		Expect(configYaml).To(ContainSubstring("clientID: google-client"))
+		Expect(configYaml).To(ContainSubstring("- example.com"))
+	})
+
+	It("serves dex below the path of a path-based issuer", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Issuer = "https://proxy.example.com/auth"
+		explicitRedirect := newTestGitHubConnector("explicit", "github-secret")
+		explicitRedirect.GitHub.RedirectURI = "https://proxy.example.com/auth/callback/explicit"
+		derivedRedirect := newTestGitHubConnector("derived", "github-secret")
+		derivedRedirect.GitHub.RedirectURI = ""
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{explicitRedirect, derivedRedirect}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}))
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+
+		config := struct {
+			Issuer     string `json:"issuer"`
+			Connectors []struct {
+				Config struct {
+					RedirectURI string `json:"redirectURI"`
+				} `json:"config"`
+			} `json:"connectors"`
+		}{}
+		Expect(yaml.Unmarshal([]byte(getTestConfigYaml(r)), &config)).To(Succeed())
+		Expect(config.Issuer).To(Equal("https://proxy.example.com/auth"))
+		Expect(config.Connectors).To(HaveLen(2))
+		Expect(config.Connectors[0].Config.RedirectURI).To(Equal("https://proxy.example.com/auth/callback"))
+		Expect(config.Connectors[1].Config.RedirectURI).To(Equal("https://proxy.example.com/auth/callback/explicit"))
+
+		ingress := &networkingv1.Ingress{}
+		unstructuredIngress, err := r.DynamicClient.Resource(networkingv1.SchemeGroupVersion.WithResource("ingresses")).
+			Namespace(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredIngress.Object, ingress)).To(Succeed())
+		Expect(ingress.Spec.Rules).To(HaveLen(1))
+		Expect(ingress.Spec.Rules[0].Host).To(Equal("proxy.example.com"))
+		Expect(ingress.Spec.Rules[0].HTTP.Paths).To(HaveLen(1))
+		Expect(ingress.Spec.Rules[0].HTTP.Paths[0].Path).To(Equal("/auth"))
+
+		By("routing the root path for an issuer without path")
+		dexServer = newTestDexServer()
+		dexServer.Spec.Issuer = "https://dex.example.com/"
+		r = newTestDexServerReconciler(dexServer)
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		unstructuredIngress, err = r.DynamicClient.Resource(networkingv1.SchemeGroupVersion.WithResource("ingresses")).
+			Namespace(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredIngress.Object, ingress)).To(Succeed())
+		Expect(ingress.Spec.Rules[0].HTTP.Paths[0].Path).To(Equal("/"))
+
+		By("rejecting an issuer path that is not a plain base path")
+		for _, issuer := range []string{
+			"https://proxy.example.com/auth/../admin",
+			"https://proxy.example.com//auth",
+			"https://proxy.example.com/auth?tenant=a",
+			"https://proxy.example.com/a%20uth",
+		} {
+			dexServer = newTestDexServer()
+			dexServer.Spec.Issuer = issuer
+			r = newTestDexServerReconciler(dexServer)
+			dexServer, err = reconcileTestDexServer(r)
+			Expect(err).NotTo(HaveOccurred())
+			appliedCond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+			Expect(appliedCond).NotTo(BeNil(), issuer)
+			Expect(appliedCond.Reason).To(Equal("InvalidSpec"), issuer)
+			Expect(appliedCond.Message).To(ContainSubstring("spec.issuer"), issuer)
+		}
+	})
+
+	It("renders the progress deadline of the deployment and reports rollouts that exceed it", func() {
+		r := newTestDexServerReconciler(newTestDexServer())
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*getTestDeployment(r).Spec.ProgressDeadlineSeconds).To(Equal(DEFAULT_PROGRESS_DEADLINE_SECONDS))
+		rolloutCond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeDeploymentRolledOut)
+		Expect(rolloutCond).NotTo(BeNil())
+		Expect(rolloutCond.Reason).To(Equal("RollingOut"))
+
+		By("rendering the configured deadline")
+		progressDeadlineSeconds := int32(1800)
+		dexServer.Spec.ProgressDeadlineSeconds = &progressDeadlineSeconds
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*getTestDeployment(r).Spec.ProgressDeadlineSeconds).To(Equal(progressDeadlineSeconds))
+
+		By("reporting a rollout that exceeded the deadline")
+		deployment := getTestDeployment(r)
+		deployment.Status.Conditions = []appsv1.DeploymentCondition{{
+			Type:    appsv1.DeploymentProgressing,
+			Status:  corev1.ConditionFalse,
+			Reason:  "ProgressDeadlineExceeded",
+			Message: `ReplicaSet "dex-1" has timed out progressing.`,
+		}}
+		_, err = r.KubeClient.AppsV1().Deployments(testDexServerNamespace).UpdateStatus(context.TODO(), deployment, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		rolloutCond = meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeDeploymentRolledOut)
+		Expect(rolloutCond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(rolloutCond.Reason).To(Equal("ProgressDeadlineExceeded"))
+		Expect(rolloutCond.Message).To(ContainSubstring("1800 seconds"))
+
+		By("reporting a completed rollout")
+		deployment = getTestDeployment(r)
+		deployment.Status = appsv1.DeploymentStatus{
+			ObservedGeneration: deployment.Generation,
+			Replicas:           1,
+			UpdatedReplicas:    1,
+			AvailableReplicas:  1,
+		}
+		_, err = r.KubeClient.AppsV1().Deployments(testDexServerNamespace).UpdateStatus(context.TODO(), deployment, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeDeploymentRolledOut)).To(BeTrue())
+	})
+
+	It("deletes the ClusterRoleBinding when the DexServer is deleted", func() {
+		dexServer := newTestDexServer()
+		r := newTestDexServerReconciler(dexServer)
+		clusterRoleBindingName := SERVICE_ACCOUNT_NAME + "-" + testDexServerNamespace
+
+		By("adding the finalizer on reconcile")
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexServer.Finalizers).To(ContainElement(DEX_SERVER_FINALIZER))
+		_, err = r.KubeClient.RbacV1().ClusterRoleBindings().Get(context.TODO(), clusterRoleBindingName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("keeping the DexServer until the ClusterRoleBinding is deleted")
+		Expect(r.Delete(context.TODO(), dexServer)).To(Succeed())
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		Expect(dexServer.DeletionTimestamp.IsZero()).To(BeFalse())
+
+		_, err = r.Reconcile(context.TODO(), ctrl.Request{
+			NamespacedName: types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.KubeClient.RbacV1().ClusterRoleBindings().Get(context.TODO(), clusterRoleBindingName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+		err = r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("removes the finalizer when the ClusterRoleBinding is already gone", func() {
+		dexServer := newTestDexServer()
+		dexServer.Finalizers = []string{DEX_SERVER_FINALIZER}
+		r := newTestDexServerReconciler(dexServer)
+
+		Expect(r.Delete(context.TODO(), dexServer)).To(Succeed())
+		_, err := r.Reconcile(context.TODO(), ctrl.Request{
+			NamespacedName: types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		err = r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("finalizes a deleted DexServer that no longer matches the label selector", func() {
+		selector, err := labels.Parse("tenant-class=gold")
+		Expect(err).NotTo(HaveOccurred())
+		dexServer := newTestDexServer()
+		dexServer.Labels = map[string]string{"tenant-class": "gold"}
+		r := newTestDexServerReconciler(dexServer)
+		r.LabelSelector = selector
+		clusterRoleBindingName := SERVICE_ACCOUNT_NAME + "-" + testDexServerNamespace
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexServer.Finalizers).To(ContainElement(DEX_SERVER_FINALIZER))
+
+		By("letting the deletion through the predicates once the DexServer is no longer selected")
+		dexServer.Labels = nil
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		Expect(r.Delete(context.TODO(), dexServer)).To(Succeed())
+		deleted := &authv1alpha1.DexServer{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, deleted)).To(Succeed())
+		Expect(dexServerLabelSelectorPredicate(selector).Update(event.UpdateEvent{ObjectOld: dexServer, ObjectNew: deleted})).To(BeTrue())
+		Expect(dexServerPredicate().Update(event.UpdateEvent{ObjectOld: dexServer, ObjectNew: deleted})).To(BeTrue())
+
+		By("deleting the ClusterRoleBinding and removing the finalizer")
+		_, err = r.Reconcile(context.TODO(), ctrl.Request{
+			NamespacedName: types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.KubeClient.RbacV1().ClusterRoleBindings().Get(context.TODO(), clusterRoleBindingName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+		err = r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, deleted)
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("sets the resources of the dex container", func() {
+		dexServer := newTestDexServer()
+		r := newTestDexServerReconciler(dexServer)
+
+		By("rendering no resources by default")
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		deployment, err := r.KubeClient.AppsV1().Deployments(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deployment.Spec.Template.Spec.Containers[0].Resources).To(Equal(corev1.ResourceRequirements{}))
+		configHash := deployment.Spec.Template.Annotations["auth.identitatem.io/configHash"]
+
+		By("rendering the resources of the DexServer without changing the config hash")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.Resources = &corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("64Mi")},
+			Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+		}
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		updatedDeployment, err := r.KubeClient.AppsV1().Deployments(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		resources := updatedDeployment.Spec.Template.Spec.Containers[0].Resources
+		Expect(resources.Requests.Cpu().String()).To(Equal("100m"))
+		Expect(resources.Requests.Memory().String()).To(Equal("64Mi"))
+		Expect(resources.Limits.Memory().String()).To(Equal("256Mi"))
+		Expect(updatedDeployment.Spec.Template.Annotations["auth.identitatem.io/configHash"]).To(Equal(configHash))
+
+		By("reconciling the resources update of a restarted deployment")
+		restartPredicate := ignoreDeploymentRestartPredicate(DEFAULT_RESTART_ANNOTATION_KEY)
+		deployment.OwnerReferences = []metav1.OwnerReference{{Kind: "DexServer", Name: testDexServerName}}
+		deployment.Generation = 1
+		restartedDeployment := deployment.DeepCopy()
+		restartedDeployment.Generation = 2
+		restartedDeployment.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"] = "now"
+		Expect(restartPredicate.Update(event.UpdateEvent{ObjectOld: deployment, ObjectNew: restartedDeployment})).To(BeFalse())
+		resizedDeployment := restartedDeployment.DeepCopy()
+		resizedDeployment.Generation = 3
+		resizedDeployment.Spec.Template.Spec.Containers[0].Resources = resources
+		Expect(restartPredicate.Update(event.UpdateEvent{ObjectOld: restartedDeployment, ObjectNew: resizedDeployment})).To(BeTrue())
+	})
+
+	It("rejects resource requests exceeding their limits", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Resources = &corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+			Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+		}
+		r := newTestDexServerReconciler(dexServer)
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Reason).To(Equal("InvalidSpec"))
+		Expect(cond.Message).To(ContainSubstring("spec.resources.requests[memory]"))
+	})
+
+	It("runs the replicas of the DexServer behind a PodDisruptionBudget", func() {
+		dexServer := newTestDexServer()
+		r := newTestDexServerReconciler(dexServer)
+
+		By("running a single pod without a PodDisruptionBudget by default, which would block node drains")
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypePodDisruptionBudgetReady)).To(BeTrue())
+		deployment, err := r.KubeClient.AppsV1().Deployments(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*deployment.Spec.Replicas).To(Equal(int32(1)))
+		_, err = r.KubeClient.PolicyV1().PodDisruptionBudgets(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+
+		By("keeping all pods but one available with several replicas")
+		replicas := int32(3)
+		dexServer.Spec.Replicas = &replicas
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		deployment, err = r.KubeClient.AppsV1().Deployments(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*deployment.Spec.Replicas).To(Equal(int32(3)))
+		pdb, err := r.KubeClient.PolicyV1().PodDisruptionBudgets(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pdb.Spec.MinAvailable.IntValue()).To(Equal(2))
+		Expect(pdb.Spec.Selector.MatchLabels).To(Equal(deployment.Spec.Selector.MatchLabels))
+
+		By("deleting the PodDisruptionBudget when scaled back to a single pod")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.Replicas = nil
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.KubeClient.PolicyV1().PodDisruptionBudgets(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("skips the PodDisruptionBudget on clusters not serving the policy/v1 API", func() {
+		dexServer := newTestDexServer()
+		replicas := int32(2)
+		dexServer.Spec.Replicas = &replicas
+		r := newTestDexServerReconciler(dexServer)
+		Expect(r.isAPIServed(podDisruptionBudgetGVK)).To(BeTrue())
+		kubeClient := r.KubeClient.(*kubefake.Clientset)
+		kubeClient.Resources = kubeClient.Resources[:3]
+		Expect(r.isAPIServed(podDisruptionBudgetGVK)).To(BeFalse())
+
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypePodDisruptionBudgetReady)).To(BeTrue())
+		_, err = r.KubeClient.PolicyV1().PodDisruptionBudgets(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("scales the deployment with a HorizontalPodAutoscaler when autoscaling is set", func() {
+		dexServer := newTestDexServer()
+		minReplicas := int32(2)
+		dexServer.Spec.Autoscaling = &authv1alpha1.AutoscalingSpec{MinReplicas: &minReplicas, MaxReplicas: 5}
+		r := newTestDexServerReconciler(dexServer)
+
+		By("requiring a CPU request")
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond.Reason).To(Equal("InvalidSpec"))
+		Expect(cond.Message).To(ContainSubstring("spec.resources.requests.cpu"))
+
+		By("applying the HorizontalPodAutoscaler of the deployment")
+		dexServer.Spec.Resources = &corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+		}
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeAutoscalerReady)).To(BeTrue())
+		hpas := r.DynamicClient.Resource(horizontalPodAutoscalerGVR).Namespace(testDexServerNamespace)
+		unstructuredHPA, err := hpas.Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		// autoscaling/v2 has the fields of autoscaling/v2beta2
+		hpa := &autoscalingv2beta2.HorizontalPodAutoscaler{}
+		Expect(runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredHPA.Object, hpa)).To(Succeed())
+		Expect(hpa.Spec.ScaleTargetRef.Kind).To(Equal("Deployment"))
+		Expect(hpa.Spec.ScaleTargetRef.Name).To(Equal(testDexServerName))
+		Expect(*hpa.Spec.MinReplicas).To(Equal(int32(2)))
+		Expect(hpa.Spec.MaxReplicas).To(Equal(int32(5)))
+		Expect(hpa.Spec.Metrics).To(HaveLen(1))
+		Expect(hpa.Spec.Metrics[0].Resource.Name).To(Equal(corev1.ResourceCPU))
+		Expect(*hpa.Spec.Metrics[0].Resource.Target.AverageUtilization).To(Equal(int32(80)))
+		deployment, err := r.KubeClient.AppsV1().Deployments(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*deployment.Spec.Replicas).To(Equal(int32(2)))
+		pdb, err := r.KubeClient.PolicyV1().PodDisruptionBudgets(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pdb.Spec.MinAvailable.IntValue()).To(Equal(1))
+
+		By("keeping the replicas set by the autoscaler")
+		replicas := int32(4)
+		deployment.Spec.Replicas = &replicas
+		_, err = r.KubeClient.AppsV1().Deployments(testDexServerNamespace).Update(context.TODO(), deployment, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		deployment, err = r.KubeClient.AppsV1().Deployments(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*deployment.Spec.Replicas).To(Equal(int32(4)))
+
+		By("deleting the HorizontalPodAutoscaler when autoscaling is unset")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.Autoscaling = nil
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = hpas.Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+		deployment, err = r.KubeClient.AppsV1().Deployments(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*deployment.Spec.Replicas).To(Equal(int32(1)))
+	})
+
+	It("leaves the HorizontalPodAutoscaler to the tooling managing the deployment", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Autoscaling = &authv1alpha1.AutoscalingSpec{MaxReplicas: 5}
+		dexServer.Spec.Resources = &corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")},
+		}
+		dexServer.Spec.ManagedResources = &authv1alpha1.ManagedResourcesSpec{
+			Exclude: []authv1alpha1.ManagedResource{authv1alpha1.ManagedResourceDeployment},
+		}
+		r := newTestDexServerReconciler(dexServer)
+
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeAutoscalerReady)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Reason).To(Equal("Unmanaged"))
+		_, err = r.DynamicClient.Resource(horizontalPodAutoscalerGVR).Namespace(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("watches the HorizontalPodAutoscalers only when their API is served", func() {
+		r := newTestDexServerReconciler(newTestDexServer())
+		Expect(r.isHorizontalPodAutoscalerServed()).To(BeTrue())
+		Expect(newHorizontalPodAutoscaler().GroupVersionKind()).To(Equal(horizontalPodAutoscalerGVK))
+
+		kubeClient := r.KubeClient.(*kubefake.Clientset)
+		kubeClient.Resources = kubeClient.Resources[:2]
+		Expect(r.isHorizontalPodAutoscalerServed()).To(BeFalse())
+	})
+
+	It("recreates deleted generated resources and records an event", func() {
+		dexServer := newTestDexServer()
+		r := newTestDexServerReconciler(dexServer)
+		recorder := record.NewFakeRecorder(20)
+		r.Recorder = recorder
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		drainEvents := func() {
+			for len(recorder.Events) > 0 {
+				<-recorder.Events
+			}
+		}
+		drainEvents()
+
+		ctx := context.TODO()
+		ingresses := r.DynamicClient.Resource(networkingv1.SchemeGroupVersion.WithResource("ingresses")).Namespace(testDexServerNamespace)
+		for _, resource := range []struct {
+			kind   string
+			name   string
+			delete func() error
+			get    func() error
+		}{
+			{"ConfigMap", testDexServerName,
+				func() error {
+					return r.KubeClient.CoreV1().ConfigMaps(testDexServerNamespace).Delete(ctx, testDexServerName, metav1.DeleteOptions{})
+				},
+				func() error {
+					_, err := r.KubeClient.CoreV1().ConfigMaps(testDexServerNamespace).Get(ctx, testDexServerName, metav1.GetOptions{})
+					return err
+				}},
+			{"Service", testDexServerName,
+				func() error {
+					return r.KubeClient.CoreV1().Services(testDexServerNamespace).Delete(ctx, testDexServerName, metav1.DeleteOptions{})
+				},
+				func() error {
+					_, err := r.KubeClient.CoreV1().Services(testDexServerNamespace).Get(ctx, testDexServerName, metav1.GetOptions{})
+					return err
+				}},
+			{"Service", GRPC_SERVICE_NAME,
+				func() error {
+					return r.KubeClient.CoreV1().Services(testDexServerNamespace).Delete(ctx, GRPC_SERVICE_NAME, metav1.DeleteOptions{})
+				},
+				func() error {
+					_, err := r.KubeClient.CoreV1().Services(testDexServerNamespace).Get(ctx, GRPC_SERVICE_NAME, metav1.GetOptions{})
+					return err
+				}},
+			{"ServiceAccount", SERVICE_ACCOUNT_NAME,
+				func() error {
+					return r.KubeClient.CoreV1().ServiceAccounts(testDexServerNamespace).Delete(ctx, SERVICE_ACCOUNT_NAME, metav1.DeleteOptions{})
+				},
+				func() error {
+					_, err := r.KubeClient.CoreV1().ServiceAccounts(testDexServerNamespace).Get(ctx, SERVICE_ACCOUNT_NAME, metav1.GetOptions{})
+					return err
+				}},
+			{"Secret", SECRET_MTLS_NAME,
+				func() error {
+					return r.Delete(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: SECRET_MTLS_NAME, Namespace: testDexServerNamespace}})
+				},
+				func() error {
+					return r.Get(ctx, types.NamespacedName{Name: SECRET_MTLS_NAME, Namespace: testDexServerNamespace}, &corev1.Secret{})
+				}},
+			{"Deployment", testDexServerName,
+				func() error {
+					return r.KubeClient.AppsV1().Deployments(testDexServerNamespace).Delete(ctx, testDexServerName, metav1.DeleteOptions{})
+				},
+				func() error {
+					_, err := r.KubeClient.AppsV1().Deployments(testDexServerNamespace).Get(ctx, testDexServerName, metav1.GetOptions{})
+					return err
+				}},
+			{"Ingress", testDexServerName,
+				func() error { return ingresses.Delete(ctx, testDexServerName, metav1.DeleteOptions{}) },
+				func() error {
+					_, err := ingresses.Get(ctx, testDexServerName, metav1.GetOptions{})
+					return err
+				}},
+		} {
+			By("recreating the deleted " + resource.kind + " " + resource.name)
+			Expect(resource.delete()).To(Succeed())
+			Expect(kubeerrors.IsNotFound(resource.get())).To(BeTrue())
+
+			deleted := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: resource.name, Namespace: testDexServerNamespace}}
+			Expect(r.mapDeletedResource(resource.kind)(deleted)).To(ConsistOf(ctrl.Request{
+				NamespacedName: types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace},
+			}))
+			Expect(recorder.Events).To(Receive(Equal(fmt.Sprintf("Normal ResourceRecreated %s %s was deleted and is recreated", resource.kind, resource.name))))
+
+			_, err := reconcileTestDexServer(r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resource.get()).To(Succeed())
+			drainEvents()
+		}
+
+		By("ignoring deleted resources that are not generated for the DexServer")
+		other := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: testDexServerNamespace}}
+		Expect(r.mapDeletedResource("ConfigMap")(other)).To(BeEmpty())
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("records events for the reconcile milestones", func() {
+		dexServer := newTestDexServer()
+		r := newTestDexServerReconciler(dexServer)
+		recorder := record.NewFakeRecorder(20)
+		r.Recorder = recorder
+		receivedEvents := func() []string {
+			events := []string{}
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			return events
+		}
+
+		By("recording the creation of the generated resources")
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(receivedEvents()).To(ConsistOf(
+			"Normal MTLSSecretCreated gRPC mTLS secret "+SECRET_MTLS_NAME+" created",
+			"Normal ConfigMapCreated ConfigMap "+testDexServerName+" created",
+			"Normal DeploymentCreated Deployment "+testDexServerName+" created",
+		))
+
+		By("recording nothing when nothing changed")
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(receivedEvents()).To(BeEmpty())
+
+		By("recording the config change and the deployment update")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.Issuer = "https://dex.other.example.com"
+		replicas := int32(2)
+		dexServer.Spec.Replicas = &replicas
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(receivedEvents()).To(ConsistOf(
+			"Normal ConfigMapChanged ConfigMap "+testDexServerName+" changed",
+			"Normal DeploymentUpdated Deployment "+testDexServerName+" updated",
+		))
+
+		By("recording sync failures as warnings")
+		Expect(os.Unsetenv(DEX_IMAGE_ENV_NAME)).To(Succeed())
+		defer os.Setenv(DEX_IMAGE_ENV_NAME, testDexImage)
+		_, err = reconcileTestDexServer(r)
+		Expect(err).To(HaveOccurred())
+		Expect(receivedEvents()).To(ConsistOf(HavePrefix("Warning DexImageNotConfigured failed to sync Deployment: ")))
+	})
+
+	It("records the generation observed by the conditions and by a successful reconcile", func() {
+		dexServer := newTestDexServer()
+		dexServer.Generation = 3
+		r := newTestDexServerReconciler(dexServer)
+
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexServer.Status.ObservedGeneration).To(Equal(int64(3)))
+		for _, condition := range dexServer.Status.Conditions {
+			Expect(condition.ObservedGeneration).To(Equal(int64(3)), condition.Type)
+		}
+
+		By("keeping the observed generation of the DexServer until the reconcile of the new generation succeeds")
+		dexServer.Generation = 4
+		dexServer.Spec.Issuer = "https://dex.other.example.com"
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		Expect(os.Unsetenv(DEX_IMAGE_ENV_NAME)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(os.Setenv(DEX_IMAGE_ENV_NAME, testDexImage)).To(Succeed())
+		Expect(err).To(HaveOccurred())
+		Expect(dexServer.Status.ObservedGeneration).To(Equal(int64(3)))
+		Expect(meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeDeploymentReady).ObservedGeneration).To(Equal(int64(4)))
+
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexServer.Status.ObservedGeneration).To(Equal(int64(4)))
+	})
+
+	It("deletes the stale ReplicaSets of the deployment only when enabled", func() {
+		r := newTestDexServerReconciler(newTestDexServer())
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+
+		deployment := getTestDeployment(r)
+		deployment.UID = "deployment-uid"
+		deployment.Annotations = map[string]string{DEPLOYMENT_REVISION_ANNOTATION: "3"}
+		deployment, err = r.KubeClient.AppsV1().Deployments(testDexServerNamespace).Update(context.TODO(), deployment, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		deployment.Status = appsv1.DeploymentStatus{
+			ObservedGeneration: deployment.Generation,
+			Replicas:           1,
+			UpdatedReplicas:    1,
+			AvailableReplicas:  1,
+		}
+		_, err = r.KubeClient.AppsV1().Deployments(testDexServerNamespace).UpdateStatus(context.TODO(), deployment, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		newReplicaSet := func(name, revision string, replicas int32, age time.Duration, ownerUID types.UID) {
+			isController := true
+			replicaSet := &appsv1.ReplicaSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              name,
+					Namespace:         testDexServerNamespace,
+					Labels:            deployment.Spec.Selector.MatchLabels,
+					Annotations:       map[string]string{DEPLOYMENT_REVISION_ANNOTATION: revision},
+					CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+					OwnerReferences: []metav1.OwnerReference{{
+						APIVersion: "apps/v1",
+						Kind:       "Deployment",
+						Name:       testDexServerName,
+						UID:        ownerUID,
+						Controller: &isController,
+					}},
+				},
+				Spec: appsv1.ReplicaSetSpec{Replicas: &replicas},
+			}
+			_, err := r.KubeClient.AppsV1().ReplicaSets(testDexServerNamespace).Create(context.TODO(), replicaSet, metav1.CreateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		newReplicaSet("stale", "1", 0, 48*time.Hour, deployment.UID)
+		newReplicaSet("recent", "2", 0, time.Minute, deployment.UID)
+		newReplicaSet("current", "3", 1, 48*time.Hour, deployment.UID)
+		newReplicaSet("other-owner", "1", 0, 48*time.Hour, "other-uid")
+		replicaSetNames := func() []string {
+			replicaSets, err := r.KubeClient.AppsV1().ReplicaSets(testDexServerNamespace).List(context.TODO(), metav1.ListOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			names := []string{}
+			for _, replicaSet := range replicaSets.Items {
+				names = append(names, replicaSet.Name)
+			}
+			return names
+		}
+
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replicaSetNames()).To(ConsistOf("stale", "recent", "current", "other-owner"))
+
+		By("keeping the ReplicaSets of a deployment managed outside of the operator")
+		r.StaleReplicaSetMaxAge = time.Hour
+		dexServer := &authv1alpha1.DexServer{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.ManagedResources = &authv1alpha1.ManagedResourcesSpec{
+			Exclude: []authv1alpha1.ManagedResource{authv1alpha1.ManagedResourceDeployment},
+		}
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replicaSetNames()).To(ConsistOf("stale", "recent", "current", "other-owner"))
+
+		By("deleting the stale ReplicaSets of a managed deployment")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.ManagedResources = nil
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(replicaSetNames()).To(ConsistOf("recent", "current", "other-owner"))
+	})
+
+	It("deletes the dex storage objects of removed connectors when enabled", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{newTestGitHubConnector("github", "github-secret")}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}))
+		newStorageObject := func(kind, name, connectorIDField, connectorID string) runtime.Object {
+			return &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion":     "dex.coreos.com/v1",
+				"kind":           kind,
+				"metadata":       map[string]interface{}{"name": name, "namespace": testDexServerNamespace},
+				connectorIDField: connectorID,
+			}}
+		}
+		refreshTokens := schema.GroupVersionResource{Group: "dex.coreos.com", Version: "v1", Resource: "refreshtokens"}
+		offlineSessions := schema.GroupVersionResource{Group: "dex.coreos.com", Version: "v1", Resource: "offlinesessionses"}
+		r.DynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(r.Scheme,
+			map[schema.GroupVersionResource]string{refreshTokens: "RefreshTokenList", offlineSessions: "OfflineSessionsList"},
+			newStorageObject("RefreshToken", "github-token", "connectorID", "github"),
+			newStorageObject("RefreshToken", "local-token", "connectorID", "local"),
+			newStorageObject("RefreshToken", "removed-token", "connectorID", "removed"),
+			newStorageObject("OfflineSessions", "removed-session", "connID", "removed"))
+		recorder := record.NewFakeRecorder(20)
+		r.Recorder = recorder
+		storageObjectNames := func() []string {
+			names := []string{}
+			for _, gvr := range []schema.GroupVersionResource{refreshTokens, offlineSessions} {
+				list, err := r.DynamicClient.Resource(gvr).Namespace(testDexServerNamespace).List(context.TODO(), metav1.ListOptions{})
+				Expect(err).NotTo(HaveOccurred())
+				for _, item := range list.Items {
+					names = append(names, item.GetName())
+				}
+			}
+			return names
+		}
+
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(storageObjectNames()).To(HaveLen(4))
+
+		By("waiting for the deployment to roll out")
+		r.CleanupOrphanedConnectorStorage = true
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(storageObjectNames()).To(HaveLen(4))
+
+		deployment := getTestDeployment(r)
+		deployment.Status = appsv1.DeploymentStatus{
+			ObservedGeneration: deployment.Generation,
+			Replicas:           1,
+			UpdatedReplicas:    1,
+			AvailableReplicas:  1,
+		}
+		_, err = r.KubeClient.AppsV1().Deployments(testDexServerNamespace).UpdateStatus(context.TODO(), deployment, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		for len(recorder.Events) > 0 {
+			<-recorder.Events
+		}
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(storageObjectNames()).To(ConsistOf("github-token", "local-token"))
+		events := []string{}
+		for len(recorder.Events) > 0 {
+			events = append(events, <-recorder.Events)
+		}
+		Expect(events).To(ContainElement("Normal OrphanedConnectorStorageCleaned Deleted 2 dex storage objects of the removed connectors removed"))
+	})
+
+	It("summarizes the DexServers by condition on the status endpoint", func() {
+		r := newTestDexServerReconciler(newTestDexServer())
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+
+		recorder := httptest.NewRecorder()
+		NewDexServerStatusHandler(r.Client).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, DEX_SERVER_STATUS_PATH, nil))
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		summary := &DexServerStatusSummary{}
+		Expect(json.Unmarshal(recorder.Body.Bytes(), summary)).To(Succeed())
+		Expect(summary.DexServers).To(Equal(1))
+		Expect(summary.Pending).To(Equal(0))
+		Expect(summary.Conditions[authv1alpha1.DexServerConditionTypeApplied]).To(Equal(map[metav1.ConditionStatus]int{metav1.ConditionTrue: 1}))
+
+		recorder = httptest.NewRecorder()
+		NewDexServerStatusHandler(r.Client).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, DEX_SERVER_STATUS_PATH, nil))
+		Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	It("exposes the issuer through a reencrypt Route and deletes the Ingress when the route type changes", func() {
+		certificateSecret := newTestTLSSecret("route-certificate")
+		dexServer := newTestDexServer()
+		dexServer.Spec.Issuer = "https://dex.example.com/auth"
+		r := newTestDexServerReconciler(dexServer, certificateSecret)
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		ingresses := r.DynamicClient.Resource(networkingv1.SchemeGroupVersion.WithResource("ingresses")).Namespace(testDexServerNamespace)
+		routes := r.DynamicClient.Resource(routev1.GroupVersion.WithResource("routes")).Namespace(testDexServerNamespace)
+		_, err = ingresses.Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		dexServer = &authv1alpha1.DexServer{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.RouteType = authv1alpha1.RouteTypeRoute
+		dexServer.Spec.ForceHTTPSRedirect = true
+		dexServer.Spec.IngressCertificateRef.Name = certificateSecret.Name
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeRouteReady)).To(BeTrue())
+		Expect(meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeIngressReady)).To(BeNil())
+		_, err = ingresses.Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+
+		unstructuredRoute, err := routes.Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		route := &routev1.Route{}
+		Expect(runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredRoute.Object, route)).To(Succeed())
+		Expect(route.Spec.Host).To(Equal("dex.example.com"))
+		Expect(route.Spec.Path).To(Equal("/auth"))
+		Expect(route.Spec.To.Name).To(Equal(testDexServerName))
+		Expect(route.Spec.TLS.Termination).To(Equal(routev1.TLSTerminationReencrypt))
+		Expect(route.Spec.TLS.InsecureEdgeTerminationPolicy).To(Equal(routev1.InsecureEdgeTerminationPolicyRedirect))
+		Expect(route.Spec.TLS.Certificate).To(Equal(string(certificateSecret.Data[corev1.TLSCertKey])))
+		Expect(route.Spec.TLS.Key).To(Equal(string(certificateSecret.Data[corev1.TLSPrivateKeyKey])))
+
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.RouteType = authv1alpha1.RouteTypeIngress
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeRouteReady)).To(BeNil())
+		_, err = routes.Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+		_, err = ingresses.Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("reads connector credentials from the configured secret key", func() {
+		dexServer := newTestDexServer()
+		connector := newTestGitHubConnector("github", "github-secret")
+		connector.GitHub.ClientSecretKey = "client-secret"
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{connector}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("github-secret", map[string]string{"client-secret": "s3cr3t"}))
+
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeConfigMapReady)).To(BeTrue())
+		Expect(getTestConfigYaml(r)).To(ContainSubstring("clientSecret: s3cr3t"))
+
+		dexServer.Spec.UseEnvExpansion = true
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getTestDeployment(r).Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{
+			Name: "DEX_CONNECTOR_GITHUB_CLIENT_SECRET",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "github-secret"},
+					Key:                  "client-secret",
+				},
+			},
+		}))
+	})
+
+	It("rejects a connector secret without the configured key", func() {
+		dexServer := newTestDexServer()
+		connector := newTestGitHubConnector("github", "github-secret")
+		connector.GitHub.ClientSecretKey = "client-secret"
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{connector}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}))
+
+		dexServer, _ = reconcileTestDexServer(r)
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeConfigMapReady)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("ConnectorSecretKeyMissing"))
+		Expect(cond.Message).To(ContainSubstring("has no key client-secret"))
+	})
+
+	It("fails and requeues the ConfigMap sync when a connector secret is missing", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{newTestGitHubConnector("github", "github-secret")}
+		r := newTestDexServerReconciler(dexServer)
+
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("connector github"))
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeConfigMapReady)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("ConfigMapFailed"))
+		appliedCond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(appliedCond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(appliedCond.Reason).To(Equal("ConfigMapFailed"))
+		_, err = r.KubeClient.CoreV1().ConfigMaps(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("records the rendered config of a paused DexServer without applying it", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Paused = true
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{newTestGitHubConnector("github", "github-secret")}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}))
+
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.KubeClient.AppsV1().Deployments(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+		_, err = r.KubeClient.CoreV1().ConfigMaps(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypePaused)).To(BeTrue())
+		appliedCond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(appliedCond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(appliedCond.Reason).To(Equal("Paused"))
+		Expect(dexServer.Status.RenderedConfig).To(ContainSubstring("id: github"))
+		Expect(dexServer.Status.RenderedConfig).To(ContainSubstring(REDACTED))
+		Expect(dexServer.Status.RenderedConfig).NotTo(ContainSubstring("s3cr3t"))
+
+		By("applying the DexServer once it is resumed")
+		dexServer.Spec.Paused = false
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getTestDeployment(r)).NotTo(BeNil())
+		Expect(getTestConfigYaml(r)).To(ContainSubstring("s3cr3t"))
+		Expect(meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypePaused)).To(BeNil())
+		Expect(dexServer.Status.RenderedConfig).To(BeEmpty())
+	})
+
+	It("renders the connectors sorted by id whatever their order in the spec", func() {
+		github := newTestGitHubConnector("github", "github-secret")
+		microsoft := newTestMicrosoftConnector("microsoft", "microsoft-secret", "common")
+		secrets := []client.Object{
+			newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}),
+			newTestSecret("microsoft-secret", map[string]string{"clientSecret": "s3cr3t"}),
+		}
+
+		dexServer := newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{microsoft, github}
+		r := newTestDexServerReconciler(append([]client.Object{dexServer}, secrets...)...)
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexServer.Status.ActiveConnectors).To(Equal([]string{"github", "microsoft"}))
+		configYaml := getTestConfigYaml(r)
+		configHash := getTestDeployment(r).Spec.Template.Annotations[CONFIG_HASH_ANNOTATION]
+
+		reordered := newTestDexServer()
+		reordered.Spec.Connectors = []authv1alpha1.ConnectorSpec{github, microsoft}
+		r = newTestDexServerReconciler(append([]client.Object{reordered}, secrets...)...)
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getTestConfigYaml(r)).To(Equal(configYaml))
+		Expect(getTestDeployment(r).Spec.Template.Annotations[CONFIG_HASH_ANNOTATION]).To(Equal(configHash))
+	})
+
+	It("fails the ConfigMap sync when a connector secret cannot be read", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{newTestGitHubConnector("github", "github-secret")}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}))
+		r.Client = &failingSecretClient{
+			Client: r.Client,
+			name:   "github-secret",
+			err:    kubeerrors.NewForbidden(corev1.Resource("secrets"), "github-secret", fmt.Errorf("access denied")),
+		}
+
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).To(HaveOccurred())
+		Expect(kubeerrors.IsForbidden(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("connector github"))
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeConfigMapReady)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("ConfigMapFailed"))
+		_, err = r.KubeClient.CoreV1().ConfigMaps(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("cross-checks the connector and DexClient redirect URIs", func() {
+		dexServer := newTestDexServer()
+		connector := newTestGitHubConnector("github", "github-secret")
+		connector.GitHub.RedirectURI = "https://other.example.com/callback"
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{connector}
+		dexClient := &authv1alpha1.DexClient{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: testDexServerNamespace},
+			Spec: authv1alpha1.DexClientSpec{
+				ClientID:     "app",
+				RedirectURIs: []string{"https://app.example.com/oauth/callback", "https://dex.example.com/callback"},
+			},
+		}
+		r := newTestDexServerReconciler(dexServer, dexClient, newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}))
+
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeRedirectURIsConsistent)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("RedirectURIMismatch"))
+		Expect(cond.Message).To(ContainSubstring("connector github redirects to https://other.example.com/callback instead of the dex callback https://dex.example.com/callback"))
+		Expect(cond.Message).To(ContainSubstring("DexClient app registers the dex callback"))
+		Expect(r.mapDexClientToDexServers(dexClient)).To(HaveLen(1))
+
+		dexServer.Spec.Connectors[0].GitHub.RedirectURI = ""
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		dexClient.Spec.RedirectURIs = dexClient.Spec.RedirectURIs[:1]
+		Expect(r.Update(context.TODO(), dexClient)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeRedirectURIsConsistent)).To(BeTrue())
+	})
+
+	It("exposes dex on the additional hosts", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.AdditionalHosts = []string{"dex.internal.example.com"}
+		connector := newTestGitHubConnector("github", "github-secret")
+		connector.GitHub.RedirectURI = "https://dex.internal.example.com/callback"
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{connector}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}))
+
+		By("routing the issuer path on every host of the Ingress")
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeRedirectURIsConsistent)).To(BeTrue())
+		unstructuredIngress, err := r.DynamicClient.Resource(networkingv1.SchemeGroupVersion.WithResource("ingresses")).
+			Namespace(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		ingress := &networkingv1.Ingress{}
+		Expect(runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredIngress.Object, ingress)).To(Succeed())
+		Expect(ingress.Spec.Rules).To(HaveLen(2))
+		Expect(ingress.Spec.Rules[0].Host).To(Equal("dex.example.com"))
+		Expect(ingress.Spec.Rules[1].Host).To(Equal("dex.internal.example.com"))
+		Expect(ingress.Spec.Rules[1].HTTP.Paths[0].Backend.Service.Name).To(Equal(testDexServerName))
+
+		By("exposing each host through its own Route")
+		dexServer.Spec.RouteType = authv1alpha1.RouteTypeRoute
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		routes := r.DynamicClient.Resource(routev1.GroupVersion.WithResource("routes")).Namespace(testDexServerNamespace)
+		unstructuredRoute, err := routes.Get(context.TODO(), testDexServerName+"-host-1", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		route := &routev1.Route{}
+		Expect(runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredRoute.Object, route)).To(Succeed())
+		Expect(route.Spec.Host).To(Equal("dex.internal.example.com"))
+		Expect(route.Spec.To.Name).To(Equal(testDexServerName))
+		_, err = routes.Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("deleting the Route of a removed host")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.AdditionalHosts = nil
+		dexServer.Spec.Connectors[0].GitHub.RedirectURI = ""
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = routes.Get(context.TODO(), testDexServerName+"-host-1", metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+		_, err = routes.Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("rejecting invalid and duplicate hosts")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.AdditionalHosts = []string{"Not_A_Host", "dex.example.com"}
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond.Reason).To(Equal("InvalidSpec"))
+		Expect(cond.Message).To(ContainSubstring("spec.additionalHosts[0]"))
+		Expect(cond.Message).To(ContainSubstring("spec.additionalHosts[1]: Duplicate value"))
+	})
+
+	It("renders the dex config as YAML or JSON", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{newTestGitHubConnector("github", "github-secret")}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}))
+		getConfigMapData := func() map[string]string {
+			configMap, err := r.KubeClient.CoreV1().ConfigMaps(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			return configMap.Data
+		}
+
+		By("rendering config.yaml by default")
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		data := getConfigMapData()
+		Expect(data).To(HaveLen(1))
+		// dex parses its config with the same YAML library, which also accepts JSON
+		yamlConfig := map[string]interface{}{}
+		Expect(yaml.Unmarshal([]byte(data["config.yaml"]), &yamlConfig)).To(Succeed())
+		Expect(yamlConfig).To(HaveKeyWithValue("issuer", "https://dex.example.com"))
+		Expect(yamlConfig).To(HaveKey("connectors"))
+		deployment := getTestDeployment(r)
+		Expect(deployment.Spec.Template.Spec.Containers[0].Command).To(ContainElement("/etc/dex/cfg/config.yaml"))
+
+		By("rendering the same config as config.json")
+		dexServer.Spec.ConfigFormat = authv1alpha1.ConfigFormatJSON
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		data = getConfigMapData()
+		Expect(data).To(HaveLen(1))
+		Expect(json.Valid([]byte(data["config.json"]))).To(BeTrue())
+		jsonConfig := map[string]interface{}{}
+		Expect(yaml.Unmarshal([]byte(data["config.json"]), &jsonConfig)).To(Succeed())
+		Expect(jsonConfig).To(Equal(yamlConfig))
+		deployment = getTestDeployment(r)
+		Expect(deployment.Spec.Template.Spec.Containers[0].Command).To(ContainElement("/etc/dex/cfg/config.json"))
+		Expect(deployment.Spec.Template.Spec.Volumes[0].ConfigMap.Items).To(Equal([]corev1.KeyToPath{{Key: "config.json", Path: "config.json"}}))
+	})
+
+	It("sets the fsGroup of the dex pods only when it is configured", func() {
+		r := newTestDexServerReconciler(newTestDexServer())
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		By("leaving the fsGroup to the pod security policy by default")
+		securityContext := getTestDeployment(r).Spec.Template.Spec.SecurityContext
+		Expect(securityContext == nil || securityContext.FSGroup == nil).To(BeTrue())
+
+		By("setting the fsGroup of the spec")
+
+		dexServer := newTestDexServer()
+		fsGroup := int64(2000)
+		dexServer.Spec.FSGroup = &fsGroup
+		r = newTestDexServerReconciler(dexServer)
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*getTestDeployment(r).Spec.Template.Spec.SecurityContext.FSGroup).To(Equal(int64(2000)))
+	})
+
+	It("mounts a writable /tmp when the root filesystem is read-only", func() {
+		r := newTestDexServerReconciler(newTestDexServer())
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		container := getTestDeployment(r).Spec.Template.Spec.Containers[0]
+		Expect(container.SecurityContext).To(BeNil())
+
+		dexServer := newTestDexServer()
+		dexServer.Spec.ReadOnlyRootFilesystem = true
+		r = newTestDexServerReconciler(dexServer)
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		podSpec := getTestDeployment(r).Spec.Template.Spec
+		container = podSpec.Containers[0]
+		Expect(container.SecurityContext).NotTo(BeNil())
+		Expect(*container.SecurityContext.ReadOnlyRootFilesystem).To(BeTrue())
+		Expect(container.VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: "tmp", MountPath: "/tmp"}))
+		defaultSizeLimit := resource.MustParse(DEFAULT_EMPTY_DIR_SIZE_LIMIT)
+		Expect(podSpec.Volumes).To(ContainElement(corev1.Volume{Name: "tmp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{SizeLimit: &defaultSizeLimit}}}))
+		// dex starts only if every mount has its volume
+		volumes := map[string]bool{}
+		for _, volume := range podSpec.Volumes {
+			volumes[volume.Name] = true
+		}
+		for _, volumeMount := range container.VolumeMounts {
+			Expect(volumes).To(HaveKey(volumeMount.Name))
+		}
+	})
+
+	It("limits the size of the writable emptyDir volumes", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.ReadOnlyRootFilesystem = true
+		sizeLimit := resource.MustParse("256Mi")
+		dexServer.Spec.EmptyDirSizeLimit = &sizeLimit
+		r := newTestDexServerReconciler(dexServer)
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		volumes := map[string]corev1.Volume{}
+		for _, volume := range getTestDeployment(r).Spec.Template.Spec.Volumes {
+			volumes[volume.Name] = volume
+		}
+		Expect(volumes["tmp"].EmptyDir.SizeLimit.String()).To(Equal("256Mi"))
+
+		By("rejecting a size limit of zero")
+		zero := resource.MustParse("0")
+		dexServer = newTestDexServer()
+		dexServer.Spec.EmptyDirSizeLimit = &zero
+		r = newTestDexServerReconciler(dexServer)
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond.Reason).To(Equal("InvalidSpec"))
+		Expect(cond.Message).To(ContainSubstring("spec.emptyDirSizeLimit"))
+	})
+
+	It("rejects an http issuer unless http issuers are allowed", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Issuer = "http://dex.example.com"
+		r := newTestDexServerReconciler(dexServer)
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("InsecureIssuer"))
+		Expect(cond.Message).To(ContainSubstring("must be an https URL"))
+		_, err = r.KubeClient.AppsV1().Deployments(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+
+		By("applying the http issuer when allowed")
+		r.AllowHTTPIssuer = true
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)).To(BeTrue())
+		Expect(getTestConfigYaml(r)).To(ContainSubstring(`issuer: "http://dex.example.com"`))
+
+		By("applying an https issuer either way, with a lower case scheme")
+		for _, allowHTTPIssuer := range []bool{false, true} {
+			dexServer := newTestDexServer()
+			dexServer.Spec.Issuer = "HTTPS://dex.example.com"
+			r := newTestDexServerReconciler(dexServer)
+			r.AllowHTTPIssuer = allowHTTPIssuer
+			dexServer, err := reconcileTestDexServer(r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)).To(BeTrue())
+			Expect(getTestConfigYaml(r)).To(ContainSubstring(`issuer: "https://dex.example.com"`))
+		}
+	})
+
+	It("rejects an invalid issuer before applying anything", func() {
+		for _, issuer := range []string{"", "dex.example.com", "/auth", "://not a url", "https://", "%zz"} {
+			dexServer := newTestDexServer()
+			dexServer.Spec.Issuer = issuer
+			r := newTestDexServerReconciler(dexServer)
+
+			result, err := r.Reconcile(context.TODO(), ctrl.Request{
+				NamespacedName: types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(ctrl.Result{}))
+			Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+			cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+			Expect(cond).NotTo(BeNil(), "issuer %q", issuer)
+			Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+			Expect(cond.Reason).To(Equal("InvalidIssuer"), "issuer %q", issuer)
+
+			_, err = r.DynamicClient.Resource(networkingv1.SchemeGroupVersion.WithResource("ingresses")).
+				Namespace(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+			Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+			_, err = r.KubeClient.CoreV1().ConfigMaps(testDexServerNamespace).Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+			Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+		}
+	})
+
+	It("renders static passwords from their labeled secrets", func() {
+		hash := "$2a$10$2b2cU8CPhOTaGrs1HRQuAueS7JTT5ZHsHSzYiFPm1leZck7Mc8T4W"
+		dexServer := newTestDexServer()
+		dexServer.Spec.StaticPasswords = []authv1alpha1.StaticPasswordSpec{{SecretRef: corev1.SecretReference{Name: "admin"}}}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("admin", map[string]string{
+			"email":    "admin@example.com",
+			"hash":     hash,
+			"username": "admin",
+			"userID":   "08a8684b-db88-4b73-90a9-3cd1661f5466",
+		}))
+
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeConfigMapReady)).To(BeTrue())
+		config := getTestConfigYaml(r)
+		Expect(config).To(ContainSubstring("enablePasswordDB: true"))
+		Expect(config).To(ContainSubstring("email: admin@example.com"))
+		Expect(config).To(ContainSubstring(hash))
+		secret := &corev1.Secret{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: "admin", Namespace: testDexServerNamespace}, secret)).To(Succeed())
+		Expect(secret.Labels).To(HaveKey(IDP_CREDENTIAL_LABEL))
+
+		secret.Data["hash"] = []byte("not-a-bcrypt-hash")
+		Expect(r.Update(context.TODO(), secret)).To(Succeed())
+		dexServer, _ = reconcileTestDexServer(r)
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeConfigMapReady)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("InvalidStaticPassword"))
+		Expect(cond.Message).NotTo(ContainSubstring("not-a-bcrypt-hash"))
+	})
+
+	It("waits for the ingress certificate before exposing the issuer", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.IngressCertificateRef.Name = "dex-certificate"
+		r := newTestDexServerReconciler(dexServer)
+		ingresses := r.DynamicClient.Resource(networkingv1.SchemeGroupVersion.WithResource("ingresses")).Namespace(testDexServerNamespace)
+
+		result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(ingressCertificateRequeueInterval))
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeIngressReady)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("WaitingForCertificate"))
+		_, err = ingresses.Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(kubeerrors.IsNotFound(err)).To(BeTrue())
+
+		// A secret without a valid key pair is still waited for
+		incomplete := newTestSecret("dex-certificate", map[string]string{corev1.TLSCertKey: "not a certificate"})
+		Expect(r.Create(context.TODO(), incomplete)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeIngressReady).Reason).To(Equal("WaitingForCertificate"))
+
+		Expect(r.Delete(context.TODO(), incomplete)).To(Succeed())
+		Expect(r.Create(context.TODO(), newTestTLSSecret("dex-certificate"))).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(meta.IsStatusConditionTrue(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeIngressReady)).To(BeTrue())
+		_, err = ingresses.Get(context.TODO(), testDexServerName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("renders the frontend section and mounts the custom theme", func() {
+		dexServer := newTestDexServer()
+		r := newTestDexServerReconciler(dexServer)
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getTestConfigYaml(r)).NotTo(ContainSubstring("frontend:"))
+
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.Frontend = &authv1alpha1.FrontendSpec{
+			Theme:             "example",
+			LogoURL:           "https://example.com/logo.png",
+			Issuer:            "Example Corp",
+			ThemeConfigMapRef: &corev1.LocalObjectReference{Name: "dex-theme"},
+		}
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		config := map[string]interface{}{}
+		Expect(yaml.Unmarshal([]byte(getTestConfigYaml(r)), &config)).To(Succeed())
+		Expect(config["frontend"]).To(Equal(map[string]interface{}{
+			"dir":     DEFAULT_FRONTEND_DIR,
+			"theme":   "example",
+			"issuer":  "Example Corp",
+			"logoURL": "https://example.com/logo.png",
+		}))
+		podSpec := getTestDeployment(r).Spec.Template.Spec
+		Expect(podSpec.Containers[0].VolumeMounts).To(ContainElement(corev1.VolumeMount{
+			Name:      "frontend-theme",
+			MountPath: "/srv/dex/web/themes/example",
+			ReadOnly:  true,
+		}))
+		volumes := map[string]corev1.Volume{}
+		for _, volume := range podSpec.Volumes {
+			volumes[volume.Name] = volume
+		}
+		Expect(volumes["frontend-theme"].ConfigMap.Name).To(Equal("dex-theme"))
+
+		By("requiring the theme of the mounted assets")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.Frontend.Theme = ""
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond.Reason).To(Equal("InvalidSpec"))
+		Expect(cond.Message).To(ContainSubstring("spec.frontend.theme"))
+	})
+
+	It("renders the expiry section only when it is configured", func() {
+		dexServer := newTestDexServer()
+		r := newTestDexServerReconciler(dexServer)
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getTestConfigYaml(r)).NotTo(ContainSubstring("expiry:"))
+
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.Expiry = &authv1alpha1.ExpirySpec{
+			IDTokens: "1h",
+			RefreshTokens: &authv1alpha1.RefreshTokenExpirySpec{
+				DisableRotation:   true,
+				ValidIfNotUsedFor: "168h",
+			},
+		}
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		config := map[string]interface{}{}
+		Expect(yaml.Unmarshal([]byte(getTestConfigYaml(r)), &config)).To(Succeed())
+		Expect(config["expiry"]).To(Equal(map[string]interface{}{
+			"idTokens": "1h",
+			"refreshTokens": map[string]interface{}{
+				"disableRotation":   true,
+				"validIfNotUsedFor": "168h",
+			},
+		}))
+		Expect(config).To(HaveKey("oauth2"))
+
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.Expiry.RefreshTokens.AbsoluteLifetime = "90 days"
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("InvalidSpec"))
+		Expect(cond.Message).To(ContainSubstring("spec.expiry.refreshTokens.absoluteLifetime"))
+	})
+
+	It("fails the reconcile with a retryable reason when a secret read times out", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{newTestGitHubConnector("github", "github-secret")}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}))
+		r.Client = &slowSecretClient{Client: r.Client, name: "github-secret"}
+		r.SecretFetchTimeout = 10 * time.Millisecond
+
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).To(HaveOccurred())
+		Expect(isSecretFetchTimeout(err)).To(BeTrue())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeConfigMapReady)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal(SECRET_FETCH_TIMEOUT_REASON))
+		Expect(cond.Message).To(ContainSubstring("github-secret"))
+
+		By("timing out the read of a connector root CA of the CA bundle")
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{{
+			Name: "ldap",
+			Id:   "ldap",
+			Type: authv1alpha1.ConnectorTypeLDAP,
+			LDAP: authv1alpha1.LDAPConfigSpec{RootCARef: corev1.SecretReference{Name: "ldap-ca"}},
+		}}
+		r.Client = &slowSecretClient{Client: r.Client, name: "ldap-ca"}
+		_, err = r.getConnectorRootCAs(dexServer, context.TODO())
+		Expect(isSecretFetchTimeout(err)).To(BeTrue())
+	})
+
+	It("reports the connectors rendered into the config", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{
+			newTestGitHubConnector("github", "github-secret"),
+			newTestMicrosoftConnector("microsoft", "microsoft-secret", "common"),
+		}
+		r := newTestDexServerReconciler(dexServer,
+			newTestSecret("github-secret", map[string]string{"clientSecret": "s3cr3t"}),
+			newTestSecret("microsoft-secret", map[string]string{"clientSecret": "s3cr3t"}))
+
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexServer.Status.ActiveConnectors).To(Equal([]string{"github", "microsoft"}))
+
+		dexServer.Spec.Connectors = dexServer.Spec.Connectors[1:]
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexServer.Status.ActiveConnectors).To(Equal([]string{"microsoft"}))
+	})
+
+	It("renders the Postgres storage and restarts dex when its password changes", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Storage = &authv1alpha1.StorageSpec{
+			Type: authv1alpha1.StorageTypePostgres,
+			Postgres: &authv1alpha1.PostgresStorageSpec{
+				Host:        "postgres.example.com",
+				Database:    "dex",
+				User:        "dex",
+				PasswordRef: corev1.LocalObjectReference{Name: "postgres-password"},
+				SSL: &authv1alpha1.PostgresSSLSpec{
+					Mode:  "verify-ca",
+					CARef: corev1.LocalObjectReference{Name: "postgres-ca"},
+				},
+			},
+		}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("postgres-password", map[string]string{"password": "s3cr3t"}))
+
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		config := map[string]interface{}{}
+		Expect(yaml.Unmarshal([]byte(getTestConfigYaml(r)), &config)).To(Succeed())
+		Expect(config["storage"]).To(Equal(map[string]interface{}{
+			"type": "postgres",
+			"config": map[string]interface{}{
+				"host":     "postgres.example.com",
+				"port":     float64(5432),
+				"database": "dex",
+				"user":     "dex",
+				"password": "$" + POSTGRES_PASSWORD_ENV_NAME,
+				"ssl": map[string]interface{}{
+					"mode":   "verify-ca",
+					"caFile": POSTGRES_CA_MOUNT_PATH + "/ca.crt",
+				},
+			},
+		}))
+		Expect(getTestConfigYaml(r)).NotTo(ContainSubstring("s3cr3t"))
+
+		deployment := getTestDeployment(r)
+		container := deployment.Spec.Template.Spec.Containers[0]
+		Expect(container.Env).To(ContainElement(corev1.EnvVar{
+			Name: POSTGRES_PASSWORD_ENV_NAME,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "postgres-password"},
+					Key:                  POSTGRES_DEFAULT_PASSWORD_KEY,
+				},
+			},
+		}))
+		Expect(container.VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: "postgres-ca", MountPath: POSTGRES_CA_MOUNT_PATH, ReadOnly: true}))
+		storageSecretHash := deployment.Spec.Template.Annotations[STORAGE_SECRET_HASH_ANNOTATION]
+		Expect(storageSecretHash).NotTo(BeEmpty())
+
+		secret := &corev1.Secret{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: "postgres-password", Namespace: testDexServerNamespace}, secret)).To(Succeed())
+		Expect(secret.Labels).To(HaveKey(IDP_CREDENTIAL_LABEL))
+		secret.Data["password"] = []byte("n3w-s3cr3t")
+		Expect(r.Update(context.TODO(), secret)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getTestDeployment(r).Spec.Template.Annotations[STORAGE_SECRET_HASH_ANNOTATION]).NotTo(Equal(storageSecretHash))
+	})
+
+	It("restarts the dex pods when a rotated LDAP root CA or serving certificate changes the mounted secrets hash", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.WebTLS = &authv1alpha1.WebTLSSpec{SecretName: "dex-serving-cert"}
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{{
+			Name: "ldap",
+			Id:   "ldap",
+			Type: authv1alpha1.ConnectorTypeLDAP,
+			LDAP: authv1alpha1.LDAPConfigSpec{
+				Host:      "ldap.example.com:636",
+				RootCARef: corev1.SecretReference{Name: "ldap-ca"},
+				BindPWRef: corev1.SecretReference{Name: "ldap-bind"},
+			},
+		}}
+		r := newTestDexServerReconciler(dexServer,
+			newTestSecret("ldap-ca", map[string]string{"ca.crt": "ca"}),
+			newTestSecret("ldap-bind", map[string]string{"bindPW": "pw"}),
+			newTestSecret("dex-serving-cert", map[string]string{"tls.crt": "crt", "tls.key": "key"}),
+		)
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		mountedSecretsHash := getTestDeployment(r).Spec.Template.Annotations[MOUNTED_SECRETS_HASH_ANNOTATION]
+		Expect(mountedSecretsHash).NotTo(BeEmpty())
+		for _, name := range []string{"ldap-ca", "dex-serving-cert"} {
+			secret := &corev1.Secret{}
+			Expect(r.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: testDexServerNamespace}, secret)).To(Succeed())
+			Expect(secret.Labels).To(HaveKey(IDP_CREDENTIAL_LABEL), name)
+		}
+
+		By("keeping the hash while the mounted secrets are unchanged")
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getTestDeployment(r).Spec.Template.Annotations[MOUNTED_SECRETS_HASH_ANNOTATION]).To(Equal(mountedSecretsHash))
+
+		By("changing the hash once the root CA rotates")
+		secret := &corev1.Secret{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: "ldap-ca", Namespace: testDexServerNamespace}, secret)).To(Succeed())
+		secret.Data["ca.crt"] = []byte("rotated ca")
+		Expect(r.Update(context.TODO(), secret)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getTestDeployment(r).Spec.Template.Annotations[MOUNTED_SECRETS_HASH_ANNOTATION]).NotTo(Equal(mountedSecretsHash))
+
+		By("changing the hash once the serving certificate rotates")
+		mountedSecretsHash = getTestDeployment(r).Spec.Template.Annotations[MOUNTED_SECRETS_HASH_ANNOTATION]
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: "dex-serving-cert", Namespace: testDexServerNamespace}, secret)).To(Succeed())
+		secret.Data["tls.crt"] = []byte("rotated crt")
+		Expect(r.Update(context.TODO(), secret)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getTestDeployment(r).Spec.Template.Annotations[MOUNTED_SECRETS_HASH_ANNOTATION]).NotTo(Equal(mountedSecretsHash))
+	})
+
+	It("labels the LDAP root CA secret so that its rotations are reconciled", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{{
+			Name: "ldap",
+			Id:   "ldap",
+			Type: authv1alpha1.ConnectorTypeLDAP,
+			LDAP: authv1alpha1.LDAPConfigSpec{
+				Host:      "ldap.example.com:636",
+				RootCARef: corev1.SecretReference{Name: "ldap-ca"},
+				BindPWRef: corev1.SecretReference{Name: "ldap-bind"},
+			},
+		}}
+		r := newTestDexServerReconciler(dexServer,
+			newTestSecret("ldap-ca", map[string]string{"ca.crt": "ca"}),
+			newTestSecret("ldap-bind", map[string]string{"bindPW": "pw"}),
+		)
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		secret := &corev1.Secret{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: "ldap-ca", Namespace: testDexServerNamespace}, secret)).To(Succeed())
+		Expect(secret.Labels).To(HaveKey(IDP_CREDENTIAL_LABEL))
+
+		By("failing the ConfigMap sync without labeling a missing root CA secret")
+		dexServer = newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{{
+			Name: "ldap",
+			Id:   "ldap",
+			Type: authv1alpha1.ConnectorTypeLDAP,
+			LDAP: authv1alpha1.LDAPConfigSpec{
+				Host:      "ldap.example.com:636",
+				RootCARef: corev1.SecretReference{Name: "missing-ca"},
+				BindPWRef: corev1.SecretReference{Name: "ldap-bind"},
+			},
+		}}
+		r = newTestDexServerReconciler(dexServer, newTestSecret("ldap-bind", map[string]string{"bindPW": "pw"}))
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).To(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeConfigMapReady)
+		Expect(cond.Reason).To(Equal("ConfigMapFailed"))
+		Expect(cond.Message).To(ContainSubstring("connector ldap root CA"))
+		secrets := &corev1.SecretList{}
+		Expect(r.List(context.TODO(), secrets)).To(Succeed())
+		for _, s := range secrets.Items {
+			Expect(s.Name).NotTo(BeEmpty())
+		}
+	})
+
+	It("mounts the trusted CA bundle next to the system CAs and the LDAP root CAs", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.TrustedCABundleRef = &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "internal-ca"},
+			Key:                  "ca.crt",
+		}
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{{
+			Name: "ldap",
+			Id:   "ldap",
+			Type: authv1alpha1.ConnectorTypeLDAP,
+			LDAP: authv1alpha1.LDAPConfigSpec{
+				Host:      "ldap.example.com:636",
+				RootCARef: corev1.SecretReference{Name: "ldap-ca"},
+				BindPWRef: corev1.SecretReference{Name: "ldap-bind"},
+			},
+		}}
+		r := newTestDexServerReconciler(dexServer,
+			newTestSecret("internal-ca", map[string]string{"ca.crt": "ca"}),
+			newTestSecret("ldap-ca", map[string]string{"ca.crt": "ldap ca"}),
+			newTestSecret("ldap-bind", map[string]string{"bindPW": "pw"}),
+		)
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		podSpec := getTestDeployment(r).Spec.Template.Spec
+		Expect(podSpec.Containers[0].VolumeMounts).To(ContainElements(
+			corev1.VolumeMount{Name: "trusted-ca-bundle", MountPath: TRUSTED_CA_BUNDLE_MOUNT_PATH, SubPath: TRUSTED_CA_BUNDLE_FILE_NAME, ReadOnly: true},
+			corev1.VolumeMount{Name: "ldapcerts-ldap", MountPath: LDAP_CERTS_MOUNT_PATH + "/ldap"},
+		))
+		volumes := map[string]corev1.Volume{}
+		for _, volume := range podSpec.Volumes {
+			volumes[volume.Name] = volume
+		}
+		Expect(volumes["trusted-ca-bundle"].Secret.SecretName).To(Equal("internal-ca"))
+		Expect(volumes["trusted-ca-bundle"].Secret.Items).To(Equal([]corev1.KeyToPath{{Key: "ca.crt", Path: TRUSTED_CA_BUNDLE_FILE_NAME}}))
+		mountedSecretsHash := getTestDeployment(r).Spec.Template.Annotations[MOUNTED_SECRETS_HASH_ANNOTATION]
+
+		By("rolling the dex pods when the bundle changes")
+		secret := &corev1.Secret{}
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: "internal-ca", Namespace: testDexServerNamespace}, secret)).To(Succeed())
+		Expect(secret.Labels).To(HaveKey(IDP_CREDENTIAL_LABEL))
+		secret.Data["ca.crt"] = []byte("rotated ca")
+		Expect(r.Update(context.TODO(), secret)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(getTestDeployment(r).Spec.Template.Annotations[MOUNTED_SECRETS_HASH_ANNOTATION]).NotTo(Equal(mountedSecretsHash))
+
+		By("reporting a key missing from the secret")
+		delete(secret.Data, "ca.crt")
+		Expect(r.Update(context.TODO(), secret)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).To(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeDeploymentReady)
+		Expect(cond.Reason).To(Equal("TrustedCABundleKeyMissing"))
+	})
+
+	It("renders the termination grace period and the preStop hook of the dex pods", func() {
+		dexServer := newTestDexServer()
+		r := newTestDexServerReconciler(dexServer)
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		podSpec := getTestDeployment(r).Spec.Template.Spec
+		Expect(podSpec.TerminationGracePeriodSeconds).To(BeNil())
+		Expect(podSpec.Containers[0].Lifecycle).To(BeNil())
+
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		terminationGracePeriodSeconds := int64(120)
+		preStopSleepSeconds := int32(15)
+		dexServer.Spec.TerminationGracePeriodSeconds = &terminationGracePeriodSeconds
+		dexServer.Spec.PreStopSleepSeconds = &preStopSleepSeconds
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		podSpec = getTestDeployment(r).Spec.Template.Spec
+		Expect(podSpec.TerminationGracePeriodSeconds).To(Equal(&terminationGracePeriodSeconds))
+		Expect(podSpec.Containers[0].Lifecycle.PreStop.Exec.Command).To(Equal([]string{"sleep", "15"}))
+
+		By("rejecting a preStop hook outlasting the grace period")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		dexServer.Spec.TerminationGracePeriodSeconds = nil
+		preStopSleepSeconds = 30
+		dexServer.Spec.PreStopSleepSeconds = &preStopSleepSeconds
+		Expect(r.Update(context.TODO(), dexServer)).To(Succeed())
+		dexServer, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		cond := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeApplied)
+		Expect(cond.Reason).To(Equal("InvalidSpec"))
+		Expect(cond.Message).To(ContainSubstring("spec.preStopSleepSeconds"))
+	})
+
+	It("probes the health endpoints on the telemetry port of dex", func() {
+		dexServer := newTestDexServer()
+		periodSeconds := int32(30)
+		dexServer.Spec.Probes = &authv1alpha1.ProbesSpec{PeriodSeconds: &periodSeconds}
+		r := newTestDexServerReconciler(dexServer)
+
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		config := map[string]interface{}{}
+		Expect(yaml.Unmarshal([]byte(getTestConfigYaml(r)), &config)).To(Succeed())
+		Expect(config["telemetry"]).To(Equal(map[string]interface{}{"http": "0.0.0.0:5558"}))
+
+		container := getTestDeployment(r).Spec.Template.Spec.Containers[0]
+		Expect(container.Ports).To(ContainElement(corev1.ContainerPort{Name: TELEMETRY_PORT_NAME, ContainerPort: 5558, Protocol: corev1.ProtocolTCP}))
+		for path, probe := range map[string]*corev1.Probe{LIVENESS_PROBE_PATH: container.LivenessProbe, READINESS_PROBE_PATH: container.ReadinessProbe} {
+			Expect(probe).NotTo(BeNil())
+			Expect(probe.HTTPGet).NotTo(BeNil())
+			Expect(probe.HTTPGet.Path).To(Equal(path))
+			Expect(probe.HTTPGet.Port).To(Equal(intstr.FromString(TELEMETRY_PORT_NAME)))
+			Expect(probe.HTTPGet.Scheme).To(Equal(corev1.URISchemeHTTP))
+			Expect(probe.InitialDelaySeconds).To(Equal(DEFAULT_PROBE_INITIAL_DELAY_SECONDS))
+			Expect(probe.PeriodSeconds).To(Equal(periodSeconds))
+			Expect(probe.TimeoutSeconds).To(Equal(DEFAULT_PROBE_TIMEOUT_SECONDS))
+		}
+	})
+
+	It("ignores the deployment restarts of a custom restart annotation", func() {
+		restartPredicate := ignoreDeploymentRestartPredicate("argocd.argoproj.io/restartedAt")
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            testDexServerName,
+				Namespace:       testDexServerNamespace,
+				Generation:      1,
+				OwnerReferences: []metav1.OwnerReference{{Kind: "DexServer", Name: testDexServerName}},
+			},
+		}
+
+		kubectlRestartedDeployment := deployment.DeepCopy()
+		kubectlRestartedDeployment.Generation = 2
+		kubectlRestartedDeployment.Spec.Template.Annotations = map[string]string{DEFAULT_RESTART_ANNOTATION_KEY: "now"}
+		Expect(restartPredicate.Update(event.UpdateEvent{ObjectOld: deployment, ObjectNew: kubectlRestartedDeployment})).To(BeTrue())
+
+		restartedDeployment := kubectlRestartedDeployment.DeepCopy()
+		restartedDeployment.Generation = 3
+		restartedDeployment.Spec.Template.Annotations["argocd.argoproj.io/restartedAt"] = "now"
+		Expect(restartPredicate.Update(event.UpdateEvent{ObjectOld: kubectlRestartedDeployment, ObjectNew: restartedDeployment})).To(BeFalse())
+		// The status updates of the same restart are ignored too
+		rollingDeployment := restartedDeployment.DeepCopy()
+		rollingDeployment.Status.UpdatedReplicas = 1
+		Expect(restartPredicate.Update(event.UpdateEvent{ObjectOld: restartedDeployment, ObjectNew: rollingDeployment})).To(BeFalse())
+	})
+
+	It("records the reconcile and mTLS certificate metrics", func() {
+		// getTestMetric returns the metric of the family name with the label values, scraped from the registry
+		getTestMetric := func(name string, labels map[string]string) *dto.Metric {
+			families, err := metrics.Registry.Gather()
+			Expect(err).NotTo(HaveOccurred())
+			for _, family := range families {
+				if family.GetName() != name {
+					continue
+				}
+				for _, metric := range family.GetMetric() {
+					matches := true
+					for _, label := range metric.GetLabel() {
+						if value, found := labels[label.GetName()]; found && value != label.GetValue() {
+							matches = false
+						}
+					}
+					if matches {
+						return metric
+					}
+				}
+			}
+			return nil
+		}
+		getReconcileTotal := func(result string) float64 {
+			if metric := getTestMetric("dexserver_reconcile_total", map[string]string{"result": result}); metric != nil {
+				return metric.GetCounter().GetValue()
+			}
+			return 0
+		}
+		successes := getReconcileTotal(RECONCILE_RESULT_SUCCESS)
+
+		dexServer := newTestDexServer()
+		r := newTestDexServerReconciler(dexServer)
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(getReconcileTotal(RECONCILE_RESULT_SUCCESS)).To(Equal(successes + 1))
+		duration := getTestMetric("dexserver_reconcile_duration_seconds", nil)
+		Expect(duration).NotTo(BeNil())
+		Expect(duration.GetHistogram().GetSampleCount()).To(BeNumerically(">", 0))
+		expiry := getTestMetric("dexserver_mtls_cert_expiry_timestamp_seconds", map[string]string{"namespace": testDexServerNamespace, "name": testDexServerName})
+		Expect(expiry).NotTo(BeNil())
+		Expect(expiry.GetGauge().GetValue()).To(BeNumerically(">", float64(time.Now().Unix())))
+	})
+
+	It("traces the reconcile and each sync phase", func() {
+		recorder := tracetest.NewSpanRecorder()
+		previousProvider := otel.GetTracerProvider()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		defer otel.SetTracerProvider(previousProvider)
+
+		dexServer := newTestDexServer()
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{newTestMicrosoftConnector("microsoft", "microsoft-secret", "not a tenant")}
+		r := newTestDexServerReconciler(dexServer, newTestSecret("microsoft-secret", map[string]string{"clientSecret": "s3cr3t"}))
+		_, err := reconcileTestDexServer(r)
+		Expect(err).To(HaveOccurred())
+
+		spans := map[string]sdktrace.ReadOnlySpan{}
+		for _, span := range recorder.Ended() {
+			spans[span.Name()] = span
+		}
+		Expect(spans).To(HaveKey("Reconcile"))
+		Expect(spans).To(HaveKey("sync ConfigMap"))
+		reconcileSpan := spans["Reconcile"]
+		Expect(reconcileSpan.Attributes()).To(ContainElement(attribute.String("dexserver.name", testDexServerName)))
+		Expect(reconcileSpan.Attributes()).To(ContainElement(attribute.String("dexserver.namespace", testDexServerNamespace)))
+		Expect(reconcileSpan.Status().Code).To(Equal(codes.Error))
+		configMapSpan := spans["sync ConfigMap"]
+		Expect(configMapSpan.Parent().SpanID()).To(Equal(reconcileSpan.SpanContext().SpanID()))
+		Expect(configMapSpan.Attributes()).To(ContainElement(attribute.String("dexserver.phase", authv1alpha1.DexServerConditionTypeConfigMapReady)))
+		Expect(configMapSpan.Status().Code).To(Equal(codes.Error))
+	})
+
+	It("rolls out new dex pods when the restart annotation changes", func() {
+		dexServer := newTestDexServer()
+		dexServer.Annotations = map[string]string{RESTART_ANNOTATION: "2021-11-04T10:00:00Z"}
+		r := newTestDexServerReconciler(dexServer)
+		_, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		oldDeployment := getTestDeployment(r)
+		Expect(oldDeployment.Spec.Template.Annotations).To(HaveKeyWithValue(DEFAULT_RESTART_ANNOTATION_KEY, "2021-11-04T10:00:00Z"))
+
+		By("reconciling the annotation change")
+		Expect(r.Get(context.TODO(), types.NamespacedName{Name: testDexServerName, Namespace: testDexServerNamespace}, dexServer)).To(Succeed())
+		newDexServer := dexServer.DeepCopy()
+		newDexServer.Annotations[RESTART_ANNOTATION] = "2021-11-05T10:00:00Z"
+		Expect(dexServerPredicate().Update(event.UpdateEvent{ObjectOld: dexServer, ObjectNew: newDexServer})).To(BeTrue())
+		Expect(r.Update(context.TODO(), newDexServer)).To(Succeed())
+		_, err = reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		newDeployment := getTestDeployment(r)
+		Expect(newDeployment.Spec.Template.Annotations).To(HaveKeyWithValue(DEFAULT_RESTART_ANNOTATION_KEY, "2021-11-05T10:00:00Z"))
+
+		By("ignoring the resulting deployment update")
+		oldDeployment.OwnerReferences = []metav1.OwnerReference{{Kind: "DexServer", Name: testDexServerName}}
+		newDeployment.OwnerReferences = oldDeployment.OwnerReferences
+		newDeployment.Generation = oldDeployment.Generation + 1
+		restartPredicate := ignoreDeploymentRestartPredicate(DEFAULT_RESTART_ANNOTATION_KEY)
+		Expect(restartPredicate.Update(event.UpdateEvent{ObjectOld: oldDeployment, ObjectNew: newDeployment})).To(BeFalse())
+	})
+})
+
+var _ = Describe("DexServer predicate", func() {
+	It("does not reconcile status-only updates", func() {
+		oldDexServer := newTestDexServer()
+		oldDexServer.Generation = 1
+		newDexServer := oldDexServer.DeepCopy()
+		meta.SetStatusCondition(&newDexServer.Status.Conditions, metav1.Condition{
+			Type:    authv1alpha1.DexServerConditionTypeApplied,
+			Status:  metav1.ConditionTrue,
+			Reason:  "Applied",
+			Message: "DexServer is applied",
+		})
+		Expect(dexServerPredicate().Update(event.UpdateEvent{ObjectOld: oldDexServer, ObjectNew: newDexServer})).To(BeFalse())
+
+		By("reconciling spec updates")
+		newDexServer = oldDexServer.DeepCopy()
+		newDexServer.Generation = 2
+		newDexServer.Spec.Issuer = "https://dex.other.example.com"
+		Expect(dexServerPredicate().Update(event.UpdateEvent{ObjectOld: oldDexServer, ObjectNew: newDexServer})).To(BeTrue())
+
+		By("reconciling finalizer updates")
+		newDexServer = oldDexServer.DeepCopy()
+		newDexServer.Finalizers = []string{DEX_SERVER_FINALIZER}
+		Expect(dexServerPredicate().Update(event.UpdateEvent{ObjectOld: oldDexServer, ObjectNew: newDexServer})).To(BeTrue())
+	})
+
+	It("tracks deployment restarts safely from concurrent events", func() {
+		restartPredicate := ignoreDeploymentRestartPredicate(DEFAULT_RESTART_ANNOTATION_KEY)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				oldDeployment := &appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:            fmt.Sprintf("dex-%d", i),
+						Namespace:       testDexServerNamespace,
+						Generation:      1,
+						OwnerReferences: []metav1.OwnerReference{{Kind: "DexServer", Name: testDexServerName}},
+					},
+				}
+				restartedDeployment := oldDeployment.DeepCopy()
+				restartedDeployment.Generation = 2
+				restartedDeployment.Spec.Template.Annotations = map[string]string{"kubectl.kubernetes.io/restartedAt": "now"}
+				Expect(restartPredicate.Update(event.UpdateEvent{ObjectOld: oldDeployment, ObjectNew: restartedDeployment})).To(BeFalse())
+				Expect(restartPredicate.Update(event.UpdateEvent{ObjectOld: restartedDeployment, ObjectNew: restartedDeployment.DeepCopy()})).To(BeFalse())
+
+				updatedDeployment := restartedDeployment.DeepCopy()
+				updatedDeployment.Generation = 3
+				Expect(restartPredicate.Update(event.UpdateEvent{ObjectOld: restartedDeployment, ObjectNew: updatedDeployment})).To(BeTrue())
+			}(i)
+		}
+		wg.Wait()
+	})
+
+	It("reconciles changes of the debug connectors annotation", func() {
+		oldDexServer := newTestDexServer()
+		newDexServer := oldDexServer.DeepCopy()
+		newDexServer.Annotations = map[string]string{DEBUG_CONNECTORS_ANNOTATION: "github"}
+		Expect(dexServerPredicate().Update(event.UpdateEvent{ObjectOld: oldDexServer, ObjectNew: newDexServer})).To(BeTrue())
+
+		By("ignoring other annotations")
+		newDexServer = oldDexServer.DeepCopy()
+		newDexServer.Annotations = map[string]string{"example.com/note": "value"}
+		Expect(dexServerPredicate().Update(event.UpdateEvent{ObjectOld: oldDexServer, ObjectNew: newDexServer})).To(BeFalse())
+	})
+
+	It("only reconciles the DexServers matching the label selector", func() {
+		selector, err := labels.Parse("tenant-class=gold")
+		Expect(err).NotTo(HaveOccurred())
+		oldDexServer := newTestDexServer()
+		newDexServer := oldDexServer.DeepCopy()
+		newDexServer.Labels = map[string]string{"tenant-class": "gold"}
+		Expect(dexServerLabelSelectorPredicate(selector).Create(event.CreateEvent{Object: oldDexServer})).To(BeFalse())
+		Expect(dexServerLabelSelectorPredicate(selector).Create(event.CreateEvent{Object: newDexServer})).To(BeTrue())
+
+		By("reconciling the DexServers that start matching the selector")
+		Expect(dexServerSelectedPredicate(selector).Update(event.UpdateEvent{ObjectOld: oldDexServer, ObjectNew: newDexServer})).To(BeTrue())
+		Expect(dexServerSelectedPredicate(selector).Update(event.UpdateEvent{ObjectOld: newDexServer, ObjectNew: newDexServer.DeepCopy()})).To(BeFalse())
+
+		By("skipping the reconcile of requests for other DexServers")
+		r := newTestDexServerReconciler(oldDexServer)
+		r.LabelSelector = selector
+		dexServer, err := reconcileTestDexServer(r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dexServer.Finalizers).To(BeEmpty())
+		Expect(dexServer.Status.Conditions).To(BeEmpty())
+	})
+})
@@ -0,0 +1,149 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// The path of the DexServer validating webhook
+const DEX_SERVER_VALIDATING_WEBHOOK_PATH = "/validate-auth-identitatem-io-v1alpha1-dexserver"
+
+//+kubebuilder:webhook:path=/validate-auth-identitatem-io-v1alpha1-dexserver,mutating=false,failurePolicy=fail,sideEffects=None,groups=auth.identitatem.io,resources=dexservers,verbs=create;update,versions=v1alpha1,name=vdexserver.kb.io,admissionReviewVersions=v1
+
+// DexServerValidator rejects DexServers whose connectors or issuer would otherwise only fail deep inside the
+// reconcile
+type DexServerValidator struct {
+	decoder *admission.Decoder
+	// When true, DexServers may use an http issuer, for local and development setups
+	AllowHTTPIssuer bool
+}
+
+// SetupWebhookWithManager registers the DexServer validating webhook on the webhook server of the manager
+func (v *DexServerValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	mgr.GetWebhookServer().Register(DEX_SERVER_VALIDATING_WEBHOOK_PATH, &webhook.Admission{Handler: v})
+	return nil
+}
+
+// InjectDecoder is called by the webhook server with the decoder of the scheme of the manager
+func (v *DexServerValidator) InjectDecoder(decoder *admission.Decoder) error {
+	v.decoder = decoder
+	return nil
+}
+
+// Handle validates the created DexServer, or the updated DexServer when its spec changes
+func (v *DexServerValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	dexServer := &authv1alpha1.DexServer{}
+	if err := v.decoder.Decode(req, dexServer); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	// DexServers created before the webhook, or before a rule changed, must still be deletable: the operator
+	// removes their finalizer with an update that leaves the spec alone
+	if dexServer.DeletionTimestamp != nil {
+		return admission.Allowed("")
+	}
+	if len(req.OldObject.Raw) > 0 {
+		oldDexServer := &authv1alpha1.DexServer{}
+		if err := v.decoder.DecodeRaw(req.OldObject, oldDexServer); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if equality.Semantic.DeepEqual(oldDexServer.Spec, dexServer.Spec) {
+			return admission.Allowed("")
+		}
+	}
+	allErrs := validateDexServerAdmission(dexServer, v.AllowHTTPIssuer)
+	if len(allErrs) == 0 {
+		return admission.Allowed("")
+	}
+	status := kubeerrors.NewInvalid(authv1alpha1.GroupVersion.WithKind("DexServer").GroupKind(), dexServer.Name, allErrs).ErrStatus
+	return admission.Response{
+		AdmissionResponse: admissionv1.AdmissionResponse{
+			Allowed: false,
+			Result:  &status,
+		},
+	}
+}
+
+// validateDexServerAdmission checks the issuer and the connectors of a DexServer on admission: the issuer must be an
+// absolute https URL, or http URL when allowHTTPIssuer is set, connector ids must be unique, and every connector must
+// reference the secret of its credential. The remaining checks of the spec are reported on the Applied condition by
+// the reconcile.
+func validateDexServerAdmission(dexServer *authv1alpha1.DexServer, allowHTTPIssuer bool) field.ErrorList {
+	allErrs := field.ErrorList{}
+	specPath := field.NewPath("spec")
+
+	issuerPath := specPath.Child("issuer")
+	if dexServer.Spec.Issuer == "" {
+		allErrs = append(allErrs, field.Required(issuerPath, ""))
+	} else if u, err := url.Parse(dexServer.Spec.Issuer); err != nil {
+		allErrs = append(allErrs, field.Invalid(issuerPath, dexServer.Spec.Issuer, err.Error()))
+	} else if !u.IsAbs() || u.Host == "" || validateIssuerScheme(dexServer.Spec.Issuer, allowHTTPIssuer) != nil {
+		if allowHTTPIssuer {
+			allErrs = append(allErrs, field.Invalid(issuerPath, dexServer.Spec.Issuer, "must be an absolute http or https URL"))
+		} else {
+			allErrs = append(allErrs, field.Invalid(issuerPath, dexServer.Spec.Issuer, "must be an absolute https URL"))
+		}
+	}
+
+	ids := map[string]bool{}
+	for i, connector := range dexServer.Spec.Connectors {
+		connectorPath := specPath.Child("connectors").Index(i)
+		if connector.Id == "" {
+			allErrs = append(allErrs, field.Required(connectorPath.Child("id"), ""))
+		} else if ids[connector.Id] {
+			allErrs = append(allErrs, field.Duplicate(connectorPath.Child("id"), connector.Id))
+		}
+		ids[connector.Id] = true
+
+		connectorType, _ := getCanonicalConnectorType(connector.Type)
+		switch connectorType {
+		case authv1alpha1.ConnectorTypeGitHub:
+			if connector.GitHub.ClientSecretRef.Name == "" {
+				allErrs = append(allErrs, field.Required(connectorPath.Child("github", "clientSecretRef", "name"), ""))
+			}
+		case authv1alpha1.ConnectorTypeMicrosoft:
+			if connector.Microsoft.ClientSecretRef.Name == "" {
+				allErrs = append(allErrs, field.Required(connectorPath.Child("microsoft", "clientSecretRef", "name"), ""))
+			}
+		case authv1alpha1.ConnectorTypeGoogle:
+			if isGoogleConfigured(connector) && connector.Google.ClientSecretRef.Name == "" {
+				allErrs = append(allErrs, field.Required(connectorPath.Child("google", "clientSecretRef", "name"), ""))
+			}
+		case authv1alpha1.ConnectorTypeLDAP:
+			if connector.LDAP.Host == "" {
+				allErrs = append(allErrs, field.Required(connectorPath.Child("ldap", "host"), ""))
+			}
+			// Without a bind DN the LDAP server is searched anonymously, without a password
+			if connector.LDAP.BindDN != "" && connector.LDAP.BindPWRef.Name == "" {
+				allErrs = append(allErrs, field.Required(connectorPath.Child("ldap", "bindPWRef", "name"), "required when bindDN is set"))
+			}
+		}
+	}
+	return allErrs
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+var _ = Describe("DexServer validating webhook", func() {
+	newLDAPConnector := func(id string) authv1alpha1.ConnectorSpec {
+		return authv1alpha1.ConnectorSpec{
+			Type: authv1alpha1.ConnectorTypeLDAP,
+			Id:   id,
+			LDAP: authv1alpha1.LDAPConfigSpec{
+				Host:      "ldap.example.com:636",
+				BindDN:    "cn=admin,dc=example,dc=com",
+				BindPWRef: corev1.SecretReference{Name: "ldap-secret"},
+			},
+		}
+	}
+
+	DescribeTable("rejects invalid DexServers",
+		func(mutate func(dexServer *authv1alpha1.DexServer), field string) {
+			dexServer := newTestDexServer()
+			dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{
+				newTestGitHubConnector("github", "github-secret"),
+				newLDAPConnector("ldap"),
+			}
+			Expect(validateDexServerAdmission(dexServer, false)).To(BeEmpty())
+
+			mutate(dexServer)
+			errs := validateDexServerAdmission(dexServer, false)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal(field))
+		},
+		Entry("duplicate connector id", func(dexServer *authv1alpha1.DexServer) {
+			dexServer.Spec.Connectors[1].Id = "github"
+		}, "spec.connectors[1].id"),
+		Entry("missing connector id", func(dexServer *authv1alpha1.DexServer) {
+			dexServer.Spec.Connectors[0].Id = ""
+		}, "spec.connectors[0].id"),
+		Entry("GitHub connector without client secret", func(dexServer *authv1alpha1.DexServer) {
+			dexServer.Spec.Connectors[0].GitHub.ClientSecretRef.Name = ""
+		}, "spec.connectors[0].github.clientSecretRef.name"),
+		Entry("Microsoft connector alias without client secret", func(dexServer *authv1alpha1.DexServer) {
+			dexServer.Spec.Connectors[0] = authv1alpha1.ConnectorSpec{Type: "azuread", Id: "microsoft"}
+		}, "spec.connectors[0].microsoft.clientSecretRef.name"),
+		Entry("LDAP connector binding without password", func(dexServer *authv1alpha1.DexServer) {
+			dexServer.Spec.Connectors[1].LDAP.BindPWRef.Name = ""
+		}, "spec.connectors[1].ldap.bindPWRef.name"),
+		Entry("LDAP connector without host", func(dexServer *authv1alpha1.DexServer) {
+			dexServer.Spec.Connectors[1].LDAP.Host = ""
+		}, "spec.connectors[1].ldap.host"),
+		Entry("missing issuer", func(dexServer *authv1alpha1.DexServer) {
+			dexServer.Spec.Issuer = ""
+		}, "spec.issuer"),
+		Entry("relative issuer", func(dexServer *authv1alpha1.DexServer) {
+			dexServer.Spec.Issuer = "dex.example.com"
+		}, "spec.issuer"),
+		Entry("http issuer", func(dexServer *authv1alpha1.DexServer) {
+			dexServer.Spec.Issuer = "http://dex.example.com"
+		}, "spec.issuer"),
+		Entry("unparsable issuer", func(dexServer *authv1alpha1.DexServer) {
+			dexServer.Spec.Issuer = "https://dex example.com/%zz"
+		}, "spec.issuer"),
+	)
+
+	It("accepts http issuers only when allowed", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.Issuer = "http://dex.example.com"
+		Expect(validateDexServerAdmission(dexServer, true)).To(BeEmpty())
+		errs := validateDexServerAdmission(dexServer, false)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Detail).To(Equal("must be an absolute https URL"))
+
+		By("accepting https issuers either way")
+		dexServer.Spec.Issuer = "https://dex.example.com"
+		Expect(validateDexServerAdmission(dexServer, true)).To(BeEmpty())
+		Expect(validateDexServerAdmission(dexServer, false)).To(BeEmpty())
+
+		By("rejecting other schemes either way")
+		dexServer.Spec.Issuer = "ftp://dex.example.com"
+		Expect(validateDexServerAdmission(dexServer, true)).To(HaveLen(1))
+	})
+
+	It("accepts LDAP connectors searching anonymously", func() {
+		dexServer := newTestDexServer()
+		connector := newLDAPConnector("ldap")
+		connector.LDAP.BindDN = ""
+		connector.LDAP.BindPWRef.Name = ""
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{connector}
+		Expect(validateDexServerAdmission(dexServer, false)).To(BeEmpty())
+	})
+
+	newValidator := func() *DexServerValidator {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(authv1alpha1.AddToScheme(scheme)).To(Succeed())
+		decoder, err := admission.NewDecoder(scheme)
+		Expect(err).NotTo(HaveOccurred())
+		validator := &DexServerValidator{}
+		Expect(validator.InjectDecoder(decoder)).To(Succeed())
+		return validator
+	}
+	toRawExtension := func(dexServer *authv1alpha1.DexServer) runtime.RawExtension {
+		raw, err := json.Marshal(dexServer)
+		Expect(err).NotTo(HaveOccurred())
+		return runtime.RawExtension{Raw: raw}
+	}
+
+	It("denies admission requests with the invalid fields", func() {
+		validator := newValidator()
+		newRequest := func(dexServer *authv1alpha1.DexServer) admission.Request {
+			return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Object:    toRawExtension(dexServer),
+			}}
+		}
+
+		dexServer := newTestDexServer()
+		dexServer.TypeMeta.APIVersion = authv1alpha1.GroupVersion.String()
+		dexServer.TypeMeta.Kind = "DexServer"
+		Expect(validator.Handle(context.TODO(), newRequest(dexServer)).Allowed).To(BeTrue())
+
+		dexServer.Spec.Issuer = "http://dex.example.com"
+		response := validator.Handle(context.TODO(), newRequest(dexServer))
+		Expect(response.Allowed).To(BeFalse())
+		Expect(response.Result.Message).To(ContainSubstring("spec.issuer"))
+		Expect(response.Result.Message).To(ContainSubstring("must be an absolute https URL"))
+	})
+
+	DescribeTable("admits updates of DexServers failing the validation",
+		func(mutate func(dexServer *authv1alpha1.DexServer), allowed bool) {
+			oldDexServer := newTestDexServer()
+			oldDexServer.TypeMeta.APIVersion = authv1alpha1.GroupVersion.String()
+			oldDexServer.TypeMeta.Kind = "DexServer"
+			oldDexServer.Spec.Issuer = "http://dex.example.com"
+			oldDexServer.Finalizers = []string{DEX_SERVER_FINALIZER}
+			dexServer := oldDexServer.DeepCopy()
+			mutate(dexServer)
+
+			response := newValidator().Handle(context.TODO(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Update,
+				Object:    toRawExtension(dexServer),
+				OldObject: toRawExtension(oldDexServer),
+			}})
+			Expect(response.Allowed).To(Equal(allowed))
+		},
+		Entry("metadata only update", func(dexServer *authv1alpha1.DexServer) {
+			dexServer.Labels = map[string]string{"tenant-class": "gold"}
+		}, true),
+		Entry("finalizer removal of a deleted DexServer", func(dexServer *authv1alpha1.DexServer) {
+			deletionTimestamp := metav1.Now()
+			dexServer.DeletionTimestamp = &deletionTimestamp
+			dexServer.Finalizers = nil
+		}, true),
+		Entry("spec update keeping the invalid field", func(dexServer *authv1alpha1.DexServer) {
+			dexServer.Spec.AdditionalHosts = []string{"dex.other.example.com"}
+		}, false),
+	)
+})
@@ -0,0 +1,85 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"path"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// Directory of the web assets in the dex image, used as the frontend dir when a custom theme is mounted into it
+const DEFAULT_FRONTEND_DIR = "/srv/dex/web"
+
+// DexFrontendSpec is the frontend section of the dex config
+type DexFrontendSpec struct {
+	Dir     string `json:"dir,omitempty"`
+	Theme   string `json:"theme,omitempty"`
+	Issuer  string `json:"issuer,omitempty"`
+	LogoURL string `json:"logoURL,omitempty"`
+}
+
+// getFrontendDir returns the directory of the web assets of dex, or "" for the dex default. Dex serves its
+// embedded assets unless a directory is set, so a mounted theme needs the directory of the assets of the image.
+func getFrontendDir(frontend *authv1alpha1.FrontendSpec) string {
+	if frontend.Dir == "" && frontend.ThemeConfigMapRef != nil {
+		return DEFAULT_FRONTEND_DIR
+	}
+	return frontend.Dir
+}
+
+// getFrontendYaml returns the frontend section of the dex config, or nothing when the DexServer has no frontend
+func getFrontendYaml(dexServer *authv1alpha1.DexServer) ([]byte, error) {
+	frontend := dexServer.Spec.Frontend
+	if frontend == nil {
+		return nil, nil
+	}
+	return yaml.Marshal(&struct {
+		Frontend DexFrontendSpec `json:"frontend"`
+	}{
+		Frontend: DexFrontendSpec{
+			Dir:     getFrontendDir(frontend),
+			Theme:   frontend.Theme,
+			Issuer:  frontend.Issuer,
+			LogoURL: frontend.LogoURL,
+		},
+	})
+}
+
+// getFrontendVolumes returns the volume and volume mount of the ConfigMap of the custom theme, mounted as the
+// directory of the theme
+func getFrontendVolumes(dexServer *authv1alpha1.DexServer) ([]corev1.Volume, []corev1.VolumeMount) {
+	frontend := dexServer.Spec.Frontend
+	if frontend == nil || frontend.ThemeConfigMapRef == nil {
+		return nil, nil
+	}
+	volume := corev1.Volume{
+		Name: "frontend-theme",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: *frontend.ThemeConfigMapRef},
+		},
+	}
+	volumeMount := corev1.VolumeMount{
+		Name:      "frontend-theme",
+		MountPath: path.Join(getFrontendDir(frontend), "themes", frontend.Theme),
+		ReadOnly:  true,
+	}
+	return []corev1.Volume{volume}, []corev1.VolumeMount{volumeMount}
+}
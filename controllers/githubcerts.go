@@ -0,0 +1,83 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// Directory of the GitHub Enterprise CA certificates in the dex container, one subdirectory per connector id
+const GITHUB_CERTS_MOUNT_PATH = "/etc/dex/githubcerts"
+
+// getGitHubCertVolumes returns the volume and volume mount of the root CA secret of a github connector. The secret
+// is mounted with only its ca.crt key.
+func getGitHubCertVolumes(connector authv1alpha1.ConnectorSpec) ([]corev1.Volume, []corev1.VolumeMount) {
+	var volumes []corev1.Volume
+	var volumeMounts []corev1.VolumeMount
+	ref := connector.GitHub.RootCARef
+	if connector.Type != authv1alpha1.ConnectorTypeGitHub || ref == nil {
+		return volumes, volumeMounts
+	}
+	volumes = append(volumes, corev1.Volume{
+		Name: "githubcerts-" + connector.Id,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: ref.Name,
+				Items:      []corev1.KeyToPath{{Key: "ca.crt", Path: "ca.crt"}},
+			},
+		},
+	})
+	volumeMounts = append(volumeMounts, corev1.VolumeMount{
+		Name:      "githubcerts-" + connector.Id,
+		MountPath: GITHUB_CERTS_MOUNT_PATH + "/" + connector.Id,
+	})
+	return volumes, volumeMounts
+}
+
+// getGitHubRootCAPath returns the path of the root CA of a github connector: the mounted ca.crt of rootCARef, or
+// rootCA when rootCARef is unset. It checks that the referenced secret has a ca.crt key, which would otherwise keep
+// the dex pods from starting.
+func (r *DexServerReconciler) getGitHubRootCAPath(connector authv1alpha1.ConnectorSpec, dexServer *authv1alpha1.DexServer, ctx context.Context) (string, error) {
+	ref := connector.GitHub.RootCARef
+	if ref == nil {
+		return connector.GitHub.RootCA, nil
+	}
+	secret := &corev1.Secret{}
+	if err := r.getSecretWithTimeout(ctx, types.NamespacedName{Name: ref.Name, Namespace: dexServer.Namespace}, secret); err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return "", &phaseFailedError{reason: "GitHubRootCASecretNotFound", err: errors.Wrapf(err, "connector %s", connector.Id)}
+		}
+		return "", err
+	}
+	// Add label to this secret so that the secret can be watched for updates
+	checkAndAddLabelToSecret(secret, r, ctx)
+	if len(secret.Data["ca.crt"]) == 0 {
+		return "", &phaseFailedError{
+			reason: "ConnectorSecretKeyMissing",
+			err:    fmt.Errorf("connector %s: secret %s/%s has no key ca.crt", connector.Id, dexServer.Namespace, ref.Name),
+		}
+	}
+	return GITHUB_CERTS_MOUNT_PATH + "/" + connector.Id + "/ca.crt", nil
+}
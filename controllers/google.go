@@ -0,0 +1,94 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+const (
+	// Directory of the Google service account keys in the dex container, one subdirectory per connector id
+	GOOGLE_SERVICE_ACCOUNT_MOUNT_PATH = "/etc/dex/googleserviceaccount"
+	// File name of the mounted Google service account key
+	GOOGLE_SERVICE_ACCOUNT_FILE_NAME = "serviceaccount.json"
+)
+
+// isGoogleConfigured returns true for a google connector configured by its google block. A google connector without
+// one is configured by rawConfig only, as google connectors were before the block was added.
+func isGoogleConfigured(connector authv1alpha1.ConnectorSpec) bool {
+	return !reflect.ValueOf(connector.Google).IsZero()
+}
+
+// getGoogleServiceAccountVolumes returns the volume and volume mount of the service account key secret of a google
+// connector. The secret is mounted with only the referenced key.
+func getGoogleServiceAccountVolumes(connector authv1alpha1.ConnectorSpec) ([]corev1.Volume, []corev1.VolumeMount) {
+	var volumes []corev1.Volume
+	var volumeMounts []corev1.VolumeMount
+	ref := connector.Google.ServiceAccountFilePathRef
+	if connector.Type != authv1alpha1.ConnectorTypeGoogle || ref == nil {
+		return volumes, volumeMounts
+	}
+	volumes = append(volumes, corev1.Volume{
+		Name: "googleserviceaccount-" + connector.Id,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: ref.Name,
+				Items:      []corev1.KeyToPath{{Key: ref.Key, Path: GOOGLE_SERVICE_ACCOUNT_FILE_NAME}},
+			},
+		},
+	})
+	volumeMounts = append(volumeMounts, corev1.VolumeMount{
+		Name:      "googleserviceaccount-" + connector.Id,
+		MountPath: GOOGLE_SERVICE_ACCOUNT_MOUNT_PATH + "/" + connector.Id,
+	})
+	return volumes, volumeMounts
+}
+
+// getGoogleServiceAccountFilePath returns the path of the service account key of a google connector, or an empty
+// path when serviceAccountFilePathRef is unset. It checks that the referenced secret has the referenced key, which
+// would otherwise keep the dex pods from starting.
+func (r *DexServerReconciler) getGoogleServiceAccountFilePath(connector authv1alpha1.ConnectorSpec, dexServer *authv1alpha1.DexServer, ctx context.Context) (string, error) {
+	ref := connector.Google.ServiceAccountFilePathRef
+	if ref == nil {
+		return "", nil
+	}
+	secret := &corev1.Secret{}
+	if err := r.getSecretWithTimeout(ctx, types.NamespacedName{Name: ref.Name, Namespace: dexServer.Namespace}, secret); err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return "", &phaseFailedError{reason: "GoogleServiceAccountSecretNotFound", err: errors.Wrapf(err, "connector %s", connector.Id)}
+		}
+		return "", err
+	}
+	// Add label to this secret so that the secret can be watched for updates
+	checkAndAddLabelToSecret(secret, r, ctx)
+	if len(secret.Data[ref.Key]) == 0 {
+		return "", &phaseFailedError{
+			reason: "ConnectorSecretKeyMissing",
+			err:    fmt.Errorf("connector %s: secret %s/%s has no key %s", connector.Id, dexServer.Namespace, ref.Name, ref.Key),
+		}
+	}
+	return GOOGLE_SERVICE_ACCOUNT_MOUNT_PATH + "/" + connector.Id + "/" + GOOGLE_SERVICE_ACCOUNT_FILE_NAME, nil
+}
@@ -0,0 +1,385 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+const (
+	MTLS_CERT_SOURCE_ANNOTATION = "auth.identitatem.io/grpc-cert-source"
+	// Holds the private keys of the pending CertificateSigningRequests of the KubeCSR gRPC certificate source
+	SECRET_MTLS_PENDING_NAME = "grpc-mtls-pending"
+	// Secrets written by cert-manager for the CertManager gRPC certificate source
+	SECRET_MTLS_SERVER_NAME = "grpc-mtls-server"
+	SECRET_MTLS_CLIENT_NAME = "grpc-mtls-client"
+	// ConfigMap published in every namespace with the cluster CA, trusted for the KubeCSR certificates
+	KUBE_ROOT_CA_CONFIGMAP_NAME = "kube-root-ca.crt"
+	KUBE_ROOT_CA_KEY            = "ca.crt"
+	CERT_MANAGER_GROUP          = "cert-manager.io"
+)
+
+var (
+	// How often the reconcile checks whether the requested gRPC certificates have been issued
+	grpcCertRequeueInterval = 30 * time.Second
+)
+
+// getGRPCCertSource returns the source of the gRPC mTLS certificates, SelfSigned when not set
+func getGRPCCertSource(dexServer *authv1alpha1.DexServer) authv1alpha1.GRPCCertSourceType {
+	if dexServer.Spec.GRPCCertSource == "" {
+		return authv1alpha1.GRPCCertSourceSelfSigned
+	}
+	return dexServer.Spec.GRPCCertSource
+}
+
+// getMTLSSecretCertSource returns the source of the certificates in the mtls secret. Secrets written before the
+// source was configurable hold self-signed certificates.
+func getMTLSSecretCertSource(secret *corev1.Secret) authv1alpha1.GRPCCertSourceType {
+	if source := secret.Annotations[MTLS_CERT_SOURCE_ANNOTATION]; source != "" {
+		return authv1alpha1.GRPCCertSourceType(source)
+	}
+	return authv1alpha1.GRPCCertSourceSelfSigned
+}
+
+// getMTLSCerts returns the gRPC mTLS certificates from the configured source. KubeCSR and CertManager return a
+// phaseWaitingError until the certificates are issued.
+func (r *DexServerReconciler) getMTLSCerts(dexServer *authv1alpha1.DexServer, ctx context.Context) (*MTLSCerts, error) {
+	switch getGRPCCertSource(dexServer) {
+	case authv1alpha1.GRPCCertSourceKubeCSR:
+		return r.issueMTLSCertsWithCSR(dexServer, ctx)
+	case authv1alpha1.GRPCCertSourceCertManager:
+		return r.issueMTLSCertsWithCertManager(dexServer, ctx)
+	default:
+		return generateMTLSCerts(dexServer.Namespace, dexServer.Spec.GRPCCertSANs)
+	}
+}
+
+// getGRPCCertCSRName returns the name of the cluster scoped CertificateSigningRequest of the server or client cert
+func getGRPCCertCSRName(dexServer *authv1alpha1.DexServer, certName string) string {
+	return fmt.Sprintf("dex-operator-%s-grpc-%s", dexServer.Namespace, certName)
+}
+
+// issueMTLSCertsWithCSR submits CertificateSigningRequests for the server and client certificates and returns the
+// certificates once they are approved and signed. The private keys are kept in the pending secret meanwhile.
+func (r *DexServerReconciler) issueMTLSCertsWithCSR(dexServer *authv1alpha1.DexServer, ctx context.Context) (*MTLSCerts, error) {
+	pendingSecret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: SECRET_MTLS_PENDING_NAME, Namespace: dexServer.Namespace}, pendingSecret); err != nil {
+		if !kubeerrors.IsNotFound(err) {
+			return nil, errors.Wrap(err, "error getting pending mtls secret")
+		}
+		return nil, r.submitGRPCCertCSRs(dexServer, ctx)
+	}
+
+	certPEMs := map[string][]byte{}
+	pendingCSRNames := []string{}
+	for _, certName := range []string{"server", "client"} {
+		csrName := getGRPCCertCSRName(dexServer, certName)
+		csr, err := r.KubeClient.CertificatesV1().CertificateSigningRequests().Get(ctx, csrName, metav1.GetOptions{})
+		if err != nil {
+			if kubeerrors.IsNotFound(err) {
+				// The request was deleted, for example after a denial... submit a new one
+				return nil, r.submitGRPCCertCSRs(dexServer, ctx)
+			}
+			return nil, errors.Wrapf(err, "error getting CertificateSigningRequest %s", csrName)
+		}
+		for _, condition := range csr.Status.Conditions {
+			if condition.Status == corev1.ConditionTrue &&
+				(condition.Type == certificatesv1.CertificateDenied || condition.Type == certificatesv1.CertificateFailed) {
+				return nil, fmt.Errorf("CertificateSigningRequest %s %s: %s. Delete it to submit a new request",
+					csrName, condition.Type, condition.Message)
+			}
+		}
+		if len(csr.Status.Certificate) == 0 {
+			pendingCSRNames = append(pendingCSRNames, csrName)
+		}
+		certPEMs[certName] = csr.Status.Certificate
+	}
+	if len(pendingCSRNames) > 0 {
+		return nil, &phaseWaitingError{
+			reason:       "WaitingForCertApproval",
+			message:      fmt.Sprintf("waiting for CertificateSigningRequests %s to be approved and signed", strings.Join(pendingCSRNames, ", ")),
+			requeueAfter: grpcCertRequeueInterval,
+		}
+	}
+
+	expiry, err := getCertPEMExpiry(certPEMs["server"])
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading the signed gRPC server certificate")
+	}
+	caPEM, err := r.getKubeRootCA(dexServer, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &MTLSCerts{
+		caPEM:            bytes.NewBuffer(caPEM),
+		caPrivKeyPEM:     new(bytes.Buffer),
+		certPEM:          bytes.NewBuffer(certPEMs["server"]),
+		certPrivKeyPEM:   bytes.NewBuffer(pendingSecret.Data["server.key"]),
+		clientPEM:        bytes.NewBuffer(certPEMs["client"]),
+		clientPrivKeyPEM: bytes.NewBuffer(pendingSecret.Data["client.key"]),
+		expiry:           expiry,
+	}, nil
+}
+
+// submitGRPCCertCSRs generates the private keys and submits the CertificateSigningRequests for the server and
+// client certificates, replacing any previous request
+func (r *DexServerReconciler) submitGRPCCertCSRs(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	log := ctrllog.FromContext(ctx)
+	if err := r.deleteGRPCCertCSRs(dexServer, ctx); err != nil {
+		return err
+	}
+
+	pendingSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      SECRET_MTLS_PENDING_NAME,
+			Namespace: dexServer.Namespace,
+			Labels: map[string]string{
+				"app": dexServer.Name,
+			},
+		},
+		Data: map[string][]byte{},
+	}
+	r.setOwnerReference(dexServer, pendingSecret)
+
+	csrs := []*certificatesv1.CertificateSigningRequest{}
+	for _, certName := range []string{"server", "client"} {
+		privKey, err := rsa.GenerateKey(rand.Reader, PRIVATE_KEY_SIZE)
+		if err != nil {
+			return errors.Wrap(err, "error generating mtls private key")
+		}
+		template := &x509.CertificateRequest{
+			Subject: pkix.Name{
+				Organization: []string{"Red Hat, Inc."},
+				Country:      []string{"US"},
+				CommonName:   getServiceName(dexServer.Namespace),
+			},
+		}
+		usages := []certificatesv1.KeyUsage{
+			certificatesv1.UsageDigitalSignature,
+			certificatesv1.UsageKeyEncipherment,
+			certificatesv1.UsageClientAuth,
+		}
+		if certName == "server" {
+			template.DNSNames, template.IPAddresses = getGRPCServerCertNames(dexServer)
+			usages = append(usages, certificatesv1.UsageServerAuth)
+		}
+		csrBytes, err := x509.CreateCertificateRequest(rand.Reader, template, privKey)
+		if err != nil {
+			return errors.Wrap(err, "error creating mtls certificate request")
+		}
+		pendingSecret.Data[certName+".key"] = pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(privKey),
+		})
+
+		csrs = append(csrs, &certificatesv1.CertificateSigningRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: getGRPCCertCSRName(dexServer, certName),
+				Labels: map[string]string{
+					"app":                 dexServer.Name,
+					"dexconfig_namespace": dexServer.Namespace,
+				},
+			},
+			Spec: certificatesv1.CertificateSigningRequestSpec{
+				Request:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrBytes}),
+				SignerName: dexServer.Spec.GRPCCertSignerName,
+				Usages:     usages,
+			},
+		})
+	}
+
+	// Store the keys first, a request without its key could never be used
+	if err := r.Delete(ctx, pendingSecret); err != nil && !kubeerrors.IsNotFound(err) {
+		return errors.Wrap(err, "error deleting pending mtls secret")
+	}
+	if err := r.Create(ctx, pendingSecret); err != nil {
+		return errors.Wrap(err, "error creating pending mtls secret")
+	}
+	for _, csr := range csrs {
+		log.Info("Creating CertificateSigningRequest", "CertificateSigningRequest.Name", csr.Name, "SignerName", csr.Spec.SignerName)
+		if _, err := r.KubeClient.CertificatesV1().CertificateSigningRequests().Create(ctx, csr, metav1.CreateOptions{}); err != nil {
+			return errors.Wrapf(err, "error creating CertificateSigningRequest %s", csr.Name)
+		}
+	}
+
+	return &phaseWaitingError{
+		reason: "WaitingForCertApproval",
+		message: fmt.Sprintf("waiting for CertificateSigningRequests %s, %s to be approved and signed",
+			getGRPCCertCSRName(dexServer, "server"), getGRPCCertCSRName(dexServer, "client")),
+		requeueAfter: grpcCertRequeueInterval,
+	}
+}
+
+// deleteGRPCCertCSRs deletes the CertificateSigningRequests of the KubeCSR gRPC certificate source
+func (r *DexServerReconciler) deleteGRPCCertCSRs(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	for _, certName := range []string{"server", "client"} {
+		csrName := getGRPCCertCSRName(dexServer, certName)
+		err := r.KubeClient.CertificatesV1().CertificateSigningRequests().Delete(ctx, csrName, metav1.DeleteOptions{})
+		if err != nil && !kubeerrors.IsNotFound(err) {
+			return errors.Wrapf(err, "error deleting CertificateSigningRequest %s", csrName)
+		}
+	}
+	return nil
+}
+
+// cleanupGRPCCertCSRs removes the CertificateSigningRequests and the pending keys once the certificates are stored
+// in the mtls secret, so that the next renewal submits new requests
+func (r *DexServerReconciler) cleanupGRPCCertCSRs(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	if err := r.deleteGRPCCertCSRs(dexServer, ctx); err != nil {
+		return err
+	}
+	pendingSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: SECRET_MTLS_PENDING_NAME, Namespace: dexServer.Namespace},
+	}
+	if err := r.Delete(ctx, pendingSecret); err != nil && !kubeerrors.IsNotFound(err) {
+		return errors.Wrap(err, "error deleting pending mtls secret")
+	}
+	return nil
+}
+
+// getKubeRootCA returns the cluster CA published in the kube-root-ca.crt ConfigMap of the DexServer namespace
+func (r *DexServerReconciler) getKubeRootCA(dexServer *authv1alpha1.DexServer, ctx context.Context) ([]byte, error) {
+	configMap := &corev1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Name: KUBE_ROOT_CA_CONFIGMAP_NAME, Namespace: dexServer.Namespace}, configMap); err != nil {
+		return nil, errors.Wrapf(err, "error getting ConfigMap %s", KUBE_ROOT_CA_CONFIGMAP_NAME)
+	}
+	ca, ok := configMap.Data[KUBE_ROOT_CA_KEY]
+	if !ok {
+		return nil, fmt.Errorf("ConfigMap %s has no %s", KUBE_ROOT_CA_CONFIGMAP_NAME, KUBE_ROOT_CA_KEY)
+	}
+	return []byte(ca), nil
+}
+
+// issueMTLSCertsWithCertManager applies cert-manager Certificates for the server and client certificates and returns
+// the certificates from the secrets written by cert-manager. cert-manager renews the certificates itself.
+func (r *DexServerReconciler) issueMTLSCertsWithCertManager(dexServer *authv1alpha1.DexServer, ctx context.Context) (*MTLSCerts, error) {
+	issuerRef := *dexServer.Spec.GRPCCertIssuerRef
+	if issuerRef.Kind == "" {
+		issuerRef.Kind = "Issuer"
+	}
+	if issuerRef.Group == "" {
+		issuerRef.Group = CERT_MANAGER_GROUP
+	}
+	serverDNSNames, serverIPAddresses := getGRPCServerCertNames(dexServer)
+
+	applier, readerDeploy := r.getApplierAndReader(dexServer)
+	for _, certName := range []string{SECRET_MTLS_SERVER_NAME, SECRET_MTLS_CLIENT_NAME} {
+		values := struct {
+			DexServer   *authv1alpha1.DexServer
+			Name        string
+			CommonName  string
+			DNSNames    []string
+			IPAddresses []string
+			Usages      []string
+			IssuerRef   authv1alpha1.CertManagerIssuerReference
+		}{
+			DexServer:  dexServer,
+			Name:       certName,
+			CommonName: getServiceName(dexServer.Namespace),
+			Usages:     []string{"digital signature", "key encipherment", "client auth"},
+			IssuerRef:  issuerRef,
+		}
+		if certName == SECRET_MTLS_SERVER_NAME {
+			values.DNSNames = serverDNSNames
+			for _, ip := range serverIPAddresses {
+				values.IPAddresses = append(values.IPAddresses, ip.String())
+			}
+			values.Usages = append(values.Usages, "server auth")
+		}
+		if _, err := applier.ApplyCustomResources(readerDeploy, values, false, "", "dex-server/grpc_certificate.yaml"); err != nil {
+			return nil, errors.Wrapf(err, "error applying cert-manager Certificate %s", certName)
+		}
+	}
+
+	secrets := map[string]*corev1.Secret{}
+	for _, secretName := range []string{SECRET_MTLS_SERVER_NAME, SECRET_MTLS_CLIENT_NAME} {
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: dexServer.Namespace}, secret); err != nil {
+			if !kubeerrors.IsNotFound(err) {
+				return nil, errors.Wrapf(err, "error getting secret %s", secretName)
+			}
+			return nil, &phaseWaitingError{
+				reason:       "WaitingForCertIssuance",
+				message:      fmt.Sprintf("waiting for cert-manager to issue Certificate %s", secretName),
+				requeueAfter: grpcCertRequeueInterval,
+			}
+		}
+		secrets[secretName] = secret
+	}
+
+	server, client := secrets[SECRET_MTLS_SERVER_NAME], secrets[SECRET_MTLS_CLIENT_NAME]
+	expiry, err := getCertPEMExpiry(server.Data["tls.crt"])
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading the issued gRPC server certificate")
+	}
+	return &MTLSCerts{
+		caPEM:            bytes.NewBuffer(server.Data["ca.crt"]),
+		caPrivKeyPEM:     new(bytes.Buffer),
+		certPEM:          bytes.NewBuffer(server.Data["tls.crt"]),
+		certPrivKeyPEM:   bytes.NewBuffer(server.Data["tls.key"]),
+		clientPEM:        bytes.NewBuffer(client.Data["tls.crt"]),
+		clientPrivKeyPEM: bytes.NewBuffer(client.Data["tls.key"]),
+		expiry:           expiry,
+	}, nil
+}
+
+// getGRPCServerCertNames returns the DNS names and IP addresses of the gRPC server certificate
+func getGRPCServerCertNames(dexServer *authv1alpha1.DexServer) ([]string, []net.IP) {
+	dnsNames := getGRPCServiceDNSNames(dexServer.Namespace)
+	ipAddresses := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	for _, san := range dexServer.Spec.GRPCCertSANs {
+		if ip := net.ParseIP(san); ip != nil {
+			ipAddresses = append(ipAddresses, ip)
+		} else {
+			dnsNames = append(dnsNames, san)
+		}
+	}
+	return dnsNames, ipAddresses
+}
+
+// getCertPEMExpiry returns the expiry of the first certificate of a PEM bundle
+func getCertPEMExpiry(certPEM []byte) (time.Time, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return time.Time{}, fmt.Errorf("no PEM encoded certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+const (
+	ISSUER_DISCOVERY_PATH = "/.well-known/openid-configuration"
+	// The OpenShift service CA, which signs the serving certificates of services, mounted into every pod
+	SERVICE_CA_FILE = "/var/run/secrets/kubernetes.io/serviceaccount/service-ca.crt"
+)
+
+var issuerCheckTimeout = 10 * time.Second
+
+// validateIssuer checks that the issuer is an absolute URL. The host of the issuer is the host of the Ingress or the
+// Route, so an issuer without a scheme or a host would expose dex on a blank host.
+func validateIssuer(issuer string) error {
+	if issuer == "" {
+		return errors.New("the issuer is required")
+	}
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return fmt.Errorf("the issuer %q is not a valid URL: %s", issuer, err.Error())
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("the issuer %q must be an absolute URL with a scheme and a host, such as https://dex.example.com", issuer)
+	}
+	return nil
+}
+
+// validateIssuerScheme checks that the issuer is an https URL, as OIDC requires of the issuers of production
+// deployments, or an http URL when allowHTTP is set for local and development setups. Clients refuse an insecure
+// issuer.
+func validateIssuerScheme(issuer string, allowHTTP bool) error {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return fmt.Errorf("the issuer %q is not a valid URL: %s", issuer, err.Error())
+	}
+	switch {
+	case u.Scheme == "https":
+		return nil
+	case u.Scheme == "http" && allowHTTP:
+		return nil
+	case u.Scheme == "http":
+		return fmt.Errorf("the issuer %q must be an https URL, http issuers are only allowed when the operator runs with --allow-http-issuer", issuer)
+	}
+	return fmt.Errorf("the issuer %q must be an https URL", issuer)
+}
+
+// normalizeIssuer returns the issuer with a lower case scheme, such as https://dex.example.com for
+// HTTPS://dex.example.com, so that the rendered issuer matches the URLs dex builds from it
+func normalizeIssuer(issuer string) string {
+	u, err := url.Parse(issuer)
+	if err != nil || u.Scheme == "" {
+		return issuer
+	}
+	// url.Parse lower cases the scheme, the rest of the issuer is kept as is
+	return u.Scheme + issuer[len(u.Scheme):]
+}
+
+// getIssuerPath returns the path of the issuer without a trailing slash, "" when dex is served at the root. Dex
+// serves all its endpoints below the path of its issuer, so a path-based issuer, such as https://example.com/auth,
+// is also the base path of dex behind a shared reverse proxy.
+func getIssuerPath(issuer string) string {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// getIssuerRoutePath returns the path routed to dex by the Ingress
+func getIssuerRoutePath(issuer string) string {
+	if path := getIssuerPath(issuer); path != "" {
+		return path
+	}
+	return "/"
+}
+
+// getDefaultRedirectURI returns the callback URL of dex for its upstream identity providers, used by connectors
+// that do not set a redirect URI
+func getDefaultRedirectURI(issuer string) string {
+	return strings.TrimSuffix(issuer, "/") + "/callback"
+}
+
+// getIssuerHosts returns the host of the issuer followed by the additional hosts of the DexServer, the hosts the
+// Ingress or the Routes expose dex at
+func getIssuerHosts(dexServer *authv1alpha1.DexServer) []string {
+	hosts := []string{}
+	if u, err := url.Parse(dexServer.Spec.Issuer); err == nil {
+		hosts = append(hosts, u.Host)
+	}
+	return append(hosts, dexServer.Spec.AdditionalHosts...)
+}
+
+// getCallbackURIs returns the callback URLs of dex on each of its hosts. Dex serves the same path on every host, so
+// an upstream identity provider may redirect to any of them.
+func getCallbackURIs(dexServer *authv1alpha1.DexServer) []string {
+	callback := getDefaultRedirectURI(dexServer.Spec.Issuer)
+	callbacks := []string{callback}
+	u, err := url.Parse(callback)
+	if err != nil {
+		return callbacks
+	}
+	for _, host := range dexServer.Spec.AdditionalHosts {
+		u.Host = host
+		callbacks = append(callbacks, u.String())
+	}
+	return callbacks
+}
+
+// checkIssuerReachability requests the discovery document of the issuer from within the cluster and returns
+// the resulting Available condition. Dex only accepts requests for its own issuer, so when the issuer hostname
+// does not resolve in-cluster (for example with split-horizon DNS) logins fail even though every resource applied.
+func checkIssuerReachability(ctx context.Context, issuer string, rootCAs *x509.CertPool) metav1.Condition {
+	discoveryURL := strings.TrimSuffix(issuer, "/") + ISSUER_DISCOVERY_PATH
+
+	ctx, cancel := context.WithTimeout(ctx, issuerCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return issuerUnavailableCondition("InvalidIssuer", fmt.Sprintf("unable to build discovery request for issuer %s. error: %s", issuer, err.Error()))
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:    rootCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+	client := &http.Client{Transport: transport}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			return issuerUnavailableCondition("IssuerDNSResolutionFailed", fmt.Sprintf("unable to resolve issuer host %s from within the cluster. error: %s", dnsErr.Name, err.Error()))
+		}
+		var unknownAuthorityErr x509.UnknownAuthorityError
+		if errors.As(err, &unknownAuthorityErr) {
+			return issuerUnavailableCondition("IssuerCertificateUntrusted", fmt.Sprintf("the certificate of issuer %s is not signed by a trusted CA. error: %s", issuer, err.Error()))
+		}
+		return issuerUnavailableCondition("IssuerUnreachable", fmt.Sprintf("unable to connect to issuer %s from within the cluster. error: %s", issuer, err.Error()))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return issuerUnavailableCondition("IssuerDiscoveryFailed", fmt.Sprintf("discovery endpoint %s returned status %d", discoveryURL, resp.StatusCode))
+	}
+
+	return metav1.Condition{
+		Type:    authv1alpha1.DexServerConditionTypeAvailable,
+		Status:  metav1.ConditionTrue,
+		Reason:  "IssuerReachable",
+		Message: fmt.Sprintf("issuer %s is reachable from within the cluster", issuer),
+	}
+}
+
+func issuerUnavailableCondition(reason string, message string) metav1.Condition {
+	return metav1.Condition{
+		Type:    authv1alpha1.DexServerConditionTypeAvailable,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	}
+}
+
+// getInternalRootCAs returns the CAs trusted by the operator for its calls to dex: the system roots, the CA of the
+// gRPC mTLS secret, the CA of the serving certificate secret of dex when it has one, and the OpenShift service CA.
+// Missing CAs are skipped, so that the calls fail certificate verification rather than skip it.
+func (r *DexServerReconciler) getInternalRootCAs(dexServer *authv1alpha1.DexServer, ctx context.Context) (*x509.CertPool, error) {
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil || rootCAs == nil {
+		rootCAs = x509.NewCertPool()
+	}
+
+	for _, secretName := range []string{SECRET_MTLS_NAME, getWebTLSSecretName(dexServer)} {
+		if secretName == "" {
+			continue
+		}
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: dexServer.Namespace}, secret); err != nil {
+			if kubeerrors.IsNotFound(err) {
+				continue
+			}
+			return nil, errors.Wrapf(err, "error getting the CA of secret %s", secretName)
+		}
+		if ca := secret.Data["ca.crt"]; len(ca) > 0 && !rootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("the ca.crt of secret %s does not contain a PEM encoded certificate", secretName)
+		}
+	}
+
+	serviceCA, err := ioutil.ReadFile(SERVICE_CA_FILE)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return rootCAs, nil
+		}
+		return nil, errors.Wrap(err, "error reading the service CA")
+	}
+	rootCAs.AppendCertsFromPEM(serviceCA)
+	return rootCAs, nil
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+const (
+	JWKS_CONFIGMAP_SUFFIX = "-jwks"
+	JWKS_KEY              = "keys.json"
+	JWKS_DISCOVERY_KEY    = "openid-configuration.json"
+	// Dex serves its JSON Web Key Set below the path of its issuer
+	JWKS_PATH = "/keys"
+)
+
+var (
+	// Delay before fetching the JWKS again after a failure, for example while dex is starting
+	jwksRetryInterval = 1 * time.Minute
+	// Lower bound of the refresh delay derived from the cache max-age of the JWKS, which dex sets to the time left
+	// until its next key rotation
+	jwksMinRefreshInterval = 1 * time.Minute
+)
+
+// syncJWKSConfigMap publishes the discovery document and the JWKS of dex into the ConfigMap <name>-jwks, for relying
+// parties that cannot reach dex at runtime. It returns the JWKSPublished condition, nil when publishing is disabled,
+// and the delay after which the published copy must be refreshed, 0 when no refresh is needed before the next
+// periodic reconcile.
+func (r *DexServerReconciler) syncJWKSConfigMap(dexServer *authv1alpha1.DexServer, ctx context.Context) (*metav1.Condition, time.Duration) {
+	log := ctrllog.FromContext(ctx)
+	configMapName := dexServer.Name + JWKS_CONFIGMAP_SUFFIX
+	if !dexServer.Spec.PublishJWKS {
+		err := r.KubeClient.CoreV1().ConfigMaps(dexServer.Namespace).Delete(ctx, configMapName, metav1.DeleteOptions{})
+		if err != nil && !kubeerrors.IsNotFound(err) {
+			log.Error(err, "failed to delete the JWKS ConfigMap", "ConfigMap.Name", configMapName)
+		}
+		return nil, 0
+	}
+	log.Info("syncJWKSConfigMap", "ConfigMap.Name", configMapName)
+
+	rootCAs, err := r.getInternalRootCAs(dexServer, ctx)
+	if err != nil {
+		return jwksNotPublishedCondition("IssuerCAUnavailable", err.Error()), jwksRetryInterval
+	}
+	issuer := strings.TrimSuffix(dexServer.Spec.Issuer, "/")
+	discovery, _, err := fetchIssuerDocument(ctx, issuer+ISSUER_DISCOVERY_PATH, rootCAs)
+	if err != nil {
+		return jwksNotPublishedCondition("JWKSFetchFailed", err.Error()), jwksRetryInterval
+	}
+	jwks, maxAge, err := fetchIssuerDocument(ctx, issuer+JWKS_PATH, rootCAs)
+	if err != nil {
+		return jwksNotPublishedCondition("JWKSFetchFailed", err.Error()), jwksRetryInterval
+	}
+
+	values := struct {
+		JWKSConfigMapName string
+		DiscoveryKey      string
+		Discovery         string
+		JWKSKey           string
+		JWKS              string
+		DexServer         *authv1alpha1.DexServer
+	}{
+		JWKSConfigMapName: configMapName,
+		DiscoveryKey:      JWKS_DISCOVERY_KEY,
+		Discovery:         string(discovery),
+		JWKSKey:           JWKS_KEY,
+		JWKS:              string(jwks),
+		DexServer:         dexServer,
+	}
+
+	files := []string{
+		"dex-server/jwks_config_map.yaml",
+	}
+
+	applier, readerDeploy := r.getApplierAndReader(dexServer)
+	if _, err := applier.ApplyDirectly(readerDeploy, values, false, "", files...); err != nil {
+		return jwksNotPublishedCondition("ConfigMapApplyFailed", err.Error()), jwksRetryInterval
+	}
+
+	// Refresh the published copy once dex rotates its signing keys
+	refreshAfter := time.Duration(0)
+	if maxAge > 0 {
+		refreshAfter = maxAge
+		if refreshAfter < jwksMinRefreshInterval {
+			refreshAfter = jwksMinRefreshInterval
+		}
+	}
+	return &metav1.Condition{
+		Type:    authv1alpha1.DexServerConditionTypeJWKSPublished,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Published",
+		Message: fmt.Sprintf("the JWKS of issuer %s is published in ConfigMap %s", dexServer.Spec.Issuer, configMapName),
+	}, refreshAfter
+}
+
+func jwksNotPublishedCondition(reason string, message string) *metav1.Condition {
+	return &metav1.Condition{
+		Type:    authv1alpha1.DexServerConditionTypeJWKSPublished,
+		Status:  metav1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	}
+}
+
+// fetchIssuerDocument returns the JSON document served by dex at the given URL, with the max-age of its
+// Cache-Control header, 0 when it has none
+func fetchIssuerDocument(ctx context.Context, documentURL string, rootCAs *x509.CertPool) ([]byte, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, issuerCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, documentURL, nil)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "unable to build request for %s", documentURL)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:    rootCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+	client := &http.Client{Transport: transport}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "unable to get %s", documentURL)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("%s returned status %d", documentURL, resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "unable to read %s", documentURL)
+	}
+	if !json.Valid(body) {
+		return nil, 0, fmt.Errorf("%s did not return a JSON document", documentURL)
+	}
+	return body, getCacheMaxAge(resp.Header.Get("Cache-Control")), nil
+}
+
+// getCacheMaxAge returns the max-age directive of a Cache-Control header value, 0 when it is missing or invalid
+func getCacheMaxAge(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+		seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+		if err != nil || seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	return 0
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+const (
+	// Directories of the LDAP certificates in the dex container, one subdirectory per connector id
+	LDAP_CERTS_MOUNT_PATH       = "/etc/dex/ldapcerts"
+	LDAP_CLIENT_CERT_MOUNT_PATH = "/etc/dex/ldapclientcert"
+	LDAP_CLIENT_KEY_MOUNT_PATH  = "/etc/dex/ldapclientkey"
+)
+
+// getLDAPCertVolumes returns the volumes and volume mounts of the root CA secret and of the client certificate and
+// key secrets of an LDAP connector. The client certificate and key secrets are mounted with only the referenced key,
+// as tls.crt and tls.key.
+func getLDAPCertVolumes(connector authv1alpha1.ConnectorSpec) ([]corev1.Volume, []corev1.VolumeMount) {
+	var volumes []corev1.Volume
+	var volumeMounts []corev1.VolumeMount
+	if connector.Type != authv1alpha1.ConnectorTypeLDAP {
+		return volumes, volumeMounts
+	}
+	if connector.LDAP.RootCARef.Name != "" {
+		volumes = append(volumes, corev1.Volume{
+			Name: "ldapcerts-" + connector.Id,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: connector.LDAP.RootCARef.Name,
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      "ldapcerts-" + connector.Id,
+			MountPath: LDAP_CERTS_MOUNT_PATH + "/" + connector.Id,
+		})
+	}
+	addKeyVolume := func(name string, ref *corev1.SecretKeySelector, mountPath string, path string) {
+		if ref == nil {
+			return
+		}
+		volumes = append(volumes, corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: ref.Name,
+					Items:      []corev1.KeyToPath{{Key: ref.Key, Path: path}},
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      name,
+			MountPath: mountPath,
+		})
+	}
+	addKeyVolume("ldapclientcert-"+connector.Id, connector.LDAP.ClientCertRef, LDAP_CLIENT_CERT_MOUNT_PATH+"/"+connector.Id, corev1.TLSCertKey)
+	addKeyVolume("ldapclientkey-"+connector.Id, connector.LDAP.ClientKeyRef, LDAP_CLIENT_KEY_MOUNT_PATH+"/"+connector.Id, corev1.TLSPrivateKeyKey)
+	return volumes, volumeMounts
+}
+
+// getLDAPClientCertPaths returns the paths of the client certificate and key of an LDAP connector that are
+// referenced by clientCertRef and clientKeyRef, or empty paths for the unset ones. It checks that the referenced
+// secrets have the referenced keys, which would otherwise keep the dex pods from starting.
+func (r *DexServerReconciler) getLDAPClientCertPaths(connector authv1alpha1.ConnectorSpec, dexServer *authv1alpha1.DexServer, ctx context.Context) (string, string, error) {
+	checkKey := func(ref *corev1.SecretKeySelector) error {
+		secret := &corev1.Secret{}
+		if err := r.getSecretWithTimeout(ctx, types.NamespacedName{Name: ref.Name, Namespace: dexServer.Namespace}, secret); err != nil {
+			if kubeerrors.IsNotFound(err) {
+				return &phaseFailedError{reason: "LDAPCertSecretNotFound", err: errors.Wrapf(err, "connector %s", connector.Id)}
+			}
+			return err
+		}
+		// Add label to this secret so that the secret can be watched for updates
+		checkAndAddLabelToSecret(secret, r, ctx)
+		if len(secret.Data[ref.Key]) == 0 {
+			return &phaseFailedError{
+				reason: "ConnectorSecretKeyMissing",
+				err:    fmt.Errorf("connector %s: secret %s/%s has no key %s", connector.Id, dexServer.Namespace, ref.Name, ref.Key),
+			}
+		}
+		return nil
+	}
+	var clientCertPath, clientKeyPath string
+	if ref := connector.LDAP.ClientCertRef; ref != nil {
+		if err := checkKey(ref); err != nil {
+			return "", "", err
+		}
+		clientCertPath = LDAP_CLIENT_CERT_MOUNT_PATH + "/" + connector.Id + "/" + corev1.TLSCertKey
+	}
+	if ref := connector.LDAP.ClientKeyRef; ref != nil {
+		if err := checkKey(ref); err != nil {
+			return "", "", err
+		}
+		clientKeyPath = LDAP_CLIENT_KEY_MOUNT_PATH + "/" + connector.Id + "/" + corev1.TLSPrivateKeyKey
+	}
+	return clientCertPath, clientKeyPath, nil
+}
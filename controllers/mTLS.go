@@ -13,7 +13,10 @@ import (
 	"math/big"
 	"net"
 	"os/exec"
+	"strings"
 	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 const (
@@ -44,7 +47,22 @@ func inCertRenewalWindow(expiry time.Time) bool {
 	return time.Now().Add(certRenewalWindow).After(expiry)
 }
 
-func generateMTLSCerts(ns string) (*MTLSCerts, error) {
+// validateGRPCCertSANs checks that every additional SAN of the gRPC server certificate is an IP address or a DNS name
+func validateGRPCCertSANs(sans []string) error {
+	for _, san := range sans {
+		if net.ParseIP(san) != nil {
+			continue
+		}
+		if errs := validation.IsDNS1123Subdomain(san); len(errs) > 0 {
+			if wildcardErrs := validation.IsWildcardDNS1123Subdomain(san); len(wildcardErrs) > 0 {
+				return fmt.Errorf("invalid gRPC certificate SAN %q: must be an IP address or a DNS name: %s", san, strings.Join(errs, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+func generateMTLSCerts(ns string, additionalSANs []string) (*MTLSCerts, error) {
 	// TODO(cdoan): handle the error, and put this into a function to reuse
 	now := time.Now()
 	expiry := now.Add(GetCertDuration())
@@ -92,7 +110,14 @@ func generateMTLSCerts(ns string) (*MTLSCerts, error) {
 		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
 	}
 
-	cert.DNSNames = []string{getServiceName(ns)}
+	cert.DNSNames = getGRPCServiceDNSNames(ns)
+	for _, san := range additionalSANs {
+		if ip := net.ParseIP(san); ip != nil {
+			cert.IPAddresses = append(cert.IPAddresses, ip)
+		} else {
+			cert.DNSNames = append(cert.DNSNames, san)
+		}
+	}
 
 	certPrivKey, err := rsa.GenerateKey(rand.Reader, PRIVATE_KEY_SIZE)
 	if err != nil {
@@ -199,6 +224,41 @@ func getServiceName(ns string) string {
 	return fmt.Sprintf("%s.%s.svc.cluster.local", GRPC_SERVICE_NAME, ns)
 }
 
+// getGRPCServiceDNSNames returns the DNS names of the gRPC server certificate: the names of the gRPC service, from
+// the short name to the FQDN, and localhost for clients within the dex pod
+func getGRPCServiceDNSNames(ns string) []string {
+	return []string{
+		GRPC_SERVICE_NAME,
+		fmt.Sprintf("%s.%s", GRPC_SERVICE_NAME, ns),
+		fmt.Sprintf("%s.%s.svc", GRPC_SERVICE_NAME, ns),
+		getServiceName(ns),
+		"localhost",
+	}
+}
+
+// hasGRPCServiceDNSNames returns true if the PEM encoded server certificate has all the DNS names of the gRPC
+// service. Certificates generated before these names were added only have the FQDN of the service.
+func hasGRPCServiceDNSNames(certPEM []byte, ns string) bool {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false
+	}
+	dnsNames := map[string]bool{}
+	for _, dnsName := range cert.DNSNames {
+		dnsNames[dnsName] = true
+	}
+	for _, dnsName := range getGRPCServiceDNSNames(ns) {
+		if !dnsNames[dnsName] {
+			return false
+		}
+	}
+	return true
+}
+
 func verifyCACert() error {
 	out, err := exec.Command("openssl", "verify", "-CAfile", "ca.crt", "server.crt").Output()
 	if err != nil {
@@ -0,0 +1,72 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// The managed resource synced by the phase of each condition type. The phases of other condition types always run.
+// The HorizontalPodAutoscaler scales the deployment, so it is left to the tooling managing the deployment.
+var phaseManagedResources = map[string]authv1alpha1.ManagedResource{
+	authv1alpha1.DexServerConditionTypeConfigMapReady:      authv1alpha1.ManagedResourceConfigMap,
+	authv1alpha1.DexServerConditionTypeHTTPServiceReady:    authv1alpha1.ManagedResourceService,
+	authv1alpha1.DexServerConditionTypeGRPCServiceReady:    authv1alpha1.ManagedResourceGRPCService,
+	authv1alpha1.DexServerConditionTypeServiceAccountReady: authv1alpha1.ManagedResourceServiceAccount,
+	authv1alpha1.DexServerConditionTypeDeploymentReady:     authv1alpha1.ManagedResourceDeployment,
+	authv1alpha1.DexServerConditionTypeAutoscalerReady:     authv1alpha1.ManagedResourceDeployment,
+	authv1alpha1.DexServerConditionTypeIngressReady:        authv1alpha1.ManagedResourceIngress,
+	authv1alpha1.DexServerConditionTypeRouteReady:          authv1alpha1.ManagedResourceIngress,
+}
+
+// isResourceManaged returns true when the operator syncs the resource: it is included, or no resource is, and is not
+// excluded
+func isResourceManaged(dexServer *authv1alpha1.DexServer, resource authv1alpha1.ManagedResource) bool {
+	managedResources := dexServer.Spec.ManagedResources
+	if managedResources == nil {
+		return true
+	}
+	if len(managedResources.Include) > 0 && !containsManagedResource(managedResources.Include, resource) {
+		return false
+	}
+	return !containsManagedResource(managedResources.Exclude, resource)
+}
+
+// isPhaseManaged returns true when the sync phase of a condition type runs
+func isPhaseManaged(dexServer *authv1alpha1.DexServer, conditionType string) bool {
+	resource, ok := phaseManagedResources[conditionType]
+	return !ok || isResourceManaged(dexServer, resource)
+}
+
+func containsManagedResource(resources []authv1alpha1.ManagedResource, resource authv1alpha1.ManagedResource) bool {
+	for _, r := range resources {
+		if r == resource {
+			return true
+		}
+	}
+	return false
+}
+
+// The resources that can be included or excluded from the sync
+var supportedManagedResources = []authv1alpha1.ManagedResource{
+	authv1alpha1.ManagedResourceConfigMap,
+	authv1alpha1.ManagedResourceService,
+	authv1alpha1.ManagedResourceGRPCService,
+	authv1alpha1.ManagedResourceServiceAccount,
+	authv1alpha1.ManagedResourceDeployment,
+	authv1alpha1.ManagedResourceIngress,
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clusteradmapply "open-cluster-management.io/clusteradm/pkg/helpers/apply"
+	"open-cluster-management.io/clusteradm/pkg/helpers/asset"
+)
+
+// renderedReader serves the files of a reader that are already rendered. The template of each file only prints
+// the rendered file, which is passed in the values by name, so the rendered content is never templated again.
+type renderedReader struct {
+	asset.ScenarioReader
+}
+
+func (renderedReader) Asset(name string) ([]byte, error) {
+	return []byte(fmt.Sprintf("{{ index . %q }}", name)), nil
+}
+
+// withAdditionalMetadata renders the files and merges the additional labels and annotations of the applier into
+// the metadata of each rendered object. It returns the reader, values and header file applying the merged
+// objects, or the ones given when there is nothing to merge.
+func (a *lockedApplier) withAdditionalMetadata(reader asset.ScenarioReader, values interface{}, headerFile string,
+	files ...string) (asset.ScenarioReader, interface{}, string, error) {
+	if len(a.additionalLabels) == 0 && len(a.additionalAnnotations) == 0 {
+		return reader, values, headerFile, nil
+	}
+	rendered := map[string]string{}
+	for _, name := range files {
+		out, err := a.Applier.MustTempalteAsset(reader, values, headerFile, name)
+		if err != nil {
+			// empty files are skipped by the applier, render them empty again
+			if clusteradmapply.IsEmptyAsset(err) {
+				rendered[name] = ""
+				continue
+			}
+			return nil, nil, "", err
+		}
+		obj := &unstructured.Unstructured{}
+		j, err := yaml.YAMLToJSON(out)
+		if err != nil {
+			return nil, nil, "", errors.Wrapf(err, "error converting %s to json", name)
+		}
+		if err := obj.UnmarshalJSON(j); err != nil {
+			return nil, nil, "", errors.Wrapf(err, "error decoding %s", name)
+		}
+		obj.SetLabels(mergeAdditionalMetadata(a.additionalLabels, obj.GetLabels()))
+		obj.SetAnnotations(mergeAdditionalMetadata(a.additionalAnnotations, obj.GetAnnotations()))
+		j, err = obj.MarshalJSON()
+		if err != nil {
+			return nil, nil, "", errors.Wrapf(err, "error encoding %s", name)
+		}
+		y, err := yaml.JSONToYAML(j)
+		if err != nil {
+			return nil, nil, "", errors.Wrapf(err, "error converting %s to yaml", name)
+		}
+		rendered[name] = string(y)
+	}
+	return renderedReader{reader}, rendered, "", nil
+}
+
+// mergeAdditionalMetadata returns the additional labels or annotations with the ones of the operator, which win
+// on conflict
+func mergeAdditionalMetadata(additional map[string]string, operator map[string]string) map[string]string {
+	if len(additional) == 0 {
+		return operator
+	}
+	merged := map[string]string{}
+	for k, v := range additional {
+		merged[k] = v
+	}
+	for k, v := range operator {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+const (
+	// The result label values of the reconcile counter
+	RECONCILE_RESULT_SUCCESS = "success"
+	RECONCILE_RESULT_ERROR   = "error"
+)
+
+var (
+	reconcileTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dexserver_reconcile_total",
+			Help: "Total number of DexServer reconciles by result, success or error",
+		},
+		[]string{"result"},
+	)
+	reconcileDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "dexserver_reconcile_duration_seconds",
+			Help:    "Duration of the DexServer reconciles in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+	mtlsCertExpiry = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dexserver_mtls_cert_expiry_timestamp_seconds",
+			Help: "Expiry of the gRPC mTLS server certificate of a DexServer, in seconds since the epoch",
+		},
+		[]string{"namespace", "name"},
+	)
+)
+
+// The metrics are served with the controller-runtime metrics on the metrics endpoint of the manager
+func init() {
+	metrics.Registry.MustRegister(reconcileTotal, reconcileDuration, mtlsCertExpiry)
+}
+
+// observeReconcile records the result and the duration of a reconcile started at start
+func observeReconcile(start time.Time, err error) {
+	result := RECONCILE_RESULT_SUCCESS
+	if err != nil {
+		result = RECONCILE_RESULT_ERROR
+	}
+	reconcileTotal.WithLabelValues(result).Inc()
+	reconcileDuration.Observe(time.Since(start).Seconds())
+}
+
+// setMTLSCertExpiryMetric records the expiry of the gRPC mTLS certificate of a DexServer
+func setMTLSCertExpiryMetric(dexServer *authv1alpha1.DexServer, expiry time.Time) {
+	mtlsCertExpiry.WithLabelValues(dexServer.Namespace, dexServer.Name).Set(float64(expiry.Unix()))
+}
+
+// deleteMTLSCertExpiryMetric forgets the expiry of the gRPC mTLS certificate of a deleted DexServer
+func deleteMTLSCertExpiryMetric(dexServer *authv1alpha1.DexServer) {
+	mtlsCertExpiry.DeleteLabelValues(dexServer.Namespace, dexServer.Name)
+}
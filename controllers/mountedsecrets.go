@@ -0,0 +1,78 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// Pod template annotation holding the hash of the secrets mounted into the dex container, so that a rotated
+// certificate, such as the LDAP root CA, restarts the dex pods. Dex only reads the mounted files at startup.
+const MOUNTED_SECRETS_HASH_ANNOTATION = "auth.identitatem.io/mountedSecretsHash"
+
+// getMountedSecretsHash returns the hash of the names and data of the serving certificate secret and of the secrets
+// of volumes. Missing secrets are skipped, the hash changes once they are created. The hashed secrets are labeled so
+// that their rotations, for example of the serving certificate by cert-manager, are reconciled right away. The gRPC
+// mTLS secret is rolled out through its expiry annotation instead.
+func (r *DexServerReconciler) getMountedSecretsHash(dexServer *authv1alpha1.DexServer, volumes []corev1.Volume, ctx context.Context) (string, error) {
+	secretNames := []string{}
+	if webTLSSecretName := getWebTLSSecretName(dexServer); webTLSSecretName != "" {
+		secretNames = append(secretNames, webTLSSecretName)
+	}
+	for _, volume := range volumes {
+		if volume.Secret != nil {
+			secretNames = append(secretNames, volume.Secret.SecretName)
+		}
+	}
+	sort.Strings(secretNames)
+
+	h := sha256.New()
+	for i, secretName := range secretNames {
+		if i > 0 && secretName == secretNames[i-1] {
+			continue
+		}
+		secret := &corev1.Secret{}
+		if err := r.getSecretWithTimeout(ctx, types.NamespacedName{Name: secretName, Namespace: dexServer.Namespace}, secret); err != nil {
+			if kubeerrors.IsNotFound(err) {
+				continue
+			}
+			return "", errors.Wrapf(err, "error getting mounted secret %s", secretName)
+		}
+		checkAndAddLabelToSecret(secret, r, ctx)
+		keys := []string{}
+		for key := range secret.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		h.Write([]byte(secret.Name))
+		for _, key := range keys {
+			h.Write([]byte(key))
+			h.Write(secret.Data[key])
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// reconcilePausedDexServer renders the dex config of a paused DexServer into its status and reports the Paused
+// condition. None of the resources of the DexServer are applied. A failed rendering is reported with the reason of
+// the ConfigMap sync and retried.
+func (r *DexServerReconciler) reconcilePausedDexServer(dexServer *authv1alpha1.DexServer, desiredDexServer *authv1alpha1.DexServer, ctx context.Context) (ctrl.Result, error) {
+	log := ctrllog.FromContext(ctx)
+	log.Info("DexServer is paused... render the config without applying it")
+
+	pausedCond := metav1.Condition{
+		Type:    authv1alpha1.DexServerConditionTypePaused,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Paused",
+		Message: "the resources of the DexServer are not applied while it is paused, the rendered dex config is recorded in status.renderedConfig",
+	}
+	dexConfig, _, err := r.renderDexServerConfig(desiredDexServer, ctx)
+	if err != nil {
+		log.Error(err, "failed to render the dex config of the paused DexServer")
+		reason := "ConfigMapFailed"
+		var failedErr *phaseFailedError
+		if errors.As(err, &failedErr) {
+			reason = failedErr.reason
+		}
+		dexServer.Status.RenderedConfig = ""
+		cond := metav1.Condition{
+			Type:    authv1alpha1.DexServerConditionTypeApplied,
+			Status:  metav1.ConditionFalse,
+			Reason:  reason,
+			Message: withReconcileIDMessage(ctx, fmt.Sprintf("failed to render the dex config. error: %s", err.Error())),
+		}
+		if err := updateDexServerStatusConditions(r.Client, dexServer, pausedCond, cond); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, err
+	}
+
+	dexServer.Status.RenderedConfig = string(dexConfig)
+	setNextReconcileStatus(dexServer, 0, 0)
+	cond := metav1.Condition{
+		Type:    authv1alpha1.DexServerConditionTypeApplied,
+		Status:  metav1.ConditionFalse,
+		Reason:  "Paused",
+		Message: "DexServer is paused",
+	}
+	if err := updateDexServerStatusConditions(r.Client, dexServer, pausedCond, cond); err != nil {
+		return ctrl.Result{}, err
+	}
+	// Nothing to retry until the DexServer is resumed or its rendered resources change
+	return ctrl.Result{}, nil
+}
+
+// clearPausedStatus removes the Paused condition and the rendered config of a resumed DexServer, they are removed
+// with the next status update of the reconcile
+func clearPausedStatus(dexServer *authv1alpha1.DexServer) {
+	meta.RemoveStatusCondition(&dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypePaused)
+	dexServer.Status.RenderedConfig = ""
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+const (
+	// The names of the telemetry port and of the health endpoints of dex
+	TELEMETRY_PORT_NAME  = "telemetry"
+	LIVENESS_PROBE_PATH  = "/healthz/live"
+	READINESS_PROBE_PATH = "/healthz/ready"
+
+	DEFAULT_PROBE_INITIAL_DELAY_SECONDS int32 = 10
+	DEFAULT_PROBE_PERIOD_SECONDS        int32 = 10
+	DEFAULT_PROBE_TIMEOUT_SECONDS       int32 = 5
+)
+
+// getDexProbes returns the liveness and readiness probes of the dex container. The telemetry listener of dex never
+// serves TLS, so the probes use HTTP whatever the web TLS of the issuer.
+func getDexProbes(dexServer *authv1alpha1.DexServer) (*corev1.Probe, *corev1.Probe) {
+	initialDelaySeconds := DEFAULT_PROBE_INITIAL_DELAY_SECONDS
+	periodSeconds := DEFAULT_PROBE_PERIOD_SECONDS
+	timeoutSeconds := DEFAULT_PROBE_TIMEOUT_SECONDS
+	if probes := dexServer.Spec.Probes; probes != nil {
+		if probes.InitialDelaySeconds != nil {
+			initialDelaySeconds = *probes.InitialDelaySeconds
+		}
+		if probes.PeriodSeconds != nil {
+			periodSeconds = *probes.PeriodSeconds
+		}
+		if probes.TimeoutSeconds != nil {
+			timeoutSeconds = *probes.TimeoutSeconds
+		}
+	}
+	newProbe := func(path string) *corev1.Probe {
+		return &corev1.Probe{
+			Handler: corev1.Handler{
+				HTTPGet: &corev1.HTTPGetAction{
+					Path:   path,
+					Port:   intstr.FromString(TELEMETRY_PORT_NAME),
+					Scheme: corev1.URISchemeHTTP,
+				},
+			},
+			InitialDelaySeconds: initialDelaySeconds,
+			PeriodSeconds:       periodSeconds,
+			TimeoutSeconds:      timeoutSeconds,
+		}
+	}
+	return newProbe(LIVENESS_PROBE_PATH), newProbe(READINESS_PROBE_PATH)
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"io"
+)
+
+// Printed in place of the value of a secretString
+const REDACTED = "***"
+
+// secretString holds a credential read from a secret, such as a connector client secret or bind password. It is
+// printed as *** whatever the format verb, and logged as *** as a fmt.Stringer or through MarshalLog, so that
+// passing it to a logger or an error by mistake does not leak the credential. Reveal returns the credential, only
+// call it where the credential is rendered or sent to dex.
+type secretString string
+
+// Reveal returns the credential
+func (s secretString) Reveal() string {
+	return string(s)
+}
+
+func (s secretString) String() string {
+	return REDACTED
+}
+
+func (s secretString) GoString() string {
+	return REDACTED
+}
+
+// Format redacts the verbs that do not call String, such as %q, %x and %#v
+func (s secretString) Format(f fmt.State, verb rune) {
+	_, _ = io.WriteString(f, REDACTED)
+}
+
+func (s secretString) MarshalLog() interface{} {
+	return REDACTED
+}
+
+// MarshalJSON redacts the credential in the structured logs of the JSON encoders
+func (s secretString) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + REDACTED + `"`), nil
+}
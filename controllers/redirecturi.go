@@ -0,0 +1,119 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// getConnectorRedirectURIs returns the redirect URIs set on the connectors, by connector id. Connectors without a
+// redirect URI use the callback of dex.
+func getConnectorRedirectURIs(dexServer *authv1alpha1.DexServer) map[string]string {
+	redirectURIs := map[string]string{}
+	for _, connector := range dexServer.Spec.Connectors {
+		redirectURI := ""
+		switch connector.Type {
+		case authv1alpha1.ConnectorTypeGitHub:
+			redirectURI = connector.GitHub.RedirectURI
+		case authv1alpha1.ConnectorTypeMicrosoft:
+			redirectURI = connector.Microsoft.RedirectURI
+		case authv1alpha1.ConnectorTypeGoogle:
+			redirectURI = connector.Google.RedirectURI
+		}
+		// Connectors configured by rawConfig only may set it there
+		if raw, found := connector.RawConfig["redirectURI"]; found {
+			_ = json.Unmarshal(raw.Raw, &redirectURI)
+		}
+		if redirectURI != "" {
+			redirectURIs[connector.Id] = redirectURI
+		}
+	}
+	return redirectURIs
+}
+
+// getRedirectURIsCondition cross-checks the redirect URIs of the connectors of the DexServer and of the DexClients
+// of its namespace. Upstream identity providers redirect to the callback of dex, on the host of the issuer or on one
+// of the additional hosts, so a connector redirect URI other than a callback breaks the login, and so does a
+// DexClient registering a callback of dex as its own redirect URI.
+func (r *DexServerReconciler) getRedirectURIsCondition(dexServer *authv1alpha1.DexServer, ctx context.Context) (metav1.Condition, error) {
+	callback := getDefaultRedirectURI(dexServer.Spec.Issuer)
+	callbacks := map[string]bool{}
+	for _, callbackURI := range getCallbackURIs(dexServer) {
+		callbacks[callbackURI] = true
+	}
+	mismatches := []string{}
+
+	connectorRedirectURIs := getConnectorRedirectURIs(dexServer)
+	for _, connector := range dexServer.Spec.Connectors {
+		if redirectURI, found := connectorRedirectURIs[connector.Id]; found && !callbacks[redirectURI] {
+			mismatches = append(mismatches, fmt.Sprintf("connector %s redirects to %s instead of the dex callback %s", connector.Id, redirectURI, callback))
+		}
+	}
+
+	dexClients := &authv1alpha1.DexClientList{}
+	if err := r.List(ctx, dexClients, client.InNamespace(dexServer.Namespace)); err != nil {
+		return metav1.Condition{}, err
+	}
+	for _, dexClient := range dexClients.Items {
+		for _, redirectURI := range dexClient.Spec.RedirectURIs {
+			if callbacks[redirectURI] {
+				mismatches = append(mismatches, fmt.Sprintf("DexClient %s registers the dex callback %s as its redirect URI", dexClient.Name, redirectURI))
+			}
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return metav1.Condition{
+			Type:    authv1alpha1.DexServerConditionTypeRedirectURIsConsistent,
+			Status:  metav1.ConditionFalse,
+			Reason:  "RedirectURIMismatch",
+			Message: strings.Join(mismatches, "; "),
+		}, nil
+	}
+	return metav1.Condition{
+		Type:    authv1alpha1.DexServerConditionTypeRedirectURIsConsistent,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Consistent",
+		Message: "the connectors and DexClients use consistent redirect URIs",
+	}, nil
+}
+
+// mapDexClientToDexServers maps a DexClient to the DexServers of its namespace, whose redirect URIs are cross-checked
+// with it
+func (r *DexServerReconciler) mapDexClientToDexServers(o client.Object) []reconcile.Request {
+	dexServers := &authv1alpha1.DexServerList{}
+	if err := r.List(context.TODO(), dexServers, client.InNamespace(o.GetNamespace())); err != nil {
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, dexServer := range dexServers.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: dexServer.Name, Namespace: dexServer.Namespace},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// The revision of a deployment, set on the deployment and on the ReplicaSets of each of its revisions
+const DEPLOYMENT_REVISION_ANNOTATION = "deployment.kubernetes.io/revision"
+
+// pruneStaleReplicaSets deletes the ReplicaSets of the dex deployment that are scaled down to zero and older than
+// StaleReplicaSetMaxAge. Only the ReplicaSets controlled by the deployment are considered, never the one of its
+// current revision, and only once the deployment rolled out, so that a rollout in progress keeps all its ReplicaSets.
+func (r *DexServerReconciler) pruneStaleReplicaSets(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	if r.StaleReplicaSetMaxAge <= 0 {
+		return nil
+	}
+	log := ctrllog.FromContext(ctx)
+
+	deployment, err := r.KubeClient.AppsV1().Deployments(dexServer.Namespace).Get(ctx, dexServer.Name, metav1.GetOptions{})
+	if err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, "error getting dex server deployment")
+	}
+	if !isDeploymentRolledOut(deployment) || deployment.Spec.Selector == nil {
+		return nil
+	}
+
+	replicaSets, err := r.KubeClient.AppsV1().ReplicaSets(dexServer.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(deployment.Spec.Selector.MatchLabels).String(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "error listing the ReplicaSets of the dex server deployment")
+	}
+	for i := range replicaSets.Items {
+		replicaSet := &replicaSets.Items[i]
+		if !isStaleReplicaSet(replicaSet, deployment, r.StaleReplicaSetMaxAge) {
+			continue
+		}
+		log.Info("deleting stale ReplicaSet", "ReplicaSet.Name", replicaSet.Name, "revision", replicaSet.Annotations[DEPLOYMENT_REVISION_ANNOTATION])
+		uid := replicaSet.UID
+		err := r.KubeClient.AppsV1().ReplicaSets(dexServer.Namespace).Delete(ctx, replicaSet.Name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &uid},
+		})
+		if err != nil && !kubeerrors.IsNotFound(err) {
+			return errors.Wrapf(err, "error deleting stale ReplicaSet %s", replicaSet.Name)
+		}
+	}
+	return nil
+}
+
+// isStaleReplicaSet returns true for a ReplicaSet of a previous revision of the deployment, without replicas and
+// older than maxAge
+func isStaleReplicaSet(replicaSet *appsv1.ReplicaSet, deployment *appsv1.Deployment, maxAge time.Duration) bool {
+	owner := metav1.GetControllerOf(replicaSet)
+	if owner == nil || owner.Kind != "Deployment" || owner.UID != deployment.UID {
+		return false
+	}
+	if replicaSet.Annotations[DEPLOYMENT_REVISION_ANNOTATION] == deployment.Annotations[DEPLOYMENT_REVISION_ANNOTATION] {
+		return false
+	}
+	if replicaSet.Spec.Replicas == nil || *replicaSet.Spec.Replicas != 0 || replicaSet.Status.Replicas != 0 {
+		return false
+	}
+	return time.Since(replicaSet.CreationTimestamp.Time) > maxAge
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// The default timeout of each read of a secret referenced by a DexServer
+	DEFAULT_SECRET_FETCH_TIMEOUT = 10 * time.Second
+	// The failed reason of a sync phase whose secret read timed out
+	SECRET_FETCH_TIMEOUT_REASON = "SecretFetchTimeout"
+)
+
+func (r *DexServerReconciler) getSecretFetchTimeout() time.Duration {
+	if r.SecretFetchTimeout <= 0 {
+		return DEFAULT_SECRET_FETCH_TIMEOUT
+	}
+	return r.SecretFetchTimeout
+}
+
+// getSecretWithTimeout reads a secret referenced by a DexServer, such as a connector credential, within the secret
+// fetch timeout so that a slow API server does not block the reconcile. A timeout is returned as a phaseFailedError
+// with the SecretFetchTimeout reason and is retried with the reconcile backoff.
+func (r *DexServerReconciler) getSecretWithTimeout(ctx context.Context, key types.NamespacedName, secret *corev1.Secret) error {
+	timeout := r.getSecretFetchTimeout()
+	fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := r.Get(fetchCtx, key, secret)
+	if err != nil && errors.Is(fetchCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		return &phaseFailedError{
+			reason: SECRET_FETCH_TIMEOUT_REASON,
+			err:    errors.Wrapf(err, "timed out after %s reading secret %s/%s", timeout, key.Namespace, key.Name),
+		}
+	}
+	return err
+}
+
+// isSecretFetchTimeout returns true if err is a timed out secret read
+func isSecretFetchTimeout(err error) bool {
+	var failedErr *phaseFailedError
+	return errors.As(err, &failedErr) && failedErr.reason == SECRET_FETCH_TIMEOUT_REASON
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// generatedResource describes a resource generated for every DexServer, whose deletion is repaired by a reconcile
+type generatedResource struct {
+	kind   string
+	object client.Object
+	// name returns the name of the resource generated for the DexServer
+	name func(dexServer *authv1alpha1.DexServer) string
+}
+
+func dexServerName(dexServer *authv1alpha1.DexServer) string {
+	return dexServer.Name
+}
+
+// generatedResources are the resources every DexServer needs. Optional resources, such as the CA bundle ConfigMap,
+// the storage RBAC, whose scope can change, and the Route and PodDisruptionBudget, whose API is not served by every
+// cluster, are also deleted by the reconcile and are not listed.
+var generatedResources = []generatedResource{
+	{"ConfigMap", &corev1.ConfigMap{}, dexServerName},
+	{"Service", &corev1.Service{}, dexServerName},
+	{"Service", &corev1.Service{}, func(*authv1alpha1.DexServer) string { return GRPC_SERVICE_NAME }},
+	{"ServiceAccount", &corev1.ServiceAccount{}, func(*authv1alpha1.DexServer) string { return SERVICE_ACCOUNT_NAME }},
+	{"Secret", &corev1.Secret{}, func(*authv1alpha1.DexServer) string { return SECRET_MTLS_NAME }},
+	{"Deployment", &appsv1.Deployment{}, dexServerName},
+	{"Ingress", &networkingv1.Ingress{}, dexServerName},
+}
+
+// deletedResourcePredicate only lets deletions through
+func deletedResourcePredicate() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc:  func(event.CreateEvent) bool { return false },
+		UpdateFunc:  func(event.UpdateEvent) bool { return false },
+		DeleteFunc:  func(event.DeleteEvent) bool { return true },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
+
+// watchDeletedResources reconciles the DexServers of a deleted generated resource right away. The Owns watches only
+// map resources to their controller, so without it the deletion of a resource generated with the owner or none
+// owner reference mode is only repaired on the periodic reconcile.
+func (r *DexServerReconciler) watchDeletedResources(b *builder.Builder) *builder.Builder {
+	watched := map[string]bool{}
+	for _, resource := range generatedResources {
+		if watched[resource.kind] {
+			continue
+		}
+		watched[resource.kind] = true
+		b = b.Watches(&source.Kind{Type: resource.object},
+			handler.EnqueueRequestsFromMapFunc(r.mapDeletedResource(resource.kind)),
+			builder.WithPredicates(deletedResourcePredicate()))
+	}
+	return b
+}
+
+// mapDeletedResource returns the handler mapping a deleted resource of the given kind to the DexServers it was
+// generated for, and records the self-healing on each of them
+func (r *DexServerReconciler) mapDeletedResource(kind string) handler.MapFunc {
+	return func(o client.Object) []reconcile.Request {
+		log := ctrl.Log.WithName("controllers").WithName("dexserver").WithName("selfHealing")
+		dexServers := &authv1alpha1.DexServerList{}
+		if err := r.List(context.TODO(), dexServers, client.InNamespace(o.GetNamespace())); err != nil {
+			log.Error(err, "failed to list the DexServers of a deleted resource", "kind", kind, "namespace", o.GetNamespace(), "name", o.GetName())
+			return nil
+		}
+
+		requests := []reconcile.Request{}
+		for i := range dexServers.Items {
+			dexServer := &dexServers.Items[i]
+			if !dexServer.DeletionTimestamp.IsZero() || !isGeneratedResource(kind, o.GetName(), dexServer) {
+				continue
+			}
+			log.Info("generated resource deleted, recreating it", "kind", kind, "namespace", o.GetNamespace(), "name", o.GetName(), "DexServer.Name", dexServer.Name)
+			r.recordEvent(dexServer, corev1.EventTypeNormal, "ResourceRecreated", "%s %s was deleted and is recreated", kind, o.GetName())
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: dexServer.Name, Namespace: dexServer.Namespace},
+			})
+		}
+		return requests
+	}
+}
+
+// isGeneratedResource returns true when the resource of the given kind and name is generated for the DexServer
+func isGeneratedResource(kind string, name string, dexServer *authv1alpha1.DexServer) bool {
+	for _, resource := range generatedResources {
+		if resource.kind == kind && resource.name(dexServer) == name {
+			return true
+		}
+	}
+	return false
+}
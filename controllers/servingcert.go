@@ -0,0 +1,90 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// The default time the serving certificate secret may take to appear
+const DEFAULT_SERVING_CERT_TIMEOUT = 10 * time.Minute
+
+func (r *DexServerReconciler) getServingCertTimeout() time.Duration {
+	if r.ServingCertTimeout <= 0 {
+		return DEFAULT_SERVING_CERT_TIMEOUT
+	}
+	return r.ServingCertTimeout
+}
+
+// getServingCertCondition returns the Degraded condition of the serving certificate secret generated by the OpenShift
+// service CA, or nil when webTLS references a secret or disables TLS. The condition is unknown from the first
+// reconcile that misses the secret, and true once the secret is still missing after the serving certificate timeout,
+// when a warning event is also recorded. Without the secret the dex pods cannot start.
+func (r *DexServerReconciler) getServingCertCondition(dexServer *authv1alpha1.DexServer, ctx context.Context) (*metav1.Condition, error) {
+	if !isServingCertGenerated(dexServer) {
+		return nil, nil
+	}
+	secretName := getWebTLSSecretName(dexServer)
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: dexServer.Namespace}, secret); err == nil {
+		return &metav1.Condition{
+			Type:    authv1alpha1.DexServerConditionTypeDegraded,
+			Status:  metav1.ConditionFalse,
+			Reason:  "ServingCertAvailable",
+			Message: fmt.Sprintf("the serving certificate secret %s exists", secretName),
+		}, nil
+	} else if !kubeerrors.IsNotFound(err) {
+		return nil, errors.Wrapf(err, "error getting the serving certificate secret %s", secretName)
+	}
+
+	// The unknown condition records since when the secret is awaited
+	timeout := r.getServingCertTimeout()
+	previous := meta.FindStatusCondition(dexServer.Status.Conditions, authv1alpha1.DexServerConditionTypeDegraded)
+	if previous == nil || previous.Status == metav1.ConditionFalse || time.Since(previous.LastTransitionTime.Time) < timeout {
+		return &metav1.Condition{
+			Type:    authv1alpha1.DexServerConditionTypeDegraded,
+			Status:  metav1.ConditionUnknown,
+			Reason:  "WaitingForServingCert",
+			Message: fmt.Sprintf("waiting for the OpenShift service CA to generate the serving certificate secret %s", secretName),
+		}, nil
+	}
+
+	if previous.Status != metav1.ConditionTrue {
+		r.recordEvent(dexServer, corev1.EventTypeWarning, "ServingCertMissing",
+			"The serving certificate secret %s did not appear within %s", secretName, timeout)
+	}
+	return &metav1.Condition{
+		Type:   authv1alpha1.DexServerConditionTypeDegraded,
+		Status: metav1.ConditionTrue,
+		Reason: "ServingCertMissing",
+		Message: fmt.Sprintf("the serving certificate secret %s did not appear within %s, so the dex pods cannot start. "+
+			"Check that the Service %s has the service.beta.openshift.io/serving-cert-secret-name annotation and that "+
+			"the OpenShift service-ca operator is running, or set spec.webTLS.secretName to an existing secret",
+			secretName, timeout, dexServer.Name),
+	}, nil
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// The termination grace period of the pods when none is set, the kubernetes default
+const DEFAULT_TERMINATION_GRACE_PERIOD_SECONDS int64 = 30
+
+// getTerminationGracePeriodSeconds returns the termination grace period of the dex pods, or "" to keep the cluster
+// default
+func getTerminationGracePeriodSeconds(dexServer *authv1alpha1.DexServer) string {
+	if dexServer.Spec.TerminationGracePeriodSeconds == nil {
+		return ""
+	}
+	return strconv.FormatInt(*dexServer.Spec.TerminationGracePeriodSeconds, 10)
+}
+
+// getDexLifecycle returns the lifecycle of the dex container, with a preStop hook sleeping for preStopSleepSeconds,
+// or nil when none is set
+func getDexLifecycle(dexServer *authv1alpha1.DexServer) *corev1.Lifecycle {
+	if dexServer.Spec.PreStopSleepSeconds == nil {
+		return nil
+	}
+	return &corev1.Lifecycle{
+		PreStop: &corev1.Handler{
+			Exec: &corev1.ExecAction{
+				Command: []string{"sleep", strconv.Itoa(int(*dexServer.Spec.PreStopSleepSeconds))},
+			},
+		},
+	}
+}
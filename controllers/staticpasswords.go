@@ -0,0 +1,97 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// The keys of a static password secret
+var staticPasswordKeys = []string{"email", "hash", "username", "userID"}
+
+// DexStaticPassword is a rendered static user of the dex password database
+type DexStaticPassword struct {
+	Email    string `json:"email"`
+	Hash     string `json:"hash"`
+	Username string `json:"username"`
+	UserID   string `json:"userID"`
+}
+
+// getStaticPasswords reads the static users of the DexServer from their secrets, which are labeled so that their
+// updates are reconciled. The password hashes are secrets and are never logged.
+func (r *DexServerReconciler) getStaticPasswords(dexServer *authv1alpha1.DexServer, ctx context.Context) ([]DexStaticPassword, error) {
+	log := ctrllog.FromContext(ctx)
+	staticPasswords := []DexStaticPassword{}
+	for i, staticPassword := range dexServer.Spec.StaticPasswords {
+		fldPath := field.NewPath("spec", "staticPasswords").Index(i).Child("secretRef")
+		secretRef := staticPassword.SecretRef
+		if secretRef.Namespace == "" {
+			secretRef.Namespace = dexServer.Namespace
+		}
+		if err := r.checkSecretNamespaceAllowed(dexServer, secretRef.Namespace); err != nil {
+			return nil, &phaseFailedError{reason: "SecretNamespaceNotAllowed", err: err}
+		}
+
+		secret := &corev1.Secret{}
+		if err := r.getSecretWithTimeout(ctx, types.NamespacedName{Name: secretRef.Name, Namespace: secretRef.Namespace}, secret); err != nil {
+			if isSecretFetchTimeout(err) {
+				return nil, err
+			}
+			if kubeerrors.IsNotFound(err) {
+				return nil, &phaseFailedError{reason: "StaticPasswordSecretNotFound", err: errors.Wrapf(err, "%s", fldPath)}
+			}
+			return nil, errors.Wrapf(err, "error getting static password secret %s/%s", secretRef.Namespace, secretRef.Name)
+		}
+		checkAndAddLabelToSecret(secret, r, ctx)
+
+		allErrs := field.ErrorList{}
+		for _, key := range staticPasswordKeys {
+			if len(secret.Data[key]) == 0 {
+				allErrs = append(allErrs, field.Required(fldPath, "the secret "+secretRef.Name+" must have the "+key+" key"))
+			}
+		}
+		if len(secret.Data["hash"]) > 0 {
+			allErrs = append(allErrs, validateBcryptHash(fldPath, string(secret.Data["hash"]))...)
+		}
+		if len(allErrs) > 0 {
+			return nil, &phaseFailedError{reason: "InvalidStaticPassword", err: allErrs.ToAggregate()}
+		}
+
+		log.V(1).Info("resolved static password", "Secret.Namespace", secretRef.Namespace, "Secret.Name", secretRef.Name, "email", string(secret.Data["email"]))
+		hash := string(secret.Data["hash"])
+		// The config of a paused DexServer is recorded in its status
+		if dexServer.Spec.Paused {
+			hash = REDACTED
+		}
+		staticPasswords = append(staticPasswords, DexStaticPassword{
+			Email:    string(secret.Data["email"]),
+			Hash:     hash,
+			Username: string(secret.Data["username"]),
+			UserID:   string(secret.Data["userID"]),
+		})
+	}
+	return staticPasswords, nil
+}
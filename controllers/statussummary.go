@@ -0,0 +1,93 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// The path of the DexServer status summary, served next to the metrics of the manager
+const DEX_SERVER_STATUS_PATH = "/dexservers"
+
+// DexServerStatusSummary summarizes the reconcile state of all the DexServers
+type DexServerStatusSummary struct {
+	// Number of DexServers
+	DexServers int `json:"dexServers"`
+	// Number of DexServers being deleted
+	Deleting int `json:"deleting"`
+	// Number of DexServers whose status does not reflect their latest generation yet
+	Pending int `json:"pending"`
+	// Number of DexServers by condition type and condition status
+	Conditions map[string]map[metav1.ConditionStatus]int `json:"conditions"`
+}
+
+// NewDexServerStatusHandler returns a handler serving the DexServerStatusSummary of the DexServers read from reader.
+// It is meant to be served by the metrics server of the manager, so that it is protected like the metrics are.
+func NewDexServerStatusHandler(reader client.Reader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		summary, err := getDexServerStatusSummary(req.Context(), reader)
+		if err != nil {
+			ctrllog.FromContext(req.Context()).Error(err, "failed to summarize the DexServer status")
+			http.Error(w, "failed to list the DexServers", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(summary); err != nil {
+			ctrllog.FromContext(req.Context()).Error(err, "failed to write the DexServer status summary")
+		}
+	})
+}
+
+// getDexServerStatusSummary counts the DexServers by condition
+func getDexServerStatusSummary(ctx context.Context, reader client.Reader) (*DexServerStatusSummary, error) {
+	dexServers := &authv1alpha1.DexServerList{}
+	if err := reader.List(ctx, dexServers); err != nil {
+		return nil, err
+	}
+	summary := &DexServerStatusSummary{
+		DexServers: len(dexServers.Items),
+		Conditions: map[string]map[metav1.ConditionStatus]int{},
+	}
+	for _, dexServer := range dexServers.Items {
+		if dexServer.DeletionTimestamp != nil {
+			summary.Deleting++
+		}
+		if dexServer.Status.ObservedGeneration < dexServer.Generation {
+			summary.Pending++
+		}
+		for _, condition := range dexServer.Status.Conditions {
+			if summary.Conditions[condition.Type] == nil {
+				summary.Conditions[condition.Type] = map[metav1.ConditionStatus]int{}
+			}
+			summary.Conditions[condition.Type][condition.Status]++
+		}
+	}
+	return summary, nil
+}
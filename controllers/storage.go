@@ -0,0 +1,200 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+const (
+	// Pod template annotation holding the hash of the storage password secret, so that a new password restarts
+	// the dex pods
+	STORAGE_SECRET_HASH_ANNOTATION = "auth.identitatem.io/storageSecretHash"
+	// Environment variable of the dex container holding the Postgres password, expanded by dex in its config
+	POSTGRES_PASSWORD_ENV_NAME = "DEX_STORAGE_POSTGRES_PASSWORD"
+	// Mount path of the CA of the Postgres server
+	POSTGRES_CA_MOUNT_PATH = "/etc/dex/postgres"
+	POSTGRES_DEFAULT_PORT  = 5432
+	// Default key of the password in the Postgres password secret
+	POSTGRES_DEFAULT_PASSWORD_KEY = "password"
+)
+
+// DexStorageSpec is the storage section of the dex config
+type DexStorageSpec struct {
+	Type   string      `json:"type"`
+	Config interface{} `json:"config"`
+}
+
+// DexPostgresStorageConfig is the config of the dex Postgres storage
+type DexPostgresStorageConfig struct {
+	Host     string                `json:"host"`
+	Port     int32                 `json:"port"`
+	Database string                `json:"database"`
+	User     string                `json:"user"`
+	Password string                `json:"password"`
+	SSL      *DexPostgresSSLConfig `json:"ssl,omitempty"`
+}
+
+// DexPostgresSSLConfig is the TLS config of the dex Postgres storage
+type DexPostgresSSLConfig struct {
+	Mode   string `json:"mode,omitempty"`
+	CAFile string `json:"caFile,omitempty"`
+}
+
+// getStorageType returns the storage backend of dex, defaulting to the kubernetes storage
+func getStorageType(dexServer *authv1alpha1.DexServer) authv1alpha1.StorageType {
+	if dexServer.Spec.Storage == nil || dexServer.Spec.Storage.Type == "" {
+		return authv1alpha1.StorageTypeKubernetes
+	}
+	return dexServer.Spec.Storage.Type
+}
+
+func getPostgresPasswordKey(postgres *authv1alpha1.PostgresStorageSpec) string {
+	if postgres.PasswordKey == "" {
+		return POSTGRES_DEFAULT_PASSWORD_KEY
+	}
+	return postgres.PasswordKey
+}
+
+// getPostgresPasswordSecret returns the secret holding the Postgres password, labeled so that its changes are
+// reconciled
+func (r *DexServerReconciler) getPostgresPasswordSecret(dexServer *authv1alpha1.DexServer, ctx context.Context) (*corev1.Secret, error) {
+	postgres := dexServer.Spec.Storage.Postgres
+	secret := &corev1.Secret{}
+	if err := r.getSecretWithTimeout(ctx, types.NamespacedName{Name: postgres.PasswordRef.Name, Namespace: dexServer.Namespace}, secret); err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return nil, &phaseFailedError{reason: "StorageSecretNotFound", err: err}
+		}
+		return nil, err
+	}
+	checkAndAddLabelToSecret(secret, r, ctx)
+	if key := getPostgresPasswordKey(postgres); len(secret.Data[key]) == 0 {
+		return nil, &phaseFailedError{
+			reason: "StorageSecretKeyMissing",
+			err:    fmt.Errorf("the storage secret %s/%s has no key %s", secret.Namespace, secret.Name, key),
+		}
+	}
+	return secret, nil
+}
+
+// getStorageYaml returns the storage section of the dex config, or nothing for the default kubernetes storage. The
+// Postgres password is a reference to the environment variable populated from its secret.
+func (r *DexServerReconciler) getStorageYaml(dexServer *authv1alpha1.DexServer, ctx context.Context) ([]byte, error) {
+	if getStorageType(dexServer) != authv1alpha1.StorageTypePostgres {
+		return nil, nil
+	}
+	postgres := dexServer.Spec.Storage.Postgres
+	if _, err := r.getPostgresPasswordSecret(dexServer, ctx); err != nil {
+		return nil, err
+	}
+	config := DexPostgresStorageConfig{
+		Host:     postgres.Host,
+		Port:     POSTGRES_DEFAULT_PORT,
+		Database: postgres.Database,
+		User:     postgres.User,
+		Password: "$" + POSTGRES_PASSWORD_ENV_NAME,
+	}
+	if postgres.Port != nil {
+		config.Port = *postgres.Port
+	}
+	if ssl := postgres.SSL; ssl != nil {
+		config.SSL = &DexPostgresSSLConfig{Mode: ssl.Mode}
+		if ssl.CARef.Name != "" {
+			config.SSL.CAFile = POSTGRES_CA_MOUNT_PATH + "/ca.crt"
+		}
+	}
+	return yaml.Marshal(&struct {
+		Storage DexStorageSpec `json:"storage"`
+	}{
+		Storage: DexStorageSpec{Type: string(authv1alpha1.StorageTypePostgres), Config: config},
+	})
+}
+
+// getStorageEnvVars returns the dex container environment variables populated from the storage secrets
+func getStorageEnvVars(dexServer *authv1alpha1.DexServer) []corev1.EnvVar {
+	if getStorageType(dexServer) != authv1alpha1.StorageTypePostgres {
+		return nil
+	}
+	postgres := dexServer.Spec.Storage.Postgres
+	return []corev1.EnvVar{{
+		Name: POSTGRES_PASSWORD_ENV_NAME,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: postgres.PasswordRef,
+				Key:                  getPostgresPasswordKey(postgres),
+			},
+		},
+	}}
+}
+
+// getStorageVolumes returns the volumes and mounts of the dex container for the CA of the Postgres server
+func getStorageVolumes(dexServer *authv1alpha1.DexServer) ([]corev1.Volume, []corev1.VolumeMount) {
+	if getStorageType(dexServer) != authv1alpha1.StorageTypePostgres {
+		return nil, nil
+	}
+	ssl := dexServer.Spec.Storage.Postgres.SSL
+	if ssl == nil || ssl.CARef.Name == "" {
+		return nil, nil
+	}
+	volume := corev1.Volume{
+		Name: "postgres-ca",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: ssl.CARef.Name},
+		},
+	}
+	volumeMount := corev1.VolumeMount{
+		Name:      "postgres-ca",
+		MountPath: POSTGRES_CA_MOUNT_PATH,
+		ReadOnly:  true,
+	}
+	return []corev1.Volume{volume}, []corev1.VolumeMount{volumeMount}
+}
+
+// getStorageSecretHash returns the hash of the name and data of the storage password secret. The password is not
+// part of the dex config, so its changes are rolled out through this hash on the pod template.
+func (r *DexServerReconciler) getStorageSecretHash(dexServer *authv1alpha1.DexServer, ctx context.Context) (string, error) {
+	if getStorageType(dexServer) != authv1alpha1.StorageTypePostgres {
+		return "", nil
+	}
+	secret, err := r.getPostgresPasswordSecret(dexServer, ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "error getting the storage secret")
+	}
+	keys := []string{}
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	h.Write([]byte(secret.Name))
+	for _, key := range keys {
+		h.Write([]byte(key))
+		h.Write(secret.Data[key])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// Id of the dex connector of the password database, which is always enabled
+const PASSWORD_DB_CONNECTOR_ID = "local"
+
+// The dex kubernetes storage resources tied to a connector, with the field holding the connector id
+var dexConnectorStorageResources = []struct {
+	gvr              schema.GroupVersionResource
+	connectorIDField string
+}{
+	{schema.GroupVersionResource{Group: "dex.coreos.com", Version: "v1", Resource: "offlinesessionses"}, "connID"},
+	{schema.GroupVersionResource{Group: "dex.coreos.com", Version: "v1", Resource: "refreshtokens"}, "connectorID"},
+}
+
+// cleanupOrphanedConnectorStorage deletes the OfflineSessions and RefreshTokens that dex stored in the namespace of
+// the DexServer for connectors that were removed, when CleanupOrphanedConnectorStorage is set. Dex shares its
+// kubernetes storage between the DexServers of a namespace, so the connectors of all of them are kept. It waits for
+// the deployment to roll out, so that no dex pod still serves a removed connector, and reports the number of
+// deleted objects in an event.
+func (r *DexServerReconciler) cleanupOrphanedConnectorStorage(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	if !r.CleanupOrphanedConnectorStorage || getStorageType(dexServer) != authv1alpha1.StorageTypeKubernetes {
+		return nil
+	}
+	log := ctrllog.FromContext(ctx)
+
+	deployment, err := r.KubeClient.AppsV1().Deployments(dexServer.Namespace).Get(ctx, dexServer.Name, metav1.GetOptions{})
+	if err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrap(err, "error getting dex server deployment")
+	}
+	if !isDeploymentRolledOut(deployment) {
+		return nil
+	}
+
+	connectorIDs, err := r.getNamespaceConnectorIDs(dexServer.Namespace, ctx)
+	if err != nil {
+		return err
+	}
+
+	deleted := 0
+	removedConnectorIDs := map[string]bool{}
+	for _, resource := range dexConnectorStorageResources {
+		list, err := r.DynamicClient.Resource(resource.gvr).Namespace(dexServer.Namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			// The storage CRDs are only registered once dex started
+			if kubeerrors.IsNotFound(err) {
+				continue
+			}
+			return errors.Wrapf(err, "error listing the dex %s", resource.gvr.Resource)
+		}
+		for i := range list.Items {
+			item := &list.Items[i]
+			connectorID, _, _ := unstructured.NestedString(item.Object, resource.connectorIDField)
+			if connectorID == "" || connectorIDs[connectorID] {
+				continue
+			}
+			log.Info("deleting orphaned dex storage object", "resource", resource.gvr.Resource, "name", item.GetName(), "connector", connectorID)
+			uid := item.GetUID()
+			err := r.DynamicClient.Resource(resource.gvr).Namespace(dexServer.Namespace).Delete(ctx, item.GetName(), metav1.DeleteOptions{
+				Preconditions: &metav1.Preconditions{UID: &uid},
+			})
+			if err != nil {
+				if kubeerrors.IsNotFound(err) {
+					continue
+				}
+				return errors.Wrapf(err, "error deleting the dex %s %s", resource.gvr.Resource, item.GetName())
+			}
+			deleted++
+			removedConnectorIDs[connectorID] = true
+		}
+	}
+	if deleted > 0 {
+		ids := []string{}
+		for id := range removedConnectorIDs {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		r.recordEvent(dexServer, corev1.EventTypeNormal, "OrphanedConnectorStorageCleaned",
+			"Deleted %d dex storage objects of the removed connectors %s", deleted, strings.Join(ids, ", "))
+	}
+	return nil
+}
+
+// getNamespaceConnectorIDs returns the ids of the connectors of the DexServers and DexConnectors of a namespace, with
+// the password database connector
+func (r *DexServerReconciler) getNamespaceConnectorIDs(namespace string, ctx context.Context) (map[string]bool, error) {
+	dexServers := &authv1alpha1.DexServerList{}
+	if err := r.List(ctx, dexServers, client.InNamespace(namespace)); err != nil {
+		return nil, errors.Wrap(err, "error listing the DexServers of the namespace")
+	}
+	connectorIDs := map[string]bool{PASSWORD_DB_CONNECTOR_ID: true}
+	for _, dexServer := range dexServers.Items {
+		for _, connector := range dexServer.Spec.Connectors {
+			connectorIDs[connector.Id] = true
+		}
+	}
+	dexConnectors := &authv1alpha1.DexConnectorList{}
+	if err := r.List(ctx, dexConnectors, client.InNamespace(namespace)); err != nil {
+		return nil, errors.Wrap(err, "error listing the DexConnectors of the namespace")
+	}
+	for _, dexConnector := range dexConnectors.Items {
+		connectorIDs[dexConnector.Spec.Id] = true
+	}
+	return connectorIDs, nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	TRACER_NAME = "github.com/identitatem/dex-operator/controllers"
+	// The OTLP endpoint environment variable of the OpenTelemetry SDKs, read by the exporter when no endpoint is given
+	OTEL_EXPORTER_OTLP_ENDPOINT_ENV_NAME = "OTEL_EXPORTER_OTLP_ENDPOINT"
+)
+
+// SetupTracing exports the spans of the reconciles to the OTLP gRPC endpoint, or to the endpoint of the
+// OTEL_EXPORTER_OTLP_ENDPOINT environment variable when endpoint is empty. Tracing stays disabled, and the spans are
+// no-ops, when neither is set. The returned function flushes the pending spans and stops the export.
+func SetupTracing(ctx context.Context, endpoint string, insecure bool) (func(context.Context) error, error) {
+	if endpoint == "" && os.Getenv(OTEL_EXPORTER_OTLP_ENDPOINT_ENV_NAME) == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	opts := []otlptracegrpc.Option{}
+	if endpoint != "" {
+		opts = append(opts, otlptracegrpc.WithEndpoint(endpoint))
+	}
+	if insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String("dex-operator"))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// startSpan starts a span of the reconcile of a DexServer
+func startSpan(ctx context.Context, name string, dexServer types.NamespacedName, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append([]attribute.KeyValue{
+		attribute.String("dexserver.name", dexServer.Name),
+		attribute.String("dexserver.namespace", dexServer.Namespace),
+	}, attrs...)
+	return otel.Tracer(TRACER_NAME).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends a span, with the error of the reconcile or phase. A phase waiting on another component did not fail.
+func endSpan(span trace.Span, err error) {
+	var waitingErr *phaseWaitingError
+	if errors.As(err, &waitingErr) {
+		span.SetAttributes(attribute.String("dexserver.waiting", waitingErr.reason))
+	} else if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+const (
+	// Path of the trusted CA bundle in the dex container. Dex loads the files of the system certificate directory on
+	// top of the system CA bundle, so the bundle adds to the system CAs rather than replacing them.
+	TRUSTED_CA_BUNDLE_MOUNT_PATH = "/etc/ssl/certs/dex-operator-trusted-ca-bundle.crt"
+	// File name of the trusted CA bundle in its volume
+	TRUSTED_CA_BUNDLE_FILE_NAME = "ca-bundle.crt"
+)
+
+// getTrustedCABundleVolumes returns the volume and volume mount of the trusted CA bundle secret. Only the referenced
+// key is mounted, as a single file of the system certificate directory.
+func getTrustedCABundleVolumes(dexServer *authv1alpha1.DexServer) ([]corev1.Volume, []corev1.VolumeMount) {
+	var volumes []corev1.Volume
+	var volumeMounts []corev1.VolumeMount
+	ref := dexServer.Spec.TrustedCABundleRef
+	if ref == nil {
+		return volumes, volumeMounts
+	}
+	volumes = append(volumes, corev1.Volume{
+		Name: "trusted-ca-bundle",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: ref.Name,
+				Items:      []corev1.KeyToPath{{Key: ref.Key, Path: TRUSTED_CA_BUNDLE_FILE_NAME}},
+			},
+		},
+	})
+	volumeMounts = append(volumeMounts, corev1.VolumeMount{
+		Name:      "trusted-ca-bundle",
+		MountPath: TRUSTED_CA_BUNDLE_MOUNT_PATH,
+		SubPath:   TRUSTED_CA_BUNDLE_FILE_NAME,
+		ReadOnly:  true,
+	})
+	return volumes, volumeMounts
+}
+
+// checkTrustedCABundle checks that the trusted CA bundle secret has the referenced key, which would otherwise keep the
+// dex pods from starting, and labels the secret so that its updates are reconciled
+func (r *DexServerReconciler) checkTrustedCABundle(dexServer *authv1alpha1.DexServer, ctx context.Context) error {
+	ref := dexServer.Spec.TrustedCABundleRef
+	if ref == nil {
+		return nil
+	}
+	secret := &corev1.Secret{}
+	if err := r.getSecretWithTimeout(ctx, types.NamespacedName{Name: ref.Name, Namespace: dexServer.Namespace}, secret); err != nil {
+		if kubeerrors.IsNotFound(err) {
+			return &phaseFailedError{reason: "TrustedCABundleSecretNotFound", err: errors.Wrap(err, "trusted CA bundle")}
+		}
+		return err
+	}
+	// Add label to this secret so that the secret can be watched for updates
+	checkAndAddLabelToSecret(secret, r, ctx)
+	if len(secret.Data[ref.Key]) == 0 {
+		return &phaseFailedError{
+			reason: "TrustedCABundleKeyMissing",
+			err:    fmt.Errorf("trusted CA bundle: secret %s/%s has no key %s", dexServer.Namespace, ref.Name, ref.Key),
+		}
+	}
+	return nil
+}
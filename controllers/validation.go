@@ -0,0 +1,607 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// validateDexServerSpec validates the DexServer spec before anything is applied, so that invalid durations and
+// numbers are reported with the offending field instead of failing at apply time. All problems are returned in a
+// single error.
+func validateDexServerSpec(dexServer *authv1alpha1.DexServer) error {
+	allErrs := field.ErrorList{}
+	specPath := field.NewPath("spec")
+
+	allErrs = append(allErrs, validateIssuerPath(specPath.Child("issuer"), dexServer.Spec.Issuer)...)
+	allErrs = append(allErrs, validateAdditionalHosts(specPath.Child("additionalHosts"), dexServer)...)
+
+	allErrs = append(allErrs, validateInt32Range(specPath.Child("sessionAffinityTimeoutSeconds"),
+		dexServer.Spec.SessionAffinityTimeoutSeconds, 1, 86400)...)
+	allErrs = append(allErrs, validateInt32Range(specPath.Child("progressDeadlineSeconds"),
+		dexServer.Spec.ProgressDeadlineSeconds, 1, math.MaxInt32)...)
+	allErrs = append(allErrs, validateInt32Range(specPath.Child("replicas"),
+		dexServer.Spec.Replicas, 1, math.MaxInt32)...)
+	if autoscaling := dexServer.Spec.Autoscaling; autoscaling != nil {
+		allErrs = append(allErrs, validateAutoscaling(specPath, autoscaling, dexServer.Spec.Resources)...)
+	}
+
+	allErrs = append(allErrs, validateIPFamilies(specPath, dexServer.Spec.IPFamilies, dexServer.Spec.IPFamilyPolicy)...)
+
+	if version := dexServer.Spec.DexConfigVersion; version != "" {
+		if _, err := getDexConfigRenderer(version); err != nil {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("dexConfigVersion"), version,
+				"must be a dex v2 version such as v2.30"))
+		}
+	}
+
+	if storage := dexServer.Spec.Storage; storage != nil {
+		allErrs = append(allErrs, validateStorage(specPath.Child("storage"), storage)...)
+	}
+
+	if expiry := dexServer.Spec.Expiry; expiry != nil {
+		allErrs = append(allErrs, validateExpiry(specPath.Child("expiry"), expiry)...)
+	}
+
+	if frontend := dexServer.Spec.Frontend; frontend != nil {
+		allErrs = append(allErrs, validateFrontend(specPath.Child("frontend"), frontend)...)
+	}
+
+	if dexServer.Spec.ManagedResources != nil {
+		allErrs = append(allErrs, validateManagedResources(specPath.Child("managedResources"), dexServer)...)
+	}
+
+	if ref := dexServer.Spec.TrustedCABundleRef; ref != nil {
+		trustedCABundlePath := specPath.Child("trustedCABundleRef")
+		if ref.Name == "" {
+			allErrs = append(allErrs, field.Required(trustedCABundlePath.Child("name"), ""))
+		}
+		if ref.Key == "" {
+			allErrs = append(allErrs, field.Required(trustedCABundlePath.Child("key"), ""))
+		}
+	}
+
+	// The preStop hook counts against the termination grace period, dex would be killed while it sleeps
+	if preStopSleepSeconds := dexServer.Spec.PreStopSleepSeconds; preStopSleepSeconds != nil {
+		terminationGracePeriodSeconds := DEFAULT_TERMINATION_GRACE_PERIOD_SECONDS
+		if dexServer.Spec.TerminationGracePeriodSeconds != nil {
+			terminationGracePeriodSeconds = *dexServer.Spec.TerminationGracePeriodSeconds
+		}
+		if int64(*preStopSleepSeconds) >= terminationGracePeriodSeconds {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("preStopSleepSeconds"), *preStopSleepSeconds,
+				fmt.Sprintf("must be less than the termination grace period of %d seconds", terminationGracePeriodSeconds)))
+		}
+	}
+
+	if webTLS := dexServer.Spec.WebTLS; webTLS != nil {
+		allErrs = append(allErrs, validateWebTLS(specPath.Child("webTLS"), webTLS)...)
+	}
+
+	if probes := dexServer.Spec.Probes; probes != nil {
+		probesPath := specPath.Child("probes")
+		allErrs = append(allErrs, validateNonNegativeInt32(probesPath.Child("initialDelaySeconds"), probes.InitialDelaySeconds)...)
+		allErrs = append(allErrs, validateInt32Range(probesPath.Child("periodSeconds"), probes.PeriodSeconds, 1, math.MaxInt32)...)
+		allErrs = append(allErrs, validateInt32Range(probesPath.Child("timeoutSeconds"), probes.TimeoutSeconds, 1, math.MaxInt32)...)
+	}
+
+	if dexServer.Spec.Resources != nil {
+		allErrs = append(allErrs, validateResourceRequirements(specPath.Child("resources"), dexServer.Spec.Resources)...)
+	}
+	if sizeLimit := dexServer.Spec.EmptyDirSizeLimit; sizeLimit != nil && sizeLimit.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("emptyDirSizeLimit"), sizeLimit.String(), "must be greater than 0"))
+	}
+
+	for i, san := range dexServer.Spec.GRPCCertSANs {
+		if err := validateGRPCCertSANs([]string{san}); err != nil {
+			allErrs = append(allErrs, field.Invalid(specPath.Child("grpcCertSANs").Index(i), san, err.Error()))
+		}
+	}
+
+	switch dexServer.Spec.GRPCCertSource {
+	case authv1alpha1.GRPCCertSourceKubeCSR:
+		if dexServer.Spec.GRPCCertSignerName == "" {
+			allErrs = append(allErrs, field.Required(specPath.Child("grpcCertSignerName"), "required when grpcCertSource is KubeCSR"))
+		}
+	case authv1alpha1.GRPCCertSourceCertManager:
+		if dexServer.Spec.GRPCCertIssuerRef == nil || dexServer.Spec.GRPCCertIssuerRef.Name == "" {
+			allErrs = append(allErrs, field.Required(specPath.Child("grpcCertIssuerRef", "name"), "required when grpcCertSource is CertManager"))
+		}
+	}
+
+	typedConfigKeys := getDexConnectorConfigKeys()
+	for i, connector := range dexServer.Spec.Connectors {
+		connectorPath := specPath.Child("connectors").Index(i)
+		connectorType, found := getCanonicalConnectorType(connector.Type)
+		if !found {
+			allErrs = append(allErrs, field.NotSupported(connectorPath.Child("type"), connector.Type, getSupportedConnectorTypes()))
+			continue
+		}
+		if !isTypedConnector(connectorType, connector) {
+			// Connectors without a config block are configured by rawConfig only
+			if len(connector.RawConfig) == 0 {
+				allErrs = append(allErrs, field.Required(connectorPath.Child("rawConfig"), fmt.Sprintf("required when type is %s", connector.Type)))
+			}
+			allErrs = append(allErrs, validateConnectorRawConfig(connectorPath.Child("rawConfig"), connector.RawConfig, nil)...)
+			continue
+		}
+		allErrs = append(allErrs, validateConnectorRawConfig(connectorPath.Child("rawConfig"),
+			connector.RawConfig, typedConfigKeys)...)
+		allErrs = append(allErrs, validateSecretKey(connectorPath.Child("github", "clientSecretKey"), connector.GitHub.ClientSecretKey)...)
+		if ref := connector.GitHub.RootCARef; ref != nil && ref.Name == "" {
+			allErrs = append(allErrs, field.Required(connectorPath.Child("github", "rootCARef", "name"), ""))
+		}
+		allErrs = append(allErrs, validateSecretKey(connectorPath.Child("microsoft", "clientSecretKey"), connector.Microsoft.ClientSecretKey)...)
+		allErrs = append(allErrs, validateSecretKey(connectorPath.Child("google", "clientSecretKey"), connector.Google.ClientSecretKey)...)
+		allErrs = append(allErrs, validateSecretKey(connectorPath.Child("ldap", "bindPWKey"), connector.LDAP.BindPWKey)...)
+	}
+
+	return allErrs.ToAggregate()
+}
+
+// validateSecretKey checks that an optional secret key is a valid key of the data of a secret
+func validateSecretKey(fldPath *field.Path, key string) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if key == "" {
+		return allErrs
+	}
+	for _, msg := range validation.IsConfigMapKey(key) {
+		allErrs = append(allErrs, field.Invalid(fldPath, key, msg))
+	}
+	return allErrs
+}
+
+// validateResourceRequirements checks that no resource request exceeds its limit, which the API server only
+// reports when the deployment is applied
+func validateResourceRequirements(fldPath *field.Path, resources *corev1.ResourceRequirements) field.ErrorList {
+	allErrs := field.ErrorList{}
+	names := []string{}
+	for name := range resources.Requests {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		request := resources.Requests[corev1.ResourceName(name)]
+		if limit, found := resources.Limits[corev1.ResourceName(name)]; found && request.Cmp(limit) > 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("requests").Key(name), request.String(),
+				fmt.Sprintf("must be less than or equal to the %s limit %s", name, limit.String())))
+		}
+	}
+	return allErrs
+}
+
+// connectorTypes maps the connector types accepted in a DexServer, dex type names and their aliases, to the dex
+// type names
+var connectorTypes = map[authv1alpha1.ConnectorType]authv1alpha1.ConnectorType{
+	authv1alpha1.ConnectorTypeGitHub:         authv1alpha1.ConnectorTypeGitHub,
+	authv1alpha1.ConnectorTypeLDAP:           authv1alpha1.ConnectorTypeLDAP,
+	authv1alpha1.ConnectorTypeMicrosoft:      authv1alpha1.ConnectorTypeMicrosoft,
+	authv1alpha1.ConnectorTypeOIDC:           authv1alpha1.ConnectorTypeOIDC,
+	authv1alpha1.ConnectorTypeOAuth:          authv1alpha1.ConnectorTypeOAuth,
+	authv1alpha1.ConnectorTypeGitLab:         authv1alpha1.ConnectorTypeGitLab,
+	authv1alpha1.ConnectorTypeGoogle:         authv1alpha1.ConnectorTypeGoogle,
+	authv1alpha1.ConnectorTypeSAML:           authv1alpha1.ConnectorTypeSAML,
+	authv1alpha1.ConnectorTypeOpenShift:      authv1alpha1.ConnectorTypeOpenShift,
+	authv1alpha1.ConnectorTypeBitbucketCloud: authv1alpha1.ConnectorTypeBitbucketCloud,
+	authv1alpha1.ConnectorTypeGitea:          authv1alpha1.ConnectorTypeGitea,
+	authv1alpha1.ConnectorTypeKeystone:       authv1alpha1.ConnectorTypeKeystone,
+	authv1alpha1.ConnectorTypeAuthProxy:      authv1alpha1.ConnectorTypeAuthProxy,
+	authv1alpha1.ConnectorTypeAtlassianCrowd: authv1alpha1.ConnectorTypeAtlassianCrowd,
+	authv1alpha1.ConnectorTypeLinkedIn:       authv1alpha1.ConnectorTypeLinkedIn,
+	// Aliases
+	"github-enterprise": authv1alpha1.ConnectorTypeGitHub,
+	"active-directory":  authv1alpha1.ConnectorTypeLDAP,
+	"azure":             authv1alpha1.ConnectorTypeMicrosoft,
+	"azuread":           authv1alpha1.ConnectorTypeMicrosoft,
+	"openid":            authv1alpha1.ConnectorTypeOIDC,
+	"openid-connect":    authv1alpha1.ConnectorTypeOIDC,
+	"bitbucket":         authv1alpha1.ConnectorTypeBitbucketCloud,
+	"crowd":             authv1alpha1.ConnectorTypeAtlassianCrowd,
+}
+
+// getCanonicalConnectorType returns the dex type name of a connector type or alias, ignoring case
+func getCanonicalConnectorType(connectorType authv1alpha1.ConnectorType) (authv1alpha1.ConnectorType, bool) {
+	canonicalType, found := connectorTypes[authv1alpha1.ConnectorType(strings.ToLower(string(connectorType)))]
+	return canonicalType, found
+}
+
+// getSupportedConnectorTypes returns the sorted connector types and aliases accepted in a DexServer
+func getSupportedConnectorTypes() []string {
+	supportedTypes := []string{}
+	for connectorType := range connectorTypes {
+		supportedTypes = append(supportedTypes, string(connectorType))
+	}
+	sort.Strings(supportedTypes)
+	return supportedTypes
+}
+
+// isTypedConnectorType returns true for the connector types configured by a config block of the connector
+func isTypedConnectorType(connectorType authv1alpha1.ConnectorType) bool {
+	switch connectorType {
+	case authv1alpha1.ConnectorTypeGitHub, authv1alpha1.ConnectorTypeLDAP, authv1alpha1.ConnectorTypeMicrosoft,
+		authv1alpha1.ConnectorTypeGoogle:
+		return true
+	}
+	return false
+}
+
+// isTypedConnector returns true for the connectors configured by their config block. connectorType is the canonical
+// type of the connector.
+func isTypedConnector(connectorType authv1alpha1.ConnectorType, connector authv1alpha1.ConnectorSpec) bool {
+	if connectorType == authv1alpha1.ConnectorTypeGoogle {
+		return isGoogleConfigured(connector)
+	}
+	return isTypedConnectorType(connectorType)
+}
+
+// canonicalizeConnectorTypes replaces the connector type aliases of a validated DexServer by the dex type names
+func canonicalizeConnectorTypes(dexServer *authv1alpha1.DexServer) {
+	for i, connector := range dexServer.Spec.Connectors {
+		if connectorType, found := getCanonicalConnectorType(connector.Type); found {
+			dexServer.Spec.Connectors[i].Type = connectorType
+		}
+	}
+}
+
+// validateConnectorRawConfig checks that every raw connector config value parses and does not override a typed key
+func validateConnectorRawConfig(fldPath *field.Path, rawConfig map[string]apiextensionsv1.JSON, typedConfigKeys map[string]bool) field.ErrorList {
+	allErrs := field.ErrorList{}
+	keys := []string{}
+	for key := range rawConfig {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := rawConfig[key]
+		if typedConfigKeys[key] {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Key(key), "is a typed connector config key and cannot be set in rawConfig"))
+			continue
+		}
+		if !json.Valid(value.Raw) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Key(key), string(value.Raw), "must be valid JSON"))
+		}
+	}
+	return allErrs
+}
+
+// getDexConnectorConfigKeys returns the keys of the typed connector config as rendered into the dex config
+func getDexConnectorConfigKeys() map[string]bool {
+	keys := map[string]bool{}
+	configType := reflect.TypeOf(DexConnectorConfigSpec{})
+	for i := 0; i < configType.NumField(); i++ {
+		if name := strings.Split(configType.Field(i).Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}
+
+// validateDuration checks that an optional duration field, such as "24h" or "90m", parses and is positive
+func validateDuration(fldPath *field.Path, value string) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if value == "" {
+		return allErrs
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return append(allErrs, field.Invalid(fldPath, value, `must be a duration such as "90s", "15m" or "24h"`))
+	}
+	if duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath, value, "must be greater than zero"))
+	}
+	return allErrs
+}
+
+// validateStorage checks that the Postgres storage has its connection parameters
+func validateStorage(fldPath *field.Path, storage *authv1alpha1.StorageSpec) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if storage.Type != authv1alpha1.StorageTypePostgres {
+		return allErrs
+	}
+	postgres := storage.Postgres
+	postgresPath := fldPath.Child("postgres")
+	if postgres == nil {
+		return append(allErrs, field.Required(postgresPath, "required when type is postgres"))
+	}
+	if postgres.Host == "" {
+		allErrs = append(allErrs, field.Required(postgresPath.Child("host"), ""))
+	}
+	if postgres.Database == "" {
+		allErrs = append(allErrs, field.Required(postgresPath.Child("database"), ""))
+	}
+	if postgres.User == "" {
+		allErrs = append(allErrs, field.Required(postgresPath.Child("user"), ""))
+	}
+	if postgres.PasswordRef.Name == "" {
+		allErrs = append(allErrs, field.Required(postgresPath.Child("passwordRef", "name"), ""))
+	}
+	allErrs = append(allErrs, validateInt32Range(postgresPath.Child("port"), postgres.Port, 1, 65535)...)
+	allErrs = append(allErrs, validateSecretKey(postgresPath.Child("passwordKey"), postgres.PasswordKey)...)
+	return allErrs
+}
+
+// validateAutoscaling checks the replica bounds of the HorizontalPodAutoscaler, and that the dex container has the
+// CPU request its utilization is computed from. The autoscaler does not scale without it.
+func validateAutoscaling(specPath *field.Path, autoscaling *authv1alpha1.AutoscalingSpec, resources *corev1.ResourceRequirements) field.ErrorList {
+	allErrs := field.ErrorList{}
+	autoscalingPath := specPath.Child("autoscaling")
+	allErrs = append(allErrs, validateInt32Range(autoscalingPath.Child("minReplicas"), autoscaling.MinReplicas, 1, math.MaxInt32)...)
+	allErrs = append(allErrs, validateInt32Range(autoscalingPath.Child("targetCPUUtilizationPercentage"),
+		autoscaling.TargetCPUUtilizationPercentage, 1, math.MaxInt32)...)
+	minReplicas := DEFAULT_AUTOSCALING_MIN_REPLICAS
+	if autoscaling.MinReplicas != nil {
+		minReplicas = *autoscaling.MinReplicas
+	}
+	if autoscaling.MaxReplicas < minReplicas {
+		allErrs = append(allErrs, field.Invalid(autoscalingPath.Child("maxReplicas"), autoscaling.MaxReplicas,
+			fmt.Sprintf("must be greater than or equal to minReplicas %d", minReplicas)))
+	}
+	if resources == nil || resources.Requests.Cpu().IsZero() {
+		allErrs = append(allErrs, field.Required(specPath.Child("resources", "requests", "cpu"), "required when autoscaling is set"))
+	}
+	return allErrs
+}
+
+// validateFrontend checks that the theme is a directory name, and is set when the assets of a custom theme are mounted
+func validateFrontend(fldPath *field.Path, frontend *authv1alpha1.FrontendSpec) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if frontend.Theme != "" {
+		for _, msg := range validation.IsConfigMapKey(frontend.Theme) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("theme"), frontend.Theme, msg))
+		}
+	}
+	if frontend.ThemeConfigMapRef != nil {
+		if frontend.ThemeConfigMapRef.Name == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("themeConfigMapRef", "name"), ""))
+		}
+		if frontend.Theme == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("theme"), "required when themeConfigMapRef is set"))
+		}
+	}
+	if frontend.Dir != "" && !path.IsAbs(frontend.Dir) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("dir"), frontend.Dir, "must be an absolute path"))
+	}
+	return allErrs
+}
+
+// validateManagedResources checks that the resources are supported, and that the ConfigMap mounted by the Deployment
+// is synced with it
+func validateManagedResources(fldPath *field.Path, dexServer *authv1alpha1.DexServer) field.ErrorList {
+	allErrs := field.ErrorList{}
+	supported := []string{}
+	for _, resource := range supportedManagedResources {
+		supported = append(supported, string(resource))
+	}
+	managedResources := dexServer.Spec.ManagedResources
+	validateResources := func(resourcesPath *field.Path, resources []authv1alpha1.ManagedResource) {
+		for i, resource := range resources {
+			if !containsManagedResource(supportedManagedResources, resource) {
+				allErrs = append(allErrs, field.NotSupported(resourcesPath.Index(i), resource, supported))
+			}
+		}
+	}
+	validateResources(fldPath.Child("include"), managedResources.Include)
+	validateResources(fldPath.Child("exclude"), managedResources.Exclude)
+	if isResourceManaged(dexServer, authv1alpha1.ManagedResourceDeployment) && !isResourceManaged(dexServer, authv1alpha1.ManagedResourceConfigMap) {
+		allErrs = append(allErrs, field.Invalid(fldPath, managedResources,
+			"the Deployment mounts the dex ConfigMap, the ConfigMap must be synced when the Deployment is"))
+	}
+	return allErrs
+}
+
+// validateWebTLS checks that the serving certificate and CA secrets are valid secret names, and are not set when TLS
+// is disabled
+func validateWebTLS(fldPath *field.Path, webTLS *authv1alpha1.WebTLSSpec) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for _, secret := range []struct {
+		name  string
+		value string
+	}{{"secretName", webTLS.SecretName}, {"caSecretName", webTLS.CASecretName}} {
+		if secret.value == "" {
+			continue
+		}
+		for _, msg := range validation.IsDNS1123Subdomain(secret.value) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(secret.name), secret.value, msg))
+		}
+		if webTLS.Disabled {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(secret.name), secret.value, "must not be set when disabled is true"))
+		}
+	}
+	return allErrs
+}
+
+// validateExpiry checks that the token and key lifetimes parse as durations
+func validateExpiry(fldPath *field.Path, expiry *authv1alpha1.ExpirySpec) field.ErrorList {
+	allErrs := field.ErrorList{}
+	allErrs = append(allErrs, validateDuration(fldPath.Child("idTokens"), expiry.IDTokens)...)
+	allErrs = append(allErrs, validateDuration(fldPath.Child("signingKeys"), expiry.SigningKeys)...)
+	allErrs = append(allErrs, validateDuration(fldPath.Child("deviceRequests"), expiry.DeviceRequests)...)
+	if refreshTokens := expiry.RefreshTokens; refreshTokens != nil {
+		refreshTokensPath := fldPath.Child("refreshTokens")
+		allErrs = append(allErrs, validateDuration(refreshTokensPath.Child("reuseInterval"), refreshTokens.ReuseInterval)...)
+		allErrs = append(allErrs, validateDuration(refreshTokensPath.Child("validIfNotUsedFor"), refreshTokens.ValidIfNotUsedFor)...)
+		allErrs = append(allErrs, validateDuration(refreshTokensPath.Child("absoluteLifetime"), refreshTokens.AbsoluteLifetime)...)
+	}
+	return allErrs
+}
+
+// validateInt32Range checks that an optional numeric field is within [min, max]
+func validateInt32Range(fldPath *field.Path, value *int32, min int32, max int32) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if value == nil {
+		return allErrs
+	}
+	if *value < min || *value > max {
+		allErrs = append(allErrs, field.Invalid(fldPath, *value, fmt.Sprintf("must be between %d and %d", min, max)))
+	}
+	return allErrs
+}
+
+// validateIPFamilies checks that the IP families of the dex Services are distinct, supported and allowed by the IP
+// family policy. The API server rejects changes of the primary family of an existing Service.
+func validateIPFamilies(specPath *field.Path, ipFamilies []corev1.IPFamily, ipFamilyPolicy *corev1.IPFamilyPolicyType) field.ErrorList {
+	allErrs := field.ErrorList{}
+	ipFamiliesPath := specPath.Child("ipFamilies")
+	seen := map[corev1.IPFamily]bool{}
+	for i, ipFamily := range ipFamilies {
+		if ipFamily != corev1.IPv4Protocol && ipFamily != corev1.IPv6Protocol {
+			allErrs = append(allErrs, field.NotSupported(ipFamiliesPath.Index(i), ipFamily,
+				[]string{string(corev1.IPv4Protocol), string(corev1.IPv6Protocol)}))
+		} else if seen[ipFamily] {
+			allErrs = append(allErrs, field.Duplicate(ipFamiliesPath.Index(i), ipFamily))
+		}
+		seen[ipFamily] = true
+	}
+	if len(ipFamilies) > 2 {
+		allErrs = append(allErrs, field.TooMany(ipFamiliesPath, len(ipFamilies), 2))
+	}
+	if ipFamilyPolicy != nil && *ipFamilyPolicy == corev1.IPFamilyPolicySingleStack && len(ipFamilies) > 1 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("ipFamilyPolicy"), *ipFamilyPolicy,
+			"SingleStack allows a single IP family"))
+	}
+	return allErrs
+}
+
+// validateNonNegativeInt32 checks that an optional numeric field is zero or greater
+func validateNonNegativeInt32(fldPath *field.Path, value *int32) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if value != nil && *value < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath, *value, "must be greater than or equal to 0"))
+	}
+	return allErrs
+}
+
+// validateConnectorConfigBlock checks that the config block of a connector matches its type: the block of the type
+// is set and no block of another type is. A block of another type is otherwise silently ignored.
+func validateConnectorConfigBlock(fldPath *field.Path, connector authv1alpha1.ConnectorSpec) field.ErrorList {
+	allErrs := field.ErrorList{}
+	blocks := []struct {
+		connectorType authv1alpha1.ConnectorType
+		name          string
+		populated     bool
+	}{
+		{authv1alpha1.ConnectorTypeGitHub, "github", !reflect.ValueOf(connector.GitHub).IsZero()},
+		{authv1alpha1.ConnectorTypeLDAP, "ldap", !reflect.ValueOf(connector.LDAP).IsZero()},
+		{authv1alpha1.ConnectorTypeMicrosoft, "microsoft", !reflect.ValueOf(connector.Microsoft).IsZero()},
+		{authv1alpha1.ConnectorTypeGoogle, "google", isGoogleConfigured(connector)},
+	}
+	for _, block := range blocks {
+		switch {
+		// A google connector may be configured by rawConfig only
+		case block.connectorType == connector.Type && !block.populated && block.connectorType != authv1alpha1.ConnectorTypeGoogle:
+			allErrs = append(allErrs, field.Required(fldPath.Child(block.name), fmt.Sprintf("required when type is %s", connector.Type)))
+		case block.connectorType != connector.Type && block.populated:
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child(block.name), fmt.Sprintf("cannot be set when type is %s", connector.Type)))
+		}
+	}
+	return allErrs
+}
+
+// bcryptHashPattern matches a bcrypt hash: version 2a, 2b or 2y, a two digit cost and 53 characters of salt and hash
+var bcryptHashPattern = regexp.MustCompile(`^\$2[aby]\$(0[4-9]|[12][0-9]|3[01])\$[./A-Za-z0-9]{53}$`)
+
+// validateBcryptHash checks that a static password hash is a well-formed bcrypt hash. The hash is a secret, so it is
+// never included in the returned error.
+func validateBcryptHash(fldPath *field.Path, hash string) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if !bcryptHashPattern.MatchString(hash) {
+		allErrs = append(allErrs, field.Invalid(fldPath, "<redacted>",
+			`must be a bcrypt hash starting with "$2a$", "$2b$" or "$2y$" followed by a cost between 04 and 31, 60 characters long`))
+	}
+	return allErrs
+}
+
+// microsoftTenantIDPattern matches a Microsoft tenant id, a GUID such as 9b1c3f6e-2a4d-4c8b-9e0f-1a2b3c4d5e6f
+var microsoftTenantIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}(-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12}$`)
+
+// validateMicrosoftTenant checks that an optional Microsoft tenant is one of common, consumers or organizations, a
+// tenant id or a tenant domain such as contoso.onmicrosoft.com. Other values fail at login time only.
+func validateMicrosoftTenant(fldPath *field.Path, tenant string) field.ErrorList {
+	allErrs := field.ErrorList{}
+	switch {
+	case tenant == "", tenant == "common", tenant == "consumers", tenant == "organizations":
+	case microsoftTenantIDPattern.MatchString(tenant):
+	case strings.Contains(tenant, ".") && len(validation.IsDNS1123Subdomain(strings.ToLower(tenant))) == 0:
+	default:
+		allErrs = append(allErrs, field.Invalid(fldPath, tenant,
+			`must be "common", "consumers", "organizations", a tenant id (GUID) or a tenant domain name`))
+	}
+	return allErrs
+}
+
+// issuerPathSegmentPattern matches a segment of the path of a path-based issuer
+var issuerPathSegmentPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]+$`)
+
+// validateIssuerPath checks that the path of a path-based issuer is a plain base path, which is also routed to dex by
+// the Ingress: no query or fragment, no empty, "." or ".." segments, and no characters that need escaping.
+func validateIssuerPath(fldPath *field.Path, issuer string) field.ErrorList {
+	allErrs := field.ErrorList{}
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return allErrs
+	}
+	if u.RawQuery != "" || u.Fragment != "" || u.ForceQuery {
+		allErrs = append(allErrs, field.Invalid(fldPath, issuer, "must not have a query or a fragment"))
+	}
+	path := getIssuerPath(issuer)
+	if path == "" {
+		return allErrs
+	}
+	for _, segment := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		if segment == "." || segment == ".." || !issuerPathSegmentPattern.MatchString(segment) {
+			allErrs = append(allErrs, field.Invalid(fldPath, issuer,
+				`the path must be a base path such as "/auth", of non-empty segments of letters, digits, ".", "_", "~" or "-"`))
+			break
+		}
+	}
+	return allErrs
+}
+
+// validateAdditionalHosts checks that the additional hosts are DNS names, as required by the Ingress and Route
+// hosts, distinct from each other and from the host of the issuer
+func validateAdditionalHosts(fldPath *field.Path, dexServer *authv1alpha1.DexServer) field.ErrorList {
+	allErrs := field.ErrorList{}
+	seen := map[string]bool{}
+	if u, err := url.Parse(dexServer.Spec.Issuer); err == nil {
+		seen[u.Host] = true
+	}
+	for i, host := range dexServer.Spec.AdditionalHosts {
+		for _, msg := range validation.IsDNS1123Subdomain(host) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), host, msg))
+		}
+		if seen[host] {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Index(i), host))
+		}
+		seen[host] = true
+	}
+	return allErrs
+}
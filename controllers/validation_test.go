@@ -0,0 +1,135 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+var _ = Describe("DexServer spec validation", func() {
+	fldPath := field.NewPath("spec", "field")
+	int32Ptr := func(i int32) *int32 { return &i }
+
+	It("accepts unset and valid values", func() {
+		Expect(validateDexServerSpec(newTestDexServer())).To(Succeed())
+		Expect(validateDuration(fldPath, "")).To(BeEmpty())
+		Expect(validateDuration(fldPath, "24h")).To(BeEmpty())
+		Expect(validateDuration(fldPath, "1h30m")).To(BeEmpty())
+		Expect(validateInt32Range(fldPath, nil, 1, 10)).To(BeEmpty())
+		Expect(validateInt32Range(fldPath, int32Ptr(10), 1, 10)).To(BeEmpty())
+		Expect(validateNonNegativeInt32(fldPath, int32Ptr(0))).To(BeEmpty())
+	})
+
+	It("rejects invalid durations", func() {
+		errs := validateDuration(fldPath, "24 hours")
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Error()).To(ContainSubstring("spec.field"))
+		Expect(errs[0].Error()).To(ContainSubstring(`must be a duration such as`))
+
+		Expect(validateDuration(fldPath, "0s")).To(HaveLen(1))
+		Expect(validateDuration(fldPath, "-5m")[0].Error()).To(ContainSubstring("must be greater than zero"))
+	})
+
+	It("rejects negative and out of range numbers", func() {
+		errs := validateNonNegativeInt32(fldPath, int32Ptr(-1))
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Error()).To(ContainSubstring("must be greater than or equal to 0"))
+
+		Expect(validateInt32Range(fldPath, int32Ptr(0), 1, 10)[0].Error()).To(ContainSubstring("must be between 1 and 10"))
+		Expect(validateInt32Range(fldPath, int32Ptr(11), 1, 10)).To(HaveLen(1))
+	})
+
+	It("aggregates the errors of all fields", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.SessionAffinityTimeoutSeconds = int32Ptr(100000)
+		dexServer.Spec.GRPCCertSANs = []string{"bad san", "10.0.0.1", "also bad"}
+
+		err := validateDexServerSpec(dexServer)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("spec.sessionAffinityTimeoutSeconds"))
+		Expect(err.Error()).To(ContainSubstring("spec.grpcCertSANs[0]"))
+		Expect(err.Error()).To(ContainSubstring("spec.grpcCertSANs[2]"))
+		Expect(err.Error()).NotTo(ContainSubstring("spec.grpcCertSANs[1]"))
+	})
+
+	It("rejects raw connector config overriding typed keys or not parsing", func() {
+		dexServer := newTestDexServer()
+		connector := newTestGitHubConnector("github", "github-secret")
+		connector.RawConfig = map[string]apiextensionsv1.JSON{
+			"clientID":             {Raw: []byte(`"other-client"`)},
+			"preferredEmailDomain": {Raw: []byte(`{not json`)},
+			"scopes":               {Raw: []byte(`["read:org"]`)},
+		}
+		dexServer.Spec.Connectors = []authv1alpha1.ConnectorSpec{connector}
+
+		err := validateDexServerSpec(dexServer)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("spec.connectors[0].rawConfig[clientID]: Forbidden"))
+		Expect(err.Error()).To(ContainSubstring("spec.connectors[0].rawConfig[preferredEmailDomain]: Invalid value"))
+		Expect(err.Error()).NotTo(ContainSubstring("scopes"))
+	})
+
+	It("requires the signer or issuer of the gRPC certificate source", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.GRPCCertSource = authv1alpha1.GRPCCertSourceKubeCSR
+		Expect(validateDexServerSpec(dexServer).Error()).To(ContainSubstring("spec.grpcCertSignerName: Required value"))
+		dexServer.Spec.GRPCCertSignerName = "example.com/grpc"
+		Expect(validateDexServerSpec(dexServer)).To(Succeed())
+
+		dexServer.Spec.GRPCCertSource = authv1alpha1.GRPCCertSourceCertManager
+		Expect(validateDexServerSpec(dexServer).Error()).To(ContainSubstring("spec.grpcCertIssuerRef.name: Required value"))
+		dexServer.Spec.GRPCCertIssuerRef = &authv1alpha1.CertManagerIssuerReference{Name: "grpc-issuer"}
+		Expect(validateDexServerSpec(dexServer)).To(Succeed())
+	})
+
+	It("validates bcrypt hashes without disclosing them", func() {
+		// bcrypt hash of "password"
+		hash := "$2a$10$2b2cU8CPhOTaGrs1HRQuAueS7JTT5ZHsHSzYiFPm1leZck7Mc8T4W"
+		Expect(validateBcryptHash(fldPath, hash)).To(BeEmpty())
+		Expect(validateBcryptHash(fldPath, "$2y$12$"+hash[7:])).To(BeEmpty())
+
+		for _, invalid := range []string{"", "password", "$1$10$" + hash[7:], "$2a$03$" + hash[7:], hash[:59], hash + "x"} {
+			errs := validateBcryptHash(fldPath, invalid)
+			Expect(errs).To(HaveLen(1), invalid)
+			if invalid != "" {
+				Expect(errs[0].Error()).NotTo(ContainSubstring(invalid))
+			}
+		}
+	})
+
+	It("rejects invalid IP families and policies", func() {
+		dexServer := newTestDexServer()
+		dexServer.Spec.IPFamilies = []corev1.IPFamily{corev1.IPv6Protocol, corev1.IPv4Protocol}
+		Expect(validateDexServerSpec(dexServer)).To(Succeed())
+		singleStack := corev1.IPFamilyPolicySingleStack
+		dexServer.Spec.IPFamilyPolicy = &singleStack
+		Expect(validateDexServerSpec(dexServer).Error()).To(ContainSubstring("spec.ipFamilyPolicy: Invalid value"))
+
+		dexServer.Spec.IPFamilyPolicy = nil
+		dexServer.Spec.IPFamilies = []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv4Protocol, "IPv5"}
+		err := validateDexServerSpec(dexServer)
+		Expect(err.Error()).To(ContainSubstring("spec.ipFamilies[1]: Duplicate value"))
+		Expect(err.Error()).To(ContainSubstring("spec.ipFamilies[2]: Unsupported value"))
+		Expect(err.Error()).To(ContainSubstring("spec.ipFamilies: Too many"))
+	})
+})
@@ -0,0 +1,82 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	authv1alpha1 "github.com/identitatem/dex-operator/api/v1alpha1"
+)
+
+// The key of the CA certificate in the web TLS CA secret
+const WEB_TLS_CA_KEY = "ca.crt"
+
+// isWebTLSDisabled returns true when dex serves plain HTTP
+func isWebTLSDisabled(dexServer *authv1alpha1.DexServer) bool {
+	return dexServer.Spec.WebTLS != nil && dexServer.Spec.WebTLS.Disabled
+}
+
+// isServingCertGenerated returns true when the serving certificate of dex is generated by the OpenShift service CA
+// through the annotation of the Service, the default when no secret is set
+func isServingCertGenerated(dexServer *authv1alpha1.DexServer) bool {
+	return dexServer.Spec.WebTLS == nil || (dexServer.Spec.WebTLS.SecretName == "" && !dexServer.Spec.WebTLS.Disabled)
+}
+
+// getWebTLSSecretName returns the name of the secret of the serving certificate of dex, or "" when dex serves plain
+// HTTP
+func getWebTLSSecretName(dexServer *authv1alpha1.DexServer) string {
+	if isWebTLSDisabled(dexServer) {
+		return ""
+	}
+	if dexServer.Spec.WebTLS != nil && dexServer.Spec.WebTLS.SecretName != "" {
+		return dexServer.Spec.WebTLS.SecretName
+	}
+	return dexServer.Name + SECRET_WEB_TLS_SUFFIX
+}
+
+// getWebTLSCASecretName returns the name of the secret of the CA that signed the serving certificate of dex, or ""
+// when the router trusts the service CA or dex serves plain HTTP
+func getWebTLSCASecretName(dexServer *authv1alpha1.DexServer) string {
+	if dexServer.Spec.WebTLS == nil || dexServer.Spec.WebTLS.Disabled {
+		return ""
+	}
+	return dexServer.Spec.WebTLS.CASecretName
+}
+
+// getWebTLSCA returns the PEM CA that signed the serving certificate of dex, or "" when no CA secret is set. The
+// secret is labeled so that its rotations are reconciled.
+func (r *DexServerReconciler) getWebTLSCA(dexServer *authv1alpha1.DexServer, ctx context.Context) (string, error) {
+	name := getWebTLSCASecretName(dexServer)
+	if name == "" {
+		return "", nil
+	}
+	secret := &corev1.Secret{}
+	if err := r.getSecretWithTimeout(ctx, types.NamespacedName{Name: name, Namespace: dexServer.Namespace}, secret); err != nil {
+		return "", errors.Wrapf(err, "error getting the web TLS CA secret %s", name)
+	}
+	checkAndAddLabelToSecret(secret, r, ctx)
+	ca := strings.TrimSpace(string(secret.Data[WEB_TLS_CA_KEY]))
+	if ca == "" {
+		return "", errors.Errorf("the web TLS CA secret %s has no %s", name, WEB_TLS_CA_KEY)
+	}
+	return ca, nil
+}
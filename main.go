@@ -17,8 +17,11 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -27,6 +30,7 @@ import (
 	dexconfig "github.com/identitatem/dex-operator/config"
 	routev1 "github.com/openshift/api/route/v1"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/dynamic"
@@ -55,15 +59,102 @@ func init() {
 	//+kubebuilder:scaffold:scheme
 }
 
+// Default name of the leader election lease of the operator. It must not change between releases, so that the
+// replicas of two releases never lead at the same time during an upgrade.
+const defaultLeaderElectionID = "09c5986b.identitatem.io"
+
+// The leader election lease may live in another namespace than the operator with --leader-election-namespace, where
+// the leader-election-role of the operator namespace does not apply
+//+kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update;patch;delete
+
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var leaderElectionNamespace string
+	var leaderElectionID string
 	var probeAddr string
+	var checkIssuerReachability bool
+	var allowHTTPIssuer bool
+	var ownerReferenceMode string
+	var allowedSecretNamespaces string
+	var maxConcurrentReconciles int
+	var recreateDeploymentOnImmutableChange bool
+	var maxReconcileBackoff time.Duration
+	var maxReconcileRetries int
+	var staleReplicaSetMaxAge time.Duration
+	var secretFetchTimeout time.Duration
+	var servingCertTimeout time.Duration
+	var restartAnnotationKey string
+	var rejectDanglingTrustedPeers bool
+	var grpcUserAgent string
+	var labelSelector string
+	var tracingEndpoint string
+	var tracingInsecure bool
+	var cleanupOrphanedConnectorStorage bool
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
-			"Enabling this will ensure there is only one active controller manager.")
+			"Enabling this will ensure there is only one active controller manager. "+
+			"Required when the operator runs more than one replica.")
+	flag.StringVar(&leaderElectionNamespace, "leader-election-namespace", "",
+		"Namespace of the leader election lease. When empty, the namespace of the operator, "+
+			"which is required when the operator runs outside of the cluster.")
+	flag.StringVar(&leaderElectionID, "leader-election-id", defaultLeaderElectionID,
+		"Name of the leader election lease. Give each shard of DexServers, set with --label-selector, its own lease "+
+			"so that the shards lead independently.")
+	flag.BoolVar(&checkIssuerReachability, "check-issuer-reachability", false,
+		"Check that the issuer discovery endpoint of each DexServer is reachable from within the cluster "+
+			"and report the result on the Available condition.")
+	flag.BoolVar(&allowHTTPIssuer, "allow-http-issuer", false,
+		"Allow DexServers with an http issuer, for local and development setups. "+
+			"By default only https issuers are applied, as OIDC requires.")
+	flag.StringVar(&ownerReferenceMode, "owner-reference-mode", controllers.OWNER_REFERENCE_MODE_CONTROLLER,
+		"How generated resources reference their DexServer: controller, owner or none. "+
+			"Use owner or none to let GitOps tools such as Argo CD or Flux track the ownership of generated resources.")
+	flag.StringVar(&allowedSecretNamespaces, "allowed-secret-namespaces", "",
+		"Comma separated list of namespaces, other than its own, from which a DexServer may read connector secrets. "+
+			"When empty, connector secrets may be read from any namespace.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"Maximum number of DexServers reconciled concurrently.")
+	flag.BoolVar(&recreateDeploymentOnImmutableChange, "recreate-deployment-on-immutable-change", false,
+		"Delete and recreate the dex deployment when an immutable field, such as the selector, changes. "+
+			"Dex is unavailable until the new pods are ready.")
+	flag.DurationVar(&maxReconcileBackoff, "max-reconcile-backoff", controllers.DEFAULT_MAX_RECONCILE_BACKOFF,
+		"Cap of the exponential backoff between the reconciles of a failing DexServer.")
+	flag.IntVar(&maxReconcileRetries, "max-reconcile-retries", 0,
+		"Number of consecutive failed reconciles after which a DexServer is no longer retried until it changes. "+
+			"0 retries indefinitely.")
+	flag.DurationVar(&staleReplicaSetMaxAge, "stale-replicaset-max-age", 0,
+		"Age after which the ReplicaSets of previous revisions of the dex deployments that are scaled down to zero "+
+			"are deleted. 0 keeps them, up to the revision history limit of the deployments.")
+	flag.DurationVar(&secretFetchTimeout, "secret-fetch-timeout", controllers.DEFAULT_SECRET_FETCH_TIMEOUT,
+		"Timeout of each read of a secret referenced by a DexServer, such as a connector credential. "+
+			"A timed out read fails the reconcile with the SecretFetchTimeout reason and is retried.")
+	flag.DurationVar(&servingCertTimeout, "serving-cert-timeout", controllers.DEFAULT_SERVING_CERT_TIMEOUT,
+		"The time the serving certificate secret generated by the OpenShift service CA may take to appear before the "+
+			"DexServer is reported Degraded with the ServingCertMissing reason.")
+	flag.StringVar(&restartAnnotationKey, "restart-annotation-key", controllers.DEFAULT_RESTART_ANNOTATION_KEY,
+		"Pod template annotation with which the rolling restarts of the dex deployments are triggered, "+
+			"for example by a GitOps tool. The deployment updates of a restart are not reconciled.")
+	flag.BoolVar(&rejectDanglingTrustedPeers, "reject-dangling-trusted-peers", false,
+		"Do not apply a DexClient to dex while one of its trusted peers is not the client ID of a DexClient in its "+
+			"namespace. Dangling trusted peers are always reported on the TrustedPeersResolved condition.")
+	flag.StringVar(&labelSelector, "label-selector", "",
+		"Label selector of the DexServers reconciled by this operator instance, for example tenant-class=gold. "+
+			"The DexClients and DexConnectors of the other DexServers are not reconciled either. "+
+			"Use disjoint selectors to shard the DexServers between several instances. When empty, all DexServers are reconciled.")
+	flag.StringVar(&tracingEndpoint, "tracing-otlp-endpoint", "",
+		"host:port of the OTLP gRPC endpoint the OpenTelemetry traces of the reconciles are exported to. "+
+			"When empty, the "+controllers.OTEL_EXPORTER_OTLP_ENDPOINT_ENV_NAME+" environment variable is used, "+
+			"and tracing is disabled when it is not set either.")
+	flag.BoolVar(&tracingInsecure, "tracing-insecure", false,
+		"Export the traces to the OTLP endpoint without TLS.")
+	flag.BoolVar(&cleanupOrphanedConnectorStorage, "cleanup-orphaned-connector-storage", false,
+		"Delete the OfflineSessions and RefreshTokens dex stored with the kubernetes storage for a removed connector. "+
+			"This invalidates the sessions of the users of the connector.")
+	flag.StringVar(&grpcUserAgent, "grpc-user-agent", controllers.DEFAULT_GRPC_USER_AGENT,
+		"The user-agent of the gRPC calls to dex, identifying the operator in the dex logs.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -72,13 +163,30 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if err := controllers.ValidateOwnerReferenceMode(ownerReferenceMode); err != nil {
+		setupLog.Error(err, "invalid flag", "flag", "owner-reference-mode")
+		os.Exit(1)
+	}
+	dexServerSelector, err := labels.Parse(labelSelector)
+	if err != nil {
+		setupLog.Error(err, "invalid flag", "flag", "label-selector")
+		os.Exit(1)
+	}
+
+	shutdownTracing, err := controllers.SetupTracing(context.Background(), tracingEndpoint, tracingInsecure)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
-		MetricsBindAddress:     metricsAddr,
-		Port:                   9443,
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "09c5986b.identitatem.io",
+		Scheme:                  scheme,
+		MetricsBindAddress:      metricsAddr,
+		Port:                    9443,
+		HealthProbeBindAddress:  probeAddr,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionID:        leaderElectionID,
+		LeaderElectionNamespace: leaderElectionNamespace,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -96,6 +204,7 @@ func main() {
 	readerConfig := dexconfig.GetScenarioResourcesReader()
 
 	files := []string{"crd/bases/auth.identitatem.io_dexclients.yaml",
+		"crd/bases/auth.identitatem.io_dexconnectors.yaml",
 		"crd/bases/auth.identitatem.io_dexservers.yaml"}
 
 	_, err = applier.ApplyDirectly(readerConfig, nil, false, "", files...)
@@ -105,24 +214,61 @@ func main() {
 	}
 
 	if err = (&controllers.DexServerReconciler{
-		Client:             mgr.GetClient(),
-		KubeClient:         kubernetes.NewForConfigOrDie(ctrl.GetConfigOrDie()),
-		DynamicClient:      dynamic.NewForConfigOrDie(ctrl.GetConfigOrDie()),
-		APIExtensionClient: apiextensionsclient.NewForConfigOrDie(ctrl.GetConfigOrDie()),
-		Scheme:             mgr.GetScheme(),
+		Client:                              mgr.GetClient(),
+		KubeClient:                          kubernetes.NewForConfigOrDie(ctrl.GetConfigOrDie()),
+		DynamicClient:                       dynamic.NewForConfigOrDie(ctrl.GetConfigOrDie()),
+		APIExtensionClient:                  apiextensionsclient.NewForConfigOrDie(ctrl.GetConfigOrDie()),
+		Scheme:                              mgr.GetScheme(),
+		CheckIssuerReachability:             checkIssuerReachability,
+		AllowHTTPIssuer:                     allowHTTPIssuer,
+		OwnerReferenceMode:                  ownerReferenceMode,
+		AllowedSecretNamespaces:             splitFlagList(allowedSecretNamespaces),
+		MaxConcurrentReconciles:             maxConcurrentReconciles,
+		RecreateDeploymentOnImmutableChange: recreateDeploymentOnImmutableChange,
+		MaxReconcileBackoff:                 maxReconcileBackoff,
+		MaxReconcileRetries:                 maxReconcileRetries,
+		StaleReplicaSetMaxAge:               staleReplicaSetMaxAge,
+		SecretFetchTimeout:                  secretFetchTimeout,
+		ServingCertTimeout:                  servingCertTimeout,
+		RestartAnnotationKey:                restartAnnotationKey,
+		LabelSelector:                       dexServerSelector,
+		CleanupOrphanedConnectorStorage:     cleanupOrphanedConnectorStorage,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "DexServer")
 		os.Exit(1)
 	}
 	if err = (&controllers.DexClientReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                     mgr.GetClient(),
+		Scheme:                     mgr.GetScheme(),
+		RejectDanglingTrustedPeers: rejectDanglingTrustedPeers,
+		GRPCUserAgent:              grpcUserAgent,
+		LabelSelector:              dexServerSelector,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "DexClient")
 		os.Exit(1)
 	}
+	if err = (&controllers.DexConnectorReconciler{
+		Client:        mgr.GetClient(),
+		Scheme:        mgr.GetScheme(),
+		LabelSelector: dexServerSelector,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "DexConnector")
+		os.Exit(1)
+	}
+	// The webhooks need a serving certificate, they are only served when deployed with one
+	if os.Getenv("ENABLE_WEBHOOKS") == "true" {
+		if err = (&controllers.DexServerValidator{AllowHTTPIssuer: allowHTTPIssuer}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "DexServer")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
+	if err := mgr.AddMetricsExtraHandler(controllers.DEX_SERVER_STATUS_PATH, controllers.NewDexServerStatusHandler(mgr.GetClient())); err != nil {
+		setupLog.Error(err, "unable to set up the DexServer status endpoint")
+		os.Exit(1)
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -137,4 +283,20 @@ func main() {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		setupLog.Error(err, "unable to flush the traces")
+	}
+}
+
+// splitFlagList returns the non-empty items of a comma separated flag value
+func splitFlagList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }